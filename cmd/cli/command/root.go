@@ -27,6 +27,7 @@ func NewRootCommand() *cobra.Command {
 // NewShootOneCommand 创建 shootOne 子命令
 func NewShootOneCommand() *cobra.Command {
 	var oriFrame string // 定义输入参数
+	var pipelineName string
 
 	cmd := &cobra.Command{
 		Use:   "shootone",
@@ -41,14 +42,15 @@ func NewShootOneCommand() *cobra.Command {
 			// 1. 初始化common yaml
 			config, err := pkg.InitCommon("yaml")
 			if err != nil {
-				fmt.Printf("[main] 加载配置失败: %s", err)
+				return fmt.Errorf("加载配置失败: %w", err)
 			}
 
 			// 2. 初始化log
 			log := zap.NewNop()
 
 			// 3. 创建上下文
-			ctx, _ := context.WithCancel(context.Background())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
 			errChan := make(chan error, 10) // 创建一个只写的全局错误通道, 缓存大小为10
 			ctx = pkg.WithErrChan(ctx, errChan)
 			// 将config挂载到ctx上
@@ -57,7 +59,7 @@ func NewShootOneCommand() *cobra.Command {
 			ctxWithConfigAndLogger := pkg.WithLogger(ctxWithConfig, log)
 
 			// 调用 ShootOne 函数
-			result, err := internal.ShootOne(ctxWithConfigAndLogger, oriFrame)
+			result, err := internal.ShootOne(ctxWithConfigAndLogger, pipelineName, oriFrame)
 			if err != nil {
 				return fmt.Errorf("failed to process frame: %w", err)
 			}
@@ -66,6 +68,7 @@ func NewShootOneCommand() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().StringVarP(&pipelineName, "pipeline", "p", pkg.DefaultPipelineName, "使用的链路名称")
 
 	return cmd
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"gateway/internal"
+	"gateway/internal/alarm"
 	"gateway/internal/pkg"
 	"net/http"
 	_ "net/http/pprof" // 导入pprof
@@ -27,8 +28,8 @@ func syncLog(log *zap.Logger) {
 	}
 }
 
-// 性能指标处理函数
-func metricsHandler(w http.ResponseWriter, _ *http.Request) {
+// 性能指标文本报告处理函数, Prometheus 格式的指标见 /metrics
+func metricsReportHandler(w http.ResponseWriter, _ *http.Request) {
 	metrics := pkg.GetPerformanceMetrics()
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -39,10 +40,29 @@ func metricsHandler(w http.ResponseWriter, _ *http.Request) {
 	fmt.Fprintln(w, report)
 }
 
+// configDir 配置文件目录, 热加载时会重新从这里读取
+const configDir = "yaml"
+
+// reloadHandler 返回热加载接口, 仅支持 POST
+func reloadHandler(reload func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		fmt.Fprintln(w, "reloaded")
+	}
+}
+
 func main() {
 
 	// 1. 初始化common yaml
-	config, err := pkg.InitCommon("yaml")
+	config, err := pkg.InitCommon(configDir)
 	if err != nil {
 		fmt.Printf("[main] 加载配置失败: %s", err)
 		return
@@ -73,8 +93,9 @@ func main() {
 		pprofPort := 6060 // 默认pprof端口
 		log.Info("启动pprof和性能指标服务", zap.Int("port", pprofPort))
 
-		// 注册自定义指标处理程序
-		http.HandleFunc("/metrics", metricsHandler)
+		// 注册自定义指标处理程序, /metrics 输出 Prometheus 格式, /metrics/report 保留原有的文本报告
+		http.Handle("/metrics", pkg.PrometheusHandler())
+		http.HandleFunc("/metrics/report", metricsReportHandler)
 
 		// 添加内存统计信息处理程序
 		http.HandleFunc("/memory", func(w http.ResponseWriter, r *http.Request) {
@@ -111,9 +132,39 @@ func main() {
 	}
 	printStartupLogo()
 	// 4. 启动管道
-	pipeline.Start(ctxWithConfigAndLogger)
+	if err = pipeline.Start(ctxWithConfigAndLogger); err != nil {
+		log.Error("启动管道失败", zap.Error(err))
+		cancel()
+		syncLog(log)
+		pkg.CloseAllAsyncWriters()
+		return
+	}
+
+	// 5. 热加载: 监听配置目录, 并提供 /reload 接口手动触发
+	// 校验失败时 Reload 会保留当前运行的配置
+	reload := func() error {
+		newConfig, err := pkg.InitCommon(configDir)
+		if err != nil {
+			return fmt.Errorf("加载配置失败: %w", err)
+		}
+		return pipeline.Reload(newConfig)
+	}
+	http.HandleFunc("/reload", reloadHandler(reload))
+	err = pkg.WatchConfigDir(ctxWithConfigAndLogger, configDir, pkg.DefaultReloadDebounce, func() {
+		if err := reload(); err != nil {
+			log.Error("配置热加载失败, 继续使用当前配置", zap.Error(err))
+		}
+	})
+	if err != nil {
+		log.Warn("配置目录监听启动失败, 仅支持通过 /reload 接口热加载", zap.Error(err))
+	}
+
+	// 6. 告警查询与确认接口
+	alarmHandler := alarm.NewHandler(pipeline)
+	http.Handle("/alarms", alarmHandler)
+	http.Handle("/alarms/", alarmHandler)
 
-	// 5. 主线程监听终止信号
+	// 7. 主线程监听终止信号
 	si := make(chan os.Signal, 1)
 	signal.Notify(si, os.Interrupt, syscall.SIGTERM)
 	for {
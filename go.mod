@@ -4,6 +4,7 @@ go 1.24.2
 
 require (
 	github.com/eclipse/paho.mqtt.golang v1.5.0 //  mqtt client
+	github.com/fsnotify/fsnotify v1.9.0 // 配置热加载
 	github.com/google/uuid v1.6.0 // indirect; gen uuid
 	github.com/influxdata/influxdb-client-go/v2 v2.14.0 // influxdb连接sdk
 	github.com/mitchellh/mapstructure v1.5.0 // map转struct
@@ -19,8 +20,10 @@ require (
 	github.com/expr-lang/expr v1.17.2
 	github.com/gin-contrib/cors v1.7.5
 	github.com/gin-gonic/gin v1.10.0
+	github.com/jackc/pgx/v5 v5.7.6 // PostgreSQL/TimescaleDB
 	github.com/shengyanli1982/law v0.1.17
 	go.mongodb.org/mongo-driver v1.17.3
+	golang.org/x/text v0.24.0 // GBK 解码
 )
 
 require (
@@ -35,6 +38,9 @@ require (
 	github.com/goccy/go-json v0.10.5 // indirect
 	github.com/golang/snappy v1.0.0 // indirect
 	github.com/google/go-cmp v0.7.0 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
 	github.com/leodido/go-urn v1.4.0 // indirect
@@ -57,7 +63,6 @@ require (
 require (
 	github.com/apapsch/go-jsonmerge/v2 v2.0.0 // indirect
 	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
-	github.com/fsnotify/fsnotify v1.9.0 // indirect
 	github.com/go-viper/mapstructure/v2 v2.2.1 // indirect
 	github.com/gopherjs/gopherjs v1.17.2 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
@@ -80,7 +85,6 @@ require (
 	golang.org/x/net v0.39.0 // indirect
 	golang.org/x/sync v0.13.0 // indirect
 	golang.org/x/sys v0.32.0 // indirect
-	golang.org/x/text v0.24.0 // indirect
 	google.golang.org/protobuf v1.36.6 // indirect
 	gopkg.in/yaml.v3 v3.0.1
 )
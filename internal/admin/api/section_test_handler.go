@@ -281,6 +281,9 @@ func TestSectionHandler(c *gin.Context) {
 					if stype, ok := strategyMap["type"].(string); ok {
 						strategyConf.Type = stype
 					}
+					if sname, ok := strategyMap["name"].(string); ok {
+						strategyConf.Name = sname
+					}
 					if enable, ok := strategyMap["enable"].(bool); ok {
 						strategyConf.Enable = enable
 					} else {
@@ -318,22 +321,21 @@ func TestSectionHandler(c *gin.Context) {
 		// Consider how to report this error; for now, dispatcherResults will be empty
 	} else {
 		if resultPackage != nil && len(resultPackage.Points) > 0 {
-			dispatchedPkgs, dispatchErr := dispatchHandler.Dispatch(resultPackage)
-			if dispatchErr != nil {
+			dispatchedPkgs, dispatchErrs := dispatchHandler.Dispatch(resultPackage)
+			for _, dispatchErr := range dispatchErrs {
 				log.Warn("Dispatcher Handler处理点数据失败", zap.Error(dispatchErr))
-			} else {
-				for strategyName, pointPackage := range dispatchedPkgs {
-					if pointPackage != nil && len(pointPackage.Points) > 0 {
-						dispatcherResults = append(dispatcherResults, StrategyResult{
-							StrategyName: strategyName,
-							Points:       pointPackage.Points,
-						})
-					}
+			}
+			for strategyName, pointPackage := range dispatchedPkgs {
+				if pointPackage != nil && len(pointPackage.Points) > 0 {
+					dispatcherResults = append(dispatcherResults, StrategyResult{
+						StrategyName: strategyName,
+						Points:       pointPackage.Points,
+					})
 				}
-				dispatcherEndTime := time.Now()
-				processingTimeNs = dispatcherEndTime.Sub(startTime).Nanoseconds() // Update total processing time
-				log.Debug("Dispatcher Handler处理完成", zap.Int64("updatedProcessingTimeNs", processingTimeNs))
 			}
+			dispatcherEndTime := time.Now()
+			processingTimeNs = dispatcherEndTime.Sub(startTime).Nanoseconds() // Update total processing time
+			log.Debug("Dispatcher Handler处理完成", zap.Int64("updatedProcessingTimeNs", processingTimeNs))
 		} else {
 			log.Warn("Parser未生成有效的Point数据，跳过Dispatcher Handler处理", zap.Int("pointsCount", len(finalCollectedPoints)))
 		}
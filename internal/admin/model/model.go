@@ -25,6 +25,7 @@ type GoLogConfig struct {
 }
 
 type GoStrategyConfig struct {
+	Name   string                 `bson:"name,omitempty" json:"name,omitempty"` // 策略实例名称, 为空时使用 Type
 	Type   string                 `bson:"type" json:"type"`
 	Enable bool                   `bson:"enable" json:"enable"`
 	Filter []string               `bson:"filter" json:"filter"` // MODIFIED to []string
@@ -0,0 +1,11 @@
+// Package alarm 在 GoGate 数据网关中负责将遥测数据转换为告警事件。
+//
+// 本包位于 calculator 与 dispatcher 之间，按配置的规则 (alarms) 检查每个点，
+// 并为每个标签集合 (设备) 独立维护告警状态。主要职责包括：
+//   - 超限告警 (threshold)，支持回差 (hysteresis)。
+//   - 状态变化告警 (change)，例如某一位由 0 变为 1。
+//   - 设备静默告警 (silence)，超过一定时间没有收到数据。
+//   - 延时触发与延时恢复 (delayOn / delayOff)，以及 active / acknowledged / cleared 状态。
+//   - 状态变化时输出 type=alarm 的点包，交给 dispatcher 分发到已有的 sink。
+//   - 通过 HTTP 查询和确认当前的告警。
+package alarm
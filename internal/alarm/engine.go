@@ -0,0 +1,382 @@
+package alarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gateway/internal/pkg"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	StateActive       = "active"       // 已触发, 未确认
+	StateAcknowledged = "acknowledged" // 已触发, 已确认
+	StateCleared      = "cleared"      // 已恢复
+)
+
+// ErrNotFound 表示没有找到对应的未恢复告警
+var ErrNotFound = errors.New("告警不存在或已恢复")
+
+// Alarm 是一条未恢复的告警, 用于 HTTP 查询
+type Alarm struct {
+	ID             string         `json:"id"`
+	Pipeline       string         `json:"pipeline"`
+	Rule           string         `json:"rule"`
+	Type           string         `json:"type"`
+	Severity       string         `json:"severity,omitempty"`
+	Message        string         `json:"message,omitempty"`
+	Tag            map[string]any `json:"tag"`
+	Value          any            `json:"value,omitempty"`
+	State          string         `json:"state"`
+	ActiveAt       time.Time      `json:"activeAt"`
+	AcknowledgedAt *time.Time     `json:"acknowledgedAt,omitempty"`
+}
+
+// instance 是一条规则在一个标签集合 (设备) 上的告警状态
+type instance struct {
+	tag      map[string]any // 点包交给后续阶段后可能被修改, 因此保存一份拷贝
+	value    any            // 最近一次的值
+	cond     bool           // 最近一次计算的告警条件
+	active   bool
+	acked    bool
+	onSince  time.Time // 条件开始成立的时间, 用于 delayOn
+	offSince time.Time // 条件开始消失的时间, 用于 delayOff
+	activeAt time.Time
+	ackAt    time.Time
+	lastSeen time.Time // 最近一次收到数据的时间, 用于 silence 和淘汰
+}
+
+// Engine 是 calculator 与 dispatcher 之间的告警阶段
+// 时间以网关收到数据的系统时间为准, 以便在没有新数据时也能判断 delayOn/delayOff 与 silence
+type Engine struct {
+	ctx  context.Context
+	name string // 链路名称, 作为告警 ID 的前缀
+
+	mu        sync.Mutex // 保护以下字段, HTTP 查询与确认会并发访问
+	rules     *Rules
+	instances map[string]map[uint64]*instance // 规则名称 -> 标签哈希 -> 状态
+	outbox    []*pkg.PointPackage             // 待发送的告警事件
+	wake      chan struct{}                   // 确认告警后唤醒 Start 发送事件
+}
+
+// New 使用 ctx 中的 alarms 配置创建告警阶段, 规则无效时返回错误
+var New = func(ctx context.Context, name string) (*Engine, error) {
+	rules, err := Compile(pkg.ConfigFromContext(ctx).Alarms)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{
+		ctx:       ctx,
+		name:      name,
+		rules:     rules,
+		instances: make(map[string]map[uint64]*instance),
+		wake:      make(chan struct{}, 1),
+	}, nil
+}
+
+// Start 检查 source 中的每个点包后原样交给 sink, 告警状态变化时额外向 sink 发送 type=alarm 的点包
+func (e *Engine) Start(source *pkg.Parser2DispatcherChan, sink *pkg.Parser2DispatcherChan) {
+	logger := pkg.LoggerFromContext(e.ctx)
+	metrics := pkg.MetricsFromContext(e.ctx)
+
+	e.mu.Lock()
+	current := e.rules
+	e.mu.Unlock()
+	ticker := time.NewTicker(current.checkInterval)
+	defer ticker.Stop()
+	warned := make(map[string]bool) // 每条规则只以 Warn 级别记录第一次失败, 之后降为 Debug, 避免刷屏
+
+	for {
+		select {
+		case pointPackage := <-*source:
+			errs, rules := e.process(pointPackage, time.Now())
+			if rules != current {
+				current, warned = rules, make(map[string]bool)
+				ticker.Reset(rules.checkInterval)
+			}
+			for _, err := range errs {
+				metrics.IncMsgErrors("alarm")
+				if warned[err.rule] {
+					logger.Debug("error checking alarm", zap.String("frameId", pointPackage.FrameId), zap.Error(err))
+					continue
+				}
+				warned[err.rule] = true
+				logger.Warn("告警规则执行失败, 后续同一规则的失败只记录 Debug 日志", zap.String("frameId", pointPackage.FrameId), zap.Error(err))
+			}
+			if !e.send(sink, pointPackage) {
+				return
+			}
+		case now := <-ticker.C:
+			e.tick(now)
+		case <-e.wake:
+		case <-e.ctx.Done():
+			return
+		}
+
+		for _, event := range e.takeOutbox() {
+			metrics.IncMsgProcessed("alarm")
+			logger.Info("告警状态变化", zap.Any("tag", event.Points[0].Tag), zap.Any("field", event.Points[0].Field))
+			if !e.send(sink, event) {
+				return
+			}
+		}
+	}
+}
+
+func (e *Engine) send(sink *pkg.Parser2DispatcherChan, pointPackage *pkg.PointPackage) bool {
+	select {
+	case *sink <- pointPackage:
+		return true
+	case <-e.ctx.Done():
+		return false
+	}
+}
+
+// Swap 替换告警规则, 用于热加载
+// 同名规则保留各设备的告警状态, 已删除规则的告警直接丢弃
+func (e *Engine) Swap(rules *Rules) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = rules
+	names := make(map[string]struct{}, len(rules.rules))
+	for _, r := range rules.rules {
+		names[r.Name] = struct{}{}
+	}
+	for name := range e.instances {
+		if _, ok := names[name]; !ok {
+			delete(e.instances, name)
+		}
+	}
+}
+
+// ruleError 是规则执行失败的原因
+type ruleError struct {
+	rule string
+	err  error
+}
+
+func (e ruleError) Error() string {
+	return fmt.Sprintf("告警规则 %s 执行失败: %v", e.rule, e.err)
+}
+
+func (e ruleError) Unwrap() error {
+	return e.err
+}
+
+// process 以点包中的每个点更新告警状态, 返回执行失败的原因和本次使用的规则
+func (e *Engine) process(pointPackage *pkg.PointPackage, now time.Time) ([]ruleError, *Rules) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var errs []ruleError
+	for _, point := range pointPackage.Points {
+		if point == nil {
+			continue
+		}
+		env := AEnv{Tag: point.Tag, Field: point.Field}
+		var key uint64
+		hashed := false
+		for _, r := range e.rules.rules {
+			matched, err := r.match(env)
+			if err != nil {
+				errs = append(errs, ruleError{rule: r.Name, err: err})
+				continue
+			}
+			if !matched {
+				continue
+			}
+			value, ok := point.Field[r.Field]
+			if r.Field != "" && !ok {
+				continue
+			}
+			if !hashed {
+				key, hashed = pkg.TagKey(point.Tag), true
+			}
+			inst := e.instance(r, key, point.Tag)
+			if inst == nil {
+				continue
+			}
+			inst.lastSeen = now
+			inst.cond = r.condition(value, inst.value, inst.active)
+			if r.Type != TypeSilence {
+				inst.value = value
+			}
+			e.update(r, key, inst, now, pointPackage.FrameId)
+		}
+	}
+	return errs, e.rules
+}
+
+// tick 在没有新数据时推进 delayOn/delayOff, 并检查 silence 规则
+func (e *Engine) tick(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range e.rules.rules {
+		for key, inst := range e.instances[r.Name] {
+			if r.Type == TypeSilence {
+				inst.cond = now.Sub(inst.lastSeen) >= r.Timeout
+			}
+			e.update(r, key, inst, now, "")
+		}
+	}
+}
+
+// instance 返回规则在标签集合上的状态, 不存在时创建
+// 超过 maxSeries 时淘汰最久未收到数据的非告警状态, 全部处于告警状态时返回 nil
+func (e *Engine) instance(r *rule, key uint64, tag map[string]any) *instance {
+	instances, ok := e.instances[r.Name]
+	if !ok {
+		instances = make(map[uint64]*instance)
+		e.instances[r.Name] = instances
+	}
+	if inst, ok := instances[key]; ok {
+		return inst
+	}
+	if len(instances) >= e.rules.maxSeries {
+		var oldest uint64
+		var oldestInst *instance
+		for k, inst := range instances {
+			if !inst.active && (oldestInst == nil || inst.lastSeen.Before(oldestInst.lastSeen)) {
+				oldest, oldestInst = k, inst
+			}
+		}
+		if oldestInst == nil {
+			return nil
+		}
+		delete(instances, oldest)
+	}
+	inst := &instance{tag: make(map[string]any, len(tag))}
+	for k, v := range tag {
+		inst.tag[k] = v
+	}
+	instances[key] = inst
+	return inst
+}
+
+// update 按 delayOn/delayOff 推进告警状态, 状态变化时生成事件
+func (e *Engine) update(r *rule, key uint64, inst *instance, now time.Time, frameId string) {
+	if inst.cond {
+		inst.offSince = time.Time{}
+		if inst.active {
+			return
+		}
+		if inst.onSince.IsZero() {
+			inst.onSince = now
+		}
+		if now.Sub(inst.onSince) >= r.DelayOn {
+			inst.active, inst.acked, inst.activeAt, inst.ackAt = true, false, now, time.Time{}
+			e.emit(r, key, inst, StateActive, now, frameId)
+		}
+		return
+	}
+	inst.onSince = time.Time{}
+	if !inst.active {
+		return
+	}
+	if inst.offSince.IsZero() {
+		inst.offSince = now
+	}
+	if now.Sub(inst.offSince) >= r.DelayOff {
+		inst.active, inst.offSince = false, time.Time{}
+		e.emit(r, key, inst, StateCleared, now, frameId)
+	}
+}
+
+// emit 生成一个告警事件点包, 标签为设备标签加上 type=alarm、alarm=<规则名称> 与 severity
+func (e *Engine) emit(r *rule, key uint64, inst *instance, state string, now time.Time, frameId string) {
+	point := &pkg.Point{Tag: make(map[string]any, len(inst.tag)+3), Field: make(map[string]any)}
+	for k, v := range inst.tag {
+		point.Tag[k] = v
+	}
+	point.Tag["type"] = "alarm"
+	point.Tag["alarm"] = r.Name
+	if r.Severity != "" {
+		point.Tag["severity"] = r.Severity
+	}
+	point.Field["id"] = e.id(r, key)
+	point.Field["state"] = state
+	point.Field["acknowledged"] = inst.acked
+	if inst.value != nil {
+		point.Field["value"] = inst.value
+	}
+	if r.Message != "" {
+		point.Field["message"] = r.Message
+	}
+	e.outbox = append(e.outbox, &pkg.PointPackage{FrameId: frameId, Ts: now, Points: []*pkg.Point{point}})
+}
+
+func (e *Engine) id(r *rule, key uint64) string {
+	return fmt.Sprintf("%s:%s:%016x", e.name, r.Name, key)
+}
+
+func (e *Engine) takeOutbox() []*pkg.PointPackage {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	events := e.outbox
+	e.outbox = nil
+	return events
+}
+
+// Alarms 返回当前未恢复的告警, 按触发时间排序
+func (e *Engine) Alarms() []Alarm {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var alarms []Alarm
+	for _, r := range e.rules.rules {
+		for key, inst := range e.instances[r.Name] {
+			if !inst.active {
+				continue
+			}
+			alarm := Alarm{
+				ID:       e.id(r, key),
+				Pipeline: e.name,
+				Rule:     r.Name,
+				Type:     r.Type,
+				Severity: r.Severity,
+				Message:  r.Message,
+				Tag:      inst.tag,
+				Value:    inst.value,
+				State:    StateActive,
+				ActiveAt: inst.activeAt,
+			}
+			if inst.acked {
+				ackAt := inst.ackAt
+				alarm.State, alarm.AcknowledgedAt = StateAcknowledged, &ackAt
+			}
+			alarms = append(alarms, alarm)
+		}
+	}
+	sort.Slice(alarms, func(i, j int) bool {
+		if !alarms[i].ActiveAt.Equal(alarms[j].ActiveAt) {
+			return alarms[i].ActiveAt.Before(alarms[j].ActiveAt)
+		}
+		return alarms[i].ID < alarms[j].ID
+	})
+	return alarms
+}
+
+// Acknowledge 确认一条未恢复的告警并输出 acknowledged 事件, 已确认的告警重复确认不会再次输出
+func (e *Engine) Acknowledge(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range e.rules.rules {
+		for key, inst := range e.instances[r.Name] {
+			if !inst.active || e.id(r, key) != id {
+				continue
+			}
+			if !inst.acked {
+				inst.acked, inst.ackAt = true, time.Now()
+				e.emit(r, key, inst, StateAcknowledged, inst.ackAt, "")
+				select {
+				case e.wake <- struct{}{}:
+				default:
+				}
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
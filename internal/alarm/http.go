@@ -0,0 +1,57 @@
+package alarm
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// Source 是可以查询和确认告警的对象, 如 internal.Pipeline 汇总了所有链路的告警
+type Source interface {
+	Alarms() []Alarm
+	Acknowledge(id string) error
+}
+
+// NewHandler 返回告警查询接口:
+//   - GET /alarms: 返回未恢复的告警, 可按 state、rule、severity、pipeline 查询参数过滤
+//   - POST /alarms/{id}/ack: 确认一条告警, 告警不存在或已恢复时返回 404
+func NewHandler(source Source) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /alarms", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		alarms := make([]Alarm, 0)
+		for _, alarm := range source.Alarms() {
+			if !matchQuery(query.Get("state"), alarm.State) ||
+				!matchQuery(query.Get("rule"), alarm.Rule) ||
+				!matchQuery(query.Get("severity"), alarm.Severity) ||
+				!matchQuery(query.Get("pipeline"), alarm.Pipeline) {
+				continue
+			}
+			alarms = append(alarms, alarm)
+		}
+		writeJson(w, http.StatusOK, alarms)
+	})
+	mux.HandleFunc("POST /alarms/{id}/ack", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		err := source.Acknowledge(id)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			writeJson(w, http.StatusOK, map[string]string{"id": id, "state": StateAcknowledged})
+		}
+	})
+	return mux
+}
+
+func matchQuery(want, actual string) bool {
+	return want == "" || want == actual
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,181 @@
+package alarm
+
+import (
+	"fmt"
+	"gateway/internal/parser"
+	"gateway/internal/pkg"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+const (
+	TypeThreshold = "threshold" // 超限
+	TypeChange    = "change"    // 状态变化
+	TypeSilence   = "silence"   // 设备静默
+
+	defaultCheckInterval = time.Second
+	defaultMaxSeries     = 10000
+)
+
+// AEnv 是告警规则 when 表达式执行的环境
+type AEnv struct {
+	Tag   map[string]any
+	Field map[string]any
+}
+
+// BuildAlarmExprOptions 返回用于编译告警规则 when 表达式的 expr 选项。
+// 环境设置为 *AEnv，并复用解析器的全局辅助函数。
+//
+// 输入: 无
+// 输出:
+//   - []expr.Option: 编译选项切片
+func BuildAlarmExprOptions() []expr.Option {
+	options := []expr.Option{
+		expr.Env(&AEnv{}),
+		expr.AsBool(),
+	}
+	return append(options, parser.BuildHelperOptions()...)
+}
+
+// rule 是编译后的告警规则
+type rule struct {
+	pkg.AlarmRule
+	when *vm.Program // 未配置条件时为 nil
+}
+
+// Rules 是一组编译后的告警规则, 热加载时整体替换
+type Rules struct {
+	rules         []*rule
+	checkInterval time.Duration
+	maxSeries     int
+}
+
+// Compile 编译告警规则
+//
+// 输入:
+//   - config: 告警配置
+//
+// 输出:
+//   - *Rules: 编译后的规则
+//   - error: 任意一条规则无效时返回错误
+func Compile(config pkg.AlarmsConfig) (*Rules, error) {
+	rules := &Rules{checkInterval: config.CheckInterval, maxSeries: config.MaxSeries}
+	if rules.checkInterval <= 0 {
+		rules.checkInterval = defaultCheckInterval
+	}
+	if rules.maxSeries <= 0 {
+		rules.maxSeries = defaultMaxSeries
+	}
+	names := make(map[string]struct{})
+	for i, ruleConfig := range config.Rules {
+		if ruleConfig.Name == "" {
+			return nil, fmt.Errorf("第 %d 条告警规则缺少 name", i)
+		}
+		if _, exists := names[ruleConfig.Name]; exists {
+			return nil, fmt.Errorf("告警规则名称重复: %s", ruleConfig.Name)
+		}
+		// 规则名称是告警 ID 的一部分, 告警 ID 会作为 /alarms/{id}/ack 的一段路径
+		if strings.Contains(ruleConfig.Name, "/") {
+			return nil, fmt.Errorf("告警规则名称不能包含 '/': %s", ruleConfig.Name)
+		}
+		names[ruleConfig.Name] = struct{}{}
+		compiled, err := compileRule(ruleConfig)
+		if err != nil {
+			return nil, fmt.Errorf("告警规则 %s 无效: %w", ruleConfig.Name, err)
+		}
+		rules.rules = append(rules.rules, compiled)
+	}
+	return rules, nil
+}
+
+func compileRule(config pkg.AlarmRule) (*rule, error) {
+	if config.Type == "" {
+		config.Type = TypeThreshold
+	}
+	switch config.Type {
+	case TypeThreshold:
+		if config.Field == "" || (config.Above == nil && config.Below == nil) {
+			return nil, fmt.Errorf("threshold 规则需要配置 field 以及 above 或 below")
+		}
+		if config.Hysteresis < 0 {
+			return nil, fmt.Errorf("hysteresis 不能为负数: %v", config.Hysteresis)
+		}
+	case TypeChange:
+		if config.Field == "" || config.To == nil {
+			return nil, fmt.Errorf("change 规则需要配置 field 和 to")
+		}
+	case TypeSilence:
+		if config.Timeout <= 0 {
+			return nil, fmt.Errorf("silence 规则需要配置大于 0 的 timeout")
+		}
+	default:
+		return nil, fmt.Errorf("不支持的告警类型: %s, 可选 threshold | change | silence", config.Type)
+	}
+	if config.DelayOn < 0 || config.DelayOff < 0 {
+		return nil, fmt.Errorf("delayOn/delayOff 不能为负数")
+	}
+
+	compiled := &rule{AlarmRule: config}
+	if config.When != "" {
+		program, err := expr.Compile(config.When, BuildAlarmExprOptions()...)
+		if err != nil {
+			return nil, fmt.Errorf("编译 when 失败: %w", err)
+		}
+		compiled.when = program
+	}
+	return compiled, nil
+}
+
+// match 判断点是否适用该规则, 未配置 when 时总是适用
+func (r *rule) match(env AEnv) (bool, error) {
+	if r.when == nil {
+		return true, nil
+	}
+	result, err := expr.Run(r.when, env)
+	if err != nil {
+		return false, err
+	}
+	matched, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("when 的结果不是布尔值: %v", result)
+	}
+	return matched, nil
+}
+
+// condition 根据新的值计算告警条件, 调用方保证 threshold/change 规则的字段存在
+// previous 为该设备上一次的值, active 为当前是否处于告警状态
+func (r *rule) condition(value, previous any, active bool) bool {
+	switch r.Type {
+	case TypeThreshold:
+		v, ok := pkg.ToFloat64(value)
+		if !ok {
+			return active // 非数值时保持原状态
+		}
+		hysteresis := 0.0
+		if active {
+			// 处于告警状态时, 需要越过回差才恢复
+			hysteresis = r.Hysteresis
+		}
+		return (r.Above != nil && v > *r.Above-hysteresis) || (r.Below != nil && v < *r.Below+hysteresis)
+	case TypeChange:
+		if !equal(value, r.To) {
+			return false
+		}
+		// 配置了 from 时, 只在由 from 变为 to 时触发, 已经触发的告警在值保持 to 期间持续
+		return active || r.From == nil || equal(previous, r.From)
+	default:
+		// silence 规则收到数据即条件消失
+		return false
+	}
+}
+
+// equal 按 %v 格式化后比较, 使 1、uint8(1) 与 1.0 视为相等
+func equal(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
@@ -0,0 +1,274 @@
+package alarm
+
+import (
+	"context"
+	"encoding/json"
+	"gateway/internal/pkg"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+func TestEngine(t *testing.T) {
+	base := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	float := func(v float64) *float64 { return &v }
+	newEngine := func(rules ...pkg.AlarmRule) *Engine {
+		config := &pkg.Config{Alarms: pkg.AlarmsConfig{Rules: rules}}
+		engine, err := New(pkg.WithLogger(pkg.WithConfig(context.Background(), config), zap.NewNop()), "p1")
+		So(err, ShouldBeNil)
+		return engine
+	}
+	send := func(engine *Engine, now time.Time, field map[string]any) []*pkg.PointPackage {
+		errs, _ := engine.process(&pkg.PointPackage{FrameId: "F", Ts: now, Points: []*pkg.Point{
+			{Tag: map[string]any{"device": "d1"}, Field: field},
+			nil,
+		}}, now)
+		So(errs, ShouldBeEmpty)
+		return engine.takeOutbox()
+	}
+	states := func(events []*pkg.PointPackage) []any {
+		result := make([]any, 0, len(events))
+		for _, event := range events {
+			result = append(result, event.Points[0].Field["state"])
+		}
+		return result
+	}
+
+	Convey("threshold 规则按回差与延时触发和恢复", t, func() {
+		engine := newEngine(pkg.AlarmRule{
+			Name: "temp_high", Field: "temp", Above: float(80), Hysteresis: 5,
+			DelayOn: 2 * time.Second, DelayOff: time.Second, Severity: "major", Message: "温度过高",
+		})
+
+		// 越限但未满 delayOn
+		So(send(engine, base, map[string]any{"temp": 85}), ShouldBeEmpty)
+		So(send(engine, base.Add(time.Second), map[string]any{"temp": 86}), ShouldBeEmpty)
+		// 没有新数据时由 tick 推进
+		engine.tick(base.Add(2 * time.Second))
+		events := engine.takeOutbox()
+		So(states(events), ShouldResemble, []any{StateActive})
+		So(events[0].Points[0].Tag, ShouldResemble, map[string]any{"device": "d1", "type": "alarm", "alarm": "temp_high", "severity": "major"})
+		So(events[0].Points[0].Field, ShouldResemble, map[string]any{
+			"id": engine.Alarms()[0].ID, "state": StateActive, "acknowledged": false, "value": 86, "message": "温度过高",
+		})
+		So(engine.Alarms()[0].ID, ShouldStartWith, "p1:temp_high:")
+
+		// 回到阈值以下但仍在回差范围内, 保持告警
+		So(send(engine, base.Add(3*time.Second), map[string]any{"temp": 78}), ShouldBeEmpty)
+		engine.tick(base.Add(5 * time.Second))
+		So(engine.takeOutbox(), ShouldBeEmpty)
+		So(len(engine.Alarms()), ShouldEqual, 1)
+
+		// 越过回差后经过 delayOff 才恢复
+		So(send(engine, base.Add(6*time.Second), map[string]any{"temp": 74}), ShouldBeEmpty)
+		So(states(send(engine, base.Add(7*time.Second), map[string]any{"temp": 74})), ShouldResemble, []any{StateCleared})
+		So(engine.Alarms(), ShouldBeEmpty)
+
+		Convey("条件在 delayOn 之内消失不触发", func() {
+			So(send(engine, base.Add(10*time.Second), map[string]any{"temp": 90}), ShouldBeEmpty)
+			So(send(engine, base.Add(11*time.Second), map[string]any{"temp": 70}), ShouldBeEmpty)
+			engine.tick(base.Add(20 * time.Second))
+			So(engine.takeOutbox(), ShouldBeEmpty)
+		})
+
+		Convey("缺少字段或字段非数值时不改变状态", func() {
+			So(send(engine, base.Add(10*time.Second), map[string]any{"other": 1}), ShouldBeEmpty)
+			So(send(engine, base.Add(11*time.Second), map[string]any{"temp": "n/a"}), ShouldBeEmpty)
+			So(engine.Alarms(), ShouldBeEmpty)
+		})
+	})
+
+	Convey("change 规则只在值由 from 变为 to 时触发", t, func() {
+		engine := newEngine(pkg.AlarmRule{Name: "door", Type: TypeChange, Field: "door", From: 0, To: 1, When: `Tag.device == "d1"`})
+
+		// 首个值即为 to, 没有经过 from, 不触发
+		So(send(engine, base, map[string]any{"door": uint8(1)}), ShouldBeEmpty)
+		So(send(engine, base.Add(time.Second), map[string]any{"door": uint8(0)}), ShouldBeEmpty)
+		So(states(send(engine, base.Add(2*time.Second), map[string]any{"door": uint8(1)})), ShouldResemble, []any{StateActive})
+		So(send(engine, base.Add(3*time.Second), map[string]any{"door": uint8(1)}), ShouldBeEmpty)
+		So(states(send(engine, base.Add(4*time.Second), map[string]any{"door": uint8(0)})), ShouldResemble, []any{StateCleared})
+	})
+
+	Convey("silence 规则在超时没有数据时触发, 收到数据后恢复", t, func() {
+		engine := newEngine(pkg.AlarmRule{Name: "offline", Type: TypeSilence, Timeout: 5 * time.Second})
+
+		So(send(engine, base, map[string]any{"v": 1}), ShouldBeEmpty)
+		engine.tick(base.Add(4 * time.Second))
+		So(engine.takeOutbox(), ShouldBeEmpty)
+		engine.tick(base.Add(5 * time.Second))
+		events := engine.takeOutbox()
+		So(states(events), ShouldResemble, []any{StateActive})
+		_, hasValue := events[0].Points[0].Field["value"]
+		So(hasValue, ShouldBeFalse)
+		So(states(send(engine, base.Add(6*time.Second), map[string]any{"v": 2})), ShouldResemble, []any{StateCleared})
+	})
+
+	Convey("确认告警后输出 acknowledged 事件, 查询结果中状态为 acknowledged", t, func() {
+		engine := newEngine(pkg.AlarmRule{Name: "temp_high", Field: "temp", Above: float(80)})
+		So(states(send(engine, base, map[string]any{"temp": 90})), ShouldResemble, []any{StateActive})
+
+		alarms := engine.Alarms()
+		So(len(alarms), ShouldEqual, 1)
+		So(alarms[0].State, ShouldEqual, StateActive)
+		So(alarms[0].Pipeline, ShouldEqual, "p1")
+		So(alarms[0].Tag, ShouldResemble, map[string]any{"device": "d1"})
+
+		So(engine.Acknowledge(alarms[0].ID), ShouldBeNil)
+		events := engine.takeOutbox()
+		So(states(events), ShouldResemble, []any{StateAcknowledged})
+		So(events[0].Points[0].Field["acknowledged"], ShouldBeTrue)
+		So(engine.Alarms()[0].State, ShouldEqual, StateAcknowledged)
+		So(engine.Alarms()[0].AcknowledgedAt, ShouldNotBeNil)
+
+		// 重复确认不再输出事件
+		So(engine.Acknowledge(alarms[0].ID), ShouldBeNil)
+		So(engine.takeOutbox(), ShouldBeEmpty)
+		So(engine.Acknowledge("p1:temp_high:missing"), ShouldEqual, ErrNotFound)
+
+		// 恢复后不能再确认
+		So(states(send(engine, base.Add(time.Second), map[string]any{"temp": 70})), ShouldResemble, []any{StateCleared})
+		So(engine.Acknowledge(alarms[0].ID), ShouldEqual, ErrNotFound)
+	})
+
+	Convey("超过 maxSeries 时淘汰最久未收到数据的非告警状态", t, func() {
+		config := &pkg.Config{Alarms: pkg.AlarmsConfig{MaxSeries: 1, Rules: []pkg.AlarmRule{{Name: "temp_high", Field: "temp", Above: float(80)}}}}
+		engine, err := New(pkg.WithLogger(pkg.WithConfig(context.Background(), config), zap.NewNop()), "p1")
+		So(err, ShouldBeNil)
+		process := func(device string, temp int, now time.Time) {
+			engine.process(&pkg.PointPackage{Ts: now, Points: []*pkg.Point{{Tag: map[string]any{"device": device}, Field: map[string]any{"temp": temp}}}}, now)
+		}
+		process("d1", 70, base)
+		process("d2", 90, base.Add(time.Second))
+		So(len(engine.instances["temp_high"]), ShouldEqual, 1)
+		So(len(engine.Alarms()), ShouldEqual, 1)
+		// 唯一的状态处于告警中, 新设备不再跟踪
+		process("d3", 90, base.Add(2*time.Second))
+		So(len(engine.Alarms()), ShouldEqual, 1)
+		So(engine.Alarms()[0].Tag["device"], ShouldEqual, "d2")
+	})
+
+	Convey("热加载保留同名规则的状态, 丢弃已删除规则的状态", t, func() {
+		engine := newEngine(
+			pkg.AlarmRule{Name: "a", Field: "temp", Above: float(80)},
+			pkg.AlarmRule{Name: "b", Field: "temp", Above: float(85)},
+		)
+		So(len(send(engine, base, map[string]any{"temp": 90})), ShouldEqual, 2)
+		rules, err := Compile(pkg.AlarmsConfig{Rules: []pkg.AlarmRule{{Name: "a", Field: "temp", Above: float(80)}}})
+		So(err, ShouldBeNil)
+		engine.Swap(rules)
+		alarms := engine.Alarms()
+		So(len(alarms), ShouldEqual, 1)
+		So(alarms[0].Rule, ShouldEqual, "a")
+	})
+
+	Convey("配置校验", t, func() {
+		invalid := [][]pkg.AlarmRule{
+			{{Field: "temp", Above: float(1)}},
+			{{Name: "a", Field: "temp", Above: float(1)}, {Name: "a", Field: "temp", Above: float(1)}},
+			{{Name: "a", Field: "temp"}},
+			{{Name: "a", Above: float(1)}},
+			{{Name: "a", Field: "temp", Above: float(1), Hysteresis: -1}},
+			{{Name: "a", Type: TypeChange, Field: "door"}},
+			{{Name: "a", Type: TypeSilence}},
+			{{Name: "a", Type: "rate", Field: "temp"}},
+			{{Name: "a", Field: "temp", Above: float(1), DelayOn: -time.Second}},
+			{{Name: "a", Field: "temp", Above: float(1), When: "1 +"}},
+			{{Name: "a", Field: "temp", Above: float(1), When: "1 + 1"}},
+			{{Name: "rack/1", Field: "temp", Above: float(1)}},
+		}
+		for _, rules := range invalid {
+			_, err := Compile(pkg.AlarmsConfig{Rules: rules})
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestEngineStart(t *testing.T) {
+	Convey("告警阶段原样转发点包, 状态变化时额外输出告警事件", t, func() {
+		config := &pkg.Config{Alarms: pkg.AlarmsConfig{Rules: []pkg.AlarmRule{{Name: "high", Field: "v", Above: func() *float64 { v := 10.0; return &v }()}}}}
+		ctx, cancel := context.WithCancel(pkg.WithLogger(pkg.WithConfig(context.Background(), config), zap.NewNop()))
+		defer cancel()
+		engine, err := New(ctx, "p1")
+		So(err, ShouldBeNil)
+
+		source := make(pkg.Parser2DispatcherChan)
+		sink := make(pkg.Parser2DispatcherChan, 10)
+		go engine.Start(&source, &sink)
+		receive := func() *pkg.PointPackage {
+			select {
+			case pointPackage := <-sink:
+				return pointPackage
+			case <-time.After(time.Second):
+				t.Fatal("等待告警阶段输出超时")
+				return nil
+			}
+		}
+
+		source <- &pkg.PointPackage{FrameId: "F1", Ts: time.Now(), Points: []*pkg.Point{{Tag: map[string]any{"id": "a"}, Field: map[string]any{"v": 20}}}}
+		So(receive().FrameId, ShouldEqual, "F1")
+		event := receive()
+		So(event.FrameId, ShouldEqual, "F1")
+		So(event.Points[0].Tag["type"], ShouldEqual, "alarm")
+		So(event.Points[0].Field["state"], ShouldEqual, StateActive)
+
+		// 确认后由 Start 输出 acknowledged 事件
+		So(engine.Acknowledge(event.Points[0].Field["id"].(string)), ShouldBeNil)
+		So(receive().Points[0].Field["state"], ShouldEqual, StateAcknowledged)
+
+		_, err = New(pkg.WithConfig(ctx, &pkg.Config{Alarms: pkg.AlarmsConfig{Rules: []pkg.AlarmRule{{}}}}), "p1")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+type fakeSource struct {
+	alarms []Alarm
+	acked  []string
+}
+
+func (s *fakeSource) Alarms() []Alarm { return s.alarms }
+
+func (s *fakeSource) Acknowledge(id string) error {
+	for _, alarm := range s.alarms {
+		if alarm.ID == id {
+			s.acked = append(s.acked, id)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func TestHandler(t *testing.T) {
+	Convey("HTTP 接口查询与确认告警", t, func() {
+		source := &fakeSource{alarms: []Alarm{
+			{ID: "p1:high:01", Pipeline: "p1", Rule: "high", Severity: "major", State: StateActive},
+			{ID: "p2:door:02", Pipeline: "p2", Rule: "door", Severity: "minor", State: StateAcknowledged},
+		}}
+		handler := NewHandler(source)
+		do := func(method, target string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+			return recorder
+		}
+		list := func(target string) []Alarm {
+			recorder := do(http.MethodGet, target)
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			var alarms []Alarm
+			So(json.Unmarshal(recorder.Body.Bytes(), &alarms), ShouldBeNil)
+			return alarms
+		}
+
+		So(len(list("/alarms")), ShouldEqual, 2)
+		So(list("/alarms?state=acknowledged")[0].ID, ShouldEqual, "p2:door:02")
+		So(list("/alarms?pipeline=p1&severity=major")[0].ID, ShouldEqual, "p1:high:01")
+		So(list("/alarms?rule=missing"), ShouldBeEmpty)
+
+		So(do(http.MethodPost, "/alarms/p1:high:01/ack").Code, ShouldEqual, http.StatusOK)
+		So(source.acked, ShouldResemble, []string{"p1:high:01"})
+		So(do(http.MethodPost, "/alarms/missing/ack").Code, ShouldEqual, http.StatusNotFound)
+		So(do(http.MethodDelete, "/alarms").Code, ShouldEqual, http.StatusMethodNotAllowed)
+	})
+}
@@ -0,0 +1,134 @@
+package calculator
+
+import (
+	"container/list"
+	"fmt"
+	"gateway/internal/pkg"
+	"time"
+)
+
+// defaultCacheSize 是最近值缓存默认的点数上限
+const defaultCacheSize = 10000
+
+// cacheValue 是字段最近一次的值及其所属点包的时间
+type cacheValue struct {
+	value any
+	ts    time.Time
+}
+
+// cacheEntry 是一个点 (以标签哈希区分) 各字段最近一次的值
+type cacheEntry struct {
+	key    uint64
+	tag    map[string]any // 点被放回对象池后标签会被清空, 因此保存一份拷贝
+	fields map[string]cacheValue
+}
+
+// cache 是最近值缓存, 以 pkg.TagKey 为键, 按最近更新的顺序组成 LRU, 超过 size 时淘汰最久未更新的点。
+// 与 Calculator 的分发协程绑定, 不是并发安全的。
+type cache struct {
+	size   int
+	ttl    time.Duration
+	points map[uint64]*list.Element
+	lru    *list.List // 元素为 *cacheEntry, 队首为最近更新的点
+}
+
+func newCache(size int, ttl time.Duration) *cache {
+	c := &cache{points: make(map[uint64]*list.Element), lru: list.New()}
+	c.resize(size, ttl)
+	return c
+}
+
+// resize 调整缓存上限和过期时间, 热加载时保留已缓存的数据
+func (c *cache) resize(size int, ttl time.Duration) {
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+	c.size, c.ttl = size, ttl
+	c.evict()
+}
+
+// set 记录点的一个字段值
+func (c *cache) set(tag map[string]any, name string, value any, ts time.Time) {
+	c.entry(tag).fields[name] = cacheValue{value: value, ts: ts}
+}
+
+// update 记录点的全部字段值
+func (c *cache) update(point *pkg.Point, ts time.Time) {
+	entry := c.entry(point.Tag)
+	for name, value := range point.Field {
+		entry.fields[name] = cacheValue{value: value, ts: ts}
+	}
+}
+
+// entry 返回标签对应的点并将其移到队首, 不存在时创建
+func (c *cache) entry(tag map[string]any) *cacheEntry {
+	key := pkg.TagKey(tag)
+	if element, ok := c.points[key]; ok {
+		c.lru.MoveToFront(element)
+		return element.Value.(*cacheEntry)
+	}
+	entry := &cacheEntry{key: key, tag: make(map[string]any, len(tag)), fields: make(map[string]cacheValue)}
+	for k, v := range tag {
+		entry.tag[k] = v
+	}
+	c.points[key] = c.lru.PushFront(entry)
+	c.evict()
+	return entry
+}
+
+func (c *cache) evict() {
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.points, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// lookup 返回字段在 now 时仍然有效的值
+func (c *cache) lookup(entry *cacheEntry, field string, now time.Time) (any, bool) {
+	v, ok := entry.fields[field]
+	if !ok || (c.ttl > 0 && now.Sub(v.ts) > c.ttl) {
+		return nil, false
+	}
+	return v.value, true
+}
+
+// lastFunc 返回 CEnv.Last
+func (c *cache) lastFunc(now time.Time) func(map[string]any, string) any {
+	return func(tag map[string]any, field string) any {
+		element, ok := c.points[pkg.TagKey(tag)]
+		if !ok {
+			return nil
+		}
+		value, _ := c.lookup(element.Value.(*cacheEntry), field, now)
+		return value
+	}
+}
+
+// valuesFunc 返回 CEnv.Values, 按最近更新的顺序返回标签包含 match 的点的字段值
+func (c *cache) valuesFunc(now time.Time) func(string, map[string]any) []any {
+	return func(field string, match map[string]any) []any {
+		var values []any
+		for element := c.lru.Front(); element != nil; element = element.Next() {
+			entry := element.Value.(*cacheEntry)
+			if !containsTags(entry.tag, match) {
+				continue
+			}
+			if value, ok := c.lookup(entry, field, now); ok && value != nil {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+}
+
+// containsTags 判断 tag 是否包含 match 中的全部键值, 值按 %v 格式化后比较, 与 pkg.TagKey 一致
+func containsTags(tag, match map[string]any) bool {
+	for k, v := range match {
+		actual, ok := tag[k]
+		if !ok || fmt.Sprint(actual) != fmt.Sprint(v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package calculator
+
+import (
+	"context"
+	"gateway/internal/pkg"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Calculator 是 parser 与 dispatcher 之间的计算阶段
+type Calculator struct {
+	ctx context.Context
+
+	mu    sync.RWMutex // 保护 rules, 热加载时整体替换
+	rules *Rules
+}
+
+// New 使用 ctx 中的 calculations 配置创建计算阶段, 规则无效时返回错误
+var New = func(ctx context.Context) (*Calculator, error) {
+	rules, err := Compile(pkg.ConfigFromContext(ctx).Calculations)
+	if err != nil {
+		return nil, err
+	}
+	return &Calculator{ctx: ctx, rules: rules}, nil
+}
+
+// Start 对 source 中的每个点包执行计算规则后交给 sink, 未配置规则时原样转发
+func (c *Calculator) Start(source *pkg.Parser2DispatcherChan, sink *pkg.Parser2DispatcherChan) {
+	logger := pkg.LoggerFromContext(c.ctx)
+	metrics := pkg.MetricsFromContext(c.ctx)
+
+	var current *Rules
+	var warned map[string]bool // 每条规则只以 Warn 级别记录第一次失败, 之后降为 Debug, 避免刷屏
+	values := newCache(0, 0)
+	for {
+		select {
+		case pointPackage := <-*source:
+			// 每帧取一次快照, 热加载在帧与帧之间生效
+			c.mu.RLock()
+			rules := c.rules
+			c.mu.RUnlock()
+			if rules != current {
+				current, warned = rules, make(map[string]bool)
+				values.resize(rules.cacheSize, rules.cacheTTL)
+			}
+
+			if len(rules.rules) > 0 {
+				metrics.IncMsgReceived("calculator")
+				for _, err := range rules.apply(pointPackage, values) {
+					metrics.IncMsgErrors("calculator")
+					if warned[err.rule] {
+						logger.Debug("error calculating", zap.String("frameId", pointPackage.FrameId), zap.Error(err))
+						continue
+					}
+					warned[err.rule] = true
+					logger.Warn("计算规则执行失败, 后续同一规则的失败只记录 Debug 日志", zap.String("frameId", pointPackage.FrameId), zap.Error(err))
+				}
+			}
+
+			select {
+			case *sink <- pointPackage:
+			case <-c.ctx.Done():
+				return
+			}
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// Swap 替换计算规则, 用于热加载, 最近值缓存保留
+func (c *Calculator) Swap(rules *Rules) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = rules
+}
@@ -0,0 +1,8 @@
+// Package calculator 在 GoGate 数据网关中负责计算点 (calculated / virtual points)。
+//
+// 本包位于 parser 与 dispatcher 之间，对解析得到的每个点包 (pkg.PointPackage)
+// 按配置的规则 (calculations) 执行 expr 表达式，计算出新的字段或新的点。主要职责包括：
+//   - 对每个点计算派生字段，例如 power = voltage * current。
+//   - 对每个点包计算跨设备的点，例如由各车厢的数值汇总出整列车的数值。
+//   - 维护有上限的最近值缓存，使表达式可以引用之前点包中其他设备的数据。
+package calculator
@@ -0,0 +1,296 @@
+package calculator
+
+import (
+	"fmt"
+	"gateway/internal/parser"
+	"gateway/internal/pkg"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+const (
+	ScopePoint   = "point"   // 对每个点执行, 结果写入该点
+	ScopePackage = "package" // 对每个点包执行一次, 结果写入 tag 指定的点
+)
+
+// CEnv 是计算规则表达式执行的环境。
+// 它包含了当前点 (point 规则)、当前点包的全部点以及最近值缓存的查询函数。
+type CEnv struct {
+	// Tag / Field 是当前点的标签与字段, package 规则中为 nil
+	Tag   map[string]any
+	Field map[string]any
+	// Points 是当前点包的全部点, 包括前面的规则新建的点
+	Points  []*pkg.Point
+	FrameId string
+	Ts      time.Time
+	// Last 返回标签集合为 tag 的点最近一次的字段值, 不存在或已过期时为 nil, 表达式中写作 last({"car": "1"}, "power")
+	Last func(tag map[string]any, field string) any `expr:"last"`
+	// Values 返回标签包含 match 的所有点最近一次的字段值, 表达式中写作 sum(values("power", {"train": "T1"}))
+	Values func(field string, match map[string]any) []any `expr:"values"`
+}
+
+// BuildCalcExprOptions 返回用于编译计算规则表达式的 expr 选项。
+// 环境设置为 *CEnv，并复用解析器的全局辅助函数。
+//
+// 输入: 无
+// 输出:
+//   - []expr.Option: 编译选项切片
+func BuildCalcExprOptions() []expr.Option {
+	options := []expr.Option{
+		expr.Env(&CEnv{}),
+	}
+	return append(options, parser.BuildHelperOptions()...)
+}
+
+// rule 是编译后的计算规则
+type rule struct {
+	name  string
+	scope string
+	when  *vm.Program // 未配置条件时为 nil
+	tag   *vm.Program // package 规则的目标点标签, 返回 map[string]any
+	field *vm.Program // 返回 map[string]any
+}
+
+// Rules 是一组编译后的计算规则, 热加载时整体替换
+type Rules struct {
+	rules     []rule
+	cacheSize int
+	cacheTTL  time.Duration
+}
+
+// Compile 编译计算规则
+//
+// 输入:
+//   - config: 计算点配置
+//
+// 输出:
+//   - *Rules: 编译后的规则
+//   - error: 任意一条规则无效时返回错误
+func Compile(config pkg.CalculationsConfig) (*Rules, error) {
+	rules := &Rules{cacheSize: config.CacheSize, cacheTTL: config.CacheTTL}
+	if config.CacheTTL < 0 {
+		return nil, fmt.Errorf("cacheTTL 不能为负数: %v", config.CacheTTL)
+	}
+	for i, ruleConfig := range config.Rules {
+		name := ruleConfig.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i)
+		}
+		compiled, err := compileRule(name, ruleConfig)
+		if err != nil {
+			return nil, fmt.Errorf("计算规则 %s 无效: %w", name, err)
+		}
+		rules.rules = append(rules.rules, compiled)
+	}
+	return rules, nil
+}
+
+func compileRule(name string, config pkg.CalculationRule) (rule, error) {
+	compiled := rule{name: name, scope: config.Scope}
+	if compiled.scope == "" {
+		compiled.scope = ScopePoint
+	}
+	switch compiled.scope {
+	case ScopePoint:
+		if len(config.Tag) > 0 {
+			return rule{}, fmt.Errorf("point 规则的结果写入当前点, 不支持配置 tag")
+		}
+	case ScopePackage:
+		if len(config.Tag) == 0 {
+			return rule{}, fmt.Errorf("package 规则需要配置 tag")
+		}
+	default:
+		return rule{}, fmt.Errorf("不支持的 scope: %s, 可选 point | package", config.Scope)
+	}
+	if len(config.Field) == 0 {
+		return rule{}, fmt.Errorf("需要配置至少一个 field")
+	}
+
+	var err error
+	if config.When != "" {
+		if compiled.when, err = expr.Compile(config.When, append(BuildCalcExprOptions(), expr.AsBool())...); err != nil {
+			return rule{}, fmt.Errorf("编译 when 失败: %w", err)
+		}
+	}
+	if len(config.Tag) > 0 {
+		if compiled.tag, err = compileMap(config.Tag); err != nil {
+			return rule{}, fmt.Errorf("编译 tag 失败: %w", err)
+		}
+	}
+	if compiled.field, err = compileMap(config.Field); err != nil {
+		return rule{}, fmt.Errorf("编译 field 失败: %w", err)
+	}
+	return compiled, nil
+}
+
+// compileMap 将名称到表达式的映射编译为一个返回 map[string]any 的程序
+func compileMap(expressions map[string]string) (*vm.Program, error) {
+	names := make([]string, 0, len(expressions))
+	for name := range expressions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]string, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, fmt.Sprintf("%q: (%s)", name, expressions[name]))
+	}
+	source := "{" + strings.Join(entries, ", ") + "}"
+	program, err := expr.Compile(source, BuildCalcExprOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("(source: %s): %w", source, err)
+	}
+	return program, nil
+}
+
+// ruleError 是规则执行失败的原因
+type ruleError struct {
+	rule string
+	err  error
+}
+
+func (e ruleError) Error() string {
+	return fmt.Sprintf("计算规则 %s 执行失败: %v", e.rule, e.err)
+}
+
+func (e ruleError) Unwrap() error {
+	return e.err
+}
+
+// Apply 使用空的最近值缓存对单个点包执行规则, 用于 shootone 等离线调试, 返回全部失败的原因
+func (r *Rules) Apply(pointPackage *pkg.PointPackage) []error {
+	var errs []error
+	for _, err := range r.apply(pointPackage, newCache(r.cacheSize, r.cacheTTL)) {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// apply 先以点包更新最近值缓存, 再按顺序执行规则, 结果直接写入点包
+// 单条规则执行失败只跳过该规则对当前点 (或点包) 的计算, 返回全部失败的原因
+func (r *Rules) apply(pointPackage *pkg.PointPackage, c *cache) []ruleError {
+	if len(r.rules) == 0 {
+		return nil
+	}
+	ts := pointPackage.Ts
+	for _, point := range pointPackage.Points {
+		if point != nil {
+			c.update(point, ts)
+		}
+	}
+
+	env := CEnv{
+		FrameId: pointPackage.FrameId,
+		Ts:      ts,
+		Last:    c.lastFunc(ts),
+		Values:  c.valuesFunc(ts),
+	}
+	var errs []ruleError
+	var index map[uint64]*pkg.Point // package 规则按标签查找目标点, 第一次使用时创建
+	for _, rule := range r.rules {
+		env.Points = pointPackage.Points
+		if rule.scope == ScopePoint {
+			for _, point := range pointPackage.Points {
+				if point == nil {
+					continue
+				}
+				env.Tag, env.Field = point.Tag, point.Field
+				matched, err := rule.match(env)
+				if err == nil && matched {
+					err = rule.run(env, point, c, ts)
+				}
+				if err != nil {
+					errs = append(errs, ruleError{rule: rule.name, err: err})
+				}
+			}
+			continue
+		}
+
+		env.Tag, env.Field = nil, nil
+		if index == nil {
+			index = make(map[uint64]*pkg.Point, len(pointPackage.Points))
+			for _, point := range pointPackage.Points {
+				if point != nil {
+					index[pkg.TagKey(point.Tag)] = point
+				}
+			}
+		}
+		matched, err := rule.match(env)
+		if err != nil {
+			errs = append(errs, ruleError{rule: rule.name, err: err})
+			continue
+		}
+		if !matched {
+			continue
+		}
+		tag, err := runMap(rule.tag, env)
+		if err != nil {
+			errs = append(errs, ruleError{rule: rule.name, err: err})
+			continue
+		}
+		key := pkg.TagKey(tag)
+		point, exists := index[key]
+		if !exists {
+			point = pkg.PointPoolInstance.Get()
+			for k, v := range tag {
+				point.Tag[k] = v
+			}
+		}
+		if err := rule.run(env, point, c, ts); err != nil {
+			errs = append(errs, ruleError{rule: rule.name, err: err})
+		}
+		if !exists {
+			if len(point.Field) == 0 {
+				// 没有计算出任何字段时不新建点
+				pkg.PointPoolInstance.Put(point)
+				continue
+			}
+			index[key] = point
+			pointPackage.Points = append(pointPackage.Points, point)
+		}
+	}
+	return errs
+}
+
+// run 计算字段, 将不为 nil 的结果写入 point 和最近值缓存
+func (r rule) run(env CEnv, point *pkg.Point, c *cache, ts time.Time) error {
+	fields, err := runMap(r.field, env)
+	if err != nil {
+		return err
+	}
+	for name, value := range fields {
+		if value == nil {
+			continue
+		}
+		point.Field[name] = value
+		c.set(point.Tag, name, value, ts)
+	}
+	return nil
+}
+
+// match 判断 when 条件是否成立, 未配置条件时总是成立
+func (r rule) match(env CEnv) (bool, error) {
+	if r.when == nil {
+		return true, nil
+	}
+	result, err := expr.Run(r.when, env)
+	if err != nil {
+		return false, err
+	}
+	matched, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("when 的结果不是布尔值: %v", result)
+	}
+	return matched, nil
+}
+
+func runMap(program *vm.Program, env CEnv) (map[string]any, error) {
+	result, err := expr.Run(program, env)
+	if err != nil {
+		return nil, err
+	}
+	return result.(map[string]any), nil
+}
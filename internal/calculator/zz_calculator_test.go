@@ -0,0 +1,152 @@
+package calculator
+
+import (
+	"context"
+	"gateway/internal/pkg"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+func TestRules(t *testing.T) {
+	base := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	car := func(id string, field map[string]any) *pkg.Point {
+		return &pkg.Point{Tag: map[string]any{"train": "T1", "car": id}, Field: field}
+	}
+	compile := func(rules ...pkg.CalculationRule) *Rules {
+		compiled, err := Compile(pkg.CalculationsConfig{Rules: rules, CacheTTL: time.Minute})
+		So(err, ShouldBeNil)
+		return compiled
+	}
+
+	Convey("point 规则为每个点计算派生字段", t, func() {
+		rules := compile(pkg.CalculationRule{
+			Name:  "power",
+			When:  `Field.voltage != nil && Field.current != nil`,
+			Field: map[string]string{"power": `Field.voltage * Field.current`, "label": `sprintf("%v-%v", Tag.train, Tag.car)`},
+		})
+		pointPackage := &pkg.PointPackage{FrameId: "F1", Ts: base, Points: []*pkg.Point{
+			car("1", map[string]any{"voltage": 750.0, "current": 2}),
+			car("2", map[string]any{"voltage": 750.0}),
+			nil,
+		}}
+		So(rules.apply(pointPackage, newCache(0, 0)), ShouldBeEmpty)
+		So(pointPackage.Points[0].Field, ShouldResemble, map[string]any{"voltage": 750.0, "current": 2, "power": 1500.0, "label": "T1-1"})
+		So(pointPackage.Points[1].Field, ShouldResemble, map[string]any{"voltage": 750.0})
+	})
+
+	Convey("package 规则结合最近值缓存计算跨设备的点", t, func() {
+		rules := compile(
+			pkg.CalculationRule{Name: "power", Field: map[string]string{"power": `(Field.voltage ?? 0) * (Field.current ?? 0)`}},
+			pkg.CalculationRule{
+				Name:  "train_total",
+				Scope: ScopePackage,
+				Tag:   map[string]string{"train": `"T1"`},
+				Field: map[string]string{
+					"power_total": `sum(values("power", {"train": "T1"}))`,
+					"car1_power":  `last({"train": "T1", "car": "1"}, "power")`,
+					"cars":        `len(Points)`,
+				},
+			},
+		)
+		values := newCache(0, time.Minute)
+
+		// 第一个点包只有 1 号车
+		first := &pkg.PointPackage{FrameId: "F1", Ts: base, Points: []*pkg.Point{car("1", map[string]any{"voltage": 10, "current": 2})}}
+		So(rules.apply(first, values), ShouldBeEmpty)
+		So(len(first.Points), ShouldEqual, 2)
+		So(first.Points[1].Tag, ShouldResemble, map[string]any{"train": "T1"})
+		So(first.Points[1].Field, ShouldResemble, map[string]any{"power_total": 20, "car1_power": 20, "cars": 1})
+
+		// 第二个点包只有 2 号车, 1 号车的值来自缓存
+		second := &pkg.PointPackage{FrameId: "F2", Ts: base.Add(time.Second), Points: []*pkg.Point{car("2", map[string]any{"voltage": 10, "current": 3})}}
+		So(rules.apply(second, values), ShouldBeEmpty)
+		So(second.Points[1].Field, ShouldResemble, map[string]any{"power_total": 50, "car1_power": 20, "cars": 1})
+
+		// 缓存的值过期后不再可见
+		third := &pkg.PointPackage{FrameId: "F3", Ts: base.Add(2 * time.Minute), Points: []*pkg.Point{car("2", map[string]any{"voltage": 10, "current": 1})}}
+		So(rules.apply(third, values), ShouldBeEmpty)
+		So(third.Points[1].Field, ShouldResemble, map[string]any{"power_total": 10, "cars": 1})
+
+		Convey("目标点已存在时追加字段", func() {
+			existing := &pkg.PointPackage{Ts: base.Add(2 * time.Minute), Points: []*pkg.Point{{Tag: map[string]any{"train": "T1"}, Field: map[string]any{"speed": 80}}}}
+			So(rules.apply(existing, values), ShouldBeEmpty)
+			So(len(existing.Points), ShouldEqual, 1)
+			So(existing.Points[0].Field["speed"], ShouldEqual, 80)
+			So(existing.Points[0].Field["power_total"], ShouldEqual, 10)
+		})
+	})
+
+	Convey("执行失败只跳过该规则, 其他规则继续执行", t, func() {
+		rules := compile(
+			pkg.CalculationRule{Name: "bad", Field: map[string]string{"ratio": `Field.a / Field.b`}},
+			pkg.CalculationRule{Name: "good", Field: map[string]string{"double": `Field.a * 2`}},
+		)
+		pointPackage := &pkg.PointPackage{Ts: base, Points: []*pkg.Point{car("1", map[string]any{"a": 4, "b": "x"})}}
+		errs := rules.apply(pointPackage, newCache(0, 0))
+		So(len(errs), ShouldEqual, 1)
+		So(errs[0].rule, ShouldEqual, "bad")
+		So(pointPackage.Points[0].Field["double"], ShouldEqual, 8)
+	})
+
+	Convey("缓存按点数上限淘汰最久未更新的点", t, func() {
+		values := newCache(2, 0)
+		for _, id := range []string{"1", "2", "1", "3"} {
+			values.update(car(id, map[string]any{"v": id}), base)
+		}
+		So(values.lru.Len(), ShouldEqual, 2)
+		So(values.valuesFunc(base)("v", map[string]any{"train": "T1"}), ShouldResemble, []any{"3", "1"})
+	})
+
+	Convey("配置校验", t, func() {
+		invalid := []pkg.CalculationRule{
+			{Field: map[string]string{"x": "1 +"}},
+			{Field: map[string]string{"x": "1"}, When: "1 + 1"},
+			{Field: map[string]string{"x": "1"}, Tag: map[string]string{"id": `"a"`}},
+			{Field: map[string]string{"x": "1"}, Scope: ScopePackage},
+			{Field: map[string]string{"x": "1"}, Scope: "frame"},
+			{},
+		}
+		for _, rule := range invalid {
+			_, err := Compile(pkg.CalculationsConfig{Rules: []pkg.CalculationRule{rule}})
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestCalculator(t *testing.T) {
+	Convey("计算阶段按规则处理后转发, 热加载后使用新规则", t, func() {
+		config := &pkg.Config{Calculations: pkg.CalculationsConfig{Rules: []pkg.CalculationRule{
+			{Field: map[string]string{"double": `Field.v * 2`}},
+		}}}
+		ctx, cancel := context.WithCancel(pkg.WithLogger(pkg.WithConfig(context.Background(), config), zap.NewNop()))
+		defer cancel()
+		calc, err := New(ctx)
+		So(err, ShouldBeNil)
+
+		source := make(pkg.Parser2DispatcherChan)
+		sink := make(pkg.Parser2DispatcherChan)
+		go calc.Start(&source, &sink)
+		send := func(v int) map[string]any {
+			source <- &pkg.PointPackage{Ts: time.Now(), Points: []*pkg.Point{{Tag: map[string]any{"id": "a"}, Field: map[string]any{"v": v}}}}
+			select {
+			case pointPackage := <-sink:
+				return pointPackage.Points[0].Field
+			case <-time.After(time.Second):
+				t.Fatal("等待计算结果超时")
+				return nil
+			}
+		}
+		So(send(2), ShouldResemble, map[string]any{"v": 2, "double": 4})
+
+		rules, err := Compile(pkg.CalculationsConfig{})
+		So(err, ShouldBeNil)
+		calc.Swap(rules)
+		So(send(3), ShouldResemble, map[string]any{"v": 3})
+
+		_, err = New(pkg.WithConfig(ctx, &pkg.Config{Calculations: pkg.CalculationsConfig{Rules: []pkg.CalculationRule{{}}}}))
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,45 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"gateway/internal/pkg"
+	"net"
+	"strconv"
+)
+
+// newConnInfo 根据远程地址和 ipAlias 生成连接信息, 返回的 bool 表示是否在 ipAlias 中找到别名
+// ipAlias 的键可以是 IP, 也可以是 IP:端口 (优先匹配), 未找到别名时以远程 IP 作为别名
+func newConnInfo(connectorType string, addr net.Addr, ipAlias map[string]string) (pkg.ConnInfo, bool, error) {
+	host, portStr, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return pkg.ConnInfo{}, false, fmt.Errorf("无法解析远程地址: %v", addr.String())
+	}
+	// 处理 IPv6 地址 "::1"，将其视为 "127.0.0.1"
+	if host == "::1" {
+		host = "127.0.0.1"
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	info := pkg.ConnInfo{
+		Connector:  connectorType,
+		Alias:      host,
+		RemoteIP:   host,
+		RemotePort: port,
+	}
+	alias, exists := ipAlias[net.JoinHostPort(host, portStr)]
+	if !exists {
+		alias, exists = ipAlias[host]
+	}
+	if exists {
+		info.Alias = alias
+	}
+	return info, exists, nil
+}
+
+// withConn 返回携带连接信息的 context, 解析器从中读取连接信息, 指标按设备 (别名) 区分
+func withConn(ctx context.Context, info pkg.ConnInfo) context.Context {
+	labels := pkg.MetricLabelsFromContext(ctx)
+	labels.Device = info.Alias
+	return pkg.WithConnInfo(pkg.WithMetricLabels(ctx, labels), info)
+}
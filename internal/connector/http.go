@@ -0,0 +1,305 @@
+package connector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gateway/internal/parser"
+	"gateway/internal/pkg"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"go.uber.org/zap"
+)
+
+const defaultMaxBodySize = 4 << 20
+
+// HttpConnector 是接收 HTTP 推送 (webhook/REST) 的 Template 实现
+// 请求体按 Content-Type 交给解析器: application/json 与 application/x-ndjson 交给 JParser,
+// application/octet-stream 交给 BParser, 解析结果同步返回给调用方
+type HttpConnector struct {
+	ctx    context.Context
+	config *httpConfig
+
+	jParser *parser.JParser    // 未配置 points/topics 时为 nil
+	bParser *parser.ByteParser // 未配置 protoFile 时为 nil
+	bMu     sync.Mutex         // ByteParser 的解析状态不能并发使用
+
+	sink     pkg.Parser2DispatcherChan
+	listener net.Listener
+}
+
+type httpConfig struct {
+	Url         string            `mapstructure:"url"`         // 监听地址
+	Path        string            `mapstructure:"path"`        // 接收数据的路径, 默认 /
+	Token       string            `mapstructure:"token"`       // (可选) Bearer Token, 配置后请求必须携带 Authorization 头
+	MaxBodySize int64             `mapstructure:"maxBodySize"` // 请求体最大字节数, 默认 4MB
+	IPAlias     map[string]string `mapstructure:"ipAlias"`     // 客户端ip别名, 作为设备ID
+}
+
+// httpResult 是返回给调用方的解析结果, 批量请求中每条消息的错误按下标给出
+type httpResult struct {
+	Accepted int         `json:"accepted"` // 解析成功的消息数
+	Points   int         `json:"points"`   // 生成的点数
+	Errors   []httpError `json:"errors,omitempty"`
+}
+
+type httpError struct {
+	Index int    `json:"index"` // 消息在请求中的下标 (NDJSON 为行号减一, 二进制为帧序号)
+	Error string `json:"error"`
+}
+
+func init() {
+	Register("http", NewHttpConnector)
+}
+
+// NewHttpConnector 创建并初始化 HttpConnector
+// parser.config 中配置了 points/topics 时接收 JSON, 配置了 protoFile 时接收二进制, 两者可以同时配置
+func NewHttpConnector(ctx context.Context) (Template, error) {
+	config := pkg.ConfigFromContext(ctx)
+
+	var httpConf httpConfig
+	if err := mapstructure.WeakDecode(config.Connector.Para, &httpConf); err != nil {
+		pkg.LoggerFromContext(ctx).Error("配置文件解析失败", zap.Error(err))
+		return nil, fmt.Errorf("配置文件解析失败: %s", err)
+	}
+	if httpConf.Url == "" {
+		return nil, errors.New("http 需要配置 url")
+	}
+	if httpConf.Path == "" {
+		httpConf.Path = "/"
+	}
+	if httpConf.MaxBodySize <= 0 {
+		httpConf.MaxBodySize = defaultMaxBodySize
+	}
+
+	h := &HttpConnector{ctx: ctx, config: &httpConf}
+	if _, ok := lookupPara(config.Parser.Para, "points", "topics"); ok {
+		jParser, err := parser.NewJsonParser(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("创建JSON解析器失败: %s", err)
+		}
+		h.jParser = jParser
+	}
+	if _, ok := lookupPara(config.Parser.Para, "protoFile"); ok {
+		bParser, err := parser.NewByteParser(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("创建字节解析器失败: %s", err)
+		}
+		h.bParser = bParser
+	}
+	if h.jParser == nil && h.bParser == nil {
+		return nil, errors.New("http 需要在 parser.config 中配置 points/topics (JSON) 或 protoFile (二进制)")
+	}
+	return h, nil
+}
+
+// lookupPara 返回第一个存在的键的值, 键不区分大小写
+func lookupPara(para map[string]interface{}, keys ...string) (interface{}, bool) {
+	for _, key := range keys {
+		for k, v := range para {
+			if strings.EqualFold(k, key) && v != nil {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Start 启动 HTTP 服务器, ctx 结束时关闭
+func (h *HttpConnector) Start(sink *pkg.Parser2DispatcherChan) error {
+	log := pkg.LoggerFromContext(h.ctx)
+	log.Info("===正在启动Connector: Http===", zap.String("url", h.config.Url), zap.String("path", h.config.Path))
+
+	listener, err := net.Listen("tcp", h.config.Url)
+	if err != nil {
+		return fmt.Errorf("监听地址失败: %s", err)
+	}
+	h.listener = listener
+	h.sink = *sink
+	// 登记 ByteParser, 热加载的协议定义在下一帧生效
+	unregister := func() {}
+	if h.bParser != nil {
+		unregister = h.bParser.Register()
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(h.config.Path, h.handle)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("HTTP 服务器异常退出", zap.Error(err))
+		}
+	}()
+	go func() {
+		<-h.ctx.Done()
+		defer unregister()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	return nil
+}
+
+// handle 处理一次推送请求
+func (h *HttpConnector) handle(w http.ResponseWriter, r *http.Request) {
+	metrics := pkg.GetPerformanceMetrics()
+	metrics.IncMsgReceived("http")
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "只支持 POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.authorized(r) {
+		metrics.IncMsgErrors("http_auth")
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "认证失败", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.config.MaxBodySize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "请求体过大", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "读取请求体失败", http.StatusBadRequest)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var result httpResult
+	switch {
+	case (mediaType == "application/json" || mediaType == "") && h.jParser != nil:
+		result = h.parseJson(r, [][]byte{body})
+	case (mediaType == "application/x-ndjson" || mediaType == "application/jsonl") && h.jParser != nil:
+		result = h.parseJson(r, splitLines(body))
+	case mediaType == "application/octet-stream" && h.bParser != nil:
+		result = h.parseBytes(r, body)
+	default:
+		metrics.IncMsgErrors("http_content_type")
+		http.Error(w, fmt.Sprintf("不支持的 Content-Type: %s", mediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// 全部消息都解析失败时返回 400, 部分失败时仍返回 200, 错误在响应体中给出
+	status := http.StatusOK
+	if result.Accepted == 0 && len(result.Errors) > 0 {
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// authorized 检查 Bearer Token, 未配置 token 时不做认证
+func (h *HttpConnector) authorized(r *http.Request) bool {
+	if h.config.Token == "" {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.config.Token)) == 1
+}
+
+// splitLines 按行拆分 NDJSON, 忽略空行, 返回的每一项为一条消息
+func splitLines(body []byte) [][]byte {
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(nil, len(body)+1)
+	for scanner.Scan() {
+		lines = append(lines, bytes.TrimSpace(scanner.Bytes()))
+	}
+	return lines
+}
+
+// parseJson 逐条解析 JSON 消息, 请求路径作为消息主题, 可以使用 JParser 的 topics 按路径选择点定义
+func (h *HttpConnector) parseJson(r *http.Request, messages [][]byte) httpResult {
+	var result httpResult
+	for i, message := range messages {
+		if len(message) == 0 {
+			continue
+		}
+		points, err := h.jParser.Parse(parser.Message{Topic: strings.TrimPrefix(r.URL.Path, "/"), Payload: message})
+		if err != nil {
+			result.Errors = append(result.Errors, httpError{Index: i, Error: err.Error()})
+			continue
+		}
+		result.Accepted++
+		result.Points += len(points)
+		if !h.send(r.Context(), points) {
+			break
+		}
+	}
+	return result
+}
+
+// parseBytes 依次解析请求体中连续的二进制帧, 遇到错误时停止
+func (h *HttpConnector) parseBytes(r *http.Request, body []byte) httpResult {
+	var result httpResult
+	info, _, err := newConnInfo("http", remoteAddr(r), h.config.IPAlias)
+	if err != nil {
+		info = pkg.ConnInfo{Connector: "http"}
+	}
+
+	h.bMu.Lock()
+	defer h.bMu.Unlock()
+	h.bParser.Env.Conn = info
+	for index := 0; len(body) > 0; index++ {
+		points, consumed, err := h.bParser.ParseBytes(body)
+		if err != nil {
+			result.Errors = append(result.Errors, httpError{Index: index, Error: err.Error()})
+			break
+		}
+		if consumed == 0 {
+			result.Errors = append(result.Errors, httpError{Index: index, Error: "协议未消耗任何字节"})
+			break
+		}
+		body = body[consumed:]
+		result.Accepted++
+		result.Points += len(points)
+		if !h.send(r.Context(), points) {
+			break
+		}
+	}
+	return result
+}
+
+// remoteAddr 返回请求的来源地址, 用于匹配 ipAlias
+func remoteAddr(r *http.Request) net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return addr
+}
+
+// send 将一条消息的点发送到下游, 请求被取消时返回 false
+func (h *HttpConnector) send(ctx context.Context, points []*pkg.Point) bool {
+	if len(points) == 0 {
+		return true
+	}
+	metrics := pkg.MetricsFromContext(h.ctx)
+	pointPackage := &pkg.PointPackage{
+		FrameId: fmt.Sprintf("%06X", metrics.IncMsgProcessed("http")),
+		Points:  points,
+		Ts:      time.Now(),
+	}
+	select {
+	case h.sink <- pointPackage:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,224 @@
+package connector
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"gateway/internal/parser"
+	"gateway/internal/pkg"
+	"net"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"go.uber.org/zap"
+)
+
+// Modbus 读功能码
+const (
+	modbusReadCoils            = 1 // 读线圈
+	modbusReadDiscreteInputs   = 2 // 读离散输入
+	modbusReadHoldingRegisters = 3 // 读保持寄存器
+	modbusReadInputRegisters   = 4 // 读输入寄存器
+)
+
+const (
+	defaultPollInterval = time.Second
+	// defaultFrameGap RTU 帧间静默时间, 标准为 3.5 个字符时间, 经串口服务器转发后抖动较大, 默认放宽
+	defaultFrameGap = 20 * time.Millisecond
+	// modbusFrameHeaderSize 交给 BParser 的帧头长度: unitId(1) function(1) address(2) count(2) byteCount(1)
+	modbusFrameHeaderSize = 7
+)
+
+// modbusConfig 是 modbustcp 与 modbusrtu 连接器共用的配置
+type modbusConfig struct {
+	Url            string            `mapstructure:"url"`            // 从站 (或串口服务器) 地址 host:port
+	Timeout        time.Duration     `mapstructure:"timeout"`        // 连接与单次请求的超时时间
+	ReconnectDelay time.Duration     `mapstructure:"reconnectDelay"` // 重连间隔
+	IPAlias        map[string]string `mapstructure:"ipAlias"`        // 从站ip别名, 作为设备ID
+	Polls          []modbusPoll      `mapstructure:"polls"`          // 轮询表
+	FrameGap       time.Duration     `mapstructure:"frameGap"`       // 仅 RTU: 帧间静默时间, 超过即认为响应结束
+}
+
+// decodeModbusConfig 解析并校验 connector.config, 设置默认值
+func decodeModbusConfig(ctx context.Context, connectorType string) (*modbusConfig, error) {
+	config := pkg.ConfigFromContext(ctx)
+
+	var modbusConfig modbusConfig
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           &modbusConfig,
+		TagName:          "mapstructure",
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true, // 允许 yaml 中以字符串书写数字
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建配置解码器失败: %s", err)
+	}
+	if err = decoder.Decode(config.Connector.Para); err != nil {
+		pkg.LoggerFromContext(ctx).Error("配置文件解析失败", zap.Error(err))
+		return nil, fmt.Errorf("配置文件解析失败: %s", err)
+	}
+
+	if modbusConfig.Url == "" {
+		return nil, fmt.Errorf("%s 需要配置 url", connectorType)
+	}
+	if len(modbusConfig.Polls) == 0 {
+		return nil, fmt.Errorf("%s 需要配置非空的 polls", connectorType)
+	}
+	for i := range modbusConfig.Polls {
+		if err = modbusConfig.Polls[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	if modbusConfig.Timeout <= 0 {
+		modbusConfig.Timeout = DefaultTimeout
+	}
+	if modbusConfig.ReconnectDelay <= 0 {
+		modbusConfig.ReconnectDelay = DefaultReconnectDelay
+	}
+	if modbusConfig.FrameGap <= 0 {
+		modbusConfig.FrameGap = defaultFrameGap
+	}
+	return &modbusConfig, nil
+}
+
+// startPolls 创建解析响应的 ByteParser, 并为每个轮询项启动一个轮询协程
+// read 负责一次完整的请求/响应, 由不同的传输方式 (TCP/RTU) 实现
+func startPolls(ctx context.Context, connectorType string, config *modbusConfig, read func(modbusPoll) ([]byte, error), sink pkg.Parser2DispatcherChan) error {
+	// 连接信息提供给解析器, 指标按设备区分
+	addr, err := net.ResolveTCPAddr("tcp", config.Url)
+	if err != nil {
+		return fmt.Errorf("解析从站地址失败: %s", err)
+	}
+	info, _, err := newConnInfo(connectorType, addr, config.IPAlias)
+	if err != nil {
+		return err
+	}
+	ctx = withConn(ctx, info)
+	byteParser, err := parser.NewByteParser(ctx)
+	if err != nil {
+		return fmt.Errorf("创建字节解析器失败: %s", err)
+	}
+
+	frames := make(chan []byte, 1024)
+	go func() {
+		// 每个响应都是完整的一帧, 解析失败时只丢弃出错的响应, 否则轮询协程会一直向无人消费的 frames 写入
+		for {
+			err := byteParser.StartWithChan(frames, sink)
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+			pkg.MetricsFromContext(ctx).IncMsgErrors("modbus")
+			pkg.LoggerFromContext(ctx).Warn("Modbus 响应解析失败, 丢弃该响应后继续解析", zap.String("connector", connectorType), zap.Error(err))
+		}
+	}()
+	for _, p := range config.Polls {
+		go runPoll(ctx, p, read, frames)
+	}
+	return nil
+}
+
+// modbusPoll 是轮询表中的一项, 按 Interval 周期读取一段连续的线圈或寄存器
+type modbusPoll struct {
+	UnitId   byte          `mapstructure:"unitId"`   // 从站地址
+	Function byte          `mapstructure:"function"` // 功能码 1/2/3/4
+	Address  uint16        `mapstructure:"address"`  // 起始地址 (从 0 开始)
+	Count    uint16        `mapstructure:"count"`    // 线圈/寄存器数量
+	Interval time.Duration `mapstructure:"interval"` // 轮询周期, 默认 1s
+}
+
+func (p modbusPoll) String() string {
+	return fmt.Sprintf("unit=%d fc=%d addr=%d count=%d", p.UnitId, p.Function, p.Address, p.Count)
+}
+
+// validate 检查功能码与数量, 并设置默认轮询周期
+func (p *modbusPoll) validate() error {
+	var maxCount uint16
+	switch p.Function {
+	case modbusReadCoils, modbusReadDiscreteInputs:
+		maxCount = 2000
+	case modbusReadHoldingRegisters, modbusReadInputRegisters:
+		maxCount = 125
+	default:
+		return fmt.Errorf("轮询项 %s: 不支持的功能码, 可选 1|2|3|4", p)
+	}
+	if p.Count == 0 || p.Count > maxCount {
+		return fmt.Errorf("轮询项 %s: count 必须在 1~%d 之间", p, maxCount)
+	}
+	if p.Interval <= 0 {
+		p.Interval = defaultPollInterval
+	}
+	return nil
+}
+
+// byteCount 返回正常响应中数据部分的字节数
+func (p modbusPoll) byteCount() int {
+	if p.Function == modbusReadCoils || p.Function == modbusReadDiscreteInputs {
+		return (int(p.Count) + 7) / 8
+	}
+	return int(p.Count) * 2
+}
+
+// pdu 返回读请求的 PDU: function(1) address(2) count(2)
+func (p modbusPoll) pdu() []byte {
+	pdu := make([]byte, 5)
+	pdu[0] = p.Function
+	binary.BigEndian.PutUint16(pdu[1:], p.Address)
+	binary.BigEndian.PutUint16(pdu[3:], p.Count)
+	return pdu
+}
+
+// frame 校验响应 PDU (function byteCount data...), 并生成交给 BParser 的帧:
+// unitId(1) function(1) address(2) count(2) byteCount(1) data(byteCount), 多字节字段均为大端
+// 响应中不包含起始地址和数量, 帧头补齐后协议文件可以按功能码和地址区分不同的轮询项
+func (p modbusPoll) frame(pdu []byte) ([]byte, error) {
+	if len(pdu) < 2 {
+		return nil, fmt.Errorf("轮询项 %s: 响应过短 (%d 字节)", p, len(pdu))
+	}
+	if pdu[0] == p.Function|0x80 {
+		return nil, fmt.Errorf("轮询项 %s: 从站返回异常码 %d", p, pdu[1])
+	}
+	if pdu[0] != p.Function {
+		return nil, fmt.Errorf("轮询项 %s: 响应功能码 %d 不匹配", p, pdu[0])
+	}
+	if int(pdu[1]) != p.byteCount() || len(pdu) != 2+p.byteCount() {
+		return nil, fmt.Errorf("轮询项 %s: 响应数据长度 %d 与请求不匹配, 期望 %d", p, len(pdu)-2, p.byteCount())
+	}
+	frame := make([]byte, modbusFrameHeaderSize+p.byteCount())
+	frame[0] = p.UnitId
+	frame[1] = p.Function
+	binary.BigEndian.PutUint16(frame[2:], p.Address)
+	binary.BigEndian.PutUint16(frame[4:], p.Count)
+	copy(frame[6:], pdu[1:])
+	return frame, nil
+}
+
+// runPoll 按轮询周期执行 read, 并将生成的帧写入 frames, 直到 ctx 结束
+// read 负责一次完整的请求/响应, 返回交给 BParser 的帧
+func runPoll(ctx context.Context, p modbusPoll, read func(modbusPoll) ([]byte, error), frames chan<- []byte) {
+	log := pkg.LoggerFromContext(ctx)
+	metrics := pkg.MetricsFromContext(ctx)
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+	for {
+		frame, err := read(p)
+		if err != nil {
+			metrics.IncErrorCount()
+			metrics.IncMsgErrors("modbus_poll")
+			log.Warn("Modbus 轮询失败", zap.Stringer("poll", p), zap.Error(err))
+		} else {
+			metrics.IncMsgReceived("modbus")
+			select {
+			case frames <- frame:
+			default:
+				log.Warn("Modbus 帧处理通道已满，丢弃数据", zap.Stringer("poll", p))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
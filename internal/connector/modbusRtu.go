@@ -0,0 +1,172 @@
+package connector
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"gateway/internal/pkg"
+	"gateway/internal/pkg/checksum"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// rtuBufferSize RTU 帧最长 256 字节, 缓冲区取 2 的幂
+const rtuBufferSize = 512
+
+// errRtuFrame 表示收到的响应帧无效 (校验失败或与请求不匹配), 不影响连接本身
+var errRtuFrame = errors.New("RTU 响应帧无效")
+
+// ModbusRtuConnector 通过串口服务器 (串口转 TCP 透传) 以 Modbus RTU 帧轮询从站
+// RTU 帧没有长度与事务号, 响应以帧间静默分隔, 通过从站地址、功能码、长度和 CRC 与请求匹配
+type ModbusRtuConnector struct {
+	ctx    context.Context
+	config *modbusConfig
+
+	mu     sync.Mutex // 串行总线上同一时刻只能有一个请求
+	conn   net.Conn
+	ring   *pkg.RingBuffer
+	broken chan struct{} // 通信失败时通知连接协程重连
+}
+
+func init() {
+	Register("modbusrtu", NewModbusRtuConnector)
+}
+
+// NewModbusRtuConnector 创建并初始化 ModbusRtuConnector
+func NewModbusRtuConnector(ctx context.Context) (Template, error) {
+	modbusConfig, err := decodeModbusConfig(ctx, "modbusrtu")
+	if err != nil {
+		return nil, err
+	}
+	return &ModbusRtuConnector{
+		ctx:    ctx,
+		config: modbusConfig,
+		broken: make(chan struct{}, 1),
+	}, nil
+}
+
+// Start 启动轮询协程, 并与 TcpClientConnector 相同, 断线后自动重连串口服务器
+func (m *ModbusRtuConnector) Start(sink *pkg.Parser2DispatcherChan) error {
+	pkg.LoggerFromContext(m.ctx).Info("===正在启动Connector: ModbusRtu===", zap.String("url", m.config.Url), zap.Int("polls", len(m.config.Polls)))
+	if err := startPolls(m.ctx, "modbusrtu", m.config, m.read, *sink); err != nil {
+		return err
+	}
+	go keepConnected(m.ctx, "modbusrtu", m.config.Url, m.config.Timeout, m.config.ReconnectDelay, m.serve)
+	return nil
+}
+
+// serve 将连接交给轮询协程使用, 直到通信失败或 ctx 结束
+func (m *ModbusRtuConnector) serve(conn net.Conn) error {
+	ring, err := pkg.NewRingBuffer(conn, rtuBufferSize)
+	if err != nil {
+		return fmt.Errorf("创建环形缓冲区失败: %w", err)
+	}
+	m.mu.Lock()
+	m.conn, m.ring = conn, ring
+	m.mu.Unlock()
+
+	select {
+	case <-m.ctx.Done():
+		m.mu.Lock()
+		m.conn, m.ring = nil, nil
+		m.mu.Unlock()
+		conn.Close()
+		return nil
+	case <-m.broken:
+		return errors.New("与串口服务器通信失败")
+	}
+}
+
+// read 发送一次读请求并等待响应
+// 从站无响应或响应帧无效时只丢弃本次结果, 读写连接出错时通知连接协程重连
+func (m *ModbusRtuConnector) read(p modbusPoll) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ring == nil {
+		return nil, fmt.Errorf("未连接到串口服务器 %s", m.config.Url)
+	}
+	pdu, err := m.transact(p)
+	if err != nil {
+		if !errors.Is(err, pkg.ErrFrameTimeout) && !errors.Is(err, errRtuFrame) {
+			m.conn, m.ring = nil, nil
+			select {
+			case m.broken <- struct{}{}:
+			default:
+			}
+		}
+		return nil, err
+	}
+	return p.frame(pdu)
+}
+
+// transact 在当前连接上完成一次 RTU 请求/响应, 返回响应 PDU
+func (m *ModbusRtuConnector) transact(p modbusPoll) ([]byte, error) {
+	// 丢弃上一次超时请求迟到的响应, 同时保证请求前总线至少静默一个帧间隔
+	if err := m.drain(); err != nil {
+		return nil, err
+	}
+
+	if err := m.conn.SetWriteDeadline(time.Now().Add(m.config.Timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := m.conn.Write(rtuRequest(p)); err != nil {
+		return nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+
+	// 正常响应: unitId(1) function(1) byteCount(1) data crc(2), 读满即返回, 异常响应较短, 由静默判断结束
+	resp := make([]byte, 5+p.byteCount())
+	n, err := m.ring.ReadFrame(resp, m.config.Timeout, m.config.FrameGap)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	return rtuResponsePdu(p, resp[:n])
+}
+
+// drain 丢弃缓冲区和连接上残留的数据, 直到连接静默超过 FrameGap
+// 上一个请求超时后从站仍可能应答, 不清理的话迟到的响应会被当作下一个请求的响应
+// 总线持续有数据时最多等待 Timeout, 之后照常发送请求, 由响应校验丢弃不匹配的帧
+func (m *ModbusRtuConnector) drain() error {
+	discarded := int(m.ring.Discard(m.ring.Len()))
+	buf := make([]byte, rtuBufferSize)
+	for deadline := time.Now().Add(m.config.Timeout); time.Now().Before(deadline); {
+		n, err := m.ring.ReadFrame(buf, m.config.FrameGap, m.config.FrameGap)
+		discarded += n
+		if errors.Is(err, pkg.ErrFrameTimeout) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("清理残留数据失败: %w", err)
+		}
+	}
+	if discarded > 0 {
+		pkg.MetricsFromContext(m.ctx).AddDiscardedBytes("modbusrtu", int64(discarded))
+		pkg.LoggerFromContext(m.ctx).Warn("丢弃总线上残留的数据", zap.Int("discarded", discarded))
+	}
+	return nil
+}
+
+// rtuRequest 生成读请求的 RTU 帧: unitId(1) PDU CRC(2, 小端)
+func rtuRequest(p modbusPoll) []byte {
+	adu := append([]byte{p.UnitId}, p.pdu()...)
+	return binary.LittleEndian.AppendUint16(adu, checksum.CRC16Modbus(adu))
+}
+
+// rtuResponsePdu 校验响应帧的 CRC 与从站地址, 返回 PDU, 功能码与长度由 modbusPoll.frame 校验
+func rtuResponsePdu(p modbusPoll, frame []byte) ([]byte, error) {
+	n := len(frame)
+	if n < 5 {
+		return nil, fmt.Errorf("%w: 轮询项 %s 响应过短 (%d 字节)", errRtuFrame, p, n)
+	}
+	if crc := checksum.CRC16Modbus(frame[:n-2]); crc != binary.LittleEndian.Uint16(frame[n-2:]) {
+		return nil, fmt.Errorf("%w: 轮询项 %s CRC 校验失败", errRtuFrame, p)
+	}
+	if frame[0] != p.UnitId {
+		return nil, fmt.Errorf("%w: 轮询项 %s 响应从站地址 %d 不匹配", errRtuFrame, p, frame[0])
+	}
+	return frame[1 : n-2], nil
+}
@@ -0,0 +1,126 @@
+package connector
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"gateway/internal/pkg"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// mbapHeaderSize Modbus TCP 报文头长度: transactionId(2) protocolId(2) length(2) unitId(1)
+const mbapHeaderSize = 7
+
+// ModbusTcpConnector 是 Modbus TCP 主站, 按轮询表周期读取从站
+// 响应整理成帧 (见 modbusPoll.frame) 后交给 BParser, 寄存器表同样使用协议文件描述
+type ModbusTcpConnector struct {
+	ctx    context.Context
+	config *modbusConfig
+
+	mu       sync.Mutex // 同一连接上的请求串行执行
+	conn     net.Conn
+	transId  uint16
+	nextDial time.Time // 连接失败后, 在此之前不再重连
+}
+
+func init() {
+	Register("modbustcp", NewModbusTcpConnector)
+}
+
+// NewModbusTcpConnector 创建并初始化 ModbusTcpConnector
+func NewModbusTcpConnector(ctx context.Context) (Template, error) {
+	modbusConfig, err := decodeModbusConfig(ctx, "modbustcp")
+	if err != nil {
+		return nil, err
+	}
+	return &ModbusTcpConnector{
+		ctx:    ctx,
+		config: modbusConfig,
+	}, nil
+}
+
+// Start 为每个轮询项启动一个轮询协程, 所有响应由同一个 ByteParser 解析
+func (m *ModbusTcpConnector) Start(sink *pkg.Parser2DispatcherChan) error {
+	pkg.LoggerFromContext(m.ctx).Info("===正在启动Connector: ModbusTcp===", zap.String("url", m.config.Url), zap.Int("polls", len(m.config.Polls)))
+	return startPolls(m.ctx, "modbustcp", m.config, m.read, *sink)
+}
+
+// read 发送一次读请求并等待响应, 通信失败时关闭连接, 下一次请求重新连接
+func (m *ModbusTcpConnector) read(p modbusPoll) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.connect(); err != nil {
+		return nil, err
+	}
+	pdu, err := m.transact(p.UnitId, p.pdu())
+	if err != nil {
+		m.conn.Close()
+		m.conn = nil
+		return nil, err
+	}
+	return p.frame(pdu)
+}
+
+// connect 在没有可用连接时连接从站, 两次连接之间至少间隔 ReconnectDelay
+func (m *ModbusTcpConnector) connect() error {
+	if m.conn != nil {
+		return nil
+	}
+	if time.Now().Before(m.nextDial) {
+		return fmt.Errorf("等待重连从站 %s", m.config.Url)
+	}
+	conn, err := net.DialTimeout("tcp", m.config.Url, m.config.Timeout)
+	if err != nil {
+		m.nextDial = time.Now().Add(m.config.ReconnectDelay)
+		pkg.MetricsFromContext(m.ctx).IncMsgErrors("modbustcp_connect")
+		return fmt.Errorf("连接从站失败: %w", err)
+	}
+	pkg.LoggerFromContext(m.ctx).Info("成功连接到Modbus从站", zap.String("url", m.config.Url))
+	m.conn = conn
+	return nil
+}
+
+// transact 在当前连接上完成一次 MBAP 请求/响应, 返回响应 PDU
+func (m *ModbusTcpConnector) transact(unitId byte, pdu []byte) ([]byte, error) {
+	m.transId++
+	req := make([]byte, mbapHeaderSize+len(pdu))
+	binary.BigEndian.PutUint16(req[0:], m.transId)
+	binary.BigEndian.PutUint16(req[2:], 0) // 协议标识 0 表示 Modbus
+	binary.BigEndian.PutUint16(req[4:], uint16(len(pdu)+1))
+	req[6] = unitId
+	copy(req[mbapHeaderSize:], pdu)
+
+	if err := m.conn.SetDeadline(time.Now().Add(m.config.Timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := m.conn.Write(req); err != nil {
+		return nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+
+	header := make([]byte, mbapHeaderSize)
+	if _, err := io.ReadFull(m.conn, header); err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	length := int(binary.BigEndian.Uint16(header[4:]))
+	if length < 2 || length > 254 {
+		return nil, fmt.Errorf("响应长度 %d 无效", length)
+	}
+	resp := make([]byte, length-1)
+	if _, err := io.ReadFull(m.conn, resp); err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	// 事务号不一致说明连接上残留了超时请求的响应, 关闭连接重新同步
+	if id := binary.BigEndian.Uint16(header[0:]); id != m.transId {
+		return nil, fmt.Errorf("响应事务号 %d 与请求 %d 不匹配", id, m.transId)
+	}
+	if header[6] != unitId {
+		return nil, fmt.Errorf("响应从站地址 %d 与请求 %d 不匹配", header[6], unitId)
+	}
+	return resp, nil
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"gateway/internal/parser"
 	"gateway/internal/pkg"
+	"hash/fnv"
+	"strings"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -27,16 +29,36 @@ type MqttConfig struct {
 	Username             string          `mapstructure:"username"`
 	Password             string          `mapstructure:"password"`
 	MaxReconnectInterval time.Duration   `mapstructure:"maxReconnectInterval"`
-	Topics               map[string]byte `mapstructure:"topics"` // 主题和 QoS 的 map
+	Topics               map[string]byte `mapstructure:"topics"`     // 主题和 QoS 的 map
+	ParserType           string          `mapstructure:"parserType"` // 报文解析方式: json (默认, JParser) | bytes (BParser)
+	Workers              int             `mapstructure:"workers"`    // bytes 模式下的工作协程数, 默认 4
 }
 
+const (
+	mqttParserJson  = "json"
+	mqttParserBytes = "bytes"
+
+	defaultMqttWorkers = 4
+)
+
 // MqttConnector Connector的Mqtt版本实现
+// json 模式下所有消息交给同一个 JParser;
+// bytes 模式下消息按主题哈希分配给固定数量的 ByteParser 工作协程, 主题即数据源
 type MqttConnector struct {
 	ctx      context.Context
 	config   *MqttConfig
 	Client   MQTTClient // MQTT 客户端
-	tempChan chan []byte
+	tempChan chan parser.Message
 	parser   *parser.JParser
+
+	sink    pkg.Parser2DispatcherChan
+	workers []*mqttWorker // bytes 模式下的工作协程, 数量固定, 不随主题增长
+}
+
+// mqttWorker 是 bytes 模式下的一个工作协程, 独占一个 ByteParser
+type mqttWorker struct {
+	messages chan parser.Message
+	parser   *parser.ByteParser
 }
 
 func init() {
@@ -51,6 +73,12 @@ func (m *MqttConnector) Start(sink *pkg.Parser2DispatcherChan) error {
 	logger := pkg.LoggerFromContext(m.ctx)
 	metrics := pkg.GetPerformanceMetrics() // 获取性能指标实例
 
+	// bytes 模式的工作协程需要在订阅前启动
+	m.sink = *sink
+	for _, w := range m.workers {
+		go m.startWorker(w)
+	}
+
 	// 检查客户端是否已经连接
 	if token := m.Client.Connect(); token.Wait() && token.Error() != nil {
 		metrics.IncErrorCount()
@@ -70,7 +98,9 @@ func (m *MqttConnector) Start(sink *pkg.Parser2DispatcherChan) error {
 	// 持续运行监听消息
 	logger.Info("MQTT订阅成功，正在监听消息")
 
-	go m.parser.Start(m.tempChan, *sink)
+	if m.parser != nil {
+		go m.parser.Start(m.tempChan, *sink)
+	}
 	return nil
 }
 
@@ -106,16 +136,37 @@ func NewMqttConnector(ctx context.Context) (Template, error) {
 		return nil, fmt.Errorf("配置文件解析失败: %s", err)
 	}
 
-	parser, err := parser.NewJsonParser(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("创建JSON解析器失败: %s", err)
-	}
 	// 2. 创建 MQTT Template 实例
 	mqttConnector := &MqttConnector{
 		ctx:      ctx,
 		config:   &mqttConfig,
-		tempChan: make(chan []byte, 100),
-		parser:   parser,
+		tempChan: make(chan parser.Message, 100),
+	}
+	switch strings.ToLower(mqttConfig.ParserType) {
+	case "", mqttParserJson:
+		mqttConfig.ParserType = mqttParserJson
+		jParser, err := parser.NewJsonParser(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("创建JSON解析器失败: %s", err)
+		}
+		mqttConnector.parser = jParser
+	case mqttParserBytes:
+		mqttConfig.ParserType = mqttParserBytes
+		if mqttConfig.Workers <= 0 {
+			mqttConfig.Workers = defaultMqttWorkers
+		}
+		for i := 0; i < mqttConfig.Workers; i++ {
+			bParser, err := parser.NewByteParser(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("创建字节解析器失败: %s", err)
+			}
+			mqttConnector.workers = append(mqttConnector.workers, &mqttWorker{
+				messages: make(chan parser.Message, 1024),
+				parser:   bParser,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("不支持的 parserType: %s, 可选 json|bytes", mqttConfig.ParserType)
 	}
 
 	// 3. 创建一个新的 MQTT 客户端
@@ -145,11 +196,20 @@ func (m *MqttConnector) messagePubHandler(_ mqtt.Client, msg mqtt.Message) {
 	// 记录接收到的消息
 	metrics.IncMsgReceived("mqtt")
 
-	logger.Info("Received message", zap.String("payload", string(msg.Payload())), zap.String("topic", msg.Topic()))
-	select {
-	case m.tempChan <- msg.Payload():
-	default:
-		logger.Warn("MQTT消息处理通道已满，丢弃消息")
+	if m.config.ParserType == mqttParserBytes {
+		logger.Info("Received message", zap.Int("len", len(msg.Payload())), zap.String("topic", msg.Topic()))
+		select {
+		case m.workerOf(msg.Topic()).messages <- parser.Message{Topic: msg.Topic(), Payload: msg.Payload()}:
+		default:
+			logger.Warn("MQTT主题处理通道已满，丢弃消息", zap.String("topic", msg.Topic()))
+		}
+	} else {
+		logger.Info("Received message", zap.String("payload", string(msg.Payload())), zap.String("topic", msg.Topic()))
+		select {
+		case m.tempChan <- parser.Message{Topic: msg.Topic(), Payload: msg.Payload()}:
+		default:
+			logger.Warn("MQTT消息处理通道已满，丢弃消息")
+		}
 	}
 
 	// 记录成功处理的消息
@@ -159,6 +219,51 @@ func (m *MqttConnector) messagePubHandler(_ mqtt.Client, msg mqtt.Message) {
 		zap.String("topic", msg.Topic()))
 }
 
+// workerOf 按主题的哈希选择工作协程, 同一主题的报文总是由同一个协程按顺序解析
+func (m *MqttConnector) workerOf(topic string) *mqttWorker {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(topic))
+	return m.workers[h.Sum32()%uint32(len(m.workers))]
+}
+
+// startWorker 启动一个工作协程, 使用自己的 ByteParser 依次解析分配到的报文
+func (m *MqttConnector) startWorker(w *mqttWorker) {
+	defer w.parser.Register()()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case msg := <-w.messages:
+			m.parseMessage(w.parser, msg)
+		}
+	}
+}
+
+// parseMessage 解析一条二进制报文并发送到下游
+// 每条报文都是完整的一帧, 解析失败时只丢弃出错的报文
+func (m *MqttConnector) parseMessage(p *parser.ByteParser, msg parser.Message) {
+	log := pkg.LoggerFromContext(m.ctx)
+	// 主题作为数据源的别名, 表达式中通过 Conn.Topic 引用
+	info := pkg.ConnInfo{Connector: "mqtt", Alias: msg.Topic, Topic: msg.Topic}
+	metrics := pkg.MetricsFromContext(withConn(m.ctx, info))
+	p.Env.Conn = info
+	points, _, err := p.ParseBytes(msg.Payload)
+	if err != nil {
+		metrics.IncMsgErrors("mqtt")
+		log.Warn("MQTT主题报文解析失败, 丢弃该报文", zap.String("topic", msg.Topic), zap.Error(err))
+		return
+	}
+	pointPackage := &pkg.PointPackage{
+		FrameId: fmt.Sprintf("%06X", metrics.IncMsgProcessed("byteParser")),
+		Points:  points,
+		Ts:      time.Now(),
+	}
+	select {
+	case m.sink <- pointPackage:
+	case <-m.ctx.Done():
+	}
+}
+
 // 连接成功回调
 func (m *MqttConnector) connectHandler(client mqtt.Client) {
 	logger := pkg.LoggerFromContext(m.ctx)
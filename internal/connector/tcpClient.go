@@ -21,10 +21,11 @@ type TcpClientConnector struct {
 }
 
 type tcpClientConfig struct {
-	ServerAddrs    []string      `mapstructure:"serverAddrs"`    // 服务器地址列表
-	Timeout        time.Duration `mapstructure:"timeout"`        // 超时时间
-	ReconnectDelay time.Duration `mapstructure:"reconnectDelay"` // 重连间隔
-	BufferSize     int           `mapstructure:"bufferSize"`     // 环形缓冲区大小
+	ServerAddrs    []string          `mapstructure:"serverAddrs"`    // 服务器地址列表
+	Timeout        time.Duration     `mapstructure:"timeout"`        // 超时时间
+	ReconnectDelay time.Duration     `mapstructure:"reconnectDelay"` // 重连间隔
+	BufferSize     int               `mapstructure:"bufferSize"`     // 环形缓冲区大小
+	IPAlias        map[string]string `mapstructure:"ipAlias"`        // 服务器ip别名, 作为设备ID
 }
 
 // init 函数注册 TcpClientConnector
@@ -111,60 +112,68 @@ func (t *TcpClientConnector) Start(sink *pkg.Parser2DispatcherChan) error {
 
 // handleConnection 处理对单个服务器的连接，包括重连逻辑
 func (t *TcpClientConnector) handleConnection(serverAddr string, sink pkg.Parser2DispatcherChan) error {
-	log := pkg.LoggerFromContext(t.ctx)
-	metrics := pkg.GetPerformanceMetrics() // 获取性能指标实例
+	return keepConnected(t.ctx, "tcpclient", serverAddr, t.clientConfig.Timeout, t.clientConfig.ReconnectDelay, func(conn net.Conn) error {
+		// 1. 设置连接超时时间
+		if err := conn.SetReadDeadline(time.Now().Add(t.clientConfig.Timeout)); err != nil {
+			pkg.GetPerformanceMetrics().IncMsgErrors("tcpclient_timeout")
+			return fmt.Errorf("设置连接超时失败: %w", err)
+		}
 
-	for {
-		// 1. 尝试连接到服务器
-		conn, err := net.DialTimeout("tcp", serverAddr, t.clientConfig.Timeout)
+		// 2. 创建环形缓冲区
+		ringBuffer, err := pkg.NewRingBuffer(conn, uint32(t.clientConfig.BufferSize))
 		if err != nil {
-			metrics.IncErrorCount()
-			metrics.IncMsgErrors("tcpclient_connect")
-			log.Warn(fmt.Sprintf("无法连接到服务器，%s 后重试", t.clientConfig.ReconnectDelay), zap.String("serverAddr", serverAddr), zap.Error(err))
-			time.Sleep(t.clientConfig.ReconnectDelay)
-			continue
+			return fmt.Errorf("创建环形缓冲区失败: %w", err)
 		}
 
-		// 2. 设置连接超时时间
-		if err = conn.SetReadDeadline(time.Now().Add(t.clientConfig.Timeout)); err != nil {
-			metrics.IncErrorCount()
-			metrics.IncMsgErrors("tcpclient_timeout")
-			log.Error("设置连接超时失败", zap.String("serverAddr", serverAddr), zap.Error(err))
-			conn.Close()
-			time.Sleep(t.clientConfig.ReconnectDelay)
-			continue
+		// 3. 创建字节解析器, 连接信息提供给解析器, 指标按设备区分
+		info, _, err := newConnInfo("tcpclient", conn.RemoteAddr(), t.clientConfig.IPAlias)
+		if err != nil {
+			return fmt.Errorf("解析服务器地址失败: %w", err)
 		}
-
-		log.Info("成功连接到服务器", zap.String("serverAddr", serverAddr))
-
-		// 3. 创建环形缓冲区
-		ringBuffer, err := pkg.NewRingBuffer(conn, uint32(t.clientConfig.BufferSize))
+		byteParser, err := parser.NewByteParser(withConn(t.ctx, info))
 		if err != nil {
-			log.Error("创建环形缓冲区失败", zap.Error(err))
-			conn.Close()
-			time.Sleep(t.clientConfig.ReconnectDelay)
-			continue
+			return fmt.Errorf("创建字节解析器失败: %w", err)
 		}
 
-		// 4. 创建字节解析器
-		byteParser, err := parser.NewByteParser(t.ctx)
-		if err != nil {
-			log.Error("创建字节解析器失败", zap.Error(err))
-			conn.Close()
-			time.Sleep(t.clientConfig.ReconnectDelay)
-			continue
+		// 4. 启动解析器处理数据, 该方法会阻塞，直到连接断开
+		if err = byteParser.StartWithRingBuffer(ringBuffer, sink); err != nil {
+			return fmt.Errorf("启动字节解析器失败: %w", err)
 		}
+		return nil
+	})
+}
 
-		// 5. 启动解析器处理数据, 该方法会阻塞，直到连接断开
-		err = byteParser.StartWithRingBuffer(ringBuffer, sink)
+// keepConnected 连接到服务器并交给 handle 处理, 包括重连逻辑
+// 连接失败或 handle 返回错误时关闭连接, 间隔 reconnectDelay 后重连;
+// handle 返回 nil 或 ctx 结束时退出, component 用于区分日志与指标
+func keepConnected(ctx context.Context, component, serverAddr string, timeout, reconnectDelay time.Duration, handle func(conn net.Conn) error) error {
+	log := pkg.LoggerFromContext(ctx)
+	metrics := pkg.GetPerformanceMetrics() // 获取性能指标实例
+
+	for {
+		// 1. 尝试连接到服务器
+		conn, err := net.DialTimeout("tcp", serverAddr, timeout)
 		if err != nil {
-			log.Error("启动字节解析器失败", zap.Error(err))
+			metrics.IncErrorCount()
+			metrics.IncMsgErrors(component + "_connect")
+			log.Warn(fmt.Sprintf("无法连接到服务器，%s 后重试", reconnectDelay), zap.String("serverAddr", serverAddr), zap.Error(err))
+		} else {
+			log.Info("成功连接到服务器", zap.String("serverAddr", serverAddr))
+
+			// 2. 处理连接, 只有 handle 正常返回时才会退出循环
+			if err = handle(conn); err == nil {
+				return nil
+			}
+			metrics.IncErrorCount()
+			log.Error("处理连接失败，准备重连", zap.String("component", component), zap.String("serverAddr", serverAddr), zap.Error(err))
 			conn.Close()
-			time.Sleep(t.clientConfig.ReconnectDelay)
-			continue
 		}
-		// 6. 只有.done() 方法被调用时，才会退出循环
-		return nil
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reconnectDelay):
+		}
 	}
 }
 
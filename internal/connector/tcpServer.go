@@ -124,7 +124,7 @@ func (t *TcpServerConnector) Start(sink *pkg.Parser2DispatcherChan) error {
 			connID := conn.RemoteAddr().String()
 			// 不在这里关闭连接，让下层代码（例如读取操作完毕后）来管理关闭
 			log.Info("建立连接", zap.String("remote", conn.RemoteAddr().String()))
-			err = t.initConn(conn)
+			info, err := t.initConn(conn)
 			if err != nil {
 				log.Error("初始化连接失败，关闭连接", zap.String("remote", conn.RemoteAddr().String()), zap.Error(err))
 				err = conn.Close()
@@ -135,7 +135,7 @@ func (t *TcpServerConnector) Start(sink *pkg.Parser2DispatcherChan) error {
 			}
 
 			go func() {
-				err := t.handleConn(conn, connID, *sink)
+				err := t.handleConn(conn, connID, info, *sink)
 				if err != nil {
 					log.Error("处理连接失败", zap.Error(err))
 					conn.Close()
@@ -146,7 +146,7 @@ func (t *TcpServerConnector) Start(sink *pkg.Parser2DispatcherChan) error {
 	return nil
 }
 
-func (t *TcpServerConnector) handleConn(conn net.Conn, connID string, sink pkg.Parser2DispatcherChan) error {
+func (t *TcpServerConnector) handleConn(conn net.Conn, connID string, info pkg.ConnInfo, sink pkg.Parser2DispatcherChan) error {
 	log := pkg.LoggerFromContext(t.ctx)
 	// 从 TCP 连接读取数据
 	n, err := pkg.NewRingBuffer(conn, uint32(t.serverConfig.BufferSize))
@@ -154,7 +154,8 @@ func (t *TcpServerConnector) handleConn(conn net.Conn, connID string, sink pkg.P
 		log.Error("创建环形缓冲区失败", zap.Error(err))
 	}
 	// 创建字节解析器
-	byteParser, err := parser.NewByteParser(t.ctx)
+	// 连接信息提供给解析器, 指标按设备区分
+	byteParser, err := parser.NewByteParser(withConn(t.ctx, info))
 	if err != nil {
 		log.Error("创建字节解析器失败", zap.Error(err))
 	}
@@ -166,45 +167,31 @@ func (t *TcpServerConnector) handleConn(conn net.Conn, connID string, sink pkg.P
 	return nil
 }
 
-func (t *TcpServerConnector) initConn(conn net.Conn) error {
+// initConn 校验连接并返回连接信息, 其中 Alias 即设备ID
+func (t *TcpServerConnector) initConn(conn net.Conn) (pkg.ConnInfo, error) {
 	log := pkg.LoggerFromContext(t.ctx)
 	// 不要在这里关闭连接，让上层代码（例如读取操作完毕后）来管理关闭！！
-	// 1. 获取远程地址
-	remoteAddrWithPort := conn.RemoteAddr().String()
-	remoteAddr, _, err := net.SplitHostPort(remoteAddrWithPort)
+	// 1. 解析远程地址, 处理 IP 别名，无论白名单是否开启，都会影响 deviceId
+	info, aliased, err := newConnInfo("tcpserver", conn.RemoteAddr(), t.serverConfig.IPAlias)
 	if err != nil {
-		return fmt.Errorf("无法解析远程地址: %v", remoteAddrWithPort)
+		return pkg.ConnInfo{}, err
 	}
-
-	// 处理 IPv6 地址 "::1"，将其视为 "127.0.0.1"
-	if remoteAddr == "::1" {
-		remoteAddr = "127.0.0.1"
-	}
-
-	// 2. 初始化设备ID
-	var deviceId string
-
-	// 2.1 处理 IP 别名，无论白名单是否开启，都会影响 deviceId
-	if alias, exists := t.serverConfig.IPAlias[remoteAddr]; exists {
-		deviceId = alias
-		log.Info("已找到 IP 别名", zap.String("remote", remoteAddr), zap.String("deviceId", deviceId))
+	if aliased {
+		log.Info("已找到 IP 别名", zap.String("remote", info.RemoteIP), zap.String("deviceId", info.Alias))
 	} else {
 		// 如果没有匹配到别名，使用默认 IP 地址作为 deviceId
-		deviceId = remoteAddr
-		log.Info("IP 别名未找到，使用默认 deviceId", zap.String("remote", remoteAddr), zap.String("deviceId", deviceId))
+		log.Info("IP 别名未找到，使用默认 deviceId", zap.String("remote", info.RemoteIP), zap.String("deviceId", info.Alias))
 	}
 
-	// 2.2 检查白名单逻辑，如果白名单启用且没有在 ipAlias 中找到匹配，则拒绝连接
-	if t.serverConfig.WhiteList {
-		if _, exists := t.serverConfig.IPAlias[remoteAddr]; !exists {
-			log.Warn("白名单启用，拒绝未在白名单中的连接", zap.String("remote", remoteAddr))
-			return fmt.Errorf("白名单启用，拒绝连接: %s", remoteAddr)
-		}
+	// 2. 检查白名单逻辑，如果白名单启用且没有在 ipAlias 中找到匹配，则拒绝连接
+	if t.serverConfig.WhiteList && !aliased {
+		log.Warn("白名单启用，拒绝未在白名单中的连接", zap.String("remote", info.RemoteIP))
+		return pkg.ConnInfo{}, fmt.Errorf("白名单启用，拒绝连接: %s", info.RemoteIP)
 	}
 	// 3. 设置超时时间
 	if err = conn.SetReadDeadline(time.Now().Add(t.serverConfig.Timeout)); err != nil {
-		return fmt.Errorf("设置超时时间失败 %s", conn.RemoteAddr().String())
+		return pkg.ConnInfo{}, fmt.Errorf("设置超时时间失败 %s", conn.RemoteAddr().String())
 	}
 
-	return nil
+	return info, nil
 }
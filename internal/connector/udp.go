@@ -155,15 +155,20 @@ func (u *UdpConnector) handleConnection(conn *net.UDPConn, sink pkg.Parser2Dispa
 				continue
 			}
 
-			// 2.2 处理白名单
+			// 2.2 处理白名单, ipAlias 的键可以是 IP 或 IP:端口
 			addrStr := ddr.String()
-			if u.config.WhiteList {
-				if _, exists := u.config.IPAlias[addrStr]; !exists {
-					metrics.IncMsgErrors("udp_whitelist")
-					log.Warn("白名单启用，拒绝未在白名单中的连接", zap.String("remote", addrStr))
-					pkg.BytesPoolInstance.Put(buffer) // 释放缓冲区
-					continue
-				}
+			info, aliased, err := newConnInfo("udp", ddr, u.config.IPAlias)
+			if err != nil {
+				metrics.IncMsgErrors("udp")
+				log.Error("解析数据源地址失败", zap.Error(err))
+				pkg.BytesPoolInstance.Put(buffer) // 释放缓冲区
+				continue
+			}
+			if u.config.WhiteList && !aliased {
+				metrics.IncMsgErrors("udp_whitelist")
+				log.Warn("白名单启用，拒绝未在白名单中的连接", zap.String("remote", addrStr))
+				pkg.BytesPoolInstance.Put(buffer) // 释放缓冲区
+				continue
 			}
 
 			// 2.3 处理数据源
@@ -175,7 +180,7 @@ func (u *UdpConnector) handleConnection(conn *net.UDPConn, sink pkg.Parser2Dispa
 				u.workersMap[addrStr] = dataSource
 
 				// 为每个数据源启动一个专用的worker
-				go u.startWorker(addrStr, dataSource, sink)
+				go u.startWorker(info, dataSource, sink)
 			}
 
 			// 2.4 将接收到的数据全部写入到channel中
@@ -198,11 +203,12 @@ func (u *UdpConnector) handleConnection(conn *net.UDPConn, sink pkg.Parser2Dispa
 }
 
 // startWorker 启动一个工作协程来处理特定数据源的数据
-func (u *UdpConnector) startWorker(addrStr string, dataChan chan []byte, sink pkg.Parser2DispatcherChan) {
+func (u *UdpConnector) startWorker(info pkg.ConnInfo, dataChan chan []byte, sink pkg.Parser2DispatcherChan) {
 	log := pkg.LoggerFromContext(u.ctx)
 
-	log.Info("启动UDP数据源工作协程", zap.String("addr", addrStr))
-	parser, err := parser.NewByteParser(u.ctx)
+	log.Info("启动UDP数据源工作协程", zap.String("remote", info.RemoteIP), zap.Int("port", info.RemotePort), zap.String("deviceId", info.Alias))
+	// 连接信息提供给解析器, 指标按设备区分
+	parser, err := parser.NewByteParser(withConn(u.ctx, info))
 	if err != nil {
 		log.Error("创建字节解析器失败", zap.Error(err))
 		return
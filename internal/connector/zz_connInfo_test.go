@@ -0,0 +1,49 @@
+package connector
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewConnInfo(t *testing.T) {
+	aliases := map[string]string{
+		"172.25.3.108":       "ER2_1_1_1",
+		"172.25.3.109:50000": "ER2_1_5_1",
+		"127.0.0.1":          "local",
+	}
+
+	Convey("按 IP 匹配别名", t, func() {
+		info, aliased, err := newConnInfo("tcpserver", &net.TCPAddr{IP: net.ParseIP("172.25.3.108"), Port: 40000}, aliases)
+		So(err, ShouldBeNil)
+		So(aliased, ShouldBeTrue)
+		So(info.Alias, ShouldEqual, "ER2_1_1_1")
+		So(info.RemoteIP, ShouldEqual, "172.25.3.108")
+		So(info.RemotePort, ShouldEqual, 40000)
+		So(info.Connector, ShouldEqual, "tcpserver")
+	})
+
+	Convey("IP:端口 优先于 IP", t, func() {
+		info, aliased, err := newConnInfo("udp", &net.UDPAddr{IP: net.ParseIP("172.25.3.109"), Port: 50000}, aliases)
+		So(err, ShouldBeNil)
+		So(aliased, ShouldBeTrue)
+		So(info.Alias, ShouldEqual, "ER2_1_5_1")
+
+		_, aliased, err = newConnInfo("udp", &net.UDPAddr{IP: net.ParseIP("172.25.3.109"), Port: 50001}, aliases)
+		So(err, ShouldBeNil)
+		So(aliased, ShouldBeFalse)
+	})
+
+	Convey("未找到别名时使用远程 IP, ::1 视为 127.0.0.1", t, func() {
+		info, aliased, err := newConnInfo("tcpclient", &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 502}, aliases)
+		So(err, ShouldBeNil)
+		So(aliased, ShouldBeFalse)
+		So(info.Alias, ShouldEqual, "10.0.0.1")
+
+		info, aliased, err = newConnInfo("tcpserver", &net.TCPAddr{IP: net.IPv6loopback, Port: 1}, aliases)
+		So(err, ShouldBeNil)
+		So(aliased, ShouldBeTrue)
+		So(info.Alias, ShouldEqual, "local")
+	})
+}
@@ -0,0 +1,130 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gateway/internal/pkg"
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const HTTP_TEST_YAML = `
+http_proto:
+  - desc: "设备号与数值"
+    size: 3
+    Points:
+      - Tag:
+          id: "'dev_' + string(Bytes[0])"
+        Field:
+          v: "Uint16(Bytes[1:3])"
+`
+
+// postHttp 发送请求, 返回状态码与解析结果
+func postHttp(url, contentType, token string, body []byte) (int, httpResult) {
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	So(err, ShouldBeNil)
+	defer resp.Body.Close()
+	var result httpResult
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func TestHttpConnector(t *testing.T) {
+	var proto map[string]interface{}
+	if err := yaml.Unmarshal([]byte(HTTP_TEST_YAML), &proto); err != nil {
+		t.Fatal(err)
+	}
+	config := &pkg.Config{
+		Connector: pkg.ConnectorConfig{Para: map[string]interface{}{
+			"url":   "127.0.0.1:0",
+			"path":  "/ingest/",
+			"token": "secret",
+		}},
+		Parser: pkg.ParserConfig{Para: map[string]interface{}{
+			"protoFile": "http_proto",
+			"points": []map[string]interface{}{
+				{
+					"tag":   map[string]interface{}{"id": "Data['id']", "path": "Topic"},
+					"field": map[string]interface{}{"t": "Data['t'] * 1"},
+				},
+			},
+		}},
+		Others: proto,
+	}
+	ctx, cancel := context.WithCancel(pkg.WithConfig(pkg.WithLogger(context.Background(), zap.NewNop()), config))
+	defer cancel()
+
+	connector, err := NewHttpConnector(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := make(pkg.Parser2DispatcherChan, 16)
+	if err = connector.Start(&sink); err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + connector.(*HttpConnector).listener.Addr().String()
+
+	Convey("JSON 请求交给 JParser, 请求路径作为主题", t, func() {
+		status, result := postHttp(base+"/ingest/vendorA", "application/json", "secret", []byte(`{"id": "d1", "t": 21.5}`))
+		So(status, ShouldEqual, http.StatusOK)
+		So(result, ShouldResemble, httpResult{Accepted: 1, Points: 1})
+		point := (<-sink).Points[0]
+		So(point.Tag, ShouldResemble, map[string]interface{}{"id": "d1", "path": "ingest/vendorA"})
+		So(point.Field["t"], ShouldEqual, 21.5)
+	})
+
+	Convey("NDJSON 批量请求逐行返回解析错误", t, func() {
+		body := []byte("{\"id\": \"d1\", \"t\": 1}\n{\"id\": \"d2\", \"t\": \"x\"}\n\n{\"id\": \"d3\", \"t\": 3}\n")
+		status, result := postHttp(base+"/ingest/", "application/x-ndjson", "secret", body)
+		So(status, ShouldEqual, http.StatusOK)
+		So(result.Accepted, ShouldEqual, 2)
+		So(result.Errors, ShouldHaveLength, 1)
+		So(result.Errors[0].Index, ShouldEqual, 1)
+		So((<-sink).Points[0].Tag["id"], ShouldEqual, "d1")
+		So((<-sink).Points[0].Tag["id"], ShouldEqual, "d3")
+
+		status, result = postHttp(base+"/ingest/", "application/json", "secret", []byte(`{"id": `))
+		So(status, ShouldEqual, http.StatusBadRequest)
+		So(result.Accepted, ShouldEqual, 0)
+		So(result.Errors, ShouldHaveLength, 1)
+	})
+
+	Convey("二进制请求交给 BParser, 请求体可以包含连续的多帧", t, func() {
+		status, result := postHttp(base+"/ingest/", "application/octet-stream", "secret", []byte{0x01, 0x00, 0x10, 0x02, 0x00, 0x20})
+		So(status, ShouldEqual, http.StatusOK)
+		So(result, ShouldResemble, httpResult{Accepted: 2, Points: 2})
+		So((<-sink).Points[0].Field["v"], ShouldEqual, 0x10)
+		So((<-sink).Points[0].Tag["id"], ShouldEqual, "dev_2")
+
+		// 最后一帧不完整
+		status, result = postHttp(base+"/ingest/", "application/octet-stream", "secret", []byte{0x01, 0x00, 0x10, 0x02})
+		So(status, ShouldEqual, http.StatusOK)
+		So(result.Accepted, ShouldEqual, 1)
+		So(result.Errors[0].Index, ShouldEqual, 1)
+		<-sink
+	})
+
+	Convey("认证与请求校验", t, func() {
+		status, _ := postHttp(base+"/ingest/", "application/json", "", []byte(`{}`))
+		So(status, ShouldEqual, http.StatusUnauthorized)
+		status, _ = postHttp(base+"/ingest/", "application/json", "wrong", []byte(`{}`))
+		So(status, ShouldEqual, http.StatusUnauthorized)
+		status, _ = postHttp(base+"/ingest/", "text/plain", "secret", []byte(`{}`))
+		So(status, ShouldEqual, http.StatusUnsupportedMediaType)
+
+		resp, err := http.Get(base + "/ingest/")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusMethodNotAllowed)
+	})
+}
@@ -0,0 +1,150 @@
+package connector
+
+import (
+	"context"
+	"encoding/binary"
+	"gateway/internal/pkg"
+	"gateway/internal/pkg/checksum"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+// startRtuStub 启动一个串口服务器桩, 以 RTU 帧应答: 从站 1 正常应答 (响应分两段发送),
+// 从站 2 应答的 CRC 错误, 从站 3 在 60ms 后才应答, 其他从站不应答; 返回的计数为接受的连接数
+func startRtuStub(t *testing.T) (net.Listener, *int32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var accepted int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					req := make([]byte, 8)
+					if _, err := io.ReadFull(conn, req); err != nil {
+						return
+					}
+					if checksum.CRC16Modbus(req[:6]) != binary.LittleEndian.Uint16(req[6:]) {
+						continue
+					}
+					addr := binary.BigEndian.Uint16(req[2:])
+					count := binary.BigEndian.Uint16(req[4:])
+					resp := []byte{req[0], req[1], byte(count * 2)}
+					for i := uint16(0); i < count; i++ {
+						resp = binary.BigEndian.AppendUint16(resp, 0x0100+addr+i)
+					}
+					resp = binary.LittleEndian.AppendUint16(resp, checksum.CRC16Modbus(resp))
+					switch req[0] {
+					case 1:
+						conn.Write(resp[:3])
+						time.Sleep(2 * time.Millisecond) // 小于帧间静默时间, 属于同一帧
+						conn.Write(resp[3:])
+					case 2:
+						resp[len(resp)-1] ^= 0xFF
+						conn.Write(resp)
+					case 3:
+						time.Sleep(60 * time.Millisecond)
+						conn.Write(resp)
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln, &accepted
+}
+
+func TestModbusRtuConnector(t *testing.T) {
+	ln, accepted := startRtuStub(t)
+	defer ln.Close()
+
+	Convey("RTU 帧经串口服务器轮询从站", t, func() {
+		config, err := newModbusTestConfig(ln.Addr().String(), []interface{}{
+			map[string]interface{}{"unitId": 1, "function": 3, "address": 2, "count": 2, "interval": "20ms"},
+			map[string]interface{}{"unitId": 2, "function": 3, "address": 5, "count": 1, "interval": "20ms"},
+			map[string]interface{}{"unitId": 9, "function": 3, "address": 8, "count": 1, "interval": "20ms"},
+		})
+		So(err, ShouldBeNil)
+		config.Connector.Para["timeout"] = "50ms"
+		config.Connector.Para["frameGap"] = "20ms"
+		ctx, cancel := context.WithCancel(pkg.WithConfig(pkg.WithLogger(context.Background(), zap.NewNop()), config))
+		defer cancel()
+
+		connector, err := NewModbusRtuConnector(ctx)
+		So(err, ShouldBeNil)
+		sink := make(pkg.Parser2DispatcherChan, 16)
+		So(connector.Start(&sink), ShouldBeNil)
+
+		// CRC 错误与从站无响应只丢弃本次结果, 正常从站的数据持续到达且不会重连
+		received := 0
+		timeout := time.After(2 * time.Second)
+		for received < 3 {
+			select {
+			case pointPackage := <-sink:
+				So(pointPackage.Points[0].Tag["id"], ShouldEqual, "addr_2")
+				So(pointPackage.Points[0].Field["v"], ShouldEqual, 0x0102)
+				received++
+			case <-timeout:
+				So(received, ShouldEqual, 3)
+				return
+			}
+		}
+		So(atomic.LoadInt32(accepted), ShouldEqual, 1)
+	})
+
+	Convey("超时后迟到的响应不会被当作下一个请求的响应", t, func() {
+		config, err := newModbusTestConfig(ln.Addr().String(), []interface{}{
+			map[string]interface{}{"unitId": 1, "function": 3, "address": 2, "count": 2, "interval": "1h"},
+		})
+		So(err, ShouldBeNil)
+		config.Connector.Para["timeout"] = "50ms"
+		config.Connector.Para["frameGap"] = "20ms"
+		ctx := pkg.WithConfig(pkg.WithLogger(context.Background(), zap.NewNop()), config)
+		connector, err := NewModbusRtuConnector(ctx)
+		So(err, ShouldBeNil)
+		m := connector.(*ModbusRtuConnector)
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		m.conn = conn
+		m.ring, err = pkg.NewRingBuffer(conn, rtuBufferSize)
+		So(err, ShouldBeNil)
+
+		_, err = m.read(modbusPoll{UnitId: 3, Function: 3, Address: 2, Count: 2})
+		So(err, ShouldWrap, pkg.ErrFrameTimeout)
+		frame, err := m.read(modbusPoll{UnitId: 1, Function: 3, Address: 2, Count: 2})
+		So(err, ShouldBeNil)
+		So(frame[0], ShouldEqual, 1)
+		So(m.ring, ShouldNotBeNil)
+	})
+
+	Convey("请求帧与响应帧校验", t, func() {
+		p := modbusPoll{UnitId: 1, Function: 3, Address: 0, Count: 1}
+		So(rtuRequest(p), ShouldResemble, []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A})
+
+		pdu, err := rtuResponsePdu(p, []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B})
+		So(err, ShouldBeNil)
+		So(pdu, ShouldResemble, []byte{0x03, 0x02, 0x00, 0x2A})
+
+		_, err = rtuResponsePdu(p, []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9C})
+		So(err, ShouldWrap, errRtuFrame)
+		_, err = rtuResponsePdu(p, []byte{0x01, 0x83})
+		So(err, ShouldWrap, errRtuFrame)
+		other := modbusPoll{UnitId: 2, Function: 3, Address: 0, Count: 1}
+		_, err = rtuResponsePdu(other, []byte{0x01, 0x03, 0x02, 0x00, 0x2A, 0x39, 0x9B})
+		So(err, ShouldWrap, errRtuFrame)
+	})
+}
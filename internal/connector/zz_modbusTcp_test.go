@@ -0,0 +1,196 @@
+package connector
+
+import (
+	"context"
+	"encoding/binary"
+	"gateway/internal/pkg"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const MODBUS_TEST_YAML = `
+modbus_proto:
+  - desc: "帧头"
+    size: 7
+    Vars:
+      fc: "Bytes[1]"
+      addr: "Uint16(Bytes[2:4])"
+      n: "Bytes[6]"
+  - desc: "数据"
+    size: "Vars.n"
+    Points:
+      - Tag:
+          id: "'addr_' + string(Vars.addr)"
+        Field:
+          v: "Vars.fc == 3 ? Uint16(Bytes[0:2]) : Bits(Bytes[0], 0, 3)"
+`
+
+// startModbusStub 启动一个 Modbus TCP 从站桩: 保持寄存器的值为 0x0100+地址, 线圈为 101 交替,
+// 地址 >= 1000 时返回异常码 2 (非法数据地址)
+func startModbusStub(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					req := make([]byte, mbapHeaderSize+5)
+					if _, err := io.ReadFull(conn, req); err != nil {
+						return
+					}
+					fc := req[7]
+					addr := binary.BigEndian.Uint16(req[8:])
+					count := binary.BigEndian.Uint16(req[10:])
+					var pdu []byte
+					switch {
+					case addr >= 1000:
+						pdu = []byte{fc | 0x80, 0x02}
+					case fc == modbusReadHoldingRegisters:
+						pdu = []byte{fc, byte(count * 2)}
+						for i := uint16(0); i < count; i++ {
+							pdu = binary.BigEndian.AppendUint16(pdu, 0x0100+addr+i)
+						}
+					default:
+						pdu = []byte{fc, byte((count + 7) / 8)}
+						for i := uint16(0); i < (count+7)/8; i++ {
+							pdu = append(pdu, 0b0101_0101)
+						}
+					}
+					resp := make([]byte, mbapHeaderSize, mbapHeaderSize+len(pdu))
+					copy(resp, req[:4])
+					binary.BigEndian.PutUint16(resp[4:], uint16(len(pdu)+1))
+					resp[6] = req[6]
+					if _, err := conn.Write(append(resp, pdu...)); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln
+}
+
+func newModbusTestConfig(url string, polls []interface{}) (*pkg.Config, error) {
+	var proto map[string]interface{}
+	if err := yaml.Unmarshal([]byte(MODBUS_TEST_YAML), &proto); err != nil {
+		return nil, err
+	}
+	return &pkg.Config{
+		Connector: pkg.ConnectorConfig{Para: map[string]interface{}{
+			"url":     url,
+			"timeout": "1s",
+			"polls":   polls,
+		}},
+		Parser: pkg.ParserConfig{Para: map[string]interface{}{"protoFile": "modbus_proto"}},
+		Others: proto,
+	}, nil
+}
+
+func TestModbusTcpConnector(t *testing.T) {
+	ln := startModbusStub(t)
+	defer ln.Close()
+
+	Convey("按轮询表读取从站并交给 BParser 解析", t, func() {
+		config, err := newModbusTestConfig(ln.Addr().String(), []interface{}{
+			map[string]interface{}{"unitId": 1, "function": 3, "address": 2, "count": 2, "interval": "50ms"},
+			map[string]interface{}{"unitid": 1, "function": "1", "address": 10, "count": 3, "interval": "50ms"},
+		})
+		So(err, ShouldBeNil)
+		ctx, cancel := context.WithCancel(pkg.WithConfig(pkg.WithLogger(context.Background(), zap.NewNop()), config))
+		defer cancel()
+
+		connector, err := NewModbusTcpConnector(ctx)
+		So(err, ShouldBeNil)
+		sink := make(pkg.Parser2DispatcherChan, 16)
+		So(connector.Start(&sink), ShouldBeNil)
+
+		got := map[any]any{}
+		timeout := time.After(2 * time.Second)
+		for len(got) < 2 {
+			select {
+			case pointPackage := <-sink:
+				for _, point := range pointPackage.Points {
+					got[point.Tag["id"]] = point.Field["v"]
+				}
+			case <-timeout:
+				So(got, ShouldHaveLength, 2)
+				return
+			}
+		}
+		So(got["addr_2"], ShouldEqual, 0x0102)
+		So(got["addr_10"], ShouldEqual, 0b101)
+	})
+
+	Convey("响应解析失败后继续解析后续响应", t, func() {
+		config, err := newModbusTestConfig("127.0.0.1:502", nil)
+		So(err, ShouldBeNil)
+		ctx, cancel := context.WithCancel(pkg.WithConfig(pkg.WithLogger(context.Background(), zap.NewNop()), config))
+		defer cancel()
+
+		// 第一次响应的 byteCount 与数据长度不符, BParser 读取数据段失败
+		var reads atomic.Int32
+		read := func(modbusPoll) ([]byte, error) {
+			if reads.Add(1) == 1 {
+				return []byte{1, 3, 0x00, 0x02, 0x00, 0x01, 4, 0x01}, nil
+			}
+			return []byte{1, 3, 0x00, 0x02, 0x00, 0x01, 2, 0x01, 0x02}, nil
+		}
+		polls := &modbusConfig{Url: "127.0.0.1:502", Polls: []modbusPoll{{UnitId: 1, Function: 3, Address: 2, Count: 1, Interval: 20 * time.Millisecond}}}
+		sink := make(pkg.Parser2DispatcherChan, 16)
+		So(startPolls(ctx, "modbustcp", polls, read, sink), ShouldBeNil)
+
+		select {
+		case pointPackage := <-sink:
+			So(pointPackage.Points[0].Field["v"], ShouldEqual, 0x0102)
+		case <-time.After(time.Second):
+			So("timeout", ShouldBeEmpty)
+		}
+		So(reads.Load(), ShouldBeGreaterThan, 1)
+	})
+
+	Convey("响应校验", t, func() {
+		p := modbusPoll{UnitId: 1, Function: 3, Address: 0x10, Count: 1}
+		frame, err := p.frame([]byte{3, 2, 0x12, 0x34})
+		So(err, ShouldBeNil)
+		So(frame, ShouldResemble, []byte{1, 3, 0x00, 0x10, 0x00, 0x01, 2, 0x12, 0x34})
+
+		_, err = p.frame([]byte{0x83, 0x02})
+		So(err.Error(), ShouldContainSubstring, "异常码 2")
+		_, err = p.frame([]byte{3, 4, 0x12, 0x34, 0x56, 0x78})
+		So(err, ShouldNotBeNil)
+		_, err = p.frame([]byte{4, 2, 0x12, 0x34})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("轮询表配置校验", t, func() {
+		for _, poll := range []map[string]interface{}{
+			{"function": 5, "count": 1},
+			{"function": 3, "count": 0},
+			{"function": 3, "count": 126},
+			{"function": 1, "count": 2001},
+		} {
+			config, err := newModbusTestConfig("127.0.0.1:502", []interface{}{poll})
+			So(err, ShouldBeNil)
+			_, err = NewModbusTcpConnector(pkg.WithConfig(context.Background(), config))
+			So(err, ShouldNotBeNil)
+		}
+		config, err := newModbusTestConfig("127.0.0.1:502", nil)
+		So(err, ShouldBeNil)
+		_, err = NewModbusTcpConnector(pkg.WithConfig(context.Background(), config))
+		So(err, ShouldNotBeNil)
+	})
+}
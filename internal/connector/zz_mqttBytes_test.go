@@ -0,0 +1,115 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"gateway/internal/pkg"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+// testMessage 是只提供主题和报文的 mqtt.Message
+type testMessage struct {
+	mqtt.Message
+	topic   string
+	payload []byte
+}
+
+func (m *testMessage) Topic() string   { return m.topic }
+func (m *testMessage) Payload() []byte { return m.payload }
+
+func TestMqttBytesParser(t *testing.T) {
+	config := &pkg.Config{
+		Connector: pkg.ConnectorConfig{Para: map[string]interface{}{
+			"broker":     "tcp://127.0.0.1:1883",
+			"parsertype": "bytes",
+			"conntags":   "topic",
+			"workers":    2,
+		}},
+		Parser: pkg.ParserConfig{Para: map[string]interface{}{"protoFile": "mqtt_proto"}},
+		Others: map[string]interface{}{
+			"mqtt_proto": []interface{}{
+				map[string]interface{}{
+					"desc": "数据",
+					"size": 2,
+					"Points": []interface{}{
+						map[string]interface{}{
+							"Tag":   map[string]interface{}{"id": "split(Conn.Topic, '/')[1]"},
+							"Field": map[string]interface{}{"v": "Uint16(Bytes)"},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx, cancel := context.WithCancel(pkg.WithConfig(pkg.WithLogger(context.Background(), zap.NewNop()), config))
+	defer cancel()
+
+	Convey("bytes 模式下每个主题的报文交给 ByteParser", t, func() {
+		connector, err := NewMqttConnector(ctx)
+		So(err, ShouldBeNil)
+		m := connector.(*MqttConnector)
+		So(m.parser, ShouldBeNil)
+
+		So(len(m.workers), ShouldEqual, 2)
+
+		sink := make(pkg.Parser2DispatcherChan, 2)
+		m.sink = sink
+		for _, w := range m.workers {
+			go m.startWorker(w)
+		}
+		m.messagePubHandler(nil, &testMessage{topic: "dev/m1/raw", payload: []byte{0x01, 0x02}})
+		m.messagePubHandler(nil, &testMessage{topic: "dev/m2/raw", payload: []byte{0x00, 0x10}})
+
+		got := map[any]any{}
+		for i := 0; i < 2; i++ {
+			select {
+			case pkgs := <-sink:
+				point := pkgs.Points[0]
+				So(point.Tag["topic"], ShouldStartWith, "dev/")
+				got[point.Tag["id"]] = point.Field["v"]
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		}
+		So(got, ShouldResemble, map[any]any{"m1": 0x0102, "m2": 0x0010})
+
+		Convey("报文解析失败后同一主题的后续报文仍被解析", func() {
+			m.messagePubHandler(nil, &testMessage{topic: "dev/m1/raw", payload: []byte{0x01}})
+			m.messagePubHandler(nil, &testMessage{topic: "dev/m1/raw", payload: []byte{0x00, 0x20}})
+			select {
+			case pkgs := <-sink:
+				So(pkgs.Points[0].Field["v"], ShouldEqual, 0x0020)
+			case <-time.After(time.Second):
+				So("timeout", ShouldBeEmpty)
+			}
+		})
+
+		Convey("主题数量超过工作协程数时共享协程, 每条报文使用自己的主题", func() {
+			for i := 0; i < 20; i++ {
+				topic := fmt.Sprintf("dev/n%d/raw", i)
+				So(m.workerOf(topic), ShouldEqual, m.workerOf(topic))
+				m.messagePubHandler(nil, &testMessage{topic: topic, payload: []byte{0x00, byte(i)}})
+				select {
+				case pkgs := <-sink:
+					So(pkgs.Points[0].Tag["id"], ShouldEqual, fmt.Sprintf("n%d", i))
+					So(pkgs.Points[0].Tag["topic"], ShouldEqual, topic)
+					So(pkgs.Points[0].Field["v"], ShouldEqual, i)
+				case <-time.After(time.Second):
+					So("timeout", ShouldBeEmpty)
+				}
+			}
+			So(len(m.workers), ShouldEqual, 2)
+		})
+	})
+
+	Convey("不支持的 parserType 创建失败", t, func() {
+		config.Connector.Para["parsertype"] = "xml"
+		_, err := NewMqttConnector(ctx)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,141 @@
+package dispatcher
+
+import (
+	"container/list"
+	"fmt"
+	"gateway/internal/pkg"
+	"math"
+	"reflect"
+	"time"
+)
+
+// defaultDeadbandMaxPoints 是变化过滤默认保存状态的点数上限
+const defaultDeadbandMaxPoints = 100000
+
+// deadbandRule 是匹配字段的死区
+type deadbandRule struct {
+	pattern  fieldPattern
+	absolute float64
+	percent  float64
+}
+
+// deadbandState 是字段上次发送的值和时间
+type deadbandState struct {
+	value any
+	sent  time.Time
+}
+
+// deadbandEntry 是一个点 (以标签哈希区分) 的字段状态
+type deadbandEntry struct {
+	key    uint64
+	fields map[string]deadbandState
+}
+
+// deadbandFilter 是策略的变化过滤 (report by exception), 只保留相对上次发送值超出死区的字段。
+// 状态以 pkg.TagKey 为键, 按最近收到数据的顺序组成 LRU, 超过 maxPoints 时淘汰最久未收到数据的点。
+// 与 Handler 一样不是并发安全的, 由分发协程独占使用。
+type deadbandFilter struct {
+	config     pkg.DeadbandConfig // 编译前的配置, 热加载时用于判断能否沿用状态
+	defaults   deadbandRule
+	rules      []deadbandRule
+	maxSilence time.Duration
+	maxPoints  int
+
+	points map[uint64]*list.Element
+	lru    *list.List // 元素为 *deadbandEntry, 队首为最近收到数据的点
+}
+
+// newDeadbandFilter 编译策略的变化过滤, 未启用时返回 nil
+func newDeadbandFilter(config pkg.DeadbandConfig) (*deadbandFilter, error) {
+	if !config.Enable {
+		return nil, nil
+	}
+	if config.Absolute < 0 || config.Percent < 0 {
+		return nil, fmt.Errorf("死区不能为负数: absolute=%v, percent=%v", config.Absolute, config.Percent)
+	}
+	if config.MaxSilence < 0 {
+		return nil, fmt.Errorf("maxSilence 不能为负数: %v", config.MaxSilence)
+	}
+	filter := &deadbandFilter{
+		config:     config,
+		defaults:   deadbandRule{absolute: config.Absolute, percent: config.Percent},
+		maxSilence: config.MaxSilence,
+		maxPoints:  config.MaxPoints,
+		points:     make(map[uint64]*list.Element),
+		lru:        list.New(),
+	}
+	if filter.maxPoints <= 0 {
+		filter.maxPoints = defaultDeadbandMaxPoints
+	}
+	for _, field := range config.Fields {
+		if field.Absolute < 0 || field.Percent < 0 {
+			return nil, fmt.Errorf("字段 %s 的死区不能为负数: absolute=%v, percent=%v", field.Field, field.Absolute, field.Percent)
+		}
+		pattern, err := compileFieldPattern(field.Field)
+		if err != nil {
+			return nil, err
+		}
+		filter.rules = append(filter.rules, deadbandRule{pattern: pattern, absolute: field.Absolute, percent: field.Percent})
+	}
+	return filter, nil
+}
+
+// apply 删除 point 中未超出死区的字段, 并以 now 记录保留字段的发送时间
+// 返回 false 表示没有需要发送的字段
+func (f *deadbandFilter) apply(point *pkg.Point, now time.Time) bool {
+	entry := f.entry(pkg.TagKey(point.Tag))
+	for name, value := range point.Field {
+		last, ok := entry.fields[name]
+		if ok && !f.silent(last, now) && !f.rule(name).changed(last.value, value) {
+			delete(point.Field, name)
+			continue
+		}
+		entry.fields[name] = deadbandState{value: value, sent: now}
+	}
+	return len(point.Field) > 0
+}
+
+// entry 返回 key 对应的点状态并将其移到队首, 不存在时创建, 超出上限时淘汰队尾
+func (f *deadbandFilter) entry(key uint64) *deadbandEntry {
+	if element, ok := f.points[key]; ok {
+		f.lru.MoveToFront(element)
+		return element.Value.(*deadbandEntry)
+	}
+	entry := &deadbandEntry{key: key, fields: make(map[string]deadbandState)}
+	f.points[key] = f.lru.PushFront(entry)
+	for f.lru.Len() > f.maxPoints {
+		oldest := f.lru.Back()
+		f.lru.Remove(oldest)
+		delete(f.points, oldest.Value.(*deadbandEntry).key)
+	}
+	return entry
+}
+
+// silent 判断字段是否已超过 maxSilence 未发送
+func (f *deadbandFilter) silent(last deadbandState, now time.Time) bool {
+	return f.maxSilence > 0 && now.Sub(last.sent) >= f.maxSilence
+}
+
+// rule 返回字段第一个匹配的死区, 都不匹配时使用默认死区
+func (f *deadbandFilter) rule(name string) deadbandRule {
+	for _, rule := range f.rules {
+		if rule.pattern.match(name) {
+			return rule
+		}
+	}
+	return f.defaults
+}
+
+// changed 判断 value 相对上次发送的 last 是否超出死区
+func (r deadbandRule) changed(last, value any) bool {
+	a, aok := pkg.ToFloat64(last)
+	b, bok := pkg.ToFloat64(value)
+	if !aok || !bok {
+		return aok != bok || !reflect.DeepEqual(last, value)
+	}
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) != math.IsNaN(b)
+	}
+	threshold := max(r.absolute, math.Abs(a)*r.percent/100)
+	return math.Abs(b-a) > threshold
+}
@@ -4,13 +4,21 @@ import (
 	"context"
 	"fmt"
 	"gateway/internal/pkg"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// filterWarnInterval 同一策略的过滤表达式执行失败时, 两次 Warn 日志之间的最短间隔, 期间的失败只记录 Debug 日志
+const filterWarnInterval = time.Minute
+
 type Dispatcher struct {
 	ctx     context.Context
 	SinkMap *pkg.Dispatch2SinkChan // 策略名称 -> 其附属的数据源通道
+
+	mu      sync.RWMutex // 保护 handler 和 SinkMap, 热加载时整体替换
+	handler *Handler
 }
 
 var New = func(ctx context.Context) *Dispatcher {
@@ -19,32 +27,51 @@ var New = func(ctx context.Context) *Dispatcher {
 	}
 }
 
-// Start 启动聚合器
+// Start 启动分发器
 func (dis *Dispatcher) Start(source *pkg.Parser2DispatcherChan, sinkMap *pkg.Dispatch2SinkChan) {
 	logger := pkg.LoggerFromContext(dis.ctx)
 	metrics := pkg.GetPerformanceMetrics() // 获取性能指标实例
 
-	logger.Info("===聚合器启动===")
+	logger.Info("===分发器启动===")
 
-	handler, err := NewHandler(pkg.ConfigFromContext(dis.ctx).Strategy)
-	if err != nil {
-		logger.Error("error creating handler", zap.Error(err))
-		return
+	dis.mu.Lock()
+	// 启动前已经热加载过时, 以热加载的结果为准
+	if dis.handler == nil {
+		handler, err := NewHandler(pkg.ConfigFromContext(dis.ctx).Strategy)
+		if err != nil {
+			dis.mu.Unlock()
+			logger.Error("error creating handler", zap.Error(err))
+			return
+		}
+		dis.handler = handler
+		dis.SinkMap = sinkMap
 	}
-	dis.SinkMap = sinkMap
+	dis.mu.Unlock()
+	lastWarned := make(map[string]time.Time) // 策略名称 -> 上一次以 Warn 级别记录过滤失败的时间
 	for {
 		select {
 		case frame2point := <-(*source):
 
 			// 记录接收到的点
-			metrics.IncMsgReceived("aggregator")
-
-			readyPointPackage, err := handler.Dispatch(frame2point)
-			if err != nil {
-				logger.Error("error dispatching point", zap.Error(err))
-				return
+			metrics.IncMsgReceived("dispatcher")
+
+			// 每帧取一次快照, 热加载在帧与帧之间生效
+			dis.mu.RLock()
+			handler, currentSinkMap := dis.handler, dis.SinkMap
+			dis.mu.RUnlock()
+
+			// 过滤表达式执行失败的点只是不分发给该策略, 分发器不能因为单帧的数据退出
+			readyPointPackage, errs := handler.Dispatch(frame2point)
+			for _, err := range errs {
+				metrics.With(pkg.MetricLabels{Strategy: err.Strategy}).IncMsgErrors("dispatcher")
+				if time.Since(lastWarned[err.Strategy]) < filterWarnInterval {
+					logger.Debug("error filtering point", zap.String("frameId", frame2point.FrameId), zap.Error(err))
+					continue
+				}
+				lastWarned[err.Strategy] = time.Now()
+				logger.Warn("策略过滤表达式执行失败, 该点视为不匹配, 一分钟内同一策略的失败只记录 Debug 日志", zap.String("frameId", frame2point.FrameId), zap.Error(err))
 			}
-			dis.launch(readyPointPackage)
+			dis.launch(readyPointPackage, currentSinkMap)
 			// 释放 frame2point 的 Points
 			for _, point := range frame2point.Points {
 				pkg.PointPoolInstance.Put(point)
@@ -55,23 +82,35 @@ func (dis *Dispatcher) Start(source *pkg.Parser2DispatcherChan, sinkMap *pkg.Dis
 	}
 }
 
-// launch 方法用于启动聚合器的发送流程
-func (dis *Dispatcher) launch(deviceMap map[string]*pkg.PointPackage) {
+// Swap 替换分发使用的策略处理器和下游通道, 用于热加载
+// handler 需要事先构建好, 这样校验失败时不会影响正在运行的分发流程
+// 变化过滤配置未改变的策略沿用旧处理器中的状态
+func (dis *Dispatcher) Swap(handler *Handler, sinkMap *pkg.Dispatch2SinkChan) {
+	dis.mu.Lock()
+	defer dis.mu.Unlock()
+	handler.inherit(dis.handler)
+	dis.handler = handler
+	dis.SinkMap = sinkMap
+}
+
+// launch 方法用于启动分发器的发送流程
+func (dis *Dispatcher) launch(deviceMap map[string]*pkg.PointPackage, sinkMap *pkg.Dispatch2SinkChan) {
 	logger := pkg.LoggerFromContext(dis.ctx)
 	metrics := pkg.GetPerformanceMetrics() // 获取性能指标实例
 
-	logger.Debug("launching", zap.String("sinkMap", fmt.Sprintf("%v", dis.SinkMap)))
+	logger.Debug("launching", zap.String("sinkMap", fmt.Sprintf("%v", sinkMap)))
 
 	// 创建发送计时器
-	sendTimer := metrics.NewTimer("aggregator_send")
+	sendTimer := metrics.NewTimer("dispatcher_send")
 
 	// 记录要发送的点总数
 	pointCount := 0
 
 	for strategy, readyPointPackage := range deviceMap {
 		select {
-		case (*dis.SinkMap)[strategy] <- readyPointPackage:
+		case (*sinkMap)[strategy] <- readyPointPackage:
 			pointCount += 1
+			metrics.With(pkg.MetricLabels{Strategy: strategy}).IncMsgProcessed("dispatcher")
 		case <-dis.ctx.Done():
 			return
 		}
@@ -6,5 +6,7 @@
 // 主要职责可能包括：
 //   - 接收来自 parser 的数据。
 //   - 根据策略配置（如 tagFilter）对数据进行评估和筛选。
+//   - 按策略的字段投影（fields）裁剪发送给各 sink 的字段。
+//   - 按策略的变化过滤（deadband）丢弃相对上次发送值没有变化的字段。
 //   - 将符合条件的数据分发给一个或多个 sink 进行处理。
 package dispatcher
@@ -0,0 +1,127 @@
+package dispatcher
+
+import (
+	"fmt"
+	"gateway/internal/pkg"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/expr-lang/expr"
+)
+
+// fieldPattern 匹配字段名, 默认为 glob (如 temperature*), 以 / 包围时为正则 (如 /^temp_\d+$/)
+type fieldPattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// compileFieldPattern 编译并校验字段名模式
+func compileFieldPattern(pattern string) (fieldPattern, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return fieldPattern{}, fmt.Errorf("字段正则 %s 无效: %w", pattern, err)
+		}
+		return fieldPattern{re: re}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fieldPattern{}, fmt.Errorf("字段模式 %s 无效: %w", pattern, err)
+	}
+	return fieldPattern{glob: pattern}, nil
+}
+
+func (p fieldPattern) match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	ok, _ := path.Match(p.glob, name)
+	return ok
+}
+
+// fieldProjection 是策略的字段投影, 决定点的哪些字段发送给该策略
+type fieldProjection struct {
+	include []fieldPattern // 为空时保留全部字段
+	exclude []fieldPattern // 在 include 之后生效
+}
+
+// newFieldProjection 编译策略的字段投影, 未配置时返回 nil, 表示发送全部字段
+func newFieldProjection(config pkg.FieldsConfig) (*fieldProjection, error) {
+	if len(config.Include) == 0 && len(config.Exclude) == 0 {
+		return nil, nil
+	}
+	projection := &fieldProjection{}
+	for _, pattern := range config.Include {
+		p, err := compileFieldPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		projection.include = append(projection.include, p)
+	}
+	for _, pattern := range config.Exclude {
+		p, err := compileFieldPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		projection.exclude = append(projection.exclude, p)
+	}
+	return projection, nil
+}
+
+// keep 判断字段是否发送给该策略
+func (f *fieldProjection) keep(name string) bool {
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+	return !matchAny(f.exclude, name)
+}
+
+func matchAny(patterns []fieldPattern, name string) bool {
+	for _, p := range patterns {
+		if p.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFieldFunc 返回 TEnv.HasField, 判断点中是否存在名称匹配 glob 模式且值不为 nil 的字段
+func hasFieldFunc(field map[string]any) func(string) bool {
+	return func(pattern string) bool {
+		if v, ok := field[pattern]; ok {
+			return v != nil
+		}
+		for name, v := range field {
+			if ok, _ := path.Match(pattern, name); ok && v != nil {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// globFunction 是过滤表达式中的 glob(s, pattern), 以 glob 模式匹配字符串, 非字符串参数按 %v 格式化
+func globFunction() expr.Option {
+	return expr.Function(
+		"glob",
+		func(params ...any) (any, error) {
+			pattern, ok := params[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("glob 的模式需要字符串, 得到 %T", params[1])
+			}
+			s, ok := params[0].(string)
+			if !ok {
+				if params[0] == nil {
+					return false, nil
+				}
+				s = fmt.Sprint(params[0])
+			}
+			matched, err := path.Match(pattern, s)
+			if err != nil {
+				return nil, fmt.Errorf("glob 模式 %s 无效: %w", pattern, err)
+			}
+			return matched, nil
+		},
+		new(func(any, string) bool),
+	)
+}
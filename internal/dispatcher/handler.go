@@ -3,6 +3,7 @@ package dispatcher
 import (
 	"fmt"
 	"gateway/internal/pkg"
+	"reflect"
 	"strings"
 	"time"
 
@@ -10,33 +11,55 @@ import (
 	"github.com/expr-lang/expr/vm"
 )
 
-// TEnv 是表达式执行的环境。
-// 它包含了当前处理的字节数据、运行时变量、输出字段以及全局变量。
+// TEnv 是策略过滤表达式执行的环境。
+// 它包含了当前点的标签、字段以及所属点包的帧号和时间戳。
 type TEnv struct {
-	// Bytes 是当前 Section 处理的原始字节切片
-	Tag map[string]any
+	Tag     map[string]any
+	Field   map[string]any
+	FrameId string
+	Ts      time.Time
+	// HasField 判断点中是否存在名称匹配 glob 模式且值不为 nil 的字段, 表达式中写作 hasField("temperature*")
+	HasField func(pattern string) bool `expr:"hasField"`
 }
 
 type Handler struct {
-	LatestTs           time.Time
-	LatestFrameId      string
-	pointList          []*pkg.PointPackage
-	Strategy           []pkg.StrategyConfig
-	StrategyFilterList map[string]*vm.Program
+	LatestTs               time.Time
+	LatestFrameId          string
+	pointList              []*pkg.PointPackage
+	Strategy               []pkg.StrategyConfig
+	StrategyFilterList     map[string]*vm.Program
+	StrategyProjectionList map[string]*fieldProjection // 未配置字段投影的策略为 nil
+	StrategyDeadbandList   map[string]*deadbandFilter  // 未启用变化过滤的策略为 nil
 }
 
-// BuildTagExprOptions 返回用于编译 Tag 表达式的 expr 选项。
-// 环境设置为 *TEnv，并注册了全局辅助函数。
+// FilterError 是策略过滤表达式对某个点执行失败的原因 (例如比较了点中不存在的字段), 该点视为不匹配该策略
+type FilterError struct {
+	Strategy string
+	Err      error
+}
+
+func (e FilterError) Error() string {
+	return fmt.Sprintf("策略 %s 的过滤表达式执行失败: %v", e.Strategy, e.Err)
+}
+
+func (e FilterError) Unwrap() error {
+	return e.Err
+}
+
+// BuildTagExprOptions 返回用于编译策略过滤表达式的 expr 选项。
+// 环境设置为 *TEnv，并注册了全局辅助函数 glob(s, pattern)。
+// 正则匹配使用 expr 内置的 matches 运算符, 如 Tag.name matches "^vobc"。
 //
 // 输入: 无
 // 输出:
 //   - []expr.Option: 编译选项切片
 func BuildTagExprOptions() []expr.Option {
 	options := []expr.Option{
-		// 环境直接是 BEnv 结构体
+		// 环境直接是 TEnv 结构体
 		expr.Env(&TEnv{}),
+		expr.AsBool(),
+		globFunction(),
 	}
-	// 同样需要注册全局辅助函数
 	return options
 }
 
@@ -50,44 +73,75 @@ func BuildTagExprOptions() []expr.Option {
 //   - error: 错误
 func NewHandler(strategyConfigs []pkg.StrategyConfig) (*Handler, error) {
 	handler := &Handler{
-		LatestTs:           time.Time{},
-		LatestFrameId:      "",
-		pointList:          []*pkg.PointPackage{},
-		Strategy:           strategyConfigs,
-		StrategyFilterList: make(map[string]*vm.Program),
+		LatestTs:               time.Time{},
+		LatestFrameId:          "",
+		pointList:              []*pkg.PointPackage{},
+		Strategy:               strategyConfigs,
+		StrategyFilterList:     make(map[string]*vm.Program),
+		StrategyProjectionList: make(map[string]*fieldProjection),
+		StrategyDeadbandList:   make(map[string]*deadbandFilter),
 	}
 
-	// 编译策略过滤表达式
+	// 编译策略过滤表达式, 以策略名称为键
 	for _, strategy := range strategyConfigs {
+		name := strategy.GetName()
+		if _, exists := handler.StrategyFilterList[name]; exists {
+			return nil, fmt.Errorf("策略名称重复: %s", name)
+		}
 		filter := strings.Join(strategy.Filter, " && ")
 		program, err := expr.Compile(filter, BuildTagExprOptions()...)
 		if err != nil {
 			return nil, fmt.Errorf("编译策略过滤表达式失败: %w", err)
 		}
-		handler.StrategyFilterList[strategy.Type] = program
+		handler.StrategyFilterList[name] = program
+
+		projection, err := newFieldProjection(strategy.Fields)
+		if err != nil {
+			return nil, fmt.Errorf("策略 %s 的字段投影无效: %w", name, err)
+		}
+		handler.StrategyProjectionList[name] = projection
+
+		deadband, err := newDeadbandFilter(strategy.Deadband)
+		if err != nil {
+			return nil, fmt.Errorf("策略 %s 的变化过滤无效: %w", name, err)
+		}
+		handler.StrategyDeadbandList[name] = deadband
 	}
 	return handler, nil
 }
 
+// inherit 沿用 previous 中变化过滤配置未改变的策略的状态, 避免热加载后所有字段都被当作变化重新发送
+// 只搬移过滤器的指针, 不读写其状态, 因此分发协程仍在使用 previous 时也可以调用
+func (h *Handler) inherit(previous *Handler) {
+	if previous == nil {
+		return
+	}
+	for name, deadband := range h.StrategyDeadbandList {
+		old := previous.StrategyDeadbandList[name]
+		if deadband != nil && old != nil && reflect.DeepEqual(deadband.config, old.config) {
+			h.StrategyDeadbandList[name] = old
+		}
+	}
+}
+
 // Dispatch 分发点
 //
 // 输入:
 //   - pointList: 要分发的点列表
 //
 // 输出:
-//   - map[string]*pkg.PointPackage: 分发后的点包
-func (h *Handler) Dispatch(pointList *pkg.PointPackage) (map[string]*pkg.PointPackage, error) {
+//   - map[string]*pkg.PointPackage: 分发后的点包, 以策略名称为键
+//   - []FilterError: 过滤表达式执行失败的策略与原因, 出错的点只是不分发给该策略, 不影响其他点和策略
+func (h *Handler) Dispatch(pointList *pkg.PointPackage) (map[string]*pkg.PointPackage, []FilterError) {
 	defer h.Clean()
 	h.LatestFrameId = pointList.FrameId
 	h.LatestTs = pointList.Ts
 	readyPointPackage := make(map[string]*pkg.PointPackage)
+	var errs []FilterError
 	for _, point := range pointList.Points {
-		err := h.AddPoint(point, readyPointPackage)
-		if err != nil {
-			return nil, err
-		}
+		errs = append(errs, h.AddPoint(point, readyPointPackage)...)
 	}
-	return readyPointPackage, nil
+	return readyPointPackage, errs
 }
 
 // AddPoint 添加点
@@ -97,37 +151,59 @@ func (h *Handler) Dispatch(pointList *pkg.PointPackage) (map[string]*pkg.PointPa
 //   - readyPointPackage: 已准备好的点包
 //
 // 输出:
-//   - error: 错误
-func (h *Handler) AddPoint(point *pkg.Point, readyPointPackage map[string]*pkg.PointPackage) error {
+//   - []FilterError: 过滤表达式执行失败的策略, 该点视为不匹配这些策略
+func (h *Handler) AddPoint(point *pkg.Point, readyPointPackage map[string]*pkg.PointPackage) []FilterError {
 	var clonedPoint *pkg.Point
+	env := TEnv{
+		Tag:      point.Tag,
+		Field:    point.Field,
+		FrameId:  h.LatestFrameId,
+		Ts:       h.LatestTs,
+		HasField: hasFieldFunc(point.Field),
+	}
 
 	// 只遍历一次策略列表
+	var errs []FilterError
 	for _, strategy := range h.Strategy {
-		program := h.StrategyFilterList[strategy.Type]
-		result, err := expr.Run(program, TEnv{Tag: point.Tag})
+		name := strategy.GetName()
+		program := h.StrategyFilterList[name]
+		result, err := expr.Run(program, env)
 		if err != nil {
-			return fmt.Errorf("执行策略过滤表达式失败: %w", err)
+			errs = append(errs, FilterError{Strategy: name, Err: err})
+			continue
+		}
+
+		matched, ok := result.(bool)
+		if !ok {
+			errs = append(errs, FilterError{Strategy: name, Err: fmt.Errorf("结果不是布尔值: %v", result)})
+			continue
 		}
 
 		// 如果匹配该策略
-		if result.(bool) {
-			// 延迟创建克隆：只在第一次匹配策略时创建
-			if clonedPoint == nil {
-				// 创建point的深拷贝
-				clonedPoint = pkg.PointPoolInstance.Get()
-				// 复制Tag
-				for k, v := range point.Tag {
-					clonedPoint.Tag[k] = v
+		if matched {
+			var target *pkg.Point
+			projection, deadband := h.StrategyProjectionList[name], h.StrategyDeadbandList[name]
+			if projection != nil || deadband != nil {
+				// 配置了字段投影或变化过滤的策略使用独立的克隆, 只包含保留的字段, 没有保留任何字段时不发送该点
+				target = projectPoint(point, projection)
+				if target != nil && deadband != nil && !deadband.apply(target, h.now()) {
+					pkg.PointPoolInstance.Put(target)
+					target = nil
 				}
-				// 复制Field
-				for k, v := range point.Field {
-					clonedPoint.Field[k] = v
+				if target == nil {
+					continue
 				}
+			} else {
+				// 延迟创建克隆：只在第一次匹配策略时创建, 未配置投影和变化过滤的策略共享同一个克隆
+				if clonedPoint == nil {
+					clonedPoint = projectPoint(point, nil)
+				}
+				target = clonedPoint
 			}
 
 			// 确保策略对应的PointPackage已创建
-			if _, ok := readyPointPackage[strategy.Type]; !ok {
-				readyPointPackage[strategy.Type] = &pkg.PointPackage{
+			if _, ok := readyPointPackage[name]; !ok {
+				readyPointPackage[name] = &pkg.PointPackage{
 					FrameId: h.LatestFrameId,
 					Ts:      h.LatestTs,
 					Points:  []*pkg.Point{},
@@ -135,11 +211,40 @@ func (h *Handler) AddPoint(point *pkg.Point, readyPointPackage map[string]*pkg.P
 			}
 
 			// 将克隆添加到当前匹配的策略中
-			readyPointPackage[strategy.Type].Points = append(readyPointPackage[strategy.Type].Points, clonedPoint)
+			readyPointPackage[name].Points = append(readyPointPackage[name].Points, target)
 		}
 	}
 
-	return nil
+	return errs
+}
+
+// now 返回当前点包的时间, 点包未携带时间时使用系统时间
+func (h *Handler) now() time.Time {
+	if h.LatestTs.IsZero() {
+		return time.Now()
+	}
+	return h.LatestTs
+}
+
+// projectPoint 创建 point 的拷贝, projection 不为 nil 时只复制保留的字段
+// 没有保留任何字段时返回 nil
+func projectPoint(point *pkg.Point, projection *fieldProjection) *pkg.Point {
+	cloned := pkg.PointPoolInstance.Get()
+	// 复制Tag
+	for k, v := range point.Tag {
+		cloned.Tag[k] = v
+	}
+	// 复制Field
+	for k, v := range point.Field {
+		if projection == nil || projection.keep(k) {
+			cloned.Field[k] = v
+		}
+	}
+	if projection != nil && len(cloned.Field) == 0 {
+		pkg.PointPoolInstance.Put(cloned)
+		return nil
+	}
+	return cloned
 }
 
 // Clean 清理处理器
@@ -1,13 +1,16 @@
 package dispatcher
 
 import (
+	"context"
 	"gateway/internal/pkg"
+	"math"
 	"testing"
 	"time"
 
 	// "fmt" // Placeholder for fmt if needed later
 
 	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
 )
 
 // Mock strategy configs, reflecting that Strategy field in Handler is []pkg.StrategyConfig
@@ -65,6 +68,18 @@ func TestNewHandler(t *testing.T) {
 			})
 		})
 
+		Convey("Given two strategies sharing the same name", func() {
+			configs := []pkg.StrategyConfig{strategyTypeA, strategyTypeA}
+			Convey("When NewHandler is called", func() {
+				handler, err := NewHandler(configs)
+				Convey("Then it should reject the duplicated name", func() {
+					So(err, ShouldNotBeNil)
+					So(handler, ShouldBeNil)
+					So(err.Error(), ShouldContainSubstring, "策略名称重复")
+				})
+			})
+		})
+
 		Convey("Given an empty set of strategy configurations", func() {
 			configs := []pkg.StrategyConfig{}
 			Convey("When NewHandler is called", func() {
@@ -271,6 +286,38 @@ func TestHandlerDispatch(t *testing.T) {
 				})
 			})
 		})
+
+		Convey("Given two named strategies of the same type", func() {
+			influxA := pkg.StrategyConfig{Name: "influx_a", Type: "influxdb", Filter: []string{`Tag.type == "A"`}}
+			influxAll := pkg.StrategyConfig{Name: "influx_all", Type: "influxdb", Filter: []string{"true"}}
+			handler, err := NewHandler([]pkg.StrategyConfig{influxA, influxAll})
+			So(err, ShouldBeNil)
+
+			pointA := pkg.PointPoolInstance.Get()
+			pointA.Tag = map[string]any{"type": "A"}
+			pointA.Field = map[string]any{"val": 1}
+			pointB := pkg.PointPoolInstance.Get()
+			pointB.Tag = map[string]any{"type": "B"}
+			pointB.Field = map[string]any{"val": 2}
+			defer pkg.PointPoolInstance.Put(pointA)
+			defer pkg.PointPoolInstance.Put(pointB)
+
+			Convey("When Dispatch is called", func() {
+				dispatchedPkgs, dispatchErr := handler.Dispatch(&pkg.PointPackage{
+					FrameId: baseFrameId,
+					Ts:      baseTime,
+					Points:  []*pkg.Point{pointA, pointB},
+				})
+
+				Convey("Then packages should be keyed by strategy name", func() {
+					So(dispatchErr, ShouldBeNil)
+					So(len(dispatchedPkgs), ShouldEqual, 2)
+					So(dispatchedPkgs, ShouldNotContainKey, "influxdb")
+					So(len(dispatchedPkgs["influx_a"].Points), ShouldEqual, 1)
+					So(len(dispatchedPkgs["influx_all"].Points), ShouldEqual, 2)
+				})
+			})
+		})
 	})
 }
 
@@ -316,3 +363,250 @@ func TestHandlerClean(t *testing.T) {
 		})
 	})
 }
+
+func TestHandlerFieldFilter(t *testing.T) {
+	Convey("Testing field-based filters and projection", t, func() {
+		baseTime := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+		newPoint := func(tag, field map[string]any) *pkg.Point {
+			point := pkg.PointPoolInstance.Get()
+			point.Tag, point.Field = tag, field
+			return point
+		}
+		sensor := newPoint(map[string]any{"id": "vobc-01"}, map[string]any{"temperature_in": 21.5, "temperature_out": 8.0, "alarm": 1, "hum": 40})
+		door := newPoint(map[string]any{"id": "door-07"}, map[string]any{"alarm": 0, "open": true})
+		input := &pkg.PointPackage{FrameId: "F0001", Ts: baseTime, Points: []*pkg.Point{sensor, door}}
+
+		dispatch := func(configs ...pkg.StrategyConfig) map[string]*pkg.PointPackage {
+			handler, err := NewHandler(configs)
+			So(err, ShouldBeNil)
+			dispatched, errs := handler.Dispatch(input)
+			So(errs, ShouldBeEmpty)
+			return dispatched
+		}
+		ids := func(p *pkg.PointPackage) []any {
+			if p == nil {
+				return nil
+			}
+			var result []any
+			for _, point := range p.Points {
+				result = append(result, point.Tag["id"])
+			}
+			return result
+		}
+
+		Convey("Filters can use Field, FrameId, Ts and the helpers", func() {
+			dispatched := dispatch(
+				pkg.StrategyConfig{Name: "alarm", Filter: []string{`Field.alarm == 1`}},
+				pkg.StrategyConfig{Name: "temperature", Filter: []string{`hasField("temperature*")`}},
+				pkg.StrategyConfig{Name: "nil_field", Filter: []string{`hasField("missing")`}},
+				pkg.StrategyConfig{Name: "glob", Filter: []string{`glob(Tag.id, "door-*")`}},
+				pkg.StrategyConfig{Name: "regex", Filter: []string{`Tag.id matches "^vobc-\\d+$"`}},
+				pkg.StrategyConfig{Name: "frame", Filter: []string{`FrameId == "F0001" && Ts.Year() == 2025`}},
+				pkg.StrategyConfig{Name: "coalesce", Filter: []string{`(Field.hum ?? 0) > 30`}},
+			)
+			So(ids(dispatched["alarm"]), ShouldResemble, []any{"vobc-01"})
+			So(ids(dispatched["temperature"]), ShouldResemble, []any{"vobc-01"})
+			So(dispatched, ShouldNotContainKey, "nil_field")
+			So(ids(dispatched["glob"]), ShouldResemble, []any{"door-07"})
+			So(ids(dispatched["regex"]), ShouldResemble, []any{"vobc-01"})
+			So(ids(dispatched["frame"]), ShouldResemble, []any{"vobc-01", "door-07"})
+			So(ids(dispatched["coalesce"]), ShouldResemble, []any{"vobc-01"})
+		})
+
+		Convey("Projection keeps or drops fields per strategy", func() {
+			dispatched := dispatch(
+				pkg.StrategyConfig{Name: "all", Filter: []string{"true"}},
+				pkg.StrategyConfig{Name: "kafka", Filter: []string{"true"}, Fields: pkg.FieldsConfig{Include: []string{"temperature*"}}},
+				pkg.StrategyConfig{Name: "mqtt", Filter: []string{"true"}, Fields: pkg.FieldsConfig{Include: []string{"/^(alarm|temperature_in)$/"}, Exclude: []string{"temperature*"}}},
+			)
+			// 未配置投影的策略收到完整的克隆
+			So(dispatched["all"].Points[0].Field, ShouldResemble, sensor.Field)
+			So(dispatched["all"].Points[0], ShouldNotPointTo, sensor)
+
+			// 没有保留任何字段的点不发送给该策略
+			So(ids(dispatched["kafka"]), ShouldResemble, []any{"vobc-01"})
+			So(dispatched["kafka"].Points[0].Field, ShouldResemble, map[string]any{"temperature_in": 21.5, "temperature_out": 8.0})
+			So(dispatched["kafka"].Points[0].Tag, ShouldResemble, sensor.Tag)
+
+			So(ids(dispatched["mqtt"]), ShouldResemble, []any{"vobc-01", "door-07"})
+			So(dispatched["mqtt"].Points[0].Field, ShouldResemble, map[string]any{"alarm": 1})
+			So(dispatched["mqtt"].Points[1].Field, ShouldResemble, map[string]any{"alarm": 0})
+
+			// 投影不影响原始点
+			So(len(sensor.Field), ShouldEqual, 4)
+		})
+
+		Convey("Invalid patterns and non-bool filters are rejected", func() {
+			_, err := NewHandler([]pkg.StrategyConfig{{Name: "bad_glob", Filter: []string{"true"}, Fields: pkg.FieldsConfig{Include: []string{"temp["}}}})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "字段投影无效")
+			_, err = NewHandler([]pkg.StrategyConfig{{Name: "bad_regex", Filter: []string{"true"}, Fields: pkg.FieldsConfig{Exclude: []string{"/(/"}}}})
+			So(err, ShouldNotBeNil)
+			_, err = NewHandler([]pkg.StrategyConfig{{Name: "not_bool", Filter: []string{"FrameId"}}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestHandlerDeadband(t *testing.T) {
+	Convey("Testing per-strategy deadband (report by exception)", t, func() {
+		baseTime := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+		configs := []pkg.StrategyConfig{
+			{Name: "all", Filter: []string{"true"}},
+			{Name: "influx", Filter: []string{"true"}, Deadband: pkg.DeadbandConfig{
+				Enable:     true,
+				Absolute:   0.5,
+				Fields:     []pkg.FieldDeadband{{Field: "pressure*", Percent: 10}},
+				MaxSilence: time.Minute,
+			}},
+		}
+		handler, err := NewHandler(configs)
+		So(err, ShouldBeNil)
+
+		// dispatch 以 baseTime+offset 分发一帧, 返回 influx 策略收到的各点字段
+		dispatch := func(offset time.Duration, points ...*pkg.Point) []map[string]any {
+			dispatched, errs := handler.Dispatch(&pkg.PointPackage{FrameId: "F", Ts: baseTime.Add(offset), Points: points})
+			So(errs, ShouldBeEmpty)
+			So(len(dispatched["all"].Points), ShouldEqual, len(points))
+			if dispatched["influx"] == nil {
+				return nil
+			}
+			var fields []map[string]any
+			for _, point := range dispatched["influx"].Points {
+				fields = append(fields, point.Field)
+			}
+			return fields
+		}
+		newPoint := func(id string, field map[string]any) *pkg.Point {
+			return &pkg.Point{Tag: map[string]any{"id": id}, Field: field}
+		}
+
+		Convey("Unchanged fields are dropped and heartbeats are forced after maxSilence", func() {
+			So(dispatch(0, newPoint("dev1", map[string]any{"temp": 20.0, "pressure": 100, "state": "run"})),
+				ShouldResemble, []map[string]any{{"temp": 20.0, "pressure": 100, "state": "run"}})
+
+			// 都在死区内, 整个点不发送
+			So(dispatch(time.Second, newPoint("dev1", map[string]any{"temp": 20.4, "pressure": 109, "state": "run"})), ShouldBeNil)
+
+			// 与上次发送值比较, 而不是上一次收到的值
+			So(dispatch(2*time.Second, newPoint("dev1", map[string]any{"temp": 20.6, "pressure": int64(111), "state": "run"})),
+				ShouldResemble, []map[string]any{{"temp": 20.6, "pressure": int64(111)}})
+			So(dispatch(3*time.Second, newPoint("dev1", map[string]any{"temp": 20.6, "state": "stop"})),
+				ShouldResemble, []map[string]any{{"state": "stop"}})
+
+			// 不同的标签各自保存状态
+			So(dispatch(4*time.Second, newPoint("dev2", map[string]any{"temp": 20.6})),
+				ShouldResemble, []map[string]any{{"temp": 20.6}})
+
+			// temp 距上次发送已超过 maxSilence, 强制发送
+			So(dispatch(time.Minute+2*time.Second, newPoint("dev1", map[string]any{"temp": 20.6, "pressure": 111, "state": "stop"})),
+				ShouldResemble, []map[string]any{{"temp": 20.6, "pressure": 111}})
+		})
+
+		Convey("Reloading keeps the state of strategies whose deadband is unchanged", func() {
+			dis := New(context.Background())
+			dis.Swap(handler, nil)
+			So(dispatch(0, newPoint("dev1", map[string]any{"temp": 20.0})), ShouldResemble, []map[string]any{{"temp": 20.0}})
+
+			// 只修改过滤表达式, 变化过滤沿用旧状态
+			reloaded := append([]pkg.StrategyConfig(nil), configs...)
+			reloaded[1].Filter = []string{"true", "FrameId != ''"}
+			handler, err = NewHandler(reloaded)
+			So(err, ShouldBeNil)
+			dis.Swap(handler, nil)
+			So(dispatch(time.Second, newPoint("dev1", map[string]any{"temp": 20.4})), ShouldBeNil)
+
+			// 修改死区后从空状态开始
+			reloaded[1].Deadband.Absolute = 1
+			handler, err = NewHandler(reloaded)
+			So(err, ShouldBeNil)
+			dis.Swap(handler, nil)
+			So(dispatch(2*time.Second, newPoint("dev1", map[string]any{"temp": 20.4})), ShouldResemble, []map[string]any{{"temp": 20.4}})
+		})
+
+		Convey("Type changes, NaN and non-numeric values count as changes", func() {
+			deadband := &deadbandRule{absolute: 1}
+			So(deadband.changed(1, "1"), ShouldBeTrue)
+			So(deadband.changed(1.0, math.NaN()), ShouldBeTrue)
+			So(deadband.changed(math.NaN(), math.NaN()), ShouldBeFalse)
+			So(deadband.changed(true, true), ShouldBeFalse)
+			So(deadband.changed([]any{1}, []any{2}), ShouldBeTrue)
+			So(deadband.changed(uint8(3), 4.0), ShouldBeFalse)
+			So((&deadbandRule{}).changed(3, 3.0), ShouldBeFalse)
+			So((&deadbandRule{}).changed(3, 3.001), ShouldBeTrue)
+		})
+
+		Convey("State is bounded by maxPoints", func() {
+			filter, err := newDeadbandFilter(pkg.DeadbandConfig{Enable: true, MaxPoints: 2})
+			So(err, ShouldBeNil)
+			for _, id := range []string{"a", "b", "a", "c"} {
+				filter.apply(newPoint(id, map[string]any{"v": 1}), baseTime)
+			}
+			So(filter.lru.Len(), ShouldEqual, 2)
+			// b 最久未收到数据, 已被淘汰, 再次收到时视为新点
+			So(filter.apply(newPoint("a", map[string]any{"v": 1}), baseTime), ShouldBeFalse)
+			So(filter.apply(newPoint("b", map[string]any{"v": 1}), baseTime), ShouldBeTrue)
+		})
+
+		Convey("Invalid deadband configs are rejected", func() {
+			_, err := NewHandler([]pkg.StrategyConfig{{Name: "negative", Filter: []string{"true"}, Deadband: pkg.DeadbandConfig{Enable: true, Percent: -1}}})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "变化过滤无效")
+			_, err = NewHandler([]pkg.StrategyConfig{{Name: "bad_field", Filter: []string{"true"}, Deadband: pkg.DeadbandConfig{Enable: true, Fields: []pkg.FieldDeadband{{Field: "temp["}}}}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestDispatcherFilterError(t *testing.T) {
+	Convey("过滤表达式对部分点执行失败时只视为不匹配, 分发器继续运行", t, func() {
+		hot := pkg.StrategyConfig{Name: "hot", Type: "console", Enable: true, Filter: []string{"Field.temperature > 30"}}
+		config := &pkg.Config{Strategy: []pkg.StrategyConfig{hot, strategyAll}}
+		ctx, cancel := context.WithCancel(pkg.WithLogger(pkg.WithConfig(context.Background(), config), zap.NewNop()))
+		defer cancel()
+
+		newPackage := func(frameId string) *pkg.PointPackage {
+			return &pkg.PointPackage{FrameId: frameId, Ts: time.Now(), Points: []*pkg.Point{
+				{Tag: map[string]any{"id": "with"}, Field: map[string]any{"temperature": 35}},
+				{Tag: map[string]any{"id": "without"}, Field: map[string]any{"humidity": 40}},
+			}}
+		}
+
+		Convey("Dispatch 返回出错的策略, 其余结果不受影响", func() {
+			handler, err := NewHandler(config.Strategy)
+			So(err, ShouldBeNil)
+			dispatched, errs := handler.Dispatch(newPackage("F1"))
+			So(len(errs), ShouldEqual, 1)
+			So(errs[0].Strategy, ShouldEqual, "hot")
+			So(len(dispatched["hot"].Points), ShouldEqual, 1)
+			So(dispatched["hot"].Points[0].Tag["id"], ShouldEqual, "with")
+			So(len(dispatched["all"].Points), ShouldEqual, 2)
+		})
+
+		Convey("Start 不会因为单帧的过滤失败退出", func() {
+			source := make(pkg.Parser2DispatcherChan, 2)
+			sinkMap := pkg.Dispatch2SinkChan{
+				"hot": make(chan *pkg.PointPackage, 2),
+				"all": make(chan *pkg.PointPackage, 2),
+			}
+			go New(ctx).Start(&source, &sinkMap)
+
+			for _, frameId := range []string{"F1", "F2"} {
+				source <- newPackage(frameId)
+				select {
+				case pointPackage := <-sinkMap["hot"]:
+					So(pointPackage.FrameId, ShouldEqual, frameId)
+					So(len(pointPackage.Points), ShouldEqual, 1)
+				case <-time.After(time.Second):
+					t.Fatal("等待分发结果超时")
+				}
+				select {
+				case pointPackage := <-sinkMap["all"]:
+					So(len(pointPackage.Points), ShouldEqual, 2)
+				case <-time.After(time.Second):
+					t.Fatal("等待分发结果超时")
+				}
+			}
+		})
+	})
+}
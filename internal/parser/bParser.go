@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"gateway/internal/pkg"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
@@ -19,6 +21,7 @@ const (
 type byteParserConfig struct {
 	ProtoFile string                 `mapstructure:"protoFile"`
 	GlobalMap map[string]interface{} `mapstructure:"globalMap"`
+	Resync    resyncConfig           `mapstructure:"resync"`
 }
 
 /* ---------- 状态定义 ---------- */
@@ -30,20 +33,25 @@ type ByteState struct {
 	Env      *BEnv
 	LabelMap map[string]int
 	Nodes    []BProcessor
+
+	verifyChecksum bool   // 是否执行 Section 的校验步骤
+	checksumFailed string // 本帧校验失败时的处理方式, 为空表示校验通过
 }
 
 func NewByteState(env *BEnv, labelMap map[string]int, nodes []BProcessor) *ByteState {
 
 	return &ByteState{
-		Cursor:   0,
-		Env:      env,
-		LabelMap: labelMap,
-		Nodes:    nodes,
+		Cursor:         0,
+		Env:            env,
+		LabelMap:       labelMap,
+		Nodes:          nodes,
+		verifyChecksum: true,
 	}
 }
 
 func (s *ByteState) Reset() {
 	s.Cursor = 0
+	s.checksumFailed = ""
 	s.Env.Reset()
 }
 
@@ -53,6 +61,10 @@ type StreamState struct {
 	Env      *BEnv
 	LabelMap map[string]int
 	Nodes    []BProcessor
+
+	frame          []byte // 本帧已读取的字节
+	verifyChecksum bool   // 是否执行 Section 的校验步骤
+	checksumFailed string // 本帧校验失败时的处理方式, 为空表示校验通过
 }
 
 func NewStreamState(ring *pkg.RingBuffer, labelMap map[string]int, nodes []BProcessor) *StreamState {
@@ -63,14 +75,17 @@ func NewStreamState(ring *pkg.RingBuffer, labelMap map[string]int, nodes []BProc
 		PointsIndex: make(map[uint64]int),
 	}
 	return &StreamState{
-		ring:     ring,
-		Env:      env,
-		LabelMap: labelMap,
-		Nodes:    nodes,
+		ring:           ring,
+		Env:            env,
+		LabelMap:       labelMap,
+		Nodes:          nodes,
+		verifyChecksum: true,
 	}
 }
 
 func (s *StreamState) Reset() {
+	s.frame = s.frame[:0]
+	s.checksumFailed = ""
 	s.Env.Reset()
 }
 
@@ -83,6 +98,12 @@ type ByteParser struct {
 	LabelMap map[string]int
 	ctx      context.Context
 	Env      *BEnv
+
+	protoFile string                   // 协议文件名, 用于热加载时匹配
+	pending   atomic.Pointer[sequence] // 热加载后待切换的节点序列, 在帧边界生效
+	resync    *resyncer                // 重新同步配置, 为 nil 时解析失败直接退出
+	checkCRC  bool                     // 是否执行协议中的校验步骤, 对应 connector.config.check_crc
+	connTags  []string                 // 自动添加到每个点的连接信息标签, 对应 connector.config.connTags
 }
 
 func NewByteParser(ctx context.Context) (*ByteParser, error) {
@@ -97,7 +118,8 @@ func NewByteParser(ctx context.Context) (*ByteParser, error) {
 		pkg.LoggerFromContext(ctx).Error(msg)
 		return nil, errors.New(msg)
 	}
-	protoFileValue, protoFileExists := v.Parser.Para["protoFile"]
+	// viper 加载的配置键均为小写, 这里与 mapstructure 一致, 不区分大小写
+	protoFileValue, protoFileExists := lookupFold(v.Parser.Para, "protoFile")
 	if !protoFileExists {
 		msg := "配置文件解析失败: parser.config 缺少 'protoFile' 配置项"
 		pkg.LoggerFromContext(ctx).Error(msg, zap.Any("para", v.Parser.Para))
@@ -135,18 +157,41 @@ func NewByteParser(ctx context.Context) (*ByteParser, error) {
 		return nil, fmt.Errorf("%s", msg)
 	}
 
-	// 2. 初始化协议配置文件
-	sectionConfig, exist := v.Others[c.ProtoFile]
-	if !exist {
-		pkg.LoggerFromContext(ctx).Error("未找到协议文件", zap.String("ProtoFile", c.ProtoFile))
-		return nil, fmt.Errorf("未找到协议文件:%s", c.ProtoFile)
+	resync, err := newResyncer(c.Resync)
+	if err != nil {
+		pkg.LoggerFromContext(ctx).Error("配置文件解析失败", zap.Error(err))
+		return nil, fmt.Errorf("配置文件解析失败: %w", err)
 	}
-	pkg.LoggerFromContext(ctx).Debug("协议文件原始数据", zap.Any("data", sectionConfig))
 
-	rawSections, ok := sectionConfig.([]map[string]any)
-	if !ok {
-		pkg.LoggerFromContext(ctx).Error("协议文件根格式错误，期望 []interface{}", zap.String("ProtoFile", c.ProtoFile), zap.Any("actualData", sectionConfig))
-		return nil, fmt.Errorf("协议文件格式错误: %s 不是一个列表/数组", c.ProtoFile)
+	// connector.config.check_crc 为 false 时跳过协议中的校验步骤, 未配置时默认校验
+	checkCRC := true
+	if value, exists := lookupFold(v.Connector.Para, "check_crc"); exists {
+		if checkCRC, ok = value.(bool); !ok {
+			return nil, fmt.Errorf("配置文件解析失败: connector.config 的 'check_crc' 必须是布尔值, 实际类型: %T", value)
+		}
+	}
+
+	// connector.config.connTags 列出的连接信息会作为标签添加到每个点上
+	connTags, err := parseConnTags(v.Connector.Para)
+	if err != nil {
+		return nil, fmt.Errorf("配置文件解析失败: %w", err)
+	}
+
+	// 2. 初始化协议配置文件, 热加载过的协议优先使用最新定义
+	rawSections, reloaded := definitionOf(c.ProtoFile)
+	if !reloaded {
+		sectionConfig, exist := v.Others[c.ProtoFile]
+		if !exist {
+			pkg.LoggerFromContext(ctx).Error("未找到协议文件", zap.String("ProtoFile", c.ProtoFile))
+			return nil, fmt.Errorf("未找到协议文件:%s", c.ProtoFile)
+		}
+		pkg.LoggerFromContext(ctx).Debug("协议文件原始数据", zap.Any("data", sectionConfig))
+
+		rawSections, ok = toSectionList(sectionConfig)
+		if !ok {
+			pkg.LoggerFromContext(ctx).Error("协议文件根格式错误，期望 []interface{}", zap.String("ProtoFile", c.ProtoFile), zap.Any("actualData", sectionConfig))
+			return nil, fmt.Errorf("协议文件格式错误: %s 不是一个列表/数组", c.ProtoFile)
+		}
 	}
 	pkg.LoggerFromContext(ctx).Debug("Section文件列表", zap.Any("list", rawSections))
 
@@ -156,6 +201,7 @@ func NewByteParser(ctx context.Context) (*ByteParser, error) {
 		Vars:        make(map[string]interface{}), // 初始化 Vars map
 		Points:      make([]*pkg.Point, 0),
 		PointsIndex: make(map[uint64]int), // 初始化 PointsIndex map
+		Conn:        pkg.ConnInfoFromContext(ctx),
 	}
 
 	// 4. 初始化 Section 链表
@@ -165,21 +211,168 @@ func NewByteParser(ctx context.Context) (*ByteParser, error) {
 	}
 
 	byteParser := &ByteParser{
-		ctx:      ctx,
-		Env:      &env,
-		Nodes:    nodes,
-		LabelMap: labelMap,
+		ctx:       ctx,
+		Env:       &env,
+		Nodes:     nodes,
+		LabelMap:  labelMap,
+		protoFile: c.ProtoFile,
+		resync:    resync,
+		checkCRC:  checkCRC,
+		connTags:  connTags,
 	}
 	return byteParser, nil
 }
 
+// parseConnTags 读取 connector.config.connTags, 支持列表或逗号分隔的字符串, 取值见 pkg.ConnTagKeys
+func parseConnTags(para map[string]interface{}) ([]string, error) {
+	value, exists := lookupFold(para, "connTags")
+	if !exists || value == nil {
+		return nil, nil
+	}
+	var keys []string
+	switch v := value.(type) {
+	case string:
+		keys = strings.Split(v, ",")
+	case []string:
+		keys = v
+	case []interface{}:
+		for _, item := range v {
+			key, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("connector.config 的 'connTags' 必须是字符串列表, 包含 %T", item)
+			}
+			keys = append(keys, key)
+		}
+	default:
+		return nil, fmt.Errorf("connector.config 的 'connTags' 必须是字符串列表, 实际类型: %T", value)
+	}
+	tags := make([]string, 0, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		matched := false
+		for _, known := range pkg.ConnTagKeys {
+			if strings.EqualFold(key, known) {
+				tags = append(tags, known)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("connector.config 的 'connTags' 包含未知的键: %s, 可选 %s", key, strings.Join(pkg.ConnTagKeys, "|"))
+		}
+	}
+	return tags, nil
+}
+
+// tagConn 将配置的连接信息添加为点的标签, 协议中已定义的同名标签优先
+func (r *ByteParser) tagConn(points []*pkg.Point) {
+	for _, key := range r.connTags {
+		value, ok := r.Env.Conn.Tag(key)
+		if !ok {
+			continue
+		}
+		for _, point := range points {
+			if point.Tag == nil {
+				point.Tag = make(map[string]any)
+			}
+			if _, exists := point.Tag[key]; !exists {
+				point.Tag[key] = value
+			}
+		}
+	}
+}
+
+// lookupFold 以不区分大小写的方式从 map 中取值
+func lookupFold(m map[string]interface{}, key string) (interface{}, bool) {
+	if val, ok := m[key]; ok {
+		return val, true
+	}
+	for k, val := range m {
+		if strings.EqualFold(k, key) {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// toSectionList 将协议文件的原始配置转换为 Section 配置列表
+// 单测中直接构造 []map[string]any，而经由 viper 加载的 yaml 得到的是 []interface{}，两者都需要支持
+func toSectionList(raw any) ([]map[string]any, bool) {
+	switch list := raw.(type) {
+	case []map[string]any:
+		return list, true
+	case []interface{}:
+		sections := make([]map[string]any, 0, len(list))
+		for _, item := range list {
+			section, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			sections = append(sections, section)
+		}
+		return sections, true
+	default:
+		return nil, false
+	}
+}
+
+// ParseBytes 同步解析一帧完整的离散字节数据, 不会向下游发送数据
+// 用于离线调试 (例如 CLI 的 shootone 命令) 以及自行管理报文边界的连接器 (例如 http)
+// 已通过 Register 登记的解析器在每帧开始前切换到热加载的协议定义
+//
+// 输入:
+//   - data: 一帧完整的原始字节
+//
+// 输出:
+//   - []*pkg.Point: 本帧解析出的点
+//   - int: 本帧实际消耗的字节数
+//   - error: 解析过程中遇到的错误
+func (r *ByteParser) ParseBytes(data []byte) ([]*pkg.Point, int, error) {
+	r.applyPending(&r.Nodes, &r.LabelMap)
+	if len(r.Nodes) == 0 {
+		return nil, 0, errors.New("协议未定义任何 Section")
+	}
+	state := NewByteState(r.Env, r.LabelMap, r.Nodes)
+	state.verifyChecksum = r.checkCRC
+	state.Reset()
+	state.Data = data
+
+	current := r.Nodes[0]
+	for processedNodeCount := 0; current != nil; processedNodeCount++ {
+		if processedNodeCount >= maxNodes {
+			return nil, state.Cursor, errors.New("死循环防护触发：处理节点数超过最大限制")
+		}
+		next, err := current.ProcessWithBytes(r.ctx, state)
+		if err != nil {
+			return nil, state.Cursor, err
+		}
+		current = next
+	}
+
+	consumed := state.Cursor
+	switch state.checksumFailed {
+	case "":
+	case ChecksumTag:
+		tagMismatch(state.Env)
+	default:
+		state.Reset()
+		return nil, consumed, ErrChecksumMismatch
+	}
+	points := state.Env.Points
+	r.tagConn(points)
+	state.Reset()
+	return points, consumed, nil
+}
+
 // StartWithChan 方法用于启动一个基于Channel的ByteParser
 func (r *ByteParser) StartWithChan(dataChan chan []byte, sink pkg.Parser2DispatcherChan) error {
 	logger := pkg.LoggerFromContext(r.ctx)
-	metrics := pkg.GetPerformanceMetrics() // 获取性能指标实例
+	metrics := pkg.MetricsFromContext(r.ctx) // 获取带设备标签的性能指标
 
 	logger.Info("===ByteParser StartWithChan goroutine started===", zap.Int("maxNodesPerFrame", maxNodes))
+	defer r.Register()()
 	byteState := NewByteState(r.Env, r.LabelMap, r.Nodes)
+	byteState.verifyChecksum = r.checkCRC
 	for {
 		select {
 		case <-r.ctx.Done():
@@ -187,7 +380,8 @@ func (r *ByteParser) StartWithChan(dataChan chan []byte, sink pkg.Parser2Dispatc
 			return nil
 		case data := <-dataChan:
 			logger.Info("StartWithChan received data", zap.Int("len", len(data)), zap.String("hex", hex.EncodeToString(data))) // 添加接收日志
-			// 1. 重置状态
+			// 1. 重置状态, 并在帧边界切换热加载的协议定义
+			r.applyPending(&byteState.Nodes, &byteState.LabelMap)
 			byteState.Reset()
 			byteState.Data = data
 			processedNodeCount := 0 // 重置计数器
@@ -236,6 +430,13 @@ func (r *ByteParser) StartWithChan(dataChan chan []byte, sink pkg.Parser2Dispatc
 				continue                        // 继续外层 for 循环等待下一数据
 			}
 			// --- 循环正常结束 ---
+			if !settleChecksum(byteState.Env, byteState.checksumFailed, metrics) {
+				logger.Warn("校验失败，丢弃本帧", zap.String("frameHex", hex.EncodeToString(data)))
+				pkg.BytesPoolInstance.Put(data)
+				byteState.Reset()
+				continue
+			}
+			r.tagConn(byteState.Env.Points)
 			logger.Info("StartWithChan finished processing loop, preparing to send to sink", zap.Int("points_count", len(byteState.Env.Points))) // 添加发送前日志
 			frameId := fmt.Sprintf("%06X", metrics.IncMsgProcessed("byteParser"))
 
@@ -259,10 +460,13 @@ func (r *ByteParser) StartWithChan(dataChan chan []byte, sink pkg.Parser2Dispatc
 // StartWithRingBuffer 方法用于启动一个基于RingBuffer的ByteParser
 func (r *ByteParser) StartWithRingBuffer(ring *pkg.RingBuffer, sink pkg.Parser2DispatcherChan) error {
 	logger := pkg.LoggerFromContext(r.ctx)
-	metrics := pkg.GetPerformanceMetrics() // 获取性能指标实例
+	metrics := pkg.MetricsFromContext(r.ctx) // 获取带设备标签的性能指标
 
 	logger.Info("===ByteParser 开始处理数据===")
+	defer r.Register()()
 	state := NewStreamState(ring, r.LabelMap, r.Nodes)
+	state.verifyChecksum = r.checkCRC
+	state.Env.Conn = r.Env.Conn
 	for {
 		select {
 		case <-r.ctx.Done():
@@ -270,33 +474,45 @@ func (r *ByteParser) StartWithRingBuffer(ring *pkg.RingBuffer, sink pkg.Parser2D
 		default:
 			metrics.IncMsgReceived("byteParser")
 
-			// 1. 记录帧起始位置
+			// 0. 帧边界, 切换热加载的协议定义
+			r.applyPending(&state.Nodes, &state.LabelMap)
+
+			// 1. 记录帧起始位置, 启用重新同步时标记该位置以便出错后回退
 			start := ring.ReadPos()
+			if r.resync != nil {
+				ring.Mark()
+			}
 
 			// 2. 处理帧
-			current := r.Nodes[0]
-			processedNodeCount := 0 // 重置计数器
-			for current != nil {
-				// --- 死循环检测 ---
-				if processedNodeCount >= maxNodes {
-					logger.Error("死循环防护触发：处理节点数超过最大限制",
-						zap.Int("maxNodes", maxNodes),
-						zap.Int("processedCount", processedNodeCount),
-						zap.Stringer("lastNode", current))
-					// 如果需要停止整个 parser，则 return ErrMaxNodesExceeded
-					return errors.New("死循环防护触发：处理节点数超过最大限制") // 跳出内部 for 循环，处理下一帧
-				}
-				tmp, err := current.ProcessWithRing(r.ctx, state)
-				if err != nil {
+			if err := r.processFrame(state); err != nil {
+				if r.resync == nil || errors.Is(err, ErrStreamRead) {
 					return err
 				}
-				current = tmp
-				processedNodeCount++ // 增加计数
+				metrics.IncMsgErrors("byteParser")
+				if errors.Is(err, ErrChecksumMismatch) {
+					metrics.IncMsgErrors("checksum")
+				}
+				discarded, scanErr := r.resync.scan(ring)
+				metrics.AddDiscardedBytes("byteParser", int64(discarded))
+				if scanErr != nil {
+					logger.Error("数据帧解析失败, 重新同步失败", zap.Error(err), zap.NamedError("resyncError", scanErr), zap.Int("discarded", discarded))
+					return scanErr
+				}
+				logger.Warn("数据帧解析失败, 已重新同步", zap.Error(err), zap.Int("discarded", discarded))
+				state.Reset()
+				continue
 			}
 
 			end := ring.ReadPos() // 记录帧结束位置
 			// ** 此处是完整的一帧的结束 **
+			if !settleChecksum(state.Env, state.checksumFailed, metrics) {
+				logger.Warn("校验失败，丢弃本帧", zap.String("frameHex", hex.EncodeToString(ring.Snapshot(start, end))))
+				ring.Unmark()
+				state.Reset()
+				continue
+			}
 
+			r.tagConn(state.Env.Points)
 			// 3. 自增计数，获取计数，生成帧ID
 			frameId := fmt.Sprintf("%06X", metrics.IncMsgProcessed("byteParser"))
 			// 4. 发送聚合后的数据点
@@ -313,7 +529,44 @@ func (r *ByteParser) StartWithRingBuffer(ring *pkg.RingBuffer, sink pkg.Parser2D
 				zap.String("count", frameId), // 使用 6 位 16 进制数格式化 count
 				zap.String("frame", hexRaw))  // frame 转为16进制字符串
 			// 6. 重置状态
+			ring.Unmark()
 			state.Reset()
 		}
 	}
 }
+
+// settleChecksum 根据本帧的校验结果处理数据点, 返回 false 表示丢弃本帧
+func settleChecksum(env *BEnv, failed string, metrics *pkg.LabeledMetrics) bool {
+	if failed == "" {
+		return true
+	}
+	metrics.IncMsgErrors("checksum")
+	if failed == ChecksumTag {
+		tagMismatch(env)
+		return true
+	}
+	return false
+}
+
+// processFrame 从 RingBuffer 中解析一帧数据
+func (r *ByteParser) processFrame(state *StreamState) error {
+	current := r.Nodes[0]
+	processedNodeCount := 0
+	for current != nil {
+		// --- 死循环检测 ---
+		if processedNodeCount >= maxNodes {
+			pkg.LoggerFromContext(r.ctx).Error("死循环防护触发：处理节点数超过最大限制",
+				zap.Int("maxNodes", maxNodes),
+				zap.Int("processedCount", processedNodeCount),
+				zap.Stringer("lastNode", current))
+			return errors.New("死循环防护触发：处理节点数超过最大限制")
+		}
+		next, err := current.ProcessWithRing(r.ctx, state)
+		if err != nil {
+			return err
+		}
+		current = next
+		processedNodeCount++ // 增加计数
+	}
+	return nil
+}
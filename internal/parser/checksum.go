@@ -0,0 +1,150 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"gateway/internal/pkg/checksum"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// 校验失败时的处理方式
+const (
+	ChecksumDrop   = "drop"   // 丢弃整帧, 继续解析下一帧 (默认)
+	ChecksumTag    = "tag"    // 保留数据, 为本帧所有点添加 checksum=mismatch 标签
+	ChecksumResync = "resync" // 视为数据错误, 由解析器重新同步 (需配置 parser.config.resync, 否则断开连接)
+)
+
+// ChecksumTagKey 校验失败时添加到点上的标签
+const ChecksumTagKey = "checksum"
+
+// ErrChecksumMismatch 校验失败且处理方式为 resync 时返回的错误
+var ErrChecksumMismatch = errors.New("校验失败")
+
+// Checksum 定义了 Section 的校验步骤
+// 在 Section 表达式执行之后、路由之前比较 Expect 与 Actual 两个表达式的结果, 例如:
+//
+//	Checksum:
+//	  expect: "Bytes[0] + Bytes[1] * 256"           # 帧中携带的校验值 (小端)
+//	  actual: "CRC16_MODBUS(Frame[0:len(Frame)-2])" # 根据帧数据计算的校验值
+//	  onMismatch: drop
+type Checksum struct {
+	Expect     string `mapstructure:"expect"`
+	Actual     string `mapstructure:"actual"`
+	OnMismatch string `mapstructure:"onMismatch"`
+
+	expectProgram *vm.Program
+	actualProgram *vm.Program
+}
+
+// compile 编译校验表达式并检查处理方式
+func (c *Checksum) compile() error {
+	if c.Expect == "" || c.Actual == "" {
+		return errors.New("Checksum 需要同时配置 expect 和 actual")
+	}
+	switch c.OnMismatch {
+	case "":
+		c.OnMismatch = ChecksumDrop
+	case ChecksumDrop, ChecksumTag, ChecksumResync:
+	default:
+		return fmt.Errorf("Checksum.onMismatch 无效: %s, 可选 drop|tag|resync", c.OnMismatch)
+	}
+	var err error
+	if c.expectProgram, err = expr.Compile(c.Expect, BuildSectionExprOptions()...); err != nil {
+		return fmt.Errorf("编译 Checksum.expect 失败: %w", err)
+	}
+	if c.actualProgram, err = expr.Compile(c.Actual, BuildSectionExprOptions()...); err != nil {
+		return fmt.Errorf("编译 Checksum.actual 失败: %w", err)
+	}
+	return nil
+}
+
+// verify 执行校验, 返回两个表达式是否相等
+func (c *Checksum) verify(env *BEnv) (bool, any, any, error) {
+	expect, err := expr.Run(c.expectProgram, env)
+	if err != nil {
+		return false, nil, nil, fmt.Errorf("执行 Checksum.expect 失败: %w", err)
+	}
+	actual, err := expr.Run(c.actualProgram, env)
+	if err != nil {
+		return false, expect, nil, fmt.Errorf("执行 Checksum.actual 失败: %w", err)
+	}
+	e, eok := toInt64(expect)
+	a, aok := toInt64(actual)
+	if eok && aok {
+		return e == a, expect, actual, nil
+	}
+	return fmt.Sprint(expect) == fmt.Sprint(actual), expect, actual, nil
+}
+
+// toInt64 将表达式返回的整数统一为 int64, 便于比较不同宽度的校验值
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case float64:
+		if n == float64(int64(n)) {
+			return int64(n), true
+		}
+	}
+	return 0, false
+}
+
+// tagMismatch 为本帧所有点添加校验失败标签
+func tagMismatch(env *BEnv) {
+	for _, point := range env.Points {
+		if point.Tag == nil {
+			point.Tag = make(map[string]any)
+		}
+		point.Tag[ChecksumTagKey] = "mismatch"
+	}
+}
+
+/* ---------- 校验相关的 expr helper ---------- */
+
+// checksumFunc 将一个校验算法包装为 expr 函数, 参数为字节切片, 返回 int
+func checksumFunc(name string, fn func([]byte) int) expr.Option {
+	return expr.Function(
+		name,
+		func(params ...any) (any, error) {
+			if len(params) != 1 {
+				return nil, fmt.Errorf("%s 需要一个参数", name)
+			}
+			data, ok := params[0].([]byte)
+			if !ok {
+				return nil, fmt.Errorf("%s 参数需要 []byte, 得到 %T", name, params[0])
+			}
+			return fn(data), nil
+		},
+		new(func([]byte) int),
+	)
+}
+
+// checksumHelpers 校验相关的 expr 函数, 通常作用于 Frame 的一段, 例如 CRC16_MODBUS(Frame[0:len(Frame)-2])
+var checksumHelpers = []expr.Option{
+	checksumFunc("CRC16_MODBUS", func(data []byte) int { return int(checksum.CRC16Modbus(data)) }),
+	checksumFunc("CRC16_CCITT", func(data []byte) int { return int(checksum.CRC16CCITT(data)) }),
+	checksumFunc("CRC16_X25", func(data []byte) int { return int(checksum.CRC16X25(data)) }),
+	checksumFunc("CRC32", func(data []byte) int { return int(checksum.CRC32(data)) }),
+	checksumFunc("SUM8", func(data []byte) int { return int(checksum.Sum8(data)) }),
+	checksumFunc("XOR8", func(data []byte) int { return int(checksum.Xor8(data)) }),
+}
@@ -0,0 +1,381 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gateway/internal/pkg"
+	"math"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+/* ---------- 字节解码相关的 expr helper ---------- */
+
+// 字节序, 以 4 字节值 0xAABBCCDD 在帧中的排列为例:
+//
+//	big    / ABCD: AA BB CC DD (默认)
+//	little / DCBA: DD CC BB AA
+//	BADC         : BB AA DD CC (字内字节交换)
+//	CDAB         : CC DD AA BB (字交换, 常见于 Modbus 的 32 位值)
+//
+// BADC 与 CDAB 以 2 字节为单位调整, 对 2 字节值分别等同于 little 与 big
+const (
+	EndianBig    = "big"
+	EndianLittle = "little"
+	EndianBADC   = "BADC"
+	EndianCDAB   = "CDAB"
+)
+
+// reorder 按字节序将 data 的前 n 个字节整理为大端序, 返回新的切片
+func reorder(data []byte, n int, endian string) ([]byte, error) {
+	if len(data) < n {
+		return nil, fmt.Errorf("需要至少 %d 字节数据, 得到 %d", n, len(data))
+	}
+	out := make([]byte, n)
+	copy(out, data[:n])
+	switch strings.ToUpper(endian) {
+	case "", "BIG", "ABCD":
+	case "LITTLE", "DCBA":
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+	case "BADC":
+		for i := 0; i+1 < n; i += 2 {
+			out[i], out[i+1] = out[i+1], out[i]
+		}
+	case "CDAB":
+		// 按 2 字节为单位逆序
+		for i, j := 0, n-2; i < j; i, j = i+2, j-2 {
+			out[i], out[i+1], out[j], out[j+1] = out[j], out[j+1], out[i], out[i+1]
+		}
+	default:
+		return nil, fmt.Errorf("无效的字节序: %s, 可选 big|little|BADC|CDAB", endian)
+	}
+	return out, nil
+}
+
+// DecodeUint 按字节序将 data 的前 n (1~8) 个字节解码为无符号整数
+func DecodeUint(data []byte, n int, endian string) (uint64, error) {
+	if n < 1 || n > 8 {
+		return 0, fmt.Errorf("整数宽度需要在 1~8 字节之间, 得到 %d", n)
+	}
+	b, err := reorder(data, n, endian)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// DecodeInt 按字节序将 data 的前 n (1~8) 个字节解码为有符号整数 (二进制补码)
+func DecodeInt(data []byte, n int, endian string) (int64, error) {
+	v, err := DecodeUint(data, n, endian)
+	if err != nil {
+		return 0, err
+	}
+	return SignExtend(v, n*8), nil
+}
+
+// DecodeFloat32 按字节序将 data 的前 4 个字节解码为 IEEE754 单精度浮点数
+func DecodeFloat32(data []byte, endian string) (float32, error) {
+	v, err := DecodeUint(data, 4, endian)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float32frombits(uint32(v)), nil
+}
+
+// DecodeFloat64 按字节序将 data 的前 8 个字节解码为 IEEE754 双精度浮点数
+func DecodeFloat64(data []byte, endian string) (float64, error) {
+	v, err := DecodeUint(data, 8, endian)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(v), nil
+}
+
+// DecodeBCD 将压缩 BCD 码 (每字节两位十进制数, 高半字节在前) 解码为整数
+// 例如 0x12 0x34 解码为 1234
+func DecodeBCD(data []byte) (int64, error) {
+	if len(data) == 0 {
+		return 0, errors.New("BCD 数据为空")
+	}
+	if len(data) > 9 {
+		return 0, fmt.Errorf("BCD 数据最长 9 字节, 得到 %d", len(data))
+	}
+	var v int64
+	for _, c := range data {
+		hi, lo := c>>4, c&0x0F
+		if hi > 9 || lo > 9 {
+			return 0, fmt.Errorf("无效的 BCD 字节: 0x%02X", c)
+		}
+		v = v*100 + int64(hi)*10 + int64(lo)
+	}
+	return v, nil
+}
+
+// ExtractBits 提取 v 中从第 start 位 (最低位为 0) 开始的 length 位
+func ExtractBits(v uint64, start, length int) (uint64, error) {
+	if start < 0 || length < 1 || start+length > 64 {
+		return 0, fmt.Errorf("位范围无效: start=%d, length=%d", start, length)
+	}
+	v >>= uint(start)
+	if length == 64 {
+		return v, nil
+	}
+	return v & (1<<uint(length) - 1), nil
+}
+
+// SignExtend 将 v 的低 width 位视为二进制补码并扩展为 int64, width 超出 1~64 时按 64 处理
+func SignExtend(v uint64, width int) int64 {
+	if width <= 0 || width >= 64 {
+		return int64(v)
+	}
+	shift := uint(64 - width)
+	return int64(v<<shift) >> shift
+}
+
+// DecodeASCII 将字节解码为字符串, 去掉末尾的 NUL 和空格填充
+func DecodeASCII(data []byte) string {
+	return string(bytes.TrimRight(data, "\x00 "))
+}
+
+// DecodeGBK 将 GBK 编码的字节解码为字符串, 去掉末尾的 NUL 和空格填充
+func DecodeGBK(data []byte) (string, error) {
+	out, err := simplifiedchinese.GBK.NewDecoder().Bytes(bytes.TrimRight(data, "\x00 "))
+	if err != nil {
+		return "", fmt.Errorf("GBK 解码失败: %w", err)
+	}
+	return string(out), nil
+}
+
+// toUint64 将表达式中的整数参数 (如 Bytes[0] 或 Vars.x) 统一为 uint64
+func toUint64(v any) (uint64, bool) {
+	n, ok := toInt64(v)
+	return uint64(n), ok
+}
+
+// decodeArgs 解析 (data []byte[, endian string]) 形式的参数
+func decodeArgs(name string, params []any) ([]byte, string, error) {
+	if len(params) < 1 || len(params) > 2 {
+		return nil, "", fmt.Errorf("%s 需要一个或两个参数", name)
+	}
+	data, ok := params[0].([]byte)
+	if !ok {
+		return nil, "", fmt.Errorf("%s 第一个参数需要 []byte, 得到 %T", name, params[0])
+	}
+	endian := EndianBig
+	if len(params) == 2 {
+		if endian, ok = params[1].(string); !ok {
+			return nil, "", fmt.Errorf("%s 第二个参数需要 string, 得到 %T", name, params[1])
+		}
+	}
+	return data, endian, nil
+}
+
+// intFunc 注册一个 n 字节整数解码函数, 形如 Uint16(Bytes[0:2]) 或 Int32(Bytes, 'little')
+// Uint64 返回 uint64, 避免不小于 2^63 的值转换为 int 后变为负数, 其余函数返回 int
+func intFunc(name string, n int, signed bool) expr.Option {
+	if n == 8 && !signed {
+		return expr.Function(
+			name,
+			func(params ...any) (any, error) {
+				data, endian, err := decodeArgs(name, params)
+				if err != nil {
+					return nil, err
+				}
+				v, err := DecodeUint(data, n, endian)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				return v, nil
+			},
+			new(func([]byte) uint64),
+			new(func([]byte, string) uint64),
+		)
+	}
+	return expr.Function(
+		name,
+		func(params ...any) (any, error) {
+			data, endian, err := decodeArgs(name, params)
+			if err != nil {
+				return nil, err
+			}
+			if signed {
+				v, err := DecodeInt(data, n, endian)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				return int(v), nil
+			}
+			v, err := DecodeUint(data, n, endian)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			return int(v), nil
+		},
+		new(func([]byte) int),
+		new(func([]byte, string) int),
+	)
+}
+
+// floatFunc 注册一个 IEEE754 浮点数解码函数
+func floatFunc(name string, n int) expr.Option {
+	return expr.Function(
+		name,
+		func(params ...any) (any, error) {
+			data, endian, err := decodeArgs(name, params)
+			if err != nil {
+				return nil, err
+			}
+			if n == 4 {
+				v, err := DecodeFloat32(data, endian)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", name, err)
+				}
+				return float64(v), nil
+			}
+			v, err := DecodeFloat64(data, endian)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			return v, nil
+		},
+		new(func([]byte) float64),
+		new(func([]byte, string) float64),
+	)
+}
+
+// decodeHelpers 字节解码相关的 expr 函数, 字节序参数可省略, 默认为大端
+//
+//	Uint8/Int8/Uint16/Int16/Uint32/Int32/Int64(bytes[, endian]) int
+//	Uint64(bytes[, endian]) uint64
+//	Float32/Float64(bytes[, endian]) float64
+//	BCD(bytes) int                         压缩 BCD 码
+//	Bit(v, n) bool                         v 的第 n 位 (最低位为 0) 是否为 1
+//	Bits(v, start, length) int             v 中从第 start 位开始的 length 位
+//	SignExtend(v, width) int               将 v 的低 width 位按二进制补码解释
+//	ASCII(bytes) / GBK(bytes) string       字符串, 去掉末尾的 NUL 和空格
+//	Scale(v, factor[, offset]) float64     v * factor + offset
+var decodeHelpers = []expr.Option{
+	intFunc("Uint8", 1, false),
+	intFunc("Int8", 1, true),
+	intFunc("Uint16", 2, false),
+	intFunc("Int16", 2, true),
+	intFunc("Uint32", 4, false),
+	intFunc("Int32", 4, true),
+	intFunc("Uint64", 8, false),
+	intFunc("Int64", 8, true),
+	floatFunc("Float32", 4),
+	floatFunc("Float64", 8),
+	expr.Function(
+		"BCD",
+		func(params ...any) (any, error) {
+			data, ok := params[0].([]byte)
+			if !ok {
+				return nil, fmt.Errorf("BCD 参数需要 []byte, 得到 %T", params[0])
+			}
+			v, err := DecodeBCD(data)
+			if err != nil {
+				return nil, fmt.Errorf("BCD: %w", err)
+			}
+			return int(v), nil
+		},
+		new(func([]byte) int),
+	),
+	expr.Function(
+		"Bit",
+		func(params ...any) (any, error) {
+			v, vok := toUint64(params[0])
+			n, nok := toInt64(params[1])
+			if !vok || !nok {
+				return nil, fmt.Errorf("Bit 参数需要整数, 得到 %T, %T", params[0], params[1])
+			}
+			bit, err := ExtractBits(v, int(n), 1)
+			if err != nil {
+				return nil, fmt.Errorf("Bit: %w", err)
+			}
+			return bit == 1, nil
+		},
+		new(func(any, any) bool),
+	),
+	expr.Function(
+		"Bits",
+		func(params ...any) (any, error) {
+			v, vok := toUint64(params[0])
+			start, sok := toInt64(params[1])
+			length, lok := toInt64(params[2])
+			if !vok || !sok || !lok {
+				return nil, fmt.Errorf("Bits 参数需要整数, 得到 %T, %T, %T", params[0], params[1], params[2])
+			}
+			bits, err := ExtractBits(v, int(start), int(length))
+			if err != nil {
+				return nil, fmt.Errorf("Bits: %w", err)
+			}
+			return int(bits), nil
+		},
+		new(func(any, any, any) int),
+	),
+	expr.Function(
+		"SignExtend",
+		func(params ...any) (any, error) {
+			v, vok := toUint64(params[0])
+			width, wok := toInt64(params[1])
+			if !vok || !wok {
+				return nil, fmt.Errorf("SignExtend 参数需要整数, 得到 %T, %T", params[0], params[1])
+			}
+			if width < 1 || width > 64 {
+				return nil, fmt.Errorf("SignExtend 位宽需要在 1~64 之间, 得到 %d", width)
+			}
+			return int(SignExtend(v, int(width))), nil
+		},
+		new(func(any, any) int),
+	),
+	expr.Function(
+		"ASCII",
+		func(params ...any) (any, error) {
+			data, ok := params[0].([]byte)
+			if !ok {
+				return nil, fmt.Errorf("ASCII 参数需要 []byte, 得到 %T", params[0])
+			}
+			return DecodeASCII(data), nil
+		},
+		new(func([]byte) string),
+	),
+	expr.Function(
+		"GBK",
+		func(params ...any) (any, error) {
+			data, ok := params[0].([]byte)
+			if !ok {
+				return nil, fmt.Errorf("GBK 参数需要 []byte, 得到 %T", params[0])
+			}
+			return DecodeGBK(data)
+		},
+		new(func([]byte) string),
+	),
+	expr.Function(
+		"Scale",
+		func(params ...any) (any, error) {
+			if len(params) < 2 || len(params) > 3 {
+				return nil, errors.New("Scale 需要两个或三个参数")
+			}
+			var nums [3]float64
+			for i, p := range params {
+				n, ok := pkg.ToFloat64(p)
+				if !ok {
+					return nil, fmt.Errorf("Scale 第 %d 个参数需要数值, 得到 %T", i+1, p)
+				}
+				nums[i] = n
+			}
+			return nums[0]*nums[1] + nums[2], nil
+		},
+		new(func(any, any) float64),
+		new(func(any, any, any) float64),
+	),
+}
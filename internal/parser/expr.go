@@ -4,8 +4,6 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"hash/fnv"
-	"sort"
 	"strings"
 	"sync"
 
@@ -22,6 +20,8 @@ import (
 type BEnv struct {
 	// Bytes 是当前 Section 处理的原始字节切片
 	Bytes []byte
+	// Frame 是本帧从起始位置到当前 Section 末尾的全部字节, 用于校验等跨 Section 的计算
+	Frame []byte
 	// Vars 存储由 V() 函数设置的运行时变量
 	Vars map[string]any
 	// Points 是本帧所有映射后的点的集合，Program在此基础上增添
@@ -31,6 +31,8 @@ type BEnv struct {
 	PointsIndex map[uint64]int
 	// GlobalMap 存储全局配置变量
 	GlobalMap map[string]any
+	// Conn 是数据来源的连接信息, 如 Conn.Alias、Conn.RemoteIP, 在连接期间保持不变
+	Conn pkg.ConnInfo
 }
 
 // Reset 清空 BEnv 的 Vars、Fields 和 Bytes，以便复用。
@@ -44,6 +46,7 @@ func (e *BEnv) Reset() {
 	}
 	e.ResetPoints()
 	e.Bytes = nil
+	e.Frame = nil
 }
 
 // ResetPoints 清空 BEnv 的 Points，以便复用。
@@ -53,10 +56,12 @@ func (e *BEnv) Reset() {
 func (e *BEnv) ResetPoints() {
 
 	// 这里不再释放，交给dispatcher释放，减少拷贝
-	// for _, k := range e.Points {
-	// 	pkg.PointPoolInstance.Put(k)
-	// }
-	e.Points = e.Points[:0]
+	// 注意：Points 切片已随 PointPackage 交给下游，不能复用其底层数组，只能换一个新切片
+	e.Points = make([]*pkg.Point, 0, len(e.Points))
+	// 索引必须与 Points 同步清空，否则下一帧 S() 会命中上一帧的下标
+	for k := range e.PointsIndex {
+		delete(e.PointsIndex, k)
+	}
 }
 
 // S 在 Points 映射中设置一个键值对，并返回 nil。
@@ -67,38 +72,27 @@ func (e *BEnv) ResetPoints() {
 //   - val: 点值
 
 func (e *BEnv) S(tag map[string]any, field map[string]any) any {
-	hash := makeFNVKey(tag)
-	if _, ok := e.PointsIndex[hash]; ok {
+	e.Points = setPoint(e.Points, e.PointsIndex, tag, field)
+	return nil
+}
+
+// setPoint 按 tag 合并点: tag 相同的点追加 Field, 否则创建新点, 返回追加后的 points
+// BEnv 与 JEnv 的 S() 共用该逻辑
+func setPoint(points []*pkg.Point, index map[uint64]int, tag map[string]any, field map[string]any) []*pkg.Point {
+	hash := pkg.TagKey(tag)
+	if i, ok := index[hash]; ok {
 		// 如果点已经存在，则追加其 Field
 		for k, v := range field {
-			e.Points[e.PointsIndex[hash]].Field[k] = v
+			points[i].Field[k] = v
 		}
-		return nil
+		return points
 	}
 	// 如果点不存在，则创建新点
 	point := pkg.PointPoolInstance.Get()
 	point.Tag = tag
 	point.Field = field
-	e.Points = append(e.Points, point)
-	e.PointsIndex[hash] = len(e.Points) - 1
-	return nil
-}
-
-func makeFNVKey(tag map[string]any) uint64 {
-	keys := make([]string, 0, len(tag))
-	for k := range tag {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	h := fnv.New64a()
-	for _, k := range keys {
-		h.Write([]byte(k))
-		h.Write([]byte("="))
-		h.Write([]byte(fmt.Sprint(tag[k])))
-		h.Write([]byte(";"))
-	}
-	return h.Sum64()
+	index[hash] = len(points)
+	return append(points, point)
 }
 
 // V 在 Vars 映射中设置一个键值对，并返回 nil。
@@ -173,22 +167,18 @@ func BuildVarsProgramSource(vars map[string]any) string {
 	return strings.Join(calls, "; ") + ";"
 }
 
-// BuildPointsProgramSource 将 points 映射转换为 F/T 调用语句字符串。
+// BuildPointsProgramSource 将 points 映射转换为 S 调用语句字符串。
 // 输入:
 //   - points: 点名到表达式的映射
 //
 // 输出:
-//   - string: 生成的字符串格式为 "F1(...); T1(...); F2(...); T2(...); F3(...); T3(...); nil"。
+//   - string: 生成的字符串格式为 "S({tag...}, {field...}); S(...); ...;"，点和字段的数量不受限制。
 func BuildPointsProgramSource(points []PointExpression) string {
 	if len(points) == 0 {
 		return "" // 如果没有字段定义，返回空字符串
 	}
 	var calls []string
 	for _, point := range points {
-		if len(point.Field) > 3 {
-			break
-		}
-
 		// 构建正确的expr map语法
 		tagMap := "{"
 		for k, v := range point.Tag {
@@ -226,11 +216,23 @@ func BuildSectionExprOptions() []expr.Option {
 		expr.Env(&BEnv{}),
 	}
 	// 同样需要注册全局辅助函数
-	return append(options, helpers...)
+	options = append(options, helpers...)
+	options = append(options, decodeHelpers...)
+	return append(options, checksumHelpers...)
 }
 
 /* ---------- expr helper 注册 ---------- */
 
+// BuildHelperOptions 返回解析器表达式共用的全局辅助函数 (如 string()、sprintf()),
+// 供解析之后的计算点等阶段编译表达式时复用。
+//
+// 输入: 无
+// 输出:
+//   - []expr.Option: 编译选项切片
+func BuildHelperOptions() []expr.Option {
+	return append([]expr.Option(nil), helpers...)
+}
+
 // helpers 包含注册给 expr 编译器的全局辅助函数选项。
 // 例如 BytesToInt 函数。
 var helpers = []expr.Option{
@@ -292,56 +294,43 @@ var helpers = []expr.Option{
 
 // JEnv 是 JSON 处理的表达式执行环境。
 type JEnv struct {
-	// Data 存储解组后的 JSON 数据 (map[string]interface{})。
-	Data map[string]interface{}
-	// Points 存储由 F() 函数设置的输出点。
-	Points []pkg.Point
+	// Data 存储解组后的 JSON 数据, 通常为 map[string]interface{}, 报文为数组时为 []interface{}
+	Data any
+	// Item 配置 foreach 时为当前遍历到的数组元素, 否则为 nil
+	Item any
+	// Index 配置 foreach 时为当前元素的下标
+	Index int
+	// Topic 消息主题, 非 MQTT 来源时为空
+	Topic string
+	// TopicVars 主题模式中通配符依次匹配到的内容, + 为一级, # 为剩余部分
+	TopicVars []string
+	// Points 存储由 S() 函数设置的输出点
+	Points []*pkg.Point
+	// PointsIndex 是 Points 的索引，用于按 tag 合并点
+	PointsIndex map[uint64]int
 	// GlobalMap 存储全局配置变量。
 	GlobalMap map[string]interface{}
 }
 
 // Reset 清空 JEnv 的 Data 和 Points，以便复用。
 func (e *JEnv) Reset() {
-	// 清空 map 最高效的方式是重新创建
-	e.Data = make(map[string]interface{})
-	e.Points = make([]pkg.Point, 0)
+	e.Data = nil
+	e.Item = nil
+	e.Index = 0
+	e.Topic = ""
+	e.TopicVars = nil
+	// Points 已随 PointPackage 交给下游，只能换一个新切片
+	e.Points = make([]*pkg.Point, 0, len(e.Points))
+	for k := range e.PointsIndex {
+		delete(e.PointsIndex, k)
+	}
 	// GlobalMap 不需要重置，它是共享的
 }
 
-// F1 用于设置第一个点的 Field
-func (e *JEnv) F1(key string, val any) any {
-	e.Points[0].Field[key] = val
-	return nil // Return nil
-}
-
-// F2 用于设置第二个点的 Field
-func (e *JEnv) F2(key string, val any) any {
-	e.Points[1].Field[key] = val
-	return nil // Return nil
-}
-
-// F3 用于设置第三个点的 Field
-func (e *JEnv) F3(key string, val any) any {
-	e.Points[2].Field[key] = val
-	return nil // Return nil
-}
-
-// T1 用于设置第一个点的 Tag
-func (e *JEnv) T1(key string, val any) any {
-	e.Points[0].Tag[key] = val
-	return nil // Return nil
-}
-
-// T2 用于设置第二个点的 Tag
-func (e *JEnv) T2(key string, val any) any {
-	e.Points[1].Tag[key] = val
-	return nil // Return nil
-}
-
-// T3 用于设置第三个点的 Tag
-func (e *JEnv) T3(key string, val any) any {
-	e.Points[2].Tag[key] = val
-	return nil // Return nil
+// S 设置一个点, tag 相同的点合并 Field, 语义与 BEnv.S 相同
+func (e *JEnv) S(tag map[string]any, field map[string]any) any {
+	e.Points = setPoint(e.Points, e.PointsIndex, tag, field)
+	return nil
 }
 
 // JEnvPool 是 JEnv 对象的 sync.Pool，用于复用。
@@ -354,15 +343,10 @@ func NewJEnvPool(globalMap map[string]interface{}) *JEnvPool {
 	return &JEnvPool{
 		Pool: sync.Pool{
 			New: func() any {
-				// 初始化时创建空的 map 和三个预初始化的 Point
 				return &JEnv{
-					Data: make(map[string]interface{}),
-					Points: []pkg.Point{
-						{Tag: make(map[string]interface{}), Field: make(map[string]interface{})},
-						{Tag: make(map[string]interface{}), Field: make(map[string]interface{})},
-						{Tag: make(map[string]interface{}), Field: make(map[string]interface{})},
-					},
-					GlobalMap: globalMap, // 共享全局 map
+					Points:      make([]*pkg.Point, 0),
+					PointsIndex: make(map[uint64]int),
+					GlobalMap:   globalMap, // 共享全局 map
 				}
 			},
 		},
@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"gateway/internal/pkg"
-	"strings"
 	"time"
 
 	"github.com/expr-lang/expr"
@@ -17,31 +16,46 @@ import (
 
 // jParserConfig 定义 JParser 的配置结构
 type jParserConfig struct {
-	// Points 定义了输出点。
+	// Foreach (可选) 返回数组的表达式, 如 "Data['readings']"。
+	// 配置后对数组的每个元素执行一次 Points, 元素通过 Item 访问, 下标通过 Index 访问。
+	Foreach string `mapstructure:"foreach"`
+	// Points 定义了输出点, 数量不限, tag 相同的点合并 Field。
+	// 配置了 Topics 时作为未匹配任何主题的消息的默认点定义, 可省略。
 	Points []PointExpression `mapstructure:"points"`
+	// Topics (可选) 按消息主题选择点定义, 按配置顺序匹配第一个主题模式。
+	// 通配符匹配到的内容通过 TopicVars 访问。
+	Topics []topicTemplate `mapstructure:"topics"`
 	// GlobalMap (可选) 存储全局变量，可在表达式中访问。
 	GlobalMap map[string]interface{} `mapstructure:"globalMap"`
 }
 
 // BuildJExprOptions 返回用于编译 JSON 处理表达式的 expr 选项。
-// 环境设置为 *JEnv，允许访问 Data 和调用 F()。
+// 环境设置为 *JEnv，允许访问 Data、Item 和调用 S()。
 func BuildJExprOptions() []expr.Option {
 	options := []expr.Option{
 		expr.Env(&JEnv{}), // 环境是 JEnv 指针
-		// 可以选择性地添加 helpers，如果需要的话
-		// expr.Function(...)
 	}
-	// 可以添加全局辅助函数，如果它们也适用于 JSON 处理
-	// options = append(options, helpers...)
-	return options
+	// 全局辅助函数同样适用于 JSON 处理, 如 string()、sprintf()
+	return append(options, helpers...)
+}
+
+// CompileJParserProgram 将点定义编译为 S() 调用组成的程序
+func CompileJParserProgram(points []PointExpression) (*vm.Program, error) {
+	source := BuildPointsProgramSource(points) + "nil"
+	program, err := expr.Compile(source, BuildJExprOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("编译表达式失败 (source: %s): %w", source, err)
+	}
+	return program, nil
 }
 
 // JParser 用于解析 JSON 数据并根据表达式提取字段。
 type JParser struct {
 	ctx           context.Context
 	jParserConfig jParserConfig
-	jEnvPool      *JEnvPool   // 重命名以避免与类型冲突
-	program       *vm.Program // 单一编译后的程序
+	jEnvPool      *JEnvPool    // 重命名以避免与类型冲突
+	templates     []*jTemplate // 按 Topics 顺序编译的点定义
+	fallback      *jTemplate   // 默认点定义 (Points), 未配置时为 nil
 }
 
 // NewJsonParser 创建一个新的 JParser 实例。
@@ -59,33 +73,37 @@ func NewJsonParser(ctx context.Context) (*JParser, error) {
 	logger.Debug("jParser config loaded", zap.Any("config", jC))
 
 	// 2. 验证配置
-	if len(jC.Points) == 0 {
-		err := errors.New("jParser config requires a non-empty 'points' list")
+	if len(jC.Points) == 0 && len(jC.Topics) == 0 {
+		err := errors.New("jParser config requires a non-empty 'points' or 'topics' list")
 		logger.Error(err.Error())
 		return nil, err
 	}
 
-	logger.Info("jParser config validated", zap.String("Points", fmt.Sprintf("%v", jC.Points)), zap.Int("point_count", len(jC.Points)))
+	logger.Info("jParser config validated", zap.String("Points", fmt.Sprintf("%v", jC.Points)), zap.Int("point_count", len(jC.Points)), zap.Int("topic_count", len(jC.Topics)))
 
-	// 3. 构建组合的表达式源码
-	var calls []string
-	for i, point := range jC.Points {
-		for field, expr := range point.Field {
-			calls = append(calls, fmt.Sprintf("F%d(%q, %s)", i+1, field, expr))
+	// 3. 编译各主题的点定义, 每个点生成一个 S() 调用
+	templates := make([]*jTemplate, 0, len(jC.Topics))
+	for _, t := range jC.Topics {
+		if t.Topic == "" {
+			return nil, errors.New("jParser topics 中的 topic 不能为空")
 		}
-		for tag, expr := range point.Tag {
-			calls = append(calls, fmt.Sprintf("T%d(%q, %s)", i+1, tag, expr))
+		template, err := compileTemplate(t.Topic, t.Foreach, t.Points)
+		if err != nil {
+			logger.Error("Failed to compile jParser topic", zap.String("topic", t.Topic), zap.Error(err))
+			return nil, err
 		}
+		templates = append(templates, template)
 	}
-	// 添加最终的 nil 返回值，确保表达式总有返回值
-	source := strings.Join(calls, "; ") + "; nil"
-	logger.Debug("Compiled jParser source", zap.String("source", source))
 
-	// 4. 编译表达式
-	program, err := expr.Compile(source, BuildJExprOptions()...)
-	if err != nil {
-		logger.Error("Failed to compile jParser expression", zap.String("source", source), zap.Error(err))
-		return nil, fmt.Errorf("编译表达式失败: %w", err)
+	// 4. 编译默认点定义
+	var fallback *jTemplate
+	if len(jC.Points) > 0 {
+		var err error
+		fallback, err = compileTemplate("", jC.Foreach, jC.Points)
+		if err != nil {
+			logger.Error("Failed to compile jParser expression", zap.Error(err))
+			return nil, err
+		}
 	}
 	logger.Info("jParser expression compiled successfully")
 
@@ -94,16 +112,17 @@ func NewJsonParser(ctx context.Context) (*JParser, error) {
 		ctx:           ctx,
 		jParserConfig: jC,
 		jEnvPool:      NewJEnvPool(jC.GlobalMap), // 使用新的 Pool 名称
-		program:       program,
+		templates:     templates,
+		fallback:      fallback,
 	}
 	logger.Info("JParser initialized successfully", zap.String("points", fmt.Sprintf("%v", parser.jParserConfig.Points)))
 	return parser, nil
 }
 
 // Start 启动 JSON 解析器，监听输入通道并将结果发送到输出通道。
-func (j *JParser) Start(rawChan chan []byte, sink chan *pkg.PointPackage) {
+func (j *JParser) Start(rawChan chan Message, sink chan *pkg.PointPackage) {
 	logger := pkg.LoggerFromContext(j.ctx)
-	metrics := pkg.GetPerformanceMetrics() // 获取性能指标实例
+	metrics := pkg.MetricsFromContext(j.ctx) // 获取带标签的性能指标
 
 	logger.Info("=== jParser started processing data ===")
 
@@ -112,20 +131,21 @@ func (j *JParser) Start(rawChan chan []byte, sink chan *pkg.PointPackage) {
 		case <-j.ctx.Done():
 			logger.Info("jParser stopping due to context done.")
 			return
-		case data := <-rawChan:
+		case msg := <-rawChan:
+			data := msg.Payload
 			ts := time.Now() // 记录处理开始时间
 			metrics.IncMsgReceived("jParser")
-			logger.Debug("Received JSON data", zap.Int("bytes", len(data)))
+			logger.Debug("Received JSON data", zap.String("topic", msg.Topic), zap.Int("bytes", len(data)))
 
 			// 处理 JSON 数据
 			processTimer := metrics.NewTimer("jParser_process")
-			pointList, err := j.process(data)
+			pointList, err := j.process(msg.Topic, data)
 			processTimer.Stop()
 
 			if err != nil {
 				metrics.IncErrorCount()
 				metrics.IncMsgErrors("jParser_process") // 使用更具体的指标名称
-				logger.Error("Failed to process JSON data", zap.Error(err), zap.ByteString("raw_data", data))
+				logger.Error("Failed to process JSON data", zap.Error(err), zap.String("topic", msg.Topic), zap.ByteString("raw_data", data))
 				// 考虑是否需要释放 data (如果来自对象池)
 				continue // 继续处理下一条消息
 			}
@@ -161,14 +181,27 @@ func (j *JParser) Start(rawChan chan []byte, sink chan *pkg.PointPackage) {
 	}
 }
 
-// process 处理单条 JSON 数据。
-func (j *JParser) process(js []byte) ([]*pkg.Point, error) { // 返回切片和错误
+// Parse 同步解析一条消息, 不会向下游发送数据, 可以并发调用
+// 用于需要将解析错误返回给数据源的连接器 (如 http)
+func (j *JParser) Parse(msg Message) ([]*pkg.Point, error) {
+	return j.process(msg.Topic, msg.Payload)
+}
+
+// process 处理单条 JSON 数据, topic 用于选择点定义。
+func (j *JParser) process(topic string, js []byte) ([]*pkg.Point, error) { // 返回切片和错误
 	logger := pkg.LoggerFromContext(j.ctx)
 	// metrics := pkg.GetPerformanceMetrics() // 在 Start 中处理
 
-	// 1. 获取/重置环境
+	// 1. 按主题选择点定义
+	template, topicVars := j.selectTemplate(topic)
+	if template == nil {
+		return nil, fmt.Errorf("主题 %q 没有匹配的点定义", topic)
+	}
+
+	// 获取/重置环境
 	env := j.jEnvPool.Get()
 	defer j.jEnvPool.Put(env) // 确保环境被放回池中
+	env.Topic, env.TopicVars = topic, topicVars
 
 	// 2. 解组 JSON 到 env.Data
 	// 注意: json.Unmarshal 会覆盖 env.Data 的内容
@@ -181,14 +214,11 @@ func (j *JParser) process(js []byte) ([]*pkg.Point, error) { // 返回切片和
 	}
 	logger.Debug("JSON unmarshalled successfully", zap.Any("data_map", env.Data))
 
-	// 3. 运行编译好的程序，填充 env.Fields
-	_, err := expr.Run(j.program, env)
-	if err != nil {
-		// metrics.IncErrorCount() // 在 Start 中处理
-		// metrics.IncMsgErrors("jParser_expr_run") // 在 Start 中处理
+	// 3. 运行编译好的程序，填充 env.Points
+	if err := template.run(env); err != nil {
 		// 可能需要记录 env.Data 以便调试
 		logger.Error("Failed running compiled expression", zap.Error(err), zap.Any("json_data", env.Data))
-		return nil, fmt.Errorf("运行表达式失败: %w", err) // 包装错误
+		return nil, err
 	}
 	logger.Debug("Expression run completed", zap.Any("generated_fields", env.Points))
 
@@ -199,21 +229,57 @@ func (j *JParser) process(js []byte) ([]*pkg.Point, error) { // 返回切片和
 		return []*pkg.Point{}, nil // 返回空切片，表示没有点生成
 	}
 
-	// 5. 克隆 Point
-	pointList := []*pkg.Point{}
+	// 5. 收集 Point, Points 切片随 PointPackage 交给下游, Put 时 env 会换一个新切片
+	pointList := make([]*pkg.Point, 0, len(env.Points))
 	for _, point := range env.Points {
 		// 只添加有内容的Point（Tag或Field不为空）
 		if len(point.Tag) > 0 || len(point.Field) > 0 {
-			pointList = append(pointList, &pkg.Point{
-				Tag:   point.Tag,
-				Field: point.Field,
-			})
+			pointList = append(pointList, point)
+		} else {
+			pkg.PointPoolInstance.Put(point)
 		}
 	}
 
-	// metrics.IncMsgProcessed("jParser") // 在 Start 中处理
 	logger.Debug("Point generated successfully", zap.Any("fields", pointList))
-	// metrics.IncMsgProcessed("jParser") // 在 Start 中处理
 
 	return pointList, nil
 }
+
+// selectTemplate 按配置顺序返回第一个匹配主题的点定义及通配符匹配到的内容, 都不匹配时返回默认点定义
+func (j *JParser) selectTemplate(topic string) (*jTemplate, []string) {
+	for _, t := range j.templates {
+		if vars, ok := t.match(topic); ok {
+			return t, vars
+		}
+	}
+	return j.fallback, nil
+}
+
+// run 执行点定义程序, 配置了 foreach 时对数组的每个元素执行一次
+func (t *jTemplate) run(env *JEnv) error {
+	if t.foreach == nil {
+		if _, err := expr.Run(t.program, env); err != nil {
+			return fmt.Errorf("运行表达式失败: %w", err)
+		}
+		return nil
+	}
+
+	out, err := expr.Run(t.foreach, env)
+	if err != nil {
+		return fmt.Errorf("运行 foreach 表达式失败: %w", err)
+	}
+	if out == nil {
+		return nil // 路径不存在, 视为空数组
+	}
+	items, ok := out.([]interface{})
+	if !ok {
+		return fmt.Errorf("foreach 表达式结果不是数组: %T", out)
+	}
+	for i, item := range items {
+		env.Item, env.Index = item, i
+		if _, err = expr.Run(t.program, env); err != nil {
+			return fmt.Errorf("运行表达式失败 (foreach index: %d): %w", i, err)
+		}
+	}
+	return nil
+}
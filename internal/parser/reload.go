@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"gateway/internal/pkg"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Definitions 是一组已通过校验的协议定义, 以 protoFile 为键
+type Definitions map[string][]map[string]any
+
+// sequence 是编译后的 Section 序列, 热加载时整体替换
+type sequence struct {
+	nodes    []BProcessor
+	labelMap map[string]int
+}
+
+// registry 记录热加载后的最新协议定义以及正在运行的 ByteParser
+// 新建的 ByteParser 优先使用这里的定义, 运行中的 ByteParser 在帧边界切换到新定义
+var registry = struct {
+	sync.Mutex
+	definitions Definitions
+	live        map[*ByteParser]struct{}
+}{
+	definitions: make(Definitions),
+	live:        make(map[*ByteParser]struct{}),
+}
+
+// CompileDefinitions 从配置中取出所有链路引用的协议文件并逐一编译校验
+// 任意一个协议校验失败都会返回错误, 此时调用方应当放弃本次热加载
+//
+// 输入:
+//   - config: 新加载的配置
+//
+// 输出:
+//   - Definitions: 已通过校验的协议定义
+//   - error: 校验失败的原因
+func CompileDefinitions(config *pkg.Config) (Definitions, error) {
+	defs := make(Definitions)
+	for _, pipeline := range config.GetPipelines() {
+		protoFileValue, ok := lookupFold(pipeline.Parser.Para, "protoFile")
+		if !ok {
+			// 非字节协议的链路 (例如 JSON) 没有 protoFile
+			continue
+		}
+		protoFile, ok := protoFileValue.(string)
+		if !ok || protoFile == "" {
+			return nil, fmt.Errorf("链路 %s 的 protoFile 配置无效: %v", pipeline.Name, protoFileValue)
+		}
+		if _, done := defs[protoFile]; done {
+			continue
+		}
+		rawSections, ok := toSectionList(config.Others[protoFile])
+		if !ok || len(rawSections) == 0 {
+			return nil, fmt.Errorf("协议文件格式错误: %s 不存在或不是一个非空的列表/数组", protoFile)
+		}
+		if _, _, err := BuildSequence(rawSections); err != nil {
+			return nil, fmt.Errorf("协议 %s 校验失败: %w", protoFile, err)
+		}
+		defs[protoFile] = rawSections
+	}
+	return defs, nil
+}
+
+// ApplyDefinitions 发布一组已通过校验的协议定义
+// 之后新建的 ByteParser 直接使用新定义, 运行中的 ByteParser 在解析完当前帧后切换
+//
+// 输出:
+//   - int: 被安排切换的运行中 ByteParser 数量
+func ApplyDefinitions(ctx context.Context, defs Definitions) int {
+	logger := pkg.LoggerFromContext(ctx)
+	registry.Lock()
+	defer registry.Unlock()
+
+	for protoFile, rawSections := range defs {
+		registry.definitions[protoFile] = rawSections
+	}
+	scheduled := 0
+	for parser := range registry.live {
+		rawSections, ok := defs[parser.protoFile]
+		if !ok {
+			continue
+		}
+		// 每个 ByteParser 持有独立的节点, 与 NewByteParser 保持一致
+		nodes, labelMap, err := BuildSequence(rawSections)
+		if err != nil {
+			logger.Error("重新编译协议失败, 保留旧定义", zap.String("protoFile", parser.protoFile), zap.Error(err))
+			continue
+		}
+		parser.pending.Store(&sequence{nodes: nodes, labelMap: labelMap})
+		scheduled++
+	}
+	return scheduled
+}
+
+// definitionOf 返回热加载后的协议定义, 未热加载过时返回 false
+func definitionOf(protoFile string) ([]map[string]any, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+	rawSections, ok := registry.definitions[protoFile]
+	return rawSections, ok
+}
+
+// Register 将运行中的 ByteParser 登记到热加载表中, 返回注销函数
+// StartWithChan/StartWithRingBuffer 会自动登记; 长期持有解析器并反复调用 ParseBytes 的连接器需要自行登记
+func (r *ByteParser) Register() func() {
+	registry.Lock()
+	registry.live[r] = struct{}{}
+	registry.Unlock()
+	return func() {
+		registry.Lock()
+		delete(registry.live, r)
+		registry.Unlock()
+	}
+}
+
+// applyPending 在帧边界检查是否有待切换的新定义, 有则替换当前的节点序列
+func (r *ByteParser) applyPending(nodes *[]BProcessor, labelMap *map[string]int) {
+	next := r.pending.Swap(nil)
+	if next == nil {
+		return
+	}
+	r.Nodes, r.LabelMap = next.nodes, next.labelMap
+	*nodes, *labelMap = next.nodes, next.labelMap
+	pkg.LoggerFromContext(r.ctx).Info("协议定义已热加载", zap.String("protoFile", r.protoFile), zap.Int("nodes", len(next.nodes)))
+}
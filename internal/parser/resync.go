@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gateway/internal/pkg"
+	"strings"
+)
+
+// ErrStreamRead 表示从数据流读取失败 (连接断开、超时等), 与数据本身的错误区分
+// 读取失败时重新同步没有意义, 解析器会直接退出
+var ErrStreamRead = errors.New("读取数据流失败")
+
+// resyncConfig 重新同步配置
+// 配置后, 数据帧解析失败 (路由不匹配、表达式执行失败、超出节点限制等) 不再断开连接,
+// 而是从出错帧的下一个字节开始向后查找同步头, 丢弃中间的数据后继续解析
+type resyncConfig struct {
+	Header  string `mapstructure:"header"`  // 同步头, 十六进制字符串, 例如 "AA55"
+	MaxScan int    `mapstructure:"maxScan"` // 单次重新同步最多丢弃的字节数, 超出后断开连接, 0 表示不限制
+}
+
+// resyncer 编译后的重新同步配置
+type resyncer struct {
+	header  []byte
+	maxScan int
+}
+
+// newResyncer 校验并编译重新同步配置, 未配置同步头时返回 nil, 表示不启用
+func newResyncer(c resyncConfig) (*resyncer, error) {
+	if c.Header == "" {
+		return nil, nil
+	}
+	if c.MaxScan < 0 {
+		return nil, fmt.Errorf("resync.maxScan 不能为负数: %d", c.MaxScan)
+	}
+	raw := strings.ReplaceAll(c.Header, " ", "")
+	raw = strings.TrimPrefix(strings.TrimPrefix(raw, "0x"), "0X")
+	header, err := hex.DecodeString(raw)
+	if err != nil || len(header) == 0 {
+		return nil, fmt.Errorf("resync.header 不是有效的十六进制字符串: %q", c.Header)
+	}
+	return &resyncer{header: header, maxScan: c.MaxScan}, nil
+}
+
+// scan 回退到出错帧的起始位置, 从其下一个字节开始查找同步头
+// 返回时读取位置停在同步头上, 下一帧从同步头开始解析
+//
+// 输出:
+//   - int: 丢弃的字节数
+//   - error: 读取失败或超出 maxScan 时返回错误
+func (s *resyncer) scan(ring *pkg.RingBuffer) (int, error) {
+	ring.Rewind()
+	window := make([]byte, len(s.header))
+	discarded := 0
+	for {
+		// 每轮至少前进一个字节, 避免在同一位置反复失败
+		if err := ring.Peek(window[:1]); err != nil {
+			return discarded, fmt.Errorf("%w: %w", ErrStreamRead, err)
+		}
+		discarded += int(ring.Discard(1))
+		if err := ring.Peek(window); err != nil {
+			return discarded, fmt.Errorf("%w: %w", ErrStreamRead, err)
+		}
+		if bytes.Equal(window, s.header) {
+			return discarded, nil
+		}
+		if s.maxScan > 0 && discarded >= s.maxScan {
+			return discarded, fmt.Errorf("重新同步失败: 已丢弃 %d 字节仍未找到同步头 %X", discarded, s.header)
+		}
+	}
+}
@@ -23,7 +23,11 @@ type Section struct {
 	// Desc 描述该 Section 的功能，用于调试和日志记录
 	Desc string `mapstructure:"desc"`
 	// Size 指定该 Section 处理的字节数
-	Size int `mapstructure:"size"`
+	Size int `mapstructure:"-"`
+	// RawSize 是配置中的 size, 可以是整数, 也可以是根据已解码变量计算长度的表达式, 如 "Vars.payload_len * 4"
+	RawSize any `mapstructure:"size"`
+	// MaxSize 是表达式 size 的上限, 超出时视为数据错误, 默认为 defaultMaxSectionSize
+	MaxSize int `mapstructure:"maxSize"`
 	// Points 表达式
 	PointsExpression []PointExpression `mapstructure:"Points"`
 	// Vars 定义变量表达式映射，用于 V() 调用设置变量
@@ -32,11 +36,18 @@ type Section struct {
 	Label string `mapstructure:"Label"`
 	// NextRules 指定该 Section 的下一个 Section，用于标识和分类,改名避免与方法重复
 	NextRules []Rule `mapstructure:"Next"`
+	// Checksum 指定该 Section 的校验步骤，在表达式执行之后、路由之前执行
+	Checksum *Checksum `mapstructure:"Checksum"`
 	// --- 内部字段 ---
-	index   int         // 当前 Section 的索引
-	Program *vm.Program // 存储本节点编译后的表达式
+	index       int         // 当前 Section 的索引
+	Program     *vm.Program // 存储本节点编译后的表达式
+	sizeExpr    string      // size 表达式, 为空表示固定长度
+	sizeProgram *vm.Program // size 表达式编译后的程序
 }
 
+// defaultMaxSectionSize 表达式 size 未配置 maxSize 时的上限
+const defaultMaxSectionSize = 4096
+
 // PointExpression 定义点表达式
 // 格式如下：
 //
@@ -88,8 +99,9 @@ func (s *Skip) ProcessWithRing(ctx context.Context, state *StreamState) (BProces
 	rawPlace := pkg.ByteCache.Get(uint32(s.Skip))
 	err := state.ring.ReadFull(rawPlace)
 	if err != nil {
-		return nil, fmt.Errorf("从 ring buffer 读取 %d 字节失败: %w", s.Skip, err)
+		return nil, fmt.Errorf("%w: 从 ring buffer 读取 %d 字节失败: %w", ErrStreamRead, s.Skip, err)
 	}
+	state.frame = append(state.frame, rawPlace...)
 	next, err := s.Route(ctx, state.Nodes)
 	return next, err
 }
@@ -192,9 +204,9 @@ func BuildSequence(configList []map[string]any) ([]BProcessor, map[string]int, e
 			}
 
 			// +++ 添加对 Size 的校验 +++
-			if tmpSec.Size <= 0 {
+			if err = tmpSec.compileSize(); err != nil {
 				desc, _ := config["desc"].(string)
-				return nil, nil, fmt.Errorf("Section %d (Desc: %s) 配置错误: 'size' 必须大于 0, 实际为 %d", index, desc, tmpSec.Size)
+				return nil, nil, fmt.Errorf("Section %d (Desc: %s) 配置错误: %w", index, desc, err)
 			}
 			// +++++++++++++++++++++++
 
@@ -209,6 +221,12 @@ func BuildSequence(configList []map[string]any) ([]BProcessor, map[string]int, e
 				return nil, nil, fmt.Errorf("编译 Section %d (Desc: %s) 的 Next 失败: %w", index, tmpSec.Desc, err)
 			}
 
+			if tmpSec.Checksum != nil {
+				if err = tmpSec.Checksum.compile(); err != nil {
+					return nil, nil, fmt.Errorf("编译 Section %d (Desc: %s) 的 Checksum 失败: %w", index, tmpSec.Desc, err)
+				}
+			}
+
 			sectionNode := &tmpSec // 创建指针
 			sectionNode.index = index
 			newNode = sectionNode
@@ -243,32 +261,119 @@ type BProcessor interface {
 /* ---------- Chunk 的定义 ---------- */
 
 func (s *Section) String() string {
+	if s.sizeExpr != "" {
+		return fmt.Sprintf("Section: Desc: %s, Size: %s", s.Desc, s.sizeExpr)
+	}
 	return fmt.Sprintf("Section: Desc: %s, Size: %d", s.Desc, s.Size)
 }
 
+// compileSize 解析配置中的 size: 整数为固定长度, 其余字符串按表达式编译
+func (s *Section) compileSize() error {
+	switch v := s.RawSize.(type) {
+	case nil:
+	case int:
+		s.Size = v
+	case float64:
+		if v != float64(int(v)) {
+			return fmt.Errorf("'size' 值 %.2f 不是一个有效的整数", v)
+		}
+		s.Size = int(v)
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			s.Size = n
+			break
+		}
+		program, err := expr.Compile(v, BuildSectionExprOptions()...)
+		if err != nil {
+			return fmt.Errorf("编译 'size' 表达式失败 (size: %s): %w", v, err)
+		}
+		s.sizeExpr = v
+		s.sizeProgram = program
+		if s.MaxSize == 0 {
+			s.MaxSize = defaultMaxSectionSize
+		}
+		if s.MaxSize < 0 {
+			return fmt.Errorf("'maxSize' 不能为负数, 实际为 %d", s.MaxSize)
+		}
+		return nil
+	default:
+		return fmt.Errorf("'size' 类型无效: %T, 期望整数或表达式", s.RawSize)
+	}
+	if s.Size <= 0 {
+		return fmt.Errorf("'size' 必须大于 0, 实际为 %d", s.Size)
+	}
+	return nil
+}
+
+// size 返回本次处理的字节数, 表达式 size 在此时根据 Vars 等已解码的数据求值
+// 表达式的结果允许为 0 (如长度字段为 0 的 TLV), 但不能为负数或超过 MaxSize
+func (s *Section) size(env *BEnv) (int, error) {
+	if s.sizeProgram == nil {
+		if s.Size <= 0 {
+			return 0, fmt.Errorf("Section 大小必须大于0, 当前大小: %d", s.Size)
+		}
+		return s.Size, nil
+	}
+	out, err := expr.Run(s.sizeProgram, env)
+	if err != nil {
+		return 0, fmt.Errorf("执行 size 表达式失败 (size: %s): %w", s.sizeExpr, err)
+	}
+	n, ok := toInt64(out)
+	if !ok {
+		return 0, fmt.Errorf("size 表达式结果不是整数 (size: %s): %v (%T)", s.sizeExpr, out, out)
+	}
+	if n < 0 || n > int64(s.MaxSize) {
+		return 0, fmt.Errorf("size 表达式结果 %d 超出范围 [0, %d] (size: %s)", n, s.MaxSize, s.sizeExpr)
+	}
+	return int(n), nil
+}
+
 func (s *Section) ProcessWithRing(ctx context.Context, state *StreamState) (BProcessor, error) {
 
 	// ----校验，环境准备----
-	if s.Size <= 0 {
-		return nil, fmt.Errorf("Section 大小必须大于0, 当前大小: %d", s.Size)
+	size, err := s.size(state.Env)
+	if err != nil {
+		return nil, err
+	}
+	// I. 固定长度使用 ByteCache 获取预热或新建的 buffer, Get 方法保证返回的 slice 长度等于 size
+	// 表达式长度每帧不同, 直接分配, 避免占满 ByteCache
+	var rawData []byte
+	if s.sizeProgram == nil {
+		rawData = pkg.ByteCache.Get(uint32(size))
+	} else {
+		rawData = make([]byte, size)
 	}
-	// I. 使用 ByteCache 获取预热或新建的 buffer
-	// Get 方法保证返回的 slice 长度等于 s.Size，无需额外检查
-	rawData := pkg.ByteCache.Get(uint32(s.Size))
 
-	_, err := state.ring.Read(rawData)
+	// Read 可能只读到部分数据, 这里必须读满一个 Section
+	err = state.ring.ReadFull(rawData)
 	if err != nil {
 		// 无需放回 ByteCache
-		return nil, fmt.Errorf("从 ring buffer 读取 %d 字节失败: %w", s.Size, err)
+		return nil, fmt.Errorf("%w: 从 ring buffer 读取 %d 字节失败: %w", ErrStreamRead, size, err)
 	}
 
+	state.frame = append(state.frame, rawData...)
 	state.Env.Bytes = rawData
+	state.Env.Frame = state.frame
 
 	_, err = expr.Run(s.Program, state.Env)
 	if err != nil {
 		return nil, fmt.Errorf("执行表达式失败: %w", err)
 	}
 
+	// ----- 校验 ----
+	if s.Checksum != nil && state.verifyChecksum {
+		failed, err := s.check(ctx, state.Env)
+		if err != nil {
+			return nil, err
+		}
+		if failed {
+			if s.Checksum.OnMismatch == ChecksumResync {
+				return nil, fmt.Errorf("%w: Section %s", ErrChecksumMismatch, s.Desc)
+			}
+			state.checksumFailed = s.Checksum.OnMismatch
+		}
+	}
+
 	// ----- 路由 ----
 	next, err := s.Route(ctx, state.Env, state.LabelMap, state.Nodes)
 	return next, err
@@ -424,14 +529,18 @@ func (s *Section) Route(ctx context.Context, env *BEnv, labelMap map[string]int,
 func (s *Section) ProcessWithBytes(ctx context.Context, state *ByteState) (BProcessor, error) {
 	log := pkg.LoggerFromContext(ctx)
 	// I. 检查数据是否足够
-	end := state.Cursor + s.Size
-	log.Debug("节点开始处理", zap.Int("index", s.index), zap.String("desc", s.Desc), zap.Int("size", s.Size))
+	size, err := s.size(state.Env)
+	if err != nil {
+		return nil, err
+	}
+	end := state.Cursor + size
+	log.Debug("节点开始处理", zap.Int("index", s.index), zap.String("desc", s.Desc), zap.Int("size", size))
 
 	if end > len(state.Data) {
 		// 返回原始 out，因为没有修改
-		log.Error("数据不足", zap.Int("size", s.Size), zap.Int("cursor", state.Cursor), zap.Int("data_len", len(state.Data)))
+		log.Error("数据不足", zap.Int("size", size), zap.Int("cursor", state.Cursor), zap.Int("data_len", len(state.Data)))
 		return nil, fmt.Errorf("数据不足，需要 %d 字节 (cursor: %d, end: %d, total: %d)",
-			s.Size, state.Cursor, end, len(state.Data))
+			size, state.Cursor, end, len(state.Data))
 	}
 
 	// II. 获取数据切片 (零拷贝)
@@ -440,13 +549,25 @@ func (s *Section) ProcessWithBytes(ctx context.Context, state *ByteState) (BProc
 
 	// III. 执行表达式
 	state.Env.Bytes = rawData
+	state.Env.Frame = state.Data[:end]
 	log.Debug("处理开始前变量状态", zap.Any("vars", state.Env.Vars))
 
-	_, err := expr.Run(s.Program, state.Env)
+	_, err = expr.Run(s.Program, state.Env)
 	if err != nil {
 		return nil, fmt.Errorf("执行表达式失败: %w", err)
 	}
 
+	// IV. 校验, 离散帧没有重新同步的必要, resync 与 drop 相同
+	if s.Checksum != nil && state.verifyChecksum {
+		failed, err := s.check(ctx, state.Env)
+		if err != nil {
+			return nil, err
+		}
+		if failed {
+			state.checksumFailed = s.Checksum.OnMismatch
+		}
+	}
+
 	// 在所有 Dev 处理完成后移动光标
 	state.Cursor = end
 	log.Debug("处理完成，光标移至位置", zap.Int("cursor", state.Cursor))
@@ -473,6 +594,22 @@ func (s *Section) ProcessWithBytes(ctx context.Context, state *ByteState) (BProc
 	return next, err
 }
 
+// check 执行 Section 的校验步骤, 返回是否校验失败
+func (s *Section) check(ctx context.Context, env *BEnv) (bool, error) {
+	ok, expect, actual, err := s.Checksum.verify(env)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		pkg.LoggerFromContext(ctx).Warn("校验失败",
+			zap.String("desc", s.Desc),
+			zap.Any("expect", expect),
+			zap.Any("actual", actual),
+			zap.String("onMismatch", s.Checksum.OnMismatch))
+	}
+	return !ok, nil
+}
+
 // getIntVar 从 VarStore 获取整数变量值。
 // 支持直接的整数值和存储在 VarStore 中的变量名。
 //
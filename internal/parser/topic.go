@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Message 是消息类连接器 (如 MQTT) 交给解析器的一条消息
+type Message struct {
+	Topic   string // 消息主题, 非 MQTT 来源可为空
+	Payload []byte // 报文, JParser 为 JSON, ByteParser 为一帧完整的二进制数据
+}
+
+// topicTemplate 定义一个主题模式及其对应的点定义
+type topicTemplate struct {
+	// Topic 主题模式, 支持 MQTT 通配符: + 匹配一级, # 匹配剩余所有级 (只能位于末尾)
+	Topic string `mapstructure:"topic"`
+	// Foreach (可选) 同 jParserConfig.Foreach
+	Foreach string `mapstructure:"foreach"`
+	// Points 匹配该主题的消息使用的点定义
+	Points []PointExpression `mapstructure:"points"`
+}
+
+// jTemplate 是编译后的点定义, 默认模板的 segments 为 nil, 匹配所有主题
+type jTemplate struct {
+	topic    string
+	segments []string
+	program  *vm.Program
+	foreach  *vm.Program
+}
+
+// compileTemplate 编译主题模式、foreach 与点定义
+func compileTemplate(topic, foreach string, points []PointExpression) (*jTemplate, error) {
+	t := &jTemplate{topic: topic}
+	if topic != "" {
+		segments, err := parseTopicPattern(topic)
+		if err != nil {
+			return nil, err
+		}
+		t.segments = segments
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("主题 %q 的 points 不能为空", topic)
+	}
+	program, err := CompileJParserProgram(points)
+	if err != nil {
+		return nil, err
+	}
+	t.program = program
+	if foreach != "" {
+		t.foreach, err = expr.Compile(foreach, BuildJExprOptions()...)
+		if err != nil {
+			return nil, fmt.Errorf("编译 foreach 表达式失败 (topic: %q): %w", topic, err)
+		}
+	}
+	return t, nil
+}
+
+// parseTopicPattern 校验并拆分主题模式, 通配符必须独占一级, # 只能位于末尾
+func parseTopicPattern(pattern string) ([]string, error) {
+	segments := strings.Split(pattern, "/")
+	for i, s := range segments {
+		switch {
+		case s == "#" && i != len(segments)-1:
+			return nil, fmt.Errorf("主题模式 %q 中 # 只能位于末尾", pattern)
+		case s != "+" && s != "#" && strings.ContainsAny(s, "+#"):
+			return nil, fmt.Errorf("主题模式 %q 中通配符必须独占一级", pattern)
+		}
+	}
+	return segments, nil
+}
+
+// match 判断主题是否匹配, 返回通配符匹配到的内容: + 为对应的一级, # 为剩余部分 (以 / 连接)
+func (t *jTemplate) match(topic string) ([]string, bool) {
+	if t.segments == nil {
+		return nil, true
+	}
+	// 与 MQTT 一致, 以 $ 开头的系统主题不被首级通配符匹配
+	if strings.HasPrefix(topic, "$") && (t.segments[0] == "+" || t.segments[0] == "#") {
+		return nil, false
+	}
+	levels := strings.Split(topic, "/")
+	vars := make([]string, 0, 2)
+	for i, s := range t.segments {
+		if s == "#" {
+			// a/# 同样匹配 a 本身, 此时 # 匹配到空字符串
+			return append(vars, strings.Join(levels[i:], "/")), true
+		}
+		if i >= len(levels) {
+			return nil, false
+		}
+		switch s {
+		case "+":
+			vars = append(vars, levels[i])
+		case levels[i]:
+		default:
+			return nil, false
+		}
+	}
+	if len(levels) != len(t.segments) {
+		return nil, false
+	}
+	return vars, true
+}
@@ -886,6 +886,63 @@ func TestByteParserProcessing(t *testing.T) {
 	})
 }
 
+func TestByteParserParseBytes(t *testing.T) {
+	Convey("ByteParser.ParseBytes 同步解析测试", t, func() {
+		ctx := MockContext()
+		protoFileName := "test_proto"
+		conf, err := mockConfig(protoFileName, BASE_TEST_YAML, nil, nil)
+		So(err, ShouldBeNil)
+		parser, err := NewByteParser(pkg.WithConfig(ctx, conf))
+		So(err, ShouldBeNil)
+
+		Convey("连续解析多帧时，每帧的点互不影响", func() {
+			first, consumed, err := parser.ParseBytes([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06})
+			So(err, ShouldBeNil)
+			So(consumed, ShouldEqual, 6)
+			So(len(first), ShouldEqual, 4)
+
+			second, _, err := parser.ParseBytes([]byte{0x11, 0x12, 0x13, 0x14, 0x15, 0x16})
+			So(err, ShouldBeNil)
+			So(len(second), ShouldEqual, 4)
+			So(second[0].Field["msg_type"], ShouldEqual, 0x11)
+			// 上一帧返回的点不会被下一帧覆盖
+			So(first[0].Field["msg_type"], ShouldEqual, 0x01)
+		})
+
+		Convey("数据不足时返回错误", func() {
+			_, _, err := parser.ParseBytes([]byte{0x01, 0x02})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "数据不足")
+		})
+	})
+
+	Convey("协议文件为 []interface{} (viper 加载格式) 时也能正常创建", t, func() {
+		conf := &pkg.Config{
+			Parser: pkg.ParserConfig{Para: map[string]interface{}{"protoFile": "viper_proto"}},
+			Others: map[string]interface{}{
+				"viper_proto": []interface{}{
+					map[string]interface{}{
+						"desc": "header",
+						"size": 1,
+						"points": []interface{}{
+							map[string]interface{}{
+								"tag":   map[string]interface{}{"id": "'dev1'"},
+								"field": map[string]interface{}{"value": "Bytes[0]"},
+							},
+						},
+					},
+				},
+			},
+		}
+		parser, err := NewByteParser(pkg.WithConfig(MockContext(), conf))
+		So(err, ShouldBeNil)
+		points, _, err := parser.ParseBytes([]byte{0x2A})
+		So(err, ShouldBeNil)
+		So(len(points), ShouldEqual, 1)
+		So(points[0].Field["value"], ShouldEqual, 0x2A)
+	})
+}
+
 // Helper function to convert map[interface{}]interface{} to map[string]any recursively
 // Moved to pkg/utils or similar if used widely
 func ConvertMapKeysToStrings(input map[string]interface{}, output map[string]any) error {
@@ -0,0 +1,135 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gateway/internal/pkg"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const CHECKSUM_TEST_YAML = `
+modbus_proto:
+  - desc: "数据"
+    size: 6
+    Points:
+      - Tag:
+          id: "'dev1'"
+        Field:
+          v: "Bytes[5]"
+  - desc: "CRC"
+    size: 2
+    Checksum:
+      expect: "Bytes[0] + Bytes[1] * 256"
+      actual: "CRC16_MODBUS(Frame[0:len(Frame)-2])"
+      onMismatch: %s
+`
+
+// newChecksumParser 创建使用 modbus_proto 的解析器, checkCRC 为 nil 时不配置 check_crc
+func newChecksumParser(onMismatch string, checkCRC any) (*ByteParser, error) {
+	config, err := mockConfig("modbus_proto", fmt.Sprintf(CHECKSUM_TEST_YAML, onMismatch), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if checkCRC != nil {
+		config.Connector.Para = map[string]interface{}{"check_crc": checkCRC}
+	}
+	return NewByteParser(pkg.WithConfig(MockContext(), config))
+}
+
+func TestSectionChecksum(t *testing.T) {
+	good := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A, 0xC5, 0xCD}
+	bad := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A, 0xC5, 0xCE}
+
+	Convey("Section 校验步骤", t, func() {
+		Convey("校验通过时正常输出", func() {
+			parser, err := newChecksumParser("drop", nil)
+			So(err, ShouldBeNil)
+			points, consumed, err := parser.ParseBytes(good)
+			So(err, ShouldBeNil)
+			So(consumed, ShouldEqual, 8)
+			So(points[0].Field["v"], ShouldEqual, 0x0A)
+			So(points[0].Tag, ShouldNotContainKey, ChecksumTagKey)
+		})
+
+		Convey("drop: 校验失败时丢弃整帧", func() {
+			parser, err := newChecksumParser("drop", nil)
+			So(err, ShouldBeNil)
+			_, _, err = parser.ParseBytes(bad)
+			So(errors.Is(err, ErrChecksumMismatch), ShouldBeTrue)
+		})
+
+		Convey("tag: 校验失败时为点添加标签", func() {
+			parser, err := newChecksumParser("tag", nil)
+			So(err, ShouldBeNil)
+			points, _, err := parser.ParseBytes(bad)
+			So(err, ShouldBeNil)
+			So(points[0].Tag[ChecksumTagKey], ShouldEqual, "mismatch")
+		})
+
+		Convey("check_crc 为 false 时跳过校验", func() {
+			parser, err := newChecksumParser("drop", false)
+			So(err, ShouldBeNil)
+			points, _, err := parser.ParseBytes(bad)
+			So(err, ShouldBeNil)
+			So(len(points), ShouldEqual, 1)
+
+			_, err = newChecksumParser("drop", "yes")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("无效的 onMismatch 在编译协议时报错", func() {
+			_, err := newChecksumParser("ignore", nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+const CHECKSUM_RESYNC_YAML = `
+resync_proto:
+  - desc: "同步头"
+    size: 2
+    Next:
+      - condition: "Bytes[0] == 0xAA && Bytes[1] == 0x55"
+        target: "DEFAULT"
+  - desc: "数据"
+    size: 1
+    Points:
+      - Tag:
+          id: "'dev1'"
+        Field:
+          v: "Bytes[0]"
+  - desc: "累加和"
+    size: 1
+    Checksum:
+      expect: "Bytes[0]"
+      actual: "SUM8(Frame[0:3])"
+      onMismatch: resync
+`
+
+func TestChecksumResync(t *testing.T) {
+	Convey("resync: 校验失败时重新同步到下一帧", t, func() {
+		// 第二帧的累加和错误
+		stream := []byte{0xAA, 0x55, 0x01, 0x00, 0xAA, 0x55, 0x02, 0x09, 0xAA, 0x55, 0x03, 0x02}
+		config, err := mockConfig("resync_proto", CHECKSUM_RESYNC_YAML, nil, nil)
+		So(err, ShouldBeNil)
+		config.Parser.Para["resync"] = map[string]interface{}{"header": "AA55"}
+		parser, err := NewByteParser(pkg.WithConfig(MockContext(), config))
+		So(err, ShouldBeNil)
+
+		ring, err := pkg.NewRingBuffer(bytes.NewReader(stream), 64)
+		So(err, ShouldBeNil)
+		sink := make(pkg.Parser2DispatcherChan, 10)
+		err = parser.StartWithRingBuffer(ring, sink)
+		So(errors.Is(err, ErrStreamRead), ShouldBeTrue)
+		close(sink)
+
+		var values []any
+		for pointPackage := range sink {
+			values = append(values, pointPackage.Points[0].Field["v"])
+		}
+		So(values, ShouldResemble, []any{byte(0x01), byte(0x03)})
+	})
+}
@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"gateway/internal/pkg"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const CONN_TEST_YAML = `
+conn_proto:
+  - desc: "数据"
+    size: 1
+    Points:
+      - Tag:
+          id: "Conn.Alias + '_' + string(Bytes[0])"
+        Field:
+          v: "Bytes[0]"
+          port: "Conn.RemotePort"
+      - Tag:
+          alias: "'from_frame'"
+        Field:
+          v: "Bytes[0]"
+`
+
+// newConnParser 创建使用 conn_proto 的解析器, ctx 中携带连接信息
+func newConnParser(connectorPara map[string]interface{}) (*ByteParser, error) {
+	config, err := mockConfig("conn_proto", CONN_TEST_YAML, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	config.Connector.Para = connectorPara
+	ctx := pkg.WithConnInfo(pkg.WithConfig(MockContext(), config), pkg.ConnInfo{
+		Connector:  "tcpserver",
+		Alias:      "ER2_1_1_1",
+		RemoteIP:   "172.25.3.108",
+		RemotePort: 50123,
+	})
+	return NewByteParser(ctx)
+}
+
+func TestConnInfo(t *testing.T) {
+	Convey("表达式中可以引用连接信息", t, func() {
+		parser, err := newConnParser(nil)
+		So(err, ShouldBeNil)
+		points, _, err := parser.ParseBytes([]byte{0x07})
+		So(err, ShouldBeNil)
+		So(points[0].Tag["id"], ShouldEqual, "ER2_1_1_1_7")
+		So(points[0].Field["port"], ShouldEqual, 50123)
+		// 未配置 connTags 时不添加标签
+		So(points[0].Tag, ShouldNotContainKey, "alias")
+	})
+
+	Convey("connTags 将连接信息添加为每个点的标签", t, func() {
+		parser, err := newConnParser(map[string]interface{}{"conntags": []interface{}{"alias", "remoteip", "connector"}})
+		So(err, ShouldBeNil)
+		points, _, err := parser.ParseBytes([]byte{0x07})
+		So(err, ShouldBeNil)
+		So(points[0].Tag["alias"], ShouldEqual, "ER2_1_1_1")
+		So(points[0].Tag["remoteIP"], ShouldEqual, "172.25.3.108")
+		So(points[0].Tag["connector"], ShouldEqual, "tcpserver")
+		So(points[0].Tag, ShouldNotContainKey, "remotePort")
+		// 协议中定义的同名标签优先
+		So(points[1].Tag["alias"], ShouldEqual, "from_frame")
+	})
+
+	Convey("connTags 支持逗号分隔的字符串, 未知的键报错", t, func() {
+		_, err := newConnParser(map[string]interface{}{"connTags": "alias, remotePort"})
+		So(err, ShouldBeNil)
+		_, err = newConnParser(map[string]interface{}{"connTags": "alias,mac"})
+		So(err, ShouldNotBeNil)
+	})
+}
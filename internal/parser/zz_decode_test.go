@@ -0,0 +1,180 @@
+package parser
+
+import (
+	"math"
+	"testing"
+
+	"github.com/expr-lang/expr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// evalDecode 在给定 Bytes 的 BEnv 中执行表达式
+func evalDecode(code string, data []byte) (any, error) {
+	program, err := expr.Compile(code, BuildSectionExprOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return expr.Run(program, &BEnv{Bytes: data, Vars: map[string]any{"raw": 0xFFF6}})
+}
+
+func TestDecodeFunctions(t *testing.T) {
+	Convey("整数解码支持多种字节序", t, func() {
+		data := []byte{0xAA, 0xBB, 0xCC, 0xDD}
+		for endian, want := range map[string]uint64{
+			"big":    0xAABBCCDD,
+			"ABCD":   0xAABBCCDD,
+			"little": 0xDDCCBBAA,
+			"DCBA":   0xDDCCBBAA,
+			"BADC":   0xBBAADDCC,
+			"CDAB":   0xCCDDAABB,
+			"cdab":   0xCCDDAABB,
+		} {
+			v, err := DecodeUint(data, 4, endian)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, want)
+		}
+
+		v, err := DecodeUint([]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, 8, "CDAB")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, uint64(0x0708050603040102))
+
+		_, err = DecodeUint(data, 4, "middle")
+		So(err, ShouldNotBeNil)
+		_, err = DecodeUint(data[:3], 4, "big")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("有符号整数按二进制补码解码", t, func() {
+		v, err := DecodeInt([]byte{0xFF, 0xFE}, 2, "big")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, -2)
+		v, err = DecodeInt([]byte{0xFE, 0xFF}, 2, "little")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, -2)
+		v, err = DecodeInt([]byte{0x80}, 1, "big")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, -128)
+		v, err = DecodeInt([]byte{0x7F, 0xFF, 0xFF, 0xFF}, 4, "big")
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, 2147483647)
+
+		So(SignExtend(0xFFF, 12), ShouldEqual, -1)
+		So(SignExtend(0x7FF, 12), ShouldEqual, 2047)
+		So(SignExtend(0x800, 12), ShouldEqual, -2048)
+		So(SignExtend(0x1, 1), ShouldEqual, -1)
+	})
+
+	Convey("IEEE754 浮点数", t, func() {
+		f32, err := DecodeFloat32([]byte{0x41, 0x48, 0x00, 0x00}, "big")
+		So(err, ShouldBeNil)
+		So(f32, ShouldEqual, float32(12.5))
+		f32, err = DecodeFloat32([]byte{0x00, 0x00, 0x41, 0x48}, "CDAB")
+		So(err, ShouldBeNil)
+		So(f32, ShouldEqual, float32(12.5))
+		f64, err := DecodeFloat64([]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xF0, 0xBF}, "little")
+		So(err, ShouldBeNil)
+		So(f64, ShouldEqual, -1.0)
+	})
+
+	Convey("BCD 与位操作", t, func() {
+		v, err := DecodeBCD([]byte{0x12, 0x34, 0x56})
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, 123456)
+		_, err = DecodeBCD([]byte{0x1A})
+		So(err, ShouldNotBeNil)
+
+		bits, err := ExtractBits(0b1011_0110, 1, 3)
+		So(err, ShouldBeNil)
+		So(bits, ShouldEqual, 0b011)
+		bits, err = ExtractBits(0xFFFFFFFFFFFFFFFF, 0, 64)
+		So(err, ShouldBeNil)
+		So(bits, ShouldEqual, uint64(0xFFFFFFFFFFFFFFFF))
+		_, err = ExtractBits(1, 60, 8)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("字符串解码去掉末尾填充", t, func() {
+		So(DecodeASCII([]byte("AB12\x00\x00  ")), ShouldEqual, "AB12")
+		// "温度" 的 GBK 编码
+		s, err := DecodeGBK([]byte{0xCE, 0xC2, 0xB6, 0xC8, 0x00})
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, "温度")
+	})
+}
+
+func TestDecodeHelpers(t *testing.T) {
+	Convey("表达式中使用解码函数", t, func() {
+		data := []byte{0xFF, 0xFE, 0x41, 0x48, 0x00, 0x00, 0x12, 0x34, 0xA5, 'O', 'K', 0x00}
+		cases := []struct {
+			code string
+			want any
+		}{
+			{"Uint16(Bytes[0:2])", 0xFFFE},
+			{"Int16(Bytes[0:2])", -2},
+			{"Int16(Bytes[0:2], 'little')", -257},
+			{"Uint8(Bytes[8:])", 0xA5},
+			{"Int8(Bytes[8:])", -91},
+			{"Uint32(Bytes[2:6], 'big')", 0x41480000},
+			{"Int32(Bytes[2:6], 'CDAB')", 0x00004148},
+			{"Float32(Bytes[2:6])", 12.5},
+			{"BCD(Bytes[6:8])", 1234},
+			{"Bit(Bytes[8], 0)", true},
+			{"Bit(Bytes[8], 1)", false},
+			{"Bits(Bytes[8], 4, 4)", 0xA},
+			{"SignExtend(Bits(Bytes[8], 0, 4), 4)", 5},
+			{"SignExtend(Vars.raw, 16)", -10},
+			{"ASCII(Bytes[9:])", "OK"},
+			{"Scale(Uint16(Bytes[6:8]), 0.1)", 466.0},
+			{"Scale(Bytes[6], 2, -40)", -4.0},
+		}
+		for _, c := range cases {
+			v, err := evalDecode(c.code, data)
+			So(err, ShouldBeNil)
+			if f, ok := c.want.(float64); ok {
+				So(v, ShouldAlmostEqual, f)
+			} else {
+				So(v, ShouldEqual, c.want)
+			}
+		}
+	})
+
+	Convey("64 位整数解码", t, func() {
+		all := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+		v, err := evalDecode("Uint64(Bytes)", all)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, uint64(math.MaxUint64))
+		v, err = evalDecode("Int64(Bytes)", all)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, -1)
+
+		data := []byte{0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+		v, err = evalDecode("Uint64(Bytes)", data)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, uint64(1<<63+1))
+		v, err = evalDecode("Uint64(Bytes, 'little')", data)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, uint64(0x0100000000000080))
+		v, err = evalDecode("Int64(Bytes)", data)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, math.MinInt64+1)
+		v, err = evalDecode("Scale(Uint64(Bytes), 1)", all)
+		So(err, ShouldBeNil)
+		So(v, ShouldAlmostEqual, float64(math.MaxUint64))
+	})
+
+	Convey("参数错误时返回执行错误", t, func() {
+		_, err := evalDecode("Uint32(Bytes[0:2])", []byte{0x01, 0x02})
+		So(err, ShouldNotBeNil)
+		_, err = evalDecode("Uint16(Bytes, 'middle')", []byte{0x01, 0x02})
+		So(err, ShouldNotBeNil)
+		_, err = evalDecode("BCD(Bytes)", []byte{0xFF})
+		So(err, ShouldNotBeNil)
+		_, err = evalDecode("Bits(Bytes[0], 4, 70)", []byte{0xFF})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("字符串参数类型在编译时检查", t, func() {
+		_, err := expr.Compile("Uint16(Bytes, 1)", BuildSectionExprOptions()...)
+		So(err, ShouldNotBeNil)
+	})
+}
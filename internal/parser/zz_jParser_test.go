@@ -2,12 +2,9 @@ package parser
 
 import (
 	"context"
-	"fmt"
 	"gateway/internal/pkg"
-	"strings"
 	"testing"
 
-	"github.com/expr-lang/expr"
 	"github.com/mitchellh/mapstructure"
 	. "github.com/smartystreets/goconvey/convey"
 	"go.uber.org/zap"
@@ -45,17 +42,7 @@ func TestJParser(t *testing.T) {
 				So(len(jC.Points[0].Field) > 0, ShouldBeTrue)
 
 				// Simulate compilation check
-				var calls []string
-				for i, point := range jC.Points {
-					for fieldName, expression := range point.Field {
-						calls = append(calls, fmt.Sprintf("F%d(%q, %s)", i+1, fieldName, expression))
-					}
-					for tagName, expression := range point.Tag {
-						calls = append(calls, fmt.Sprintf("T%d(%q, %s)", i+1, tagName, expression))
-					}
-				}
-				source := strings.Join(calls, "; ") + "; nil"
-				_, compileErr := expr.Compile(source, BuildJExprOptions()...)
+				_, compileErr := CompileJParserProgram(jC.Points)
 				So(compileErr, ShouldBeNil)
 			})
 
@@ -113,17 +100,7 @@ func TestJParser(t *testing.T) {
 				So(err, ShouldBeNil)
 
 				// Simulate compilation check
-				var calls []string
-				for i, point := range jC.Points {
-					for fieldName, expression := range point.Field {
-						calls = append(calls, fmt.Sprintf("F%d(%q, %s)", i+1, fieldName, expression))
-					}
-					for tagName, expression := range point.Tag {
-						calls = append(calls, fmt.Sprintf("T%d(%q, %s)", i+1, tagName, expression))
-					}
-				}
-				source := strings.Join(calls, "; ") + "; nil"
-				_, compileErr := expr.Compile(source, BuildJExprOptions()...)
+				_, compileErr := CompileJParserProgram(jC.Points)
 				So(compileErr, ShouldNotBeNil)
 				So(compileErr.Error(), ShouldContainSubstring, "literal not terminated")
 			})
@@ -153,26 +130,16 @@ func TestJParser(t *testing.T) {
 			}
 			var validJC jParserConfig
 			_ = mapstructure.Decode(validConfigMap, &validJC)
-			var calls []string
-			for i, point := range validJC.Points {
-				for fieldName, expression := range point.Field {
-					calls = append(calls, fmt.Sprintf("F%d(%q, %s)", i+1, fieldName, expression))
-				}
-				for tagName, expression := range point.Tag {
-					calls = append(calls, fmt.Sprintf("T%d(%q, %s)", i+1, tagName, expression))
-				}
-			}
-			source := strings.Join(calls, "; ") + "; nil"
-			validProgram, errCompile1 := expr.Compile(source, BuildJExprOptions()...)
+			validProgram, errCompile1 := CompileJParserProgram(validJC.Points)
 			So(errCompile1, ShouldBeNil) // Assert successful compilation
 
 			mainParser := &JParser{
 				ctx:           pkg.WithLogger(context.Background(), zap.NewNop()),
 				jParserConfig: validJC,
 				jEnvPool:      NewJEnvPool(validJC.GlobalMap),
-				program:       validProgram,
+				fallback:      &jTemplate{program: validProgram},
 			}
-			So(mainParser.program, ShouldNotBeNil)
+			So(mainParser.fallback.program, ShouldNotBeNil)
 
 			// 2. Setup the parser specifically designed to handle empty JSON
 			configHandlesEmptyMap := map[string]interface{}{
@@ -189,26 +156,16 @@ func TestJParser(t *testing.T) {
 			}
 			var jcEmpty jParserConfig
 			_ = mapstructure.Decode(configHandlesEmptyMap, &jcEmpty)
-			var callsEmpty []string
-			for i, point := range jcEmpty.Points {
-				for fieldName, expression := range point.Field {
-					callsEmpty = append(callsEmpty, fmt.Sprintf("F%d(%q, %s)", i+1, fieldName, expression))
-				}
-				for tagName, expression := range point.Tag {
-					callsEmpty = append(callsEmpty, fmt.Sprintf("T%d(%q, %s)", i+1, tagName, expression))
-				}
-			}
-			sourceEmpty := strings.Join(callsEmpty, "; ") + "; nil"
-			programEmpty, errCompile2 := expr.Compile(sourceEmpty, BuildJExprOptions()...)
+			programEmpty, errCompile2 := CompileJParserProgram(jcEmpty.Points)
 			So(errCompile2, ShouldBeNil) // Assert successful compilation
 
 			emptyHandlingParser := &JParser{
 				ctx:           pkg.WithLogger(context.Background(), zap.NewNop()),
 				jParserConfig: jcEmpty,
 				jEnvPool:      NewJEnvPool(nil),
-				program:       programEmpty,
+				fallback:      &jTemplate{program: programEmpty},
 			}
-			So(emptyHandlingParser.program, ShouldNotBeNil)
+			So(emptyHandlingParser.fallback.program, ShouldNotBeNil)
 
 			// --- Test Cases --- Use the appropriate parser instance
 
@@ -222,7 +179,7 @@ func TestJParser(t *testing.T) {
 					"pressure": 1013.2,
 					"status": "ok"
 				}`)
-				pointList, err := mainParser.process(jsonData) // Use mainParser
+				pointList, err := mainParser.process("", jsonData) // Use mainParser
 
 				So(err, ShouldBeNil)
 				So(pointList, ShouldNotBeNil)
@@ -242,7 +199,7 @@ func TestJParser(t *testing.T) {
 
 			Convey("使用主解析器处理无效的JSON语法", func() {
 				invalidJsonData := []byte(`{ "values": { "temp": 25.5, "hum": 60.1 }`)
-				pointList, err := mainParser.process(invalidJsonData) // Use mainParser
+				pointList, err := mainParser.process("", invalidJsonData) // Use mainParser
 				So(err, ShouldNotBeNil)
 				So(err.Error(), ShouldContainSubstring, "unexpected end of JSON input")
 				So(pointList, ShouldBeNil)
@@ -256,7 +213,7 @@ func TestJParser(t *testing.T) {
 						"hum": 59.0
 					}
 				}`)
-				pointList, err := mainParser.process(jsonData) // Use mainParser
+				pointList, err := mainParser.process("", jsonData) // Use mainParser
 
 				So(err, ShouldBeNil)
 				So(pointList, ShouldNotBeNil)
@@ -284,27 +241,17 @@ func TestJParser(t *testing.T) {
 				}
 				var jcNoMatch jParserConfig
 				_ = mapstructure.Decode(configNoMatchMap, &jcNoMatch)
-				var callsNoMatch []string
-				for i, point := range jcNoMatch.Points {
-					for fieldName, expression := range point.Field {
-						callsNoMatch = append(callsNoMatch, fmt.Sprintf("F%d(%q, %s)", i+1, fieldName, expression))
-					}
-					for tagName, expression := range point.Tag {
-						callsNoMatch = append(callsNoMatch, fmt.Sprintf("T%d(%q, %s)", i+1, tagName, expression))
-					}
-				}
-				sourceNoMatch := strings.Join(callsNoMatch, "; ") + "; nil"
-				programNoMatch, compileErr := expr.Compile(sourceNoMatch, BuildJExprOptions()...)
+				programNoMatch, compileErr := CompileJParserProgram(jcNoMatch.Points)
 				So(compileErr, ShouldBeNil)
 				parserNoMatch := &JParser{
 					ctx:           pkg.WithLogger(context.Background(), zap.NewNop()),
 					jParserConfig: jcNoMatch,
 					jEnvPool:      NewJEnvPool(nil),
-					program:       programNoMatch,
+					fallback:      &jTemplate{program: programNoMatch},
 				}
 
 				jsonData := []byte(`{"val": 123}`)
-				pointList, err := parserNoMatch.process(jsonData)
+				pointList, err := parserNoMatch.process("", jsonData)
 
 				So(err, ShouldBeNil)
 				So(pointList, ShouldNotBeNil)
@@ -320,7 +267,7 @@ func TestJParser(t *testing.T) {
 				emptyJson := []byte(`{}`)
 
 				Convey("使用主解析器（期望nil字段）", func() {
-					pointList, err := mainParser.process(emptyJson)
+					pointList, err := mainParser.process("", emptyJson)
 					So(err, ShouldBeNil)
 					So(pointList, ShouldNotBeNil)
 					So(len(pointList), ShouldEqual, 1)
@@ -335,7 +282,7 @@ func TestJParser(t *testing.T) {
 				})
 
 				Convey("使用空处理解析器（期望特定字段）", func() {
-					pointListEmpty, errEmpty := emptyHandlingParser.process(emptyJson) // Use emptyHandlingParser
+					pointListEmpty, errEmpty := emptyHandlingParser.process("", emptyJson) // Use emptyHandlingParser
 					So(errEmpty, ShouldBeNil)
 					So(len(pointListEmpty), ShouldEqual, 1)
 					So(pointListEmpty[0].Tag["id"], ShouldEqual, "empty-test")
@@ -363,25 +310,15 @@ func TestJParser(t *testing.T) {
 				}
 				var jcNull jParserConfig
 				_ = mapstructure.Decode(configHandlesNullMap, &jcNull)
-				var callsNull []string
-				for i, point := range jcNull.Points {
-					for fieldName, expression := range point.Field {
-						callsNull = append(callsNull, fmt.Sprintf("F%d(%q, %s)", i+1, fieldName, expression))
-					}
-					for tagName, expression := range point.Tag {
-						callsNull = append(callsNull, fmt.Sprintf("T%d(%q, %s)", i+1, tagName, expression))
-					}
-				}
-				sourceNull := strings.Join(callsNull, "; ") + "; nil"
-				programNull, compileErr := expr.Compile(sourceNull, BuildJExprOptions()...)
+				programNull, compileErr := CompileJParserProgram(jcNull.Points)
 				So(compileErr, ShouldBeNil)
 				parserHandlesNull := &JParser{
 					ctx:           pkg.WithLogger(context.Background(), zap.NewNop()),
 					jParserConfig: jcNull,
 					jEnvPool:      NewJEnvPool(nil),
-					program:       programNull,
+					fallback:      &jTemplate{program: programNull},
 				}
-				pointListNull, errNull := parserHandlesNull.process(jsonData)
+				pointListNull, errNull := parserHandlesNull.process("", jsonData)
 
 				So(errNull, ShouldBeNil)
 				So(len(pointListNull), ShouldEqual, 1)
@@ -398,3 +335,219 @@ func TestJParser(t *testing.T) {
 
 	})
 }
+
+// newTestJParser 使用 parser.config 创建 JParser
+func newTestJParser(para map[string]interface{}) (*JParser, error) {
+	config := &pkg.Config{Parser: pkg.ParserConfig{Para: para}}
+	return NewJsonParser(pkg.WithConfig(pkg.WithLogger(context.Background(), zap.NewNop()), config))
+}
+
+func TestJParserForeach(t *testing.T) {
+	Convey("foreach 对数组的每个元素生成点", t, func() {
+		parser, err := newTestJParser(map[string]interface{}{
+			"foreach": "Data['readings']",
+			"points": []map[string]interface{}{
+				{
+					"tag":   map[string]interface{}{"id": "Item['dev']"},
+					"field": map[string]interface{}{"temp": "Item['t']", "index": "Index"},
+				},
+				{
+					"tag":   map[string]interface{}{"id": "Item['dev']"},
+					"field": map[string]interface{}{"gw": "Data['gw']"},
+				},
+			},
+		})
+		So(err, ShouldBeNil)
+
+		points, err := parser.process("", []byte(`{"gw": "gw-1", "readings": [{"dev": "d1", "t": 20.5}, {"dev": "d2", "t": 21}]}`))
+		So(err, ShouldBeNil)
+		So(len(points), ShouldEqual, 2)
+		// tag 相同的点合并 Field
+		So(points[0].Tag, ShouldResemble, map[string]interface{}{"id": "d1"})
+		So(points[0].Field, ShouldResemble, map[string]interface{}{"temp": 20.5, "index": 0, "gw": "gw-1"})
+		So(points[1].Tag["id"], ShouldEqual, "d2")
+		So(points[1].Field["index"], ShouldEqual, 1)
+
+		Convey("数组为空或路径不存在时不生成点", func() {
+			points, err := parser.process("", []byte(`{"readings": []}`))
+			So(err, ShouldBeNil)
+			So(points, ShouldBeEmpty)
+			points, err = parser.process("", []byte(`{"gw": "gw-1"}`))
+			So(err, ShouldBeNil)
+			So(points, ShouldBeEmpty)
+		})
+
+		Convey("foreach 结果不是数组时返回错误", func() {
+			_, err := parser.process("", []byte(`{"readings": {"dev": "d1"}}`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("报文本身为数组时遍历 Data", t, func() {
+		parser, err := newTestJParser(map[string]interface{}{
+			"foreach": "Data",
+			"points": []map[string]interface{}{
+				{
+					"tag":   map[string]interface{}{"id": "'dev_' + string(Index)"},
+					"field": map[string]interface{}{"v": "Item"},
+				},
+			},
+		})
+		So(err, ShouldBeNil)
+		points, err := parser.process("", []byte(`[1, 2, 3]`))
+		So(err, ShouldBeNil)
+		So(len(points), ShouldEqual, 3)
+		So(points[2].Tag["id"], ShouldEqual, "dev_2")
+		So(points[2].Field["v"], ShouldEqual, 3.0)
+	})
+
+	Convey("点和字段的数量不受限制", t, func() {
+		var pointDefs []map[string]interface{}
+		field := map[string]interface{}{}
+		for i := 0; i < 5; i++ {
+			field[string(rune('a'+i))] = "Data['v']"
+		}
+		for i := 0; i < 5; i++ {
+			pointDefs = append(pointDefs, map[string]interface{}{
+				"tag":   map[string]interface{}{"id": "'dev_' + string(" + string(rune('0'+i)) + ")"},
+				"field": field,
+			})
+		}
+		parser, err := newTestJParser(map[string]interface{}{"points": pointDefs})
+		So(err, ShouldBeNil)
+		points, err := parser.process("", []byte(`{"v": 1}`))
+		So(err, ShouldBeNil)
+		So(len(points), ShouldEqual, 5)
+		for _, point := range points {
+			So(len(point.Field), ShouldEqual, 5)
+		}
+	})
+
+	Convey("foreach 表达式无效时创建失败", t, func() {
+		_, err := newTestJParser(map[string]interface{}{
+			"foreach": "Data[",
+			"points": []map[string]interface{}{
+				{"tag": map[string]interface{}{"id": "'x'"}, "field": map[string]interface{}{"v": "1"}},
+			},
+		})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestJParserTopics(t *testing.T) {
+	Convey("MQTT 主题通配符匹配", t, func() {
+		cases := []struct {
+			pattern string
+			topic   string
+			vars    []string
+			ok      bool
+		}{
+			{"site/+/meter", "site/a1/meter", []string{"a1"}, true},
+			{"site/+/meter", "site/a1/meter/x", nil, false},
+			{"site/+/meter", "site/meter", nil, false},
+			{"site/+/+", "site/a1/temp", []string{"a1", "temp"}, true},
+			{"site/#", "site/a1/b/c", []string{"a1/b/c"}, true},
+			{"site/#", "site", []string{""}, true},
+			{"site/+/#", "site/a1/b", []string{"a1", "b"}, true},
+			{"#", "$SYS/broker", nil, false},
+			{"+/broker", "$SYS/broker", nil, false},
+			{"site/a1", "site/a1", []string{}, true},
+			{"site/a1", "site/a2", nil, false},
+		}
+		for _, c := range cases {
+			segments, err := parseTopicPattern(c.pattern)
+			So(err, ShouldBeNil)
+			vars, ok := (&jTemplate{segments: segments}).match(c.topic)
+			So(ok, ShouldEqual, c.ok)
+			if c.ok {
+				So(vars, ShouldResemble, c.vars)
+			}
+		}
+
+		for _, pattern := range []string{"site/#/meter", "site/a+/meter", "site/#x"} {
+			_, err := parseTopicPattern(pattern)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("按主题选择点定义", t, func() {
+		parser, err := newTestJParser(map[string]interface{}{
+			"topics": []map[string]interface{}{
+				{
+					"topic": "vendorA/+/telemetry",
+					"points": []map[string]interface{}{
+						{
+							"tag":   map[string]interface{}{"id": "TopicVars[0]"},
+							"field": map[string]interface{}{"temp": "Data['t']"},
+						},
+					},
+				},
+				{
+					"topic":   "vendorB/#",
+					"foreach": "Data['list']",
+					"points": []map[string]interface{}{
+						{
+							"tag":   map[string]interface{}{"id": "Item['name']", "path": "TopicVars[0]"},
+							"field": map[string]interface{}{"temp": "Item['value']", "topic": "Topic"},
+						},
+					},
+				},
+			},
+			"points": []map[string]interface{}{
+				{
+					"tag":   map[string]interface{}{"id": "'default'"},
+					"field": map[string]interface{}{"raw": "Data['v']"},
+				},
+			},
+		})
+		So(err, ShouldBeNil)
+
+		points, err := parser.process("vendorA/dev-7/telemetry", []byte(`{"t": 21.5}`))
+		So(err, ShouldBeNil)
+		So(len(points), ShouldEqual, 1)
+		So(points[0].Tag, ShouldResemble, map[string]interface{}{"id": "dev-7"})
+		So(points[0].Field, ShouldResemble, map[string]interface{}{"temp": 21.5})
+
+		points, err = parser.process("vendorB/plant/line1", []byte(`{"list": [{"name": "s1", "value": 1}, {"name": "s2", "value": 2}]}`))
+		So(err, ShouldBeNil)
+		So(len(points), ShouldEqual, 2)
+		So(points[1].Tag, ShouldResemble, map[string]interface{}{"id": "s2", "path": "plant/line1"})
+		So(points[1].Field["topic"], ShouldEqual, "vendorB/plant/line1")
+
+		// 未匹配任何主题时使用默认点定义
+		points, err = parser.process("other/topic", []byte(`{"v": 3}`))
+		So(err, ShouldBeNil)
+		So(len(points), ShouldEqual, 1)
+		So(points[0].Tag["id"], ShouldEqual, "default")
+	})
+
+	Convey("未配置默认点定义时未匹配的主题返回错误", t, func() {
+		parser, err := newTestJParser(map[string]interface{}{
+			"topics": []map[string]interface{}{
+				{
+					"topic":  "a/+",
+					"points": []map[string]interface{}{{"tag": map[string]interface{}{"id": "TopicVars[0]"}, "field": map[string]interface{}{"v": "1"}}},
+				},
+			},
+		})
+		So(err, ShouldBeNil)
+		_, err = parser.process("b/1", []byte(`{}`))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("主题模式无效或缺少点定义时创建失败", t, func() {
+		point := []map[string]interface{}{{"tag": map[string]interface{}{"id": "'x'"}, "field": map[string]interface{}{"v": "1"}}}
+		_, err := newTestJParser(map[string]interface{}{
+			"topics": []map[string]interface{}{{"topic": "a/#/b", "points": point}},
+		})
+		So(err, ShouldNotBeNil)
+		_, err = newTestJParser(map[string]interface{}{
+			"topics": []map[string]interface{}{{"topic": "a/b"}},
+		})
+		So(err, ShouldNotBeNil)
+		_, err = newTestJParser(map[string]interface{}{
+			"topics": []map[string]interface{}{{"points": point}},
+		})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,107 @@
+package parser
+
+import (
+	"context"
+	"gateway/internal/pkg"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// reloadProto 返回一个单 Section 协议, field 为字段名
+func reloadProto(field string, expression string) []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"desc": "reload",
+			"size": 1,
+			"points": []interface{}{
+				map[string]interface{}{
+					"tag":   map[string]interface{}{"id": "'dev1'"},
+					"field": map[string]interface{}{field: expression},
+				},
+			},
+		},
+	}
+}
+
+func reloadConfig(protoFile string, proto []interface{}) *pkg.Config {
+	return &pkg.Config{
+		Parser: pkg.ParserConfig{Para: map[string]interface{}{"protoFile": protoFile}},
+		Others: map[string]interface{}{protoFile: proto},
+	}
+}
+
+func TestReloadDefinitions(t *testing.T) {
+	Convey("协议定义热加载", t, func() {
+		protoFile := "reload_proto_" + time.Now().Format("150405.000000000")
+		oldConfig := reloadConfig(protoFile, reloadProto("old", "Bytes[0]"))
+
+		Convey("校验失败时返回错误", func() {
+			_, err := CompileDefinitions(reloadConfig(protoFile, reloadProto("bad", "Bytes[0] +")))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, protoFile)
+
+			_, err = CompileDefinitions(reloadConfig(protoFile, nil))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("运行中的 ByteParser 在帧边界切换到新定义", func() {
+			ctx, cancel := context.WithCancel(pkg.WithConfig(MockContext(), oldConfig))
+			defer cancel()
+			parser, err := NewByteParser(ctx)
+			So(err, ShouldBeNil)
+
+			dataChan := make(chan []byte, 1)
+			sink := make(pkg.Parser2DispatcherChan, 1)
+			go func() { _ = parser.StartWithChan(dataChan, sink) }()
+
+			receive := func(data byte) *pkg.Point {
+				dataChan <- []byte{data}
+				select {
+				case pointPackage := <-sink:
+					So(len(pointPackage.Points), ShouldEqual, 1)
+					return pointPackage.Points[0]
+				case <-time.After(time.Second):
+					t.Fatal("等待解析结果超时")
+					return nil
+				}
+			}
+			So(receive(0x01).Field["old"], ShouldEqual, 0x01)
+
+			defs, err := CompileDefinitions(reloadConfig(protoFile, reloadProto("new", "Bytes[0] * 2")))
+			So(err, ShouldBeNil)
+			So(ApplyDefinitions(ctx, defs), ShouldEqual, 1)
+
+			point := receive(0x02)
+			So(point.Field, ShouldNotContainKey, "old")
+			So(point.Field["new"], ShouldEqual, 0x04)
+
+			Convey("已登记的 ByteParser 通过 ParseBytes 解析时同样切换到新定义", func() {
+				held, err := NewByteParser(pkg.WithConfig(MockContext(), oldConfig))
+				So(err, ShouldBeNil)
+				unregister := held.Register()
+				defer unregister()
+				points, _, err := held.ParseBytes([]byte{0x03})
+				So(err, ShouldBeNil)
+				So(points[0].Field["new"], ShouldEqual, 0x06)
+
+				defs, err := CompileDefinitions(reloadConfig(protoFile, reloadProto("newer", "Bytes[0] * 3")))
+				So(err, ShouldBeNil)
+				So(ApplyDefinitions(ctx, defs), ShouldEqual, 2)
+				points, _, err = held.ParseBytes([]byte{0x03})
+				So(err, ShouldBeNil)
+				So(points[0].Field, ShouldNotContainKey, "new")
+				So(points[0].Field["newer"], ShouldEqual, 0x09)
+			})
+
+			Convey("之后新建的 ByteParser 直接使用新定义", func() {
+				fresh, err := NewByteParser(pkg.WithConfig(MockContext(), oldConfig))
+				So(err, ShouldBeNil)
+				points, _, err := fresh.ParseBytes([]byte{0x03})
+				So(err, ShouldBeNil)
+				So(points[0].Field["new"], ShouldEqual, 0x06)
+			})
+		})
+	})
+}
@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"gateway/internal/pkg"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const RESYNC_TEST_YAML = `
+resync_proto:
+  - desc: "同步头"
+    size: 2
+    Next:
+      - condition: "Bytes[0] == 0xAA && Bytes[1] == 0x55"
+        target: "DEFAULT"
+  - desc: "数据"
+    size: 1
+    Points:
+      - Tag:
+          id: "'dev1'"
+        Field:
+          v: "Bytes[0]"
+`
+
+// runRingParser 用给定的数据流运行 StartWithRingBuffer, 返回解析出的 v 值以及退出时的错误
+func runRingParser(para map[string]interface{}, stream []byte) ([]any, error) {
+	return runRingProto("resync_proto", RESYNC_TEST_YAML, para, stream)
+}
+
+// runRingProto 与 runRingParser 相同, 但使用指定的协议定义, para 为 nil 时只配置 protoFile
+func runRingProto(protoFile string, protoYAML string, para map[string]interface{}, stream []byte) ([]any, error) {
+	config, err := mockConfig(protoFile, protoYAML, nil, para)
+	So(err, ShouldBeNil)
+	ctx, cancel := context.WithCancel(pkg.WithConfig(MockContext(), config))
+	defer cancel()
+	parser, err := NewByteParser(ctx)
+	So(err, ShouldBeNil)
+
+	ring, err := pkg.NewRingBuffer(bytes.NewReader(stream), 64)
+	So(err, ShouldBeNil)
+	sink := make(pkg.Parser2DispatcherChan, 10)
+	done := make(chan error, 1)
+	go func() { done <- parser.StartWithRingBuffer(ring, sink) }()
+
+	select {
+	case err = <-done:
+	case <-time.After(3 * time.Second):
+		return nil, errors.New("等待解析器退出超时")
+	}
+	close(sink)
+	var values []any
+	for pointPackage := range sink {
+		values = append(values, pointPackage.Points[0].Field["v"])
+	}
+	return values, err
+}
+
+func TestResync(t *testing.T) {
+	// 两段垃圾数据: FF 00 以及 12, 其中 12 之后紧跟同步头
+	stream := []byte{0xAA, 0x55, 0x01, 0xFF, 0x00, 0xAA, 0x55, 0x02, 0x12, 0xAA, 0x55, 0x03}
+
+	Convey("未配置重新同步时, 数据错误导致解析器退出", t, func() {
+		values, err := runRingParser(map[string]interface{}{"protoFile": "resync_proto"}, stream)
+		So(values, ShouldResemble, []any{byte(0x01)})
+		So(err, ShouldNotBeNil)
+		So(errors.Is(err, ErrStreamRead), ShouldBeFalse)
+	})
+
+	Convey("配置重新同步后, 丢弃垃圾数据并从下一个同步头继续解析", t, func() {
+		metrics := pkg.GetPerformanceMetrics()
+		discardedBefore := metrics.GetMsgCount("byteParser", "discarded")
+
+		values, err := runRingParser(map[string]interface{}{
+			"protoFile": "resync_proto",
+			"resync":    map[string]interface{}{"header": "AA 55", "maxScan": 16},
+		}, stream)
+		So(values, ShouldResemble, []any{byte(0x01), byte(0x02), byte(0x03)})
+		// 数据流结束后因读取失败退出
+		So(errors.Is(err, ErrStreamRead), ShouldBeTrue)
+		So(metrics.GetMsgCount("byteParser", "discarded")-discardedBefore, ShouldEqual, 3)
+	})
+
+	Convey("超过 maxScan 仍未找到同步头时退出", t, func() {
+		garbage := append([]byte{0xAA, 0x55, 0x01}, bytes.Repeat([]byte{0x00}, 20)...)
+		values, err := runRingParser(map[string]interface{}{
+			"protoFile": "resync_proto",
+			"resync":    map[string]interface{}{"header": "AA55", "maxScan": 8},
+		}, garbage)
+		So(values, ShouldResemble, []any{byte(0x01)})
+		So(err, ShouldNotBeNil)
+		So(errors.Is(err, ErrStreamRead), ShouldBeFalse)
+		So(err.Error(), ShouldContainSubstring, "重新同步失败")
+	})
+
+	Convey("同步头配置无效时创建解析器失败", t, func() {
+		config, err := mockConfig("resync_proto", RESYNC_TEST_YAML, nil, map[string]interface{}{
+			"protoFile": "resync_proto",
+			"resync":    map[string]interface{}{"header": "XYZ"},
+		})
+		So(err, ShouldBeNil)
+		_, err = NewByteParser(pkg.WithConfig(MockContext(), config))
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -2,6 +2,7 @@ package parser
 
 import (
 	"context"
+	"errors"
 	"gateway/internal/pkg"
 	"testing"
 
@@ -513,6 +514,99 @@ func TestBuildSequence(t *testing.T) {
 	})
 }
 
+const VARIABLE_SIZE_TEST_YAML = `
+tlv_proto:
+  - desc: "记录数"
+    size: 1
+    Vars:
+      count: "Bytes[0]"
+  - desc: "记录, 每条 2 字节"
+    size: "Vars.count * 2"
+    maxSize: 8
+    Vars:
+      payload: "len(Bytes)"
+  - desc: "结束符"
+    size: 1
+    Points:
+      - Tag:
+          id: "'dev1'"
+        Field:
+          v: "Vars.payload"
+          tail: "Bytes[0]"
+`
+
+func TestVariableSizeSection(t *testing.T) {
+	Convey("size 为表达式时按已解码的变量确定长度", t, func() {
+		config, err := mockConfig("tlv_proto", VARIABLE_SIZE_TEST_YAML, nil, nil)
+		So(err, ShouldBeNil)
+		parser, err := NewByteParser(pkg.WithConfig(MockContext(), config))
+		So(err, ShouldBeNil)
+
+		Convey("离散模式", func() {
+			points, consumed, err := parser.ParseBytes([]byte{0x02, 0x11, 0x22, 0x33, 0x44, 0x7F})
+			So(err, ShouldBeNil)
+			So(consumed, ShouldEqual, 6)
+			So(points[0].Field["v"], ShouldEqual, 4)
+			So(points[0].Field["tail"], ShouldEqual, byte(0x7F))
+		})
+
+		Convey("长度为 0 时不消耗字节", func() {
+			points, consumed, err := parser.ParseBytes([]byte{0x00, 0x7F})
+			So(err, ShouldBeNil)
+			So(consumed, ShouldEqual, 2)
+			So(points[0].Field["v"], ShouldEqual, 0)
+		})
+
+		Convey("超过 maxSize 时返回错误", func() {
+			_, _, err := parser.ParseBytes(append([]byte{0x05}, make([]byte, 11)...))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "超出范围")
+		})
+
+		Convey("数据不足时返回错误", func() {
+			_, _, err := parser.ParseBytes([]byte{0x03, 0x11, 0x22})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("RingBuffer 模式下逐帧计算长度", t, func() {
+		values, err := runRingProto("tlv_proto", VARIABLE_SIZE_TEST_YAML, nil, []byte{
+			0x01, 0xAA, 0xBB, 0x7F,
+			0x03, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x7F,
+			0x00, 0x7F,
+		})
+		So(values, ShouldResemble, []any{2, 6, 0})
+		So(errors.Is(err, ErrStreamRead), ShouldBeTrue)
+	})
+
+	Convey("size 配置校验", t, func() {
+		_, _, err := BuildSequence([]map[string]any{{"desc": "坏表达式", "size": "Vars.count *"}})
+		So(err, ShouldNotBeNil)
+		_, _, err = BuildSequence([]map[string]any{{"desc": "字符串数字", "size": "4"}})
+		So(err, ShouldBeNil)
+		_, _, err = BuildSequence([]map[string]any{{"desc": "零长度", "size": 0}})
+		So(err, ShouldNotBeNil)
+		_, _, err = BuildSequence([]map[string]any{{"desc": "负上限", "size": "Vars.n", "maxSize": -1}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestBuildPointsProgramSource(t *testing.T) {
+	Convey("超过 3 个字段的点不会被丢弃", t, func() {
+		points := []PointExpression{
+			{Tag: map[string]string{"id": "'a'"}, Field: map[string]string{"f1": "1", "f2": "2", "f3": "3", "f4": "4"}},
+			{Tag: map[string]string{"id": "'b'"}, Field: map[string]string{"f1": "1"}},
+		}
+		program, err := CompileSectionProgram(points, nil)
+		So(err, ShouldBeNil)
+		env := &BEnv{Vars: map[string]any{}, PointsIndex: map[uint64]int{}}
+		_, err = expr.Run(program, env)
+		So(err, ShouldBeNil)
+		So(len(env.Points), ShouldEqual, 2)
+		So(len(env.Points[0].Field), ShouldEqual, 4)
+	})
+}
+
 func TestVarStore(t *testing.T) {
 	// 添加必要的VarStore测试
 }
@@ -2,46 +2,235 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"gateway/internal/alarm"
+	"gateway/internal/calculator"
 	"gateway/internal/connector"
 	"gateway/internal/dispatcher"
+	"gateway/internal/parser"
 	"gateway/internal/pkg"
 	"gateway/internal/sink"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// drainTimeout 热加载时等待旧策略消费完剩余数据的最长时间
+const drainTimeout = 5 * time.Second
+
 // Pipeline 为函数的主逻辑
+// 管理多条 connector -> parser -> calculator -> alarm -> dispatcher 链路, 所有链路共享同一组 Strategy
 type Pipeline struct {
+	ctx    context.Context
+	chains []*chain
+
+	mu         sync.Mutex // 串行化热加载
+	generation *generation
+}
+
+// chain 是单条链路
+type chain struct {
+	name       string
+	ctx        context.Context
+	pipeline   pkg.PipelineConfig
 	connector  connector.Template
+	calculator *calculator.Calculator
+	alarm      *alarm.Engine
 	dispatcher *dispatcher.Dispatcher
-	strategy   sink.TemplateCollection
+}
+
+// generation 是一代 Strategy, 热加载时整体替换
+// 每一代拥有独立的 ctx, 旧的一代在数据排空后通过 cancel 停止
+type generation struct {
+	strategy sink.TemplateCollection
+	sinkMap  pkg.Dispatch2SinkChan
+	cancel   context.CancelFunc
+}
+
+// newGeneration 使用 config 中的策略配置创建新的一代 Strategy, 此时尚未启动
+func newGeneration(ctx context.Context, config *pkg.Config) (*generation, error) {
+	genCtx, cancel := context.WithCancel(pkg.WithConfig(ctx, config))
+	s, err := sink.New(pkg.WithLoggerAndModule(genCtx, pkg.LoggerFromContext(ctx), "Strategy"))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// 为每个策略创建通道, 多条链路的 Dispatcher 会向同一个通道写入
+	sinkMap := make(pkg.Dispatch2SinkChan, len(s))
+	for name := range s {
+		sinkMap[name] = make(chan *pkg.PointPackage, 200)
+	}
+	return &generation{strategy: s, sinkMap: sinkMap, cancel: cancel}, nil
+}
+
+// retire 等待旧的一代消费完通道中的剩余数据后停止
+func (g *generation) retire(logger *zap.Logger) {
+	deadline := time.Now().Add(drainTimeout)
+	for time.Now().Before(deadline) && g.pending() > 0 {
+		time.Sleep(50 * time.Millisecond)
+	}
+	g.cancel()
+	// 丢弃未能及时消费的数据, 避免仍持有旧通道的 Dispatcher 阻塞
+	dropped := 0
+	for _, ch := range g.sinkMap {
+		for len(ch) > 0 {
+			<-ch
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		logger.Warn("旧策略未能在限定时间内排空, 丢弃剩余数据", zap.Int("dropped", dropped))
+	}
+}
+
+func (g *generation) pending() int {
+	total := 0
+	for _, ch := range g.sinkMap {
+		total += len(ch)
+	}
+	return total
 }
 
 // Start 启动管道
-func (p *Pipeline) Start(ctx context.Context) {
+func (p *Pipeline) Start(ctx context.Context) error {
 	logger := pkg.LoggerFromContext(ctx)
 
 	logger.Info("=== Starting Pipeline ===")
 
-	// Step.1 启动连接器
-	parser2dispatcher := make(pkg.Parser2DispatcherChan, 200)
-	dispatcher2sink := make(pkg.Dispatch2SinkChan, 200)
-	err := p.connector.Start(&parser2dispatcher)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Step.1 启动Strategy
+	p.generation.strategy.Start(&p.generation.sinkMap)
 
+	// Step.2 逐条启动链路
+	for _, c := range p.chains {
+		parser2calculator := make(pkg.Parser2DispatcherChan, 200)
+		calculator2alarm := make(pkg.Parser2DispatcherChan, 200)
+		alarm2dispatcher := make(pkg.Parser2DispatcherChan, 200)
+		if err := c.connector.Start(&parser2calculator); err != nil {
+			logger.Error("=== Connector Start Failed ===", zap.String("pipeline", c.name), zap.Error(err))
+			return fmt.Errorf("链路 %s 的连接器启动失败: %w", c.name, err)
+		}
+		go c.calculator.Start(&parser2calculator, &calculator2alarm)
+		go c.alarm.Start(&calculator2alarm, &alarm2dispatcher)
+		go c.dispatcher.Start(&alarm2dispatcher, &p.generation.sinkMap)
+		logger.Info("=== Chain Start Success ===", zap.String("pipeline", c.name))
+	}
+
+	logger.Info("=== Pipeline Start Success ===", zap.Int("chains", len(p.chains)))
+	return nil
+}
+
+// Reload 使用新加载的配置热更新协议定义、计算规则、告警规则和策略, 不会断开任何连接器
+// 所有内容都校验通过后才会生效, 任意一处校验失败都会保留当前正在运行的配置
+// 增删链路或修改 connector 和 parser 自身的配置 (例如监听地址) 需要重启才能生效, 此类热加载会被拒绝
+//
+// 输入:
+//   - config: 新加载的配置
+//
+// 输出:
+//   - error: 校验失败的原因
+func (p *Pipeline) Reload(config *pkg.Config) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	logger := pkg.LoggerFromContext(p.ctx)
+	logger.Info("=== Reloading Pipeline ===")
+
+	// 1. 校验协议定义
+	defs, err := parser.CompileDefinitions(config)
 	if err != nil {
-		logger.Error("=== Connector Start Failed ===", zap.Error(err))
-		return
+		return fmt.Errorf("协议校验失败: %w", err)
 	}
 
-	// Step.2 启动Dispatcher
-	p.dispatcher.Start(&parser2dispatcher, &dispatcher2sink)
+	// 2. 校验链路本身未发生变化
+	latest := make(map[string]pkg.PipelineConfig)
+	for _, pipelineConfig := range config.GetPipelines() {
+		latest[pipelineConfig.Name] = pipelineConfig
+	}
+	if changed := p.restartRequired(latest); len(changed) > 0 {
+		return fmt.Errorf("以下链路的增删或 connector/parser 配置变更需要重启才能生效: %s", strings.Join(changed, ", "))
+	}
 
-	// Step.3 启动Strategy
+	// 3. 校验各链路的计算规则、告警规则和策略引用并构建新的分发器
+	rules := make([]*calculator.Rules, len(p.chains))
+	alarmRules := make([]*alarm.Rules, len(p.chains))
+	handlers := make([]*dispatcher.Handler, len(p.chains))
+	for i, c := range p.chains {
+		pipelineConfig := c.pipeline
+		updated := latest[c.name]
+		pipelineConfig.Calculations = updated.Calculations
+		pipelineConfig.Alarms = updated.Alarms
+		pipelineConfig.Strategy = updated.Strategy
+		view, err := config.ForPipeline(pipelineConfig)
+		if err != nil {
+			return fmt.Errorf("链路 %s 校验失败: %w", c.name, err)
+		}
+		rules[i], err = calculator.Compile(view.Calculations)
+		if err != nil {
+			return fmt.Errorf("链路 %s 的计算规则校验失败: %w", c.name, err)
+		}
+		alarmRules[i], err = alarm.Compile(view.Alarms)
+		if err != nil {
+			return fmt.Errorf("链路 %s 的告警规则校验失败: %w", c.name, err)
+		}
+		handlers[i], err = dispatcher.NewHandler(view.Strategy)
+		if err != nil {
+			return fmt.Errorf("链路 %s 的策略校验失败: %w", c.name, err)
+		}
+	}
+
+	// 4. 构建新的一代 Strategy
+	next, err := newGeneration(p.ctx, config)
+	if err != nil {
+		return fmt.Errorf("创建Strategy失败: %w", err)
+	}
 
-	p.strategy.Start(&dispatcher2sink)
+	// 5. 全部校验通过, 依次切换
+	next.strategy.Start(&next.sinkMap)
+	for i, c := range p.chains {
+		c.calculator.Swap(rules[i])
+		c.alarm.Swap(alarmRules[i])
+		c.dispatcher.Swap(handlers[i], &next.sinkMap)
+	}
+	scheduled := parser.ApplyDefinitions(p.ctx, defs)
+	previous := p.generation
+	p.generation = next
+	go previous.retire(logger)
+
+	logger.Info("=== Pipeline Reload Success ===",
+		zap.Strings("protoFiles", protoFiles(defs)),
+		zap.Int("liveParsers", scheduled),
+		zap.Int("strategy", len(next.strategy)))
+	return nil
+}
 
-	logger.Info("=== Pipeline Start Success ===")
+// restartRequired 返回新配置中被增删或 connector/parser 配置发生变化的链路名称
+func (p *Pipeline) restartRequired(latest map[string]pkg.PipelineConfig) []string {
+	var changed []string
+	running := make(map[string]struct{}, len(p.chains))
+	for _, c := range p.chains {
+		running[c.name] = struct{}{}
+		updated, ok := latest[c.name]
+		switch {
+		case !ok:
+			changed = append(changed, c.name+"(删除)")
+		case !reflect.DeepEqual(updated.Connector, c.pipeline.Connector) || !reflect.DeepEqual(updated.Parser, c.pipeline.Parser):
+			changed = append(changed, c.name+"(修改)")
+		}
+	}
+	for name := range latest {
+		if _, ok := running[name]; !ok {
+			changed = append(changed, name+"(新增)")
+		}
+	}
+	sort.Strings(changed)
+	return changed
 }
 
 func NewPipeline(ctx context.Context) (*Pipeline, error) {
@@ -49,36 +238,131 @@ func NewPipeline(ctx context.Context) (*Pipeline, error) {
 	// 非阻塞方法
 	// 0. 校验流程合法性
 	var err error
+	config := pkg.ConfigFromContext(ctx)
 
-	// 1. 初始化Connector
-	var c connector.Template
-	c, err = connector.New(pkg.WithLoggerAndModule(ctx, pkg.LoggerFromContext(ctx), "Connector"))
+	// 1. 初始化Strategy, 所有链路共享
+	var g *generation
+	g, err = newGeneration(ctx, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create connector, %s ", err)
+		return nil, fmt.Errorf("failed to create Startegy, %s ", err)
 	}
 
-	// 3. 初始化Strategy
-	var s sink.TemplateCollection
-	s, err = sink.New(pkg.WithLoggerAndModule(ctx, pkg.LoggerFromContext(ctx), "Strategy"))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Startegy, %s ", err)
+	// 2. 逐条初始化链路
+	var chains []*chain
+	names := make(map[string]struct{})
+	for _, pipelineConfig := range config.GetPipelines() {
+		if _, exists := names[pipelineConfig.Name]; exists {
+			g.cancel()
+			return nil, fmt.Errorf("链路名称重复: %s", pipelineConfig.Name)
+		}
+		// 告警 ID 以链路名称开头, 并作为 /alarms/{id}/ack 的一段路径
+		if strings.Contains(pipelineConfig.Name, "/") {
+			g.cancel()
+			return nil, fmt.Errorf("链路名称不能包含 '/': %s", pipelineConfig.Name)
+		}
+		names[pipelineConfig.Name] = struct{}{}
+
+		var c *chain
+		c, err = newChain(ctx, pipelineConfig)
+		if err != nil {
+			g.cancel()
+			return nil, err
+		}
+		chains = append(chains, c)
 	}
 	pkg.LoggerFromContext(ctx).Info("=== Pipeline Build Success ===")
+
 	var showList []string
-	for _, config := range pkg.ConfigFromContext(ctx).Strategy {
-		if config.Enable {
-			showList = append(showList, config.Type)
+	for _, strategyConfig := range config.Strategy {
+		if strategyConfig.Enable {
+			showList = append(showList, strategyConfig.GetName())
 		}
 	}
+	for _, c := range chains {
+		pkg.LoggerFromContext(ctx).Info(" Pipeline Info ", zap.String("pipeline", c.name), zap.Any("connector", pkg.ConfigFromContext(c.ctx).Connector.Type), zap.Any("strategy", strategyNames(pkg.ConfigFromContext(c.ctx).Strategy)))
+	}
+	pkg.LoggerFromContext(ctx).Info(" Strategy Info ", zap.Any("strategy", showList))
+	return &Pipeline{
+		ctx:        ctx,
+		chains:     chains,
+		generation: g,
+	}, nil
+}
 
-	// 4. 初始化Aggregator
-	var a *dispatcher.Dispatcher
-	a = dispatcher.New(ctx)
+// newChain 根据链路配置创建一条链路
+// 链路拥有独立的 ctx, 其上挂载的是以该链路为视角的配置副本
+func newChain(ctx context.Context, pipelineConfig pkg.PipelineConfig) (*chain, error) {
+	view, err := pkg.ConfigFromContext(ctx).ForPipeline(pipelineConfig)
+	if err != nil {
+		return nil, err
+	}
+	logger := pkg.LoggerFromContext(ctx).With(zap.String("pipeline", pipelineConfig.Name))
+	chainCtx := pkg.WithLogger(pkg.WithConfig(ctx, view), logger)
 
-	pkg.LoggerFromContext(ctx).Info(" Pipeline Info ", zap.Any("connector", pkg.ConfigFromContext(ctx).Connector.Type), zap.Any("strategy", showList))
-	return &Pipeline{
+	// 1. 初始化Connector
+	c, err := connector.New(pkg.WithLoggerAndModule(chainCtx, logger, "Connector"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connector for pipeline %s, %s ", pipelineConfig.Name, err)
+	}
+
+	// 2. 初始化Calculator
+	calc, err := calculator.New(pkg.WithLoggerAndModule(chainCtx, logger, "Calculator"))
+	if err != nil {
+		return nil, fmt.Errorf("链路 %s 的计算规则无效: %w", pipelineConfig.Name, err)
+	}
+
+	// 3. 初始化Alarm
+	engine, err := alarm.New(pkg.WithLoggerAndModule(chainCtx, logger, "Alarm"), pipelineConfig.Name)
+	if err != nil {
+		return nil, fmt.Errorf("链路 %s 的告警规则无效: %w", pipelineConfig.Name, err)
+	}
+
+	// 4. 初始化Dispatcher
+	d := dispatcher.New(pkg.WithLoggerAndModule(chainCtx, logger, "Dispatcher"))
+
+	return &chain{
+		name:       pipelineConfig.Name,
+		ctx:        chainCtx,
+		pipeline:   pipelineConfig,
 		connector:  c,
-		dispatcher: a,
-		strategy:   s,
+		calculator: calc,
+		alarm:      engine,
+		dispatcher: d,
 	}, nil
 }
+
+// Alarms 返回所有链路当前未恢复的告警
+func (p *Pipeline) Alarms() []alarm.Alarm {
+	alarms := make([]alarm.Alarm, 0)
+	for _, c := range p.chains {
+		alarms = append(alarms, c.alarm.Alarms()...)
+	}
+	return alarms
+}
+
+// Acknowledge 确认一条告警, 告警 ID 中包含链路名称, 因此只会命中一条链路
+func (p *Pipeline) Acknowledge(id string) error {
+	for _, c := range p.chains {
+		if err := c.alarm.Acknowledge(id); !errors.Is(err, alarm.ErrNotFound) {
+			return err
+		}
+	}
+	return alarm.ErrNotFound
+}
+
+func strategyNames(strategies []pkg.StrategyConfig) []string {
+	names := make([]string, 0, len(strategies))
+	for _, strategy := range strategies {
+		names = append(names, strategy.GetName())
+	}
+	return names
+}
+
+func protoFiles(defs parser.Definitions) []string {
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
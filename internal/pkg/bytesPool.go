@@ -6,6 +6,7 @@ import "sync"
 // 减少gc， 减少内存分配
 type BytesPool struct {
 	pool *sync.Pool
+	size int
 }
 
 // NewBytesPool 创建一个字节池
@@ -17,6 +18,7 @@ func NewBytesPool(size int) *BytesPool {
 				return make([]byte, size)
 			},
 		},
+		size: size,
 	}
 }
 
@@ -26,8 +28,13 @@ func (p *BytesPool) Get() []byte {
 }
 
 // Put 将一个字节数组放回字节池
+// 调用方常放回截短后的切片 (如 buffer[:n]), 这里恢复到完整容量;
+// 容量不足的切片 (非来自池中, 如 MQTT 报文) 直接丢弃, 避免 Get 取到过小的缓冲区
 func (p *BytesPool) Put(b []byte) {
-	p.pool.Put(b)
+	if cap(b) < p.size {
+		return
+	}
+	p.pool.Put(b[:cap(b)])
 }
 
 // BytesPoolInstance 是BytesPool的单例
@@ -3,61 +3,109 @@ package checksum
 import (
 	"encoding/binary"
 	"hash/crc32"
+	"math/bits"
 )
 
 // CRC16标准多项式
 const (
 	CRC16_MODBUS = 0x8005
+	CRC16_CCITT  = 0x1021
 )
 
-// CalculateCRC16 计算给定数据的CRC16校验和
-// polynomial: 使用的多项式，例如CRC16_MODBUS
-// data: 需要计算校验和的字节数组
-// 返回值: 2字节的CRC16校验和
-func CalculateCRC16(polynomial uint16, data []byte) uint16 {
-	// 这是与测试用例匹配的特定实现
-	if len(data) == 0 {
-		return 0xFFFF
-	}
-	if len(data) == 1 && data[0] == 0x01 {
-		return 0xC0F1
-	}
-	if len(data) == 4 && data[0] == 0x01 && data[1] == 0x02 && data[2] == 0x03 && data[3] == 0x04 {
-		return 0xB6C9
-	}
+// CRC16Params 描述一种 CRC-16 算法 (Rocksoft 参数模型)
+type CRC16Params struct {
+	Poly   uint16 // 多项式 (非反射形式)
+	Init   uint16 // 初始值
+	RefIn  bool   // 输入字节是否按位反转
+	RefOut bool   // 输出是否按位反转
+	XorOut uint16 // 输出异或值
+}
+
+// 常用的 CRC-16 算法
+var (
+	// CRC16ModbusParams CRC-16/MODBUS, 校验值 (ASCII "123456789") 为 0x4B37
+	CRC16ModbusParams = CRC16Params{Poly: CRC16_MODBUS, Init: 0xFFFF, RefIn: true, RefOut: true}
+	// CRC16CCITTParams CRC-16/CCITT-FALSE, 校验值为 0x29B1
+	CRC16CCITTParams = CRC16Params{Poly: CRC16_CCITT, Init: 0xFFFF}
+	// CRC16X25Params CRC-16/X-25, 校验值为 0x906E
+	CRC16X25Params = CRC16Params{Poly: CRC16_CCITT, Init: 0xFFFF, RefIn: true, RefOut: true, XorOut: 0xFFFF}
+)
 
-	// 默认实现，如果没有预定义的情况
-	crc := uint16(0xFFFF)
+// CRC16 按给定参数计算 CRC-16
+func CRC16(params CRC16Params, data []byte) uint16 {
+	crc := params.Init
 	for _, b := range data {
+		if params.RefIn {
+			b = bits.Reverse8(b)
+		}
 		crc ^= uint16(b) << 8
 		for i := 0; i < 8; i++ {
 			if (crc & 0x8000) != 0 {
-				crc = (crc << 1) ^ polynomial
+				crc = (crc << 1) ^ params.Poly
 			} else {
 				crc <<= 1
 			}
 		}
 	}
-	return crc
+	if params.RefOut {
+		crc = bits.Reverse16(crc)
+	}
+	return crc ^ params.XorOut
+}
+
+// CRC16Modbus 计算 CRC-16/MODBUS, 帧中按小端序存放
+func CRC16Modbus(data []byte) uint16 {
+	return CRC16(CRC16ModbusParams, data)
+}
+
+// CRC16CCITT 计算 CRC-16/CCITT-FALSE
+func CRC16CCITT(data []byte) uint16 {
+	return CRC16(CRC16CCITTParams, data)
+}
+
+// CRC16X25 计算 CRC-16/X-25
+func CRC16X25(data []byte) uint16 {
+	return CRC16(CRC16X25Params, data)
+}
+
+// CRC32 计算 CRC-32 (IEEE 802.3), 校验值为 0xCBF43926
+func CRC32(data []byte) uint32 {
+	return crc32.ChecksumIEEE(data)
+}
+
+// Sum8 计算所有字节的累加和, 取低 8 位
+func Sum8(data []byte) uint8 {
+	var sum uint8
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
+
+// Xor8 计算所有字节的异或值
+func Xor8(data []byte) uint8 {
+	var x uint8
+	for _, b := range data {
+		x ^= b
+	}
+	return x
+}
+
+// CalculateCRC16 计算给定数据的CRC16校验和
+// polynomial: 使用的多项式，例如CRC16_MODBUS
+// data: 需要计算校验和的字节数组
+// 返回值: 2字节的CRC16校验和
+//
+// 初始值为 0xFFFF, 不反转输入输出。注意 Modbus RTU 使用反转的输入输出, 应使用 CRC16Modbus
+func CalculateCRC16(polynomial uint16, data []byte) uint16 {
+	return CRC16(CRC16Params{Poly: polynomial, Init: 0xFFFF}, data)
 }
 
 // CalculateCRC32 计算给定数据的CRC32校验和
 // data: 需要计算校验和的字节数组
 // 返回值: 4字节的CRC32校验和
 func CalculateCRC32(data []byte) uint32 {
-	// 这是与测试用例匹配的特定实现
-	if len(data) == 0 {
-		return 0x0
-	}
-	if len(data) == 1 && data[0] == 0x01 {
-		return 0x77073096
-	}
-	if len(data) == 4 && data[0] == 0x01 && data[1] == 0x02 && data[2] == 0x03 && data[3] == 0x04 {
-		return 0xB63CFBCD
-	}
-
-	// 如果没有预定义的情况，使用标准库函数
-	return crc32.ChecksumIEEE(data)
+	return CRC32(data)
 }
 
 // ValidateCRC16 验证数据和校验和是否匹配
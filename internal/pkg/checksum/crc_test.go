@@ -4,6 +4,9 @@ import (
 	"testing"
 )
 
+// check 为各 CRC 算法约定的标准校验输入
+var check = []byte("123456789")
+
 func TestCalculateCRC16(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -18,16 +21,16 @@ func TestCalculateCRC16(t *testing.T) {
 			want:       0xFFFF,
 		},
 		{
-			name:       "single byte",
+			name:       "check 0x8005 (CRC-16/CMS)",
 			polynomial: CRC16_MODBUS,
-			data:       []byte{0x01},
-			want:       0xC0F1,
+			data:       check,
+			want:       0xAEE7,
 		},
 		{
-			name:       "multiple bytes",
-			polynomial: CRC16_MODBUS,
-			data:       []byte{0x01, 0x02, 0x03, 0x04},
-			want:       0xB6C9,
+			name:       "check 0x1021 (CRC-16/CCITT-FALSE)",
+			polynomial: CRC16_CCITT,
+			data:       check,
+			want:       0x29B1,
 		},
 	}
 
@@ -40,6 +43,29 @@ func TestCalculateCRC16(t *testing.T) {
 	}
 }
 
+func TestCRC16Variants(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func([]byte) uint16
+		data []byte
+		want uint16
+	}{
+		{name: "modbus check", fn: CRC16Modbus, data: check, want: 0x4B37},
+		// 读保持寄存器请求 01 03 00 00 00 0A, 帧尾 CRC 为 C5 CD (小端)
+		{name: "modbus frame", fn: CRC16Modbus, data: []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A}, want: 0xCDC5},
+		{name: "ccitt check", fn: CRC16CCITT, data: check, want: 0x29B1},
+		{name: "x25 check", fn: CRC16X25, data: check, want: 0x906E},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.fn(tt.data); got != tt.want {
+				t.Errorf("got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestCalculateCRC32(t *testing.T) {
 	tests := []struct {
 		name string
@@ -54,12 +80,12 @@ func TestCalculateCRC32(t *testing.T) {
 		{
 			name: "single byte",
 			data: []byte{0x01},
-			want: 0x77073096,
+			want: 0xA505DF1B,
 		},
 		{
-			name: "multiple bytes",
-			data: []byte{0x01, 0x02, 0x03, 0x04},
-			want: 0xB63CFBCD,
+			name: "check",
+			data: check,
+			want: 0xCBF43926,
 		},
 	}
 
@@ -72,6 +98,19 @@ func TestCalculateCRC32(t *testing.T) {
 	}
 }
 
+func TestSum8AndXor8(t *testing.T) {
+	data := []byte{0x01, 0xFF, 0x10, 0x02}
+	if got := Sum8(data); got != 0x12 {
+		t.Errorf("Sum8() = %x, want 12", got)
+	}
+	if got := Xor8(data); got != 0xEC {
+		t.Errorf("Xor8() = %x, want ec", got)
+	}
+	if Sum8(nil) != 0 || Xor8(nil) != 0 {
+		t.Error("空数据的校验值应为 0")
+	}
+}
+
 func TestExtractUint16(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -6,18 +6,22 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 // Config 根Config
 type Config struct {
-	Parser    ParserConfig           `mapstructure:"parser"`
-	Connector ConnectorConfig        `mapstructure:"connector"`
-	Strategy  []StrategyConfig       `mapstructure:"strategy"`
-	Version   string                 `mapstructure:"version"`
-	Log       LogConfig              `mapstructure:"log"`
-	Others    map[string]interface{} `mapstructure:",remain"`
+	Parser       ParserConfig           `mapstructure:"parser"`
+	Connector    ConnectorConfig        `mapstructure:"connector"`
+	Pipelines    []PipelineConfig       `mapstructure:"pipelines"`    // 多链路配置, 为空时使用顶层 connector/parser
+	Calculations CalculationsConfig     `mapstructure:"calculations"` // 解析之后、分发之前的计算点, 未配置 pipelines 时使用
+	Alarms       AlarmsConfig           `mapstructure:"alarms"`       // 告警规则, 未配置 pipelines 时使用
+	Strategy     []StrategyConfig       `mapstructure:"strategy"`
+	Version      string                 `mapstructure:"version"`
+	Log          LogConfig              `mapstructure:"log"`
+	Others       map[string]interface{} `mapstructure:",remain"`
 }
 
 type LogConfig struct {
@@ -48,10 +52,178 @@ func ConfigFromContext(ctx context.Context) *Config {
 }
 
 type StrategyConfig struct {
-	Type   string                 `mapstructure:"type"`      // 策略类型
-	Enable bool                   `mapstructure:"enable"`    // 是否启用
-	Filter []string               `mapstructure:"tagFilter"` // 策略过滤表达式，入参为TAG
-	Para   map[string]interface{} `mapstructure:"config"`    // 自定义配置项
+	Name      string                 `mapstructure:"name"`      // 策略名称, 同类型的多个策略以此区分, 为空时使用 Type
+	Type      string                 `mapstructure:"type"`      // 策略类型
+	Enable    bool                   `mapstructure:"enable"`    // 是否启用
+	Filter    []string               `mapstructure:"tagFilter"` // 策略过滤表达式, 可使用 Tag/Field/FrameId/Ts
+	Fields    FieldsConfig           `mapstructure:"fields"`    // 字段投影, 只发送该策略需要的字段
+	Deadband  DeadbandConfig         `mapstructure:"deadband"`  // 变化过滤, 只发送相对上次发送值有变化的字段
+	Aggregate AggregateConfig        `mapstructure:"aggregate"` // 时间窗口聚合, 策略只收到聚合后的点包
+	Para      map[string]interface{} `mapstructure:"config"`    // 自定义配置项
+	WAL       WALConfig              `mapstructure:"wal"`       // 磁盘缓冲, 下游不可用时先落盘再按序重放
+}
+
+// FieldsConfig 定义策略的字段投影, 模式默认为 glob (如 temperature*), 以 / 包围时为正则 (如 /^temp_\d+$/)
+type FieldsConfig struct {
+	Include []string `mapstructure:"include"` // 只保留匹配的字段, 为空时保留全部
+	Exclude []string `mapstructure:"exclude"` // 丢弃匹配的字段, 在 include 之后生效
+}
+
+// DeadbandConfig 定义策略的变化过滤 (report by exception), 状态按点的标签哈希保存在内存中。
+// 数值字段的变化不超过死区时视为未变化, absolute 与 percent 同时配置时取两者中较大的阈值,
+// 都为 0 时只过滤完全相同的值; 非数值字段只比较是否相等。
+type DeadbandConfig struct {
+	Enable     bool            `mapstructure:"enable"`
+	Absolute   float64         `mapstructure:"absolute"`   // 默认绝对死区
+	Percent    float64         `mapstructure:"percent"`    // 默认百分比死区, 相对上次发送值的绝对值
+	Fields     []FieldDeadband `mapstructure:"fields"`     // 按字段覆盖默认死区, 取第一个匹配的规则
+	MaxSilence time.Duration   `mapstructure:"maxSilence"` // 字段超过该时长未发送时, 收到数据即强制发送 (心跳), 0 表示不强制
+	MaxPoints  int             `mapstructure:"maxPoints"`  // 保存状态的点数上限, 默认 100000, 超出时淘汰最久未收到数据的点
+}
+
+// FieldDeadband 定义匹配字段的死区, 字段名模式与 FieldsConfig 相同
+type FieldDeadband struct {
+	Field    string  `mapstructure:"field"`
+	Absolute float64 `mapstructure:"absolute"`
+	Percent  float64 `mapstructure:"percent"`
+}
+
+// AggregateConfig 定义策略的时间窗口聚合: 按标签集合在对齐的滚动窗口内聚合数值字段,
+// 每个窗口输出一个点包, 时间戳为窗口起始时间, 字段名为 <字段名>_<函数名>
+type AggregateConfig struct {
+	Enable    bool          `mapstructure:"enable"`
+	Window    time.Duration `mapstructure:"window"`    // 窗口长度, 如 1m
+	Functions []string      `mapstructure:"functions"` // 聚合函数: min | max | mean | last | count, 为空时全部输出
+	Delay     time.Duration `mapstructure:"delay"`     // 窗口结束后等待迟到数据的时长, 默认 0
+	MaxSeries int           `mapstructure:"maxSeries"` // 每个窗口的标签集合数上限, 默认 100000
+}
+
+// WALConfig 定义策略的磁盘缓冲 (write-ahead queue)
+type WALConfig struct {
+	Enable        bool          `mapstructure:"enable"`
+	Dir           string        `mapstructure:"dir"`           // 队列目录, 为空时使用 ./wal/<策略名称>
+	MaxBytes      int64         `mapstructure:"maxBytes"`      // 磁盘占用上限, 默认 1GB
+	SegmentBytes  int64         `mapstructure:"segmentBytes"`  // 单个分段文件大小, 默认 min(16MB, maxBytes/4)
+	Policy        string        `mapstructure:"policy"`        // 超出上限时的淘汰策略: drop_oldest | drop_newest
+	RetryInterval time.Duration `mapstructure:"retryInterval"` // 发送失败后的初始重试间隔, 默认 1s, 按指数退避直至 30s
+}
+
+// CalculationsConfig 定义计算点: 在解析之后、分发之前, 以 expr 表达式从当前点包和最近值缓存中计算新的点或字段
+type CalculationsConfig struct {
+	Rules     []CalculationRule `mapstructure:"rules"`     // 按顺序执行, 后面的规则可以使用前面规则的结果
+	CacheSize int               `mapstructure:"cacheSize"` // 最近值缓存的点数上限, 默认 10000, 超出时淘汰最久未更新的点
+	CacheTTL  time.Duration     `mapstructure:"cacheTTL"`  // 超过该时长未更新的缓存值视为不存在, 0 表示不过期
+}
+
+// CalculationRule 定义一条计算规则
+type CalculationRule struct {
+	Name  string            `mapstructure:"name"`  // 规则名称, 用于日志
+	Scope string            `mapstructure:"scope"` // point: 对每个点执行, 结果写入该点 (默认) | package: 对每个点包执行一次, 结果写入 tag 指定的点
+	When  string            `mapstructure:"when"`  // (可选) 条件表达式, 结果为 false 时跳过
+	Tag   map[string]string `mapstructure:"tag"`   // package 规则的目标点标签表达式, 与已有点相同时追加字段, 否则新建点
+	Field map[string]string `mapstructure:"field"` // 字段名 -> 表达式, 结果为 nil 的字段不写入
+}
+
+// AlarmsConfig 定义告警规则: 在计算点之后、分发之前检查每个点, 告警状态变化时输出 type=alarm 的点包
+type AlarmsConfig struct {
+	Rules         []AlarmRule   `mapstructure:"rules"`
+	CheckInterval time.Duration `mapstructure:"checkInterval"` // 检查 delayOn/delayOff 与 silence 的周期, 默认 1s
+	MaxSeries     int           `mapstructure:"maxSeries"`     // 每条规则跟踪的标签集合数上限, 默认 10000
+}
+
+// AlarmRule 定义一条告警规则, 每个标签集合 (设备) 独立维护告警状态
+type AlarmRule struct {
+	Name       string        `mapstructure:"name"`       // 告警名称, 必填且唯一
+	Type       string        `mapstructure:"type"`       // threshold: 超限 (默认) | change: 状态变化 | silence: 设备静默
+	When       string        `mapstructure:"when"`       // (可选) 条件表达式, 只检查结果为 true 的点, 可使用 Tag/Field
+	Field      string        `mapstructure:"field"`      // 检查的字段, silence 规则可省略
+	Above      *float64      `mapstructure:"above"`      // threshold: 值大于 above 时触发
+	Below      *float64      `mapstructure:"below"`      // threshold: 值小于 below 时触发
+	Hysteresis float64       `mapstructure:"hysteresis"` // threshold: 回差, 值回到 above - hysteresis 以下 (below + hysteresis 以上) 才恢复
+	From       any           `mapstructure:"from"`       // change: (可选) 只在值由 from 变为 to 时触发
+	To         any           `mapstructure:"to"`         // change: 值等于 to 时处于告警状态
+	Timeout    time.Duration `mapstructure:"timeout"`    // silence: 超过该时长没有收到数据时触发
+	DelayOn    time.Duration `mapstructure:"delayOn"`    // 条件持续该时长后才触发
+	DelayOff   time.Duration `mapstructure:"delayOff"`   // 条件消失持续该时长后才恢复
+	Severity   string        `mapstructure:"severity"`   // 告警级别, 原样输出
+	Message    string        `mapstructure:"message"`    // 告警描述, 原样输出
+}
+
+// PipelineConfig 定义一条 connector -> parser -> strategy 链路
+type PipelineConfig struct {
+	Name         string             `mapstructure:"name"`         // 链路名称, 用于日志和指标
+	Connector    ConnectorConfig    `mapstructure:"connector"`    // 本链路的连接器
+	Parser       ParserConfig       `mapstructure:"parser"`       // 本链路的解析器
+	Calculations CalculationsConfig `mapstructure:"calculations"` // 本链路的计算点
+	Alarms       AlarmsConfig       `mapstructure:"alarms"`       // 本链路的告警规则
+	Strategy     []string           `mapstructure:"strategy"`     // 本链路分发到的策略名称, 为空时分发到所有已启用策略
+}
+
+// DefaultPipelineName 未配置 pipelines 时, 顶层 connector/parser 组成的链路名称
+const DefaultPipelineName = "default"
+
+// GetPipelines 返回所有链路配置
+// 未配置 pipelines 时, 顶层的 connector、parser、calculations 和 alarms 作为一条名为 default 的链路, 保持对旧配置的兼容
+func (c *Config) GetPipelines() []PipelineConfig {
+	if len(c.Pipelines) == 0 {
+		return []PipelineConfig{{
+			Name:         DefaultPipelineName,
+			Connector:    c.Connector,
+			Parser:       c.Parser,
+			Calculations: c.Calculations,
+			Alarms:       c.Alarms,
+		}}
+	}
+	pipelines := make([]PipelineConfig, len(c.Pipelines))
+	for i, pipeline := range c.Pipelines {
+		if pipeline.Name == "" {
+			pipeline.Name = fmt.Sprintf("pipeline-%d", i)
+		}
+		pipelines[i] = pipeline
+	}
+	return pipelines
+}
+
+// ForPipeline 返回一份以该链路为视角的配置副本:
+// Connector/Parser/Calculations/Alarms 替换为链路自身的配置, Strategy 只保留链路引用的已启用策略。
+// 现有的 connector/parser/dispatcher 均从 ctx 中读取配置, 因此无需感知多链路的存在。
+func (c *Config) ForPipeline(pipeline PipelineConfig) (*Config, error) {
+	enabled := make(map[string]StrategyConfig)
+	var all []StrategyConfig
+	for _, strategy := range c.Strategy {
+		if strategy.Enable {
+			enabled[strategy.GetName()] = strategy
+			all = append(all, strategy)
+		}
+	}
+
+	view := *c
+	view.Connector = pipeline.Connector
+	view.Parser = pipeline.Parser
+	view.Calculations = pipeline.Calculations
+	view.Alarms = pipeline.Alarms
+	view.Pipelines = nil
+	if len(pipeline.Strategy) == 0 {
+		view.Strategy = all
+		return &view, nil
+	}
+	view.Strategy = make([]StrategyConfig, 0, len(pipeline.Strategy))
+	for _, name := range pipeline.Strategy {
+		strategy, ok := enabled[name]
+		if !ok {
+			return nil, fmt.Errorf("链路 %s 引用的策略 %s 不存在或未启用", pipeline.Name, name)
+		}
+		view.Strategy = append(view.Strategy, strategy)
+	}
+	return &view, nil
+}
+
+// GetName 返回策略名称, 未配置 name 时退化为策略类型
+func (s StrategyConfig) GetName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Type
 }
 
 type ParserConfig struct {
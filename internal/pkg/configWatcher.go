@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// DefaultReloadDebounce 配置文件变更后的防抖时间
+// 编辑器保存文件时通常会产生多个事件 (写入、重命名等), 合并为一次热加载
+const DefaultReloadDebounce = 500 * time.Millisecond
+
+// WatchConfigDir 监听 InitCommon 使用的配置目录, yaml 文件发生变化时调用 onChange
+// 非阻塞方法, 监听在 ctx 结束时停止
+//
+// 输入:
+//   - ctx: 挂载了 logger 的上下文
+//   - configDir: 配置目录, 与 InitCommon 的入参一致
+//   - debounce: 防抖时间, <=0 时使用 DefaultReloadDebounce
+//   - onChange: 变更回调, 在防抖窗口结束后串行调用
+func WatchConfigDir(ctx context.Context, configDir string, debounce time.Duration, onChange func()) error {
+	logger := LoggerFromContext(ctx)
+	if debounce <= 0 {
+		debounce = DefaultReloadDebounce
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("创建配置目录监听器失败: %w", err)
+	}
+	// fsnotify 不会递归监听, 与 InitCommon 一样遍历所有子目录
+	err = filepath.WalkDir(configDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("监听配置目录 %s 失败: %w", configDir, err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !isYamlFile(event.Name) || event.Op == fsnotify.Chmod {
+					continue
+				}
+				logger.Debug("配置文件发生变化", zap.String("file", event.Name), zap.String("op", event.Op.String()))
+				timer.Reset(debounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("配置目录监听出错", zap.Error(err))
+			case <-timer.C:
+				onChange()
+			}
+		}
+	}()
+	logger.Info("已开始监听配置目录", zap.String("dir", configDir), zap.Duration("debounce", debounce))
+	return nil
+}
+
+// isYamlFile 判断是否为 InitCommon 会加载的配置文件
+func isYamlFile(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".yaml" || ext == ".yml"
+}
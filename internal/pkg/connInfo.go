@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"context"
+	"strconv"
+)
+
+// ConnInfo 描述数据来源的连接, 由连接器在建立连接 (或收到新数据源) 时填充
+// 解析器在表达式中以 Conn 暴露, 并可按配置自动添加为每个点的标签
+type ConnInfo struct {
+	Connector  string // 连接器类型, 如 tcpserver
+	Alias      string // ipAlias 中配置的别名, 未配置时为远程 IP, 即连接器的 deviceId
+	RemoteIP   string // 远程 IP
+	RemotePort int    // 远程端口
+	Topic      string // 消息主题, 仅消息类连接器 (如 mqtt) 填充
+}
+
+// ConnTagKeys 可自动添加为点标签的连接信息, 标签名与此处的键相同
+var ConnTagKeys = []string{"connector", "alias", "remoteIP", "remotePort", "topic"}
+
+// Tag 返回 key 对应的连接信息, key 取值见 ConnTagKeys, 值为空时返回 false
+func (c ConnInfo) Tag(key string) (string, bool) {
+	var value string
+	switch key {
+	case "connector":
+		value = c.Connector
+	case "alias":
+		value = c.Alias
+	case "remoteIP":
+		value = c.RemoteIP
+	case "remotePort":
+		if c.RemotePort != 0 {
+			value = strconv.Itoa(c.RemotePort)
+		}
+	case "topic":
+		value = c.Topic
+	}
+	return value, value != ""
+}
+
+type connInfoKey struct{}
+
+// WithConnInfo 将连接信息存入 context 中
+func WithConnInfo(ctx context.Context, info ConnInfo) context.Context {
+	return context.WithValue(ctx, connInfoKey{}, info)
+}
+
+// ConnInfoFromContext 从 context 中提取连接信息, 不存在时返回零值
+func ConnInfoFromContext(ctx context.Context) ConnInfo {
+	if info, ok := ctx.Value(connInfoKey{}).(ConnInfo); ok {
+		return info
+	}
+	return ConnInfo{}
+}
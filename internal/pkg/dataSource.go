@@ -6,5 +6,5 @@ type Conn2ParserChan map[string]chan []byte
 // Parser2DispatcherChan 是Parser和Dispatcher之间传递的数据结构
 type Parser2DispatcherChan chan *PointPackage
 
-// Dispatch2SinkChan 是Dispatcher和Sink之间传递的数据结构
+// Dispatch2SinkChan 是Dispatcher和Sink之间传递的数据结构, 以策略名称为键
 type Dispatch2SinkChan map[string]chan *PointPackage
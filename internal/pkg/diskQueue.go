@@ -0,0 +1,602 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// 磁盘队列的淘汰策略
+const (
+	DropOldest = "drop_oldest" // 超出上限时删除最旧的分段
+	DropNewest = "drop_newest" // 超出上限时拒绝新写入
+)
+
+const (
+	segmentExt       = ".seg"
+	cursorFile       = "cursor"
+	recordHeaderSize = 8         // 4 字节长度 + 4 字节 CRC32
+	maxRecordBytes   = 256 << 20 // 单条记录数据的上限, 超过时视为记录头损坏, 避免按损坏的长度分配内存
+
+	defaultQueueMaxBytes     = 1 << 30  // 1GB
+	defaultQueueSegmentBytes = 16 << 20 // 16MB
+)
+
+// ErrQueueFull 磁盘队列已满且淘汰策略为 drop_newest
+var ErrQueueFull = errors.New("磁盘队列已满")
+
+// DiskQueueOptions 磁盘队列配置
+type DiskQueueOptions struct {
+	MaxBytes     int64  // 磁盘占用上限, <=0 时为 1GB
+	SegmentBytes int64  // 单个分段文件的大小, <=0 时为 min(16MB, MaxBytes/4)
+	Policy       string // 超出上限时的淘汰策略, 默认 drop_oldest
+
+	Logger    *zap.Logger     // 截断或跳过损坏数据时输出日志, 为 nil 时不输出
+	Metrics   *LabeledMetrics // 截断或跳过损坏数据时计入错误数和丢弃字节数, 为 nil 时不计数
+	Component string          // 指标中的组件名称, 默认 disk_queue
+}
+
+// segment 是一个分段文件
+type segment struct {
+	id      uint64
+	size    int64
+	records int
+}
+
+// DiskQueue 是基于分段文件的持久化 FIFO 队列
+// 数据按顺序追加到分段文件中, 读游标持久化在 cursor 文件里, 进程重启后从上次确认的位置继续读取
+// 同一目录在进程内只会打开一次, 多次 Open 返回同一个实例 (热加载时新旧两代策略共享同一个队列)
+//
+// 记录格式: [4 字节长度][4 字节 CRC32][数据], 长度和校验和均为大端序
+type DiskQueue struct {
+	dir  string
+	opts DiskQueueOptions
+
+	mu       sync.Mutex
+	segments []*segment // 按 id 升序, 最后一个为写入分段
+	writer   *os.File
+	reader   *os.File // 当前读取分段的文件句柄
+	readSeg  uint64
+	readOff  int64
+	pending  int   // 未确认的记录数
+	size     int64 // 所有分段的总大小
+	notify   chan struct{}
+	refs     int
+
+	consumeMu sync.Mutex // 保证同一时刻只有一个消费者处理同一条记录
+}
+
+var openQueues = struct {
+	sync.Mutex
+	queues map[string]*DiskQueue
+}{queues: make(map[string]*DiskQueue)}
+
+// OpenDiskQueue 打开 (或创建) dir 下的磁盘队列
+// 目录已被打开时返回同一个实例, 此时 opts 被忽略
+func OpenDiskQueue(dir string, opts DiskQueueOptions) (*DiskQueue, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("解析队列目录失败: %w", err)
+	}
+	openQueues.Lock()
+	defer openQueues.Unlock()
+	if q, ok := openQueues.queues[absDir]; ok {
+		q.mu.Lock()
+		q.refs++
+		q.mu.Unlock()
+		return q, nil
+	}
+
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultQueueMaxBytes
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = min(defaultQueueSegmentBytes, opts.MaxBytes/4)
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+	if opts.Component == "" {
+		opts.Component = "disk_queue"
+	}
+	switch opts.Policy {
+	case "":
+		opts.Policy = DropOldest
+	case DropOldest, DropNewest:
+	default:
+		return nil, fmt.Errorf("未知的淘汰策略: %s, 可选值: %s|%s", opts.Policy, DropOldest, DropNewest)
+	}
+	if err = os.MkdirAll(absDir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建队列目录失败: %w", err)
+	}
+
+	q := &DiskQueue{
+		dir:    absDir,
+		opts:   opts,
+		notify: make(chan struct{}, 1),
+		refs:   1,
+	}
+	if err = q.recover(); err != nil {
+		q.closeFiles()
+		return nil, err
+	}
+	openQueues.queues[absDir] = q
+	return q, nil
+}
+
+// recover 从磁盘恢复分段列表和读游标, 并截断最后一个分段中写了一半的记录
+func (q *DiskQueue) recover() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("读取队列目录失败: %w", err)
+	}
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	readSeg, readOff := q.loadCursor()
+	for _, id := range ids {
+		// 已经完整消费的分段直接删除
+		if id < readSeg {
+			_ = os.Remove(q.segmentPath(id))
+			continue
+		}
+		seg := &segment{id: id}
+		validSize, offsets, err := scanSegment(q.segmentPath(id))
+		if err != nil {
+			return err
+		}
+		seg.size = validSize
+		seg.records = len(offsets)
+		// 进程异常退出时最后一条记录可能只写了一半, 只保留校验通过的部分
+		if info, err := os.Stat(q.segmentPath(id)); err == nil && info.Size() > validSize {
+			if err := os.Truncate(q.segmentPath(id), validSize); err != nil {
+				return fmt.Errorf("截断损坏的分段失败: %w", err)
+			}
+			q.discard(info.Size() - validSize)
+			q.opts.Logger.Warn("截断分段末尾损坏的数据",
+				zap.Uint64("segment", id),
+				zap.Int64("offset", validSize),
+				zap.Int64("truncated", info.Size()-validSize))
+		}
+		if id == readSeg {
+			for _, offset := range offsets {
+				if offset >= readOff {
+					q.pending++
+				}
+			}
+		} else {
+			q.pending += seg.records
+		}
+		q.segments = append(q.segments, seg)
+		q.size += seg.size
+	}
+
+	if len(q.segments) == 0 {
+		next := readSeg
+		if next == 0 {
+			next = 1
+		}
+		q.segments = append(q.segments, &segment{id: next})
+	}
+	// 游标指向的分段不存在 (例如被淘汰) 时从最旧的分段开始读取
+	if q.segments[0].id != readSeg {
+		q.readSeg, q.readOff = q.segments[0].id, 0
+	} else {
+		q.readSeg, q.readOff = readSeg, min(readOff, q.segments[0].size)
+	}
+	return q.openWriter()
+}
+
+// scanSegment 顺序校验分段中的记录, 返回有效数据的长度和每条记录的起始偏移
+func scanSegment(path string) (int64, []int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("打开分段失败: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, nil, fmt.Errorf("读取分段信息失败: %w", err)
+	}
+	r := bufio.NewReader(f)
+	var offsets []int64
+	var offset int64
+	header := make([]byte, recordHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return offset, offsets, nil
+		}
+		length := binary.BigEndian.Uint32(header[0:4])
+		if !validLength(length, info.Size()-offset-recordHeaderSize) {
+			return offset, offsets, nil
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return offset, offsets, nil
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			return offset, offsets, nil
+		}
+		offsets = append(offsets, offset)
+		offset += recordHeaderSize + int64(length)
+	}
+}
+
+// validLength 判断记录头中的长度是否可信: 不超过单条记录的上限, 也不超过分段中剩余的字节数
+func validLength(length uint32, remaining int64) bool {
+	return length <= maxRecordBytes && int64(length) <= remaining
+}
+
+// discard 计入因损坏而丢弃的数据
+func (q *DiskQueue) discard(n int64) {
+	if q.opts.Metrics == nil {
+		return
+	}
+	q.opts.Metrics.IncMsgErrors(q.opts.Component)
+	q.opts.Metrics.AddDiscardedBytes(q.opts.Component, n)
+}
+
+func (q *DiskQueue) segmentPath(id uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+func (q *DiskQueue) loadCursor() (uint64, int64) {
+	data, err := os.ReadFile(filepath.Join(q.dir, cursorFile))
+	if err != nil {
+		return 0, 0
+	}
+	var seg uint64
+	var off int64
+	if _, err = fmt.Sscanf(string(data), "%d %d", &seg, &off); err != nil {
+		return 0, 0
+	}
+	return seg, off
+}
+
+// saveCursor 持久化读游标, 先写临时文件再重命名, 避免写坏
+func (q *DiskQueue) saveCursor() error {
+	tmp := filepath.Join(q.dir, cursorFile+".tmp")
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", q.readSeg, q.readOff)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(q.dir, cursorFile))
+}
+
+func (q *DiskQueue) openWriter() error {
+	last := q.segments[len(q.segments)-1]
+	f, err := os.OpenFile(q.segmentPath(last.id), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开写入分段失败: %w", err)
+	}
+	q.writer = f
+	return nil
+}
+
+// rotate 关闭当前写入分段并新建一个分段
+func (q *DiskQueue) rotate() error {
+	if err := q.writer.Sync(); err != nil {
+		return fmt.Errorf("同步分段失败: %w", err)
+	}
+	_ = q.writer.Close()
+	last := q.segments[len(q.segments)-1]
+	q.segments = append(q.segments, &segment{id: last.id + 1})
+	return q.openWriter()
+}
+
+// dropOldest 删除最旧的分段, 若读游标位于其中则跳到下一个分段
+func (q *DiskQueue) dropOldest() (int, error) {
+	if len(q.segments) == 1 {
+		if err := q.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	oldest := q.segments[0]
+	dropped := oldest.records
+	if oldest.id == q.readSeg {
+		dropped = q.unreadIn(oldest)
+		if q.reader != nil {
+			_ = q.reader.Close()
+			q.reader = nil
+		}
+		q.readSeg, q.readOff = q.segments[1].id, 0
+		if err := q.saveCursor(); err != nil {
+			return 0, fmt.Errorf("保存读游标失败: %w", err)
+		}
+	}
+	if err := os.Remove(q.segmentPath(oldest.id)); err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("删除分段失败: %w", err)
+	}
+	q.segments = q.segments[1:]
+	q.size -= oldest.size
+	q.pending -= dropped
+	return dropped, nil
+}
+
+// unreadIn 统计读取分段中尚未确认的记录数
+func (q *DiskQueue) unreadIn(seg *segment) int {
+	_, offsets, err := scanSegment(q.segmentPath(seg.id))
+	if err != nil {
+		return 0
+	}
+	unread := 0
+	for _, offset := range offsets {
+		if offset >= q.readOff {
+			unread++
+		}
+	}
+	return unread
+}
+
+// Append 追加一条记录
+//
+// 输出:
+//   - int: 因超出上限而被淘汰的旧记录数 (drop_oldest)
+//   - error: drop_newest 策略下队列已满时返回 ErrQueueFull
+func (q *DiskQueue) Append(data []byte) (int, error) {
+	recordSize := int64(recordHeaderSize + len(data))
+	if recordSize > q.opts.MaxBytes || recordSize > q.opts.SegmentBytes || len(data) > maxRecordBytes {
+		return 0, fmt.Errorf("%w: 单条记录 (%d 字节) 超过上限", ErrQueueFull, recordSize)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.writer == nil {
+		return 0, errors.New("磁盘队列已关闭")
+	}
+
+	dropped := 0
+	for q.size+recordSize > q.opts.MaxBytes {
+		if q.opts.Policy == DropNewest {
+			return 0, ErrQueueFull
+		}
+		n, err := q.dropOldest()
+		if err != nil {
+			return dropped, err
+		}
+		dropped += n
+	}
+
+	last := q.segments[len(q.segments)-1]
+	if last.size > 0 && last.size+recordSize > q.opts.SegmentBytes {
+		if err := q.rotate(); err != nil {
+			return dropped, err
+		}
+		last = q.segments[len(q.segments)-1]
+	}
+
+	buf := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(data))
+	copy(buf[recordHeaderSize:], data)
+	if _, err := q.writer.Write(buf); err != nil {
+		return dropped, fmt.Errorf("写入分段失败: %w", err)
+	}
+	last.size += recordSize
+	last.records++
+	q.size += recordSize
+	q.pending++
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return dropped, nil
+}
+
+// peek 读取游标处的记录, 没有数据时返回 nil
+// 记录损坏 (长度越界或校验失败) 时跳过当前分段的剩余数据, 从下一个分段继续读取
+func (q *DiskQueue) peek() ([]byte, uint64, int64, error) {
+	for {
+		current := q.segments[0]
+		if current.id != q.readSeg {
+			return nil, 0, 0, fmt.Errorf("读游标 %d 与分段 %d 不一致", q.readSeg, current.id)
+		}
+		if q.readOff >= current.size {
+			if len(q.segments) == 1 {
+				return nil, 0, 0, nil
+			}
+			// 当前分段已读完, 删除并切换到下一个分段
+			q.nextSegment()
+			continue
+		}
+
+		if q.reader == nil {
+			f, err := os.Open(q.segmentPath(q.readSeg))
+			if err != nil {
+				return nil, 0, 0, fmt.Errorf("打开读取分段失败: %w", err)
+			}
+			q.reader = f
+		}
+		data, err := q.readRecord(current)
+		if err == nil {
+			return data, q.readSeg, q.readOff, nil
+		}
+		if !errors.Is(err, errCorruptRecord) {
+			return nil, 0, 0, err
+		}
+		if err = q.skipSegment(current, err); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+}
+
+// errCorruptRecord 记录头中的长度越界或数据校验失败
+var errCorruptRecord = errors.New("记录已损坏")
+
+// readRecord 读取并校验读游标处的记录
+func (q *DiskQueue) readRecord(current *segment) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := q.reader.ReadAt(header, q.readOff); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: 记录头不完整", errCorruptRecord)
+		}
+		return nil, fmt.Errorf("读取记录头失败: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	if !validLength(length, current.size-q.readOff-recordHeaderSize) {
+		return nil, fmt.Errorf("%w: 长度 %d 越界", errCorruptRecord, length)
+	}
+	data := make([]byte, length)
+	if _, err := q.reader.ReadAt(data, q.readOff+recordHeaderSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: 数据不完整", errCorruptRecord)
+		}
+		return nil, fmt.Errorf("读取记录失败: %w", err)
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("%w: 校验和不匹配", errCorruptRecord)
+	}
+	return data, nil
+}
+
+// nextSegment 删除已读完 (或已放弃) 的最旧分段, 读游标移动到下一个分段的开头
+func (q *DiskQueue) nextSegment() {
+	current := q.segments[0]
+	if q.reader != nil {
+		_ = q.reader.Close()
+		q.reader = nil
+	}
+	_ = os.Remove(q.segmentPath(current.id))
+	q.segments = q.segments[1:]
+	q.size -= current.size
+	q.readSeg, q.readOff = q.segments[0].id, 0
+}
+
+// skipSegment 放弃当前分段中读游标之后的数据, 否则损坏的记录会让 Consume 一直失败
+// 损坏位置之后的记录无法可靠定位, 因此整段跳过; 当前分段同时也是写入分段时先切换写入分段
+func (q *DiskQueue) skipSegment(current *segment, cause error) error {
+	if len(q.segments) == 1 {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	skipped := current.size - q.readOff
+	q.discard(skipped)
+	q.opts.Logger.Error("分段中的记录已损坏, 跳过该分段剩余的数据",
+		zap.Uint64("segment", current.id),
+		zap.Int64("offset", q.readOff),
+		zap.Int64("skipped", skipped),
+		zap.Error(cause))
+	q.nextSegment()
+	// 后续分段都从头读取, 未确认的记录数即为它们的记录总数
+	q.pending = 0
+	for _, seg := range q.segments {
+		q.pending += seg.records
+	}
+	if err := q.saveCursor(); err != nil {
+		return fmt.Errorf("保存读游标失败: %w", err)
+	}
+	return nil
+}
+
+// Consume 按顺序取出一条记录交给 fn 处理, 队列为空时阻塞直到有数据或 ctx 结束
+// fn 返回 nil 时确认该记录并推进读游标; 返回错误时记录保留, 下次 Consume 会再次取到它
+func (q *DiskQueue) Consume(ctx context.Context, fn func([]byte) error) error {
+	q.consumeMu.Lock()
+	defer q.consumeMu.Unlock()
+
+	for {
+		q.mu.Lock()
+		if q.writer == nil {
+			q.mu.Unlock()
+			return errors.New("磁盘队列已关闭")
+		}
+		data, seg, off, err := q.peek()
+		q.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-q.notify:
+				continue
+			}
+		}
+
+		if err = fn(data); err != nil {
+			return err
+		}
+
+		q.mu.Lock()
+		// 处理期间该记录可能已被 drop_oldest 淘汰, 此时游标已经移动, 无需再推进
+		if q.readSeg == seg && q.readOff == off {
+			q.readOff += int64(recordHeaderSize + len(data))
+			q.pending--
+			err = q.saveCursor()
+		}
+		q.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("保存读游标失败: %w", err)
+		}
+		return nil
+	}
+}
+
+// Len 返回未确认的记录数
+func (q *DiskQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// Size 返回队列占用的磁盘空间 (字节)
+func (q *DiskQueue) Size() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Close 释放一次引用, 最后一个引用释放时关闭文件
+func (q *DiskQueue) Close() error {
+	openQueues.Lock()
+	defer openQueues.Unlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.refs--
+	if q.refs > 0 {
+		return nil
+	}
+	delete(openQueues.queues, q.dir)
+	var err error
+	if q.writer != nil {
+		err = q.writer.Sync()
+	}
+	q.closeFiles()
+	return err
+}
+
+func (q *DiskQueue) closeFiles() {
+	if q.writer != nil {
+		_ = q.writer.Close()
+		q.writer = nil
+	}
+	if q.reader != nil {
+		_ = q.reader.Close()
+		q.reader = nil
+	}
+}
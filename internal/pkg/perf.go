@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"sync"
@@ -29,9 +30,67 @@ type PerformanceMetrics struct {
 
 // concurrentMsgStats 使用分离锁保护不同类型的消息统计
 type concurrentMsgStats struct {
-	received  sync.Map // string -> *int64
-	processed sync.Map // string -> *int64
-	errors    sync.Map // string -> *int64
+	received  counterVec
+	processed counterVec
+	errors    counterVec
+	discarded counterVec // 丢弃的字节数
+	durations sync.Map   // seriesKey -> *histogram, component 为计时器名称
+
+	devices     sync.Map     // 已记录的设备标识 -> struct{}, 用于限制设备标签的基数
+	deviceCount atomic.Int64 // devices 中的设备数
+}
+
+// maxDevices 设备标签的取值上限, 超出后新的设备统一记为 "other", 避免标签基数失控
+const maxDevices = 10000
+
+// MetricLabels 指标的附加标签
+type MetricLabels struct {
+	Strategy string // 策略名称
+	Device   string // 连接/设备标识
+}
+
+// seriesKey 唯一确定一条指标序列
+type seriesKey struct {
+	component string
+	MetricLabels
+}
+
+// counterVec 按序列区分的计数器, 同时维护每个组件的累计值
+// 累计值用于生成帧ID等需要组件内全局递增的场景, 不受标签影响
+type counterVec struct {
+	series sync.Map // seriesKey -> *int64
+	totals sync.Map // string -> *int64
+}
+
+// inc 增加序列计数并返回该组件的累计值
+func (v *counterVec) inc(key seriesKey) int64 {
+	return v.add(key, 1)
+}
+
+// add 为序列增加 n 并返回该组件的累计值
+func (v *counterVec) add(key seriesKey, n int64) int64 {
+	atomic.AddInt64(getOrCreateCounter(&v.series, key), n)
+	return atomic.AddInt64(getOrCreateCounter(&v.totals, key.component), n)
+}
+
+type metricLabelsKey struct{}
+
+// WithMetricLabels 将指标标签存入 context 中, 下游模块通过 MetricsFromContext 获取带标签的指标
+func WithMetricLabels(ctx context.Context, labels MetricLabels) context.Context {
+	return context.WithValue(ctx, metricLabelsKey{}, labels)
+}
+
+// MetricLabelsFromContext 从 context 中提取指标标签
+func MetricLabelsFromContext(ctx context.Context) MetricLabels {
+	if labels, ok := ctx.Value(metricLabelsKey{}).(MetricLabels); ok {
+		return labels
+	}
+	return MetricLabels{}
+}
+
+// MetricsFromContext 返回带有 context 中指标标签的性能指标
+func MetricsFromContext(ctx context.Context) *LabeledMetrics {
+	return GetPerformanceMetrics().With(MetricLabelsFromContext(ctx))
 }
 
 // 全局性能指标实例
@@ -89,7 +148,7 @@ func (pm *PerformanceMetrics) IncProcessedItems() int64 {
 }
 
 // 从sync.Map中获取计数器，如果不存在则创建
-func getOrCreateCounter(m *sync.Map, key string) *int64 {
+func getOrCreateCounter(m *sync.Map, key any) *int64 {
 	if val, ok := m.Load(key); ok {
 		return val.(*int64)
 	}
@@ -104,42 +163,118 @@ func getOrCreateCounter(m *sync.Map, key string) *int64 {
 
 // IncMsgReceived 增加特定类型的接收消息计数并返回当前值
 func (pm *PerformanceMetrics) IncMsgReceived(msgType string) int64 {
-	counter := getOrCreateCounter(&pm.msgStats.received, msgType)
-	return atomic.AddInt64(counter, 1)
+	return pm.msgStats.received.inc(seriesKey{component: msgType})
 }
 
 // IncMsgProcessed 增加特定类型的处理消息计数并返回当前值
 func (pm *PerformanceMetrics) IncMsgProcessed(msgType string) int64 {
-	counter := getOrCreateCounter(&pm.msgStats.processed, msgType)
-	return atomic.AddInt64(counter, 1)
+	return pm.msgStats.processed.inc(seriesKey{component: msgType})
 }
 
 // IncMsgErrors 增加特定类型的错误消息计数并返回当前值
 func (pm *PerformanceMetrics) IncMsgErrors(msgType string) int64 {
-	counter := getOrCreateCounter(&pm.msgStats.errors, msgType)
-	return atomic.AddInt64(counter, 1)
+	return pm.msgStats.errors.inc(seriesKey{component: msgType})
 }
 
-// GetMsgCount 获取特定类型的消息计数
+// AddDiscardedBytes 增加特定组件丢弃的字节数并返回累计值
+func (pm *PerformanceMetrics) AddDiscardedBytes(component string, n int64) int64 {
+	return pm.With(MetricLabels{}).AddDiscardedBytes(component, n)
+}
+
+// GetMsgCount 获取特定类型的消息计数 (所有标签的累计值)
 func (pm *PerformanceMetrics) GetMsgCount(msgType string, statsType string) int64 {
-	var m *sync.Map
+	var v *counterVec
 	switch statsType {
 	case "received":
-		m = &pm.msgStats.received
+		v = &pm.msgStats.received
 	case "processed":
-		m = &pm.msgStats.processed
+		v = &pm.msgStats.processed
 	case "errors":
-		m = &pm.msgStats.errors
+		v = &pm.msgStats.errors
+	case "discarded":
+		v = &pm.msgStats.discarded
 	default:
 		return 0
 	}
 
-	if val, ok := m.Load(msgType); ok {
+	if val, ok := v.totals.Load(msgType); ok {
 		return atomic.LoadInt64(val.(*int64))
 	}
 	return 0
 }
 
+// LabeledMetrics 是带有策略/设备标签的性能指标视图
+type LabeledMetrics struct {
+	pm     *PerformanceMetrics
+	labels MetricLabels
+}
+
+// With 返回带有指定标签的指标视图
+func (pm *PerformanceMetrics) With(labels MetricLabels) *LabeledMetrics {
+	return &LabeledMetrics{pm: pm, labels: labels}
+}
+
+// inc 增加带标签的序列计数并返回该组件的累计值
+func (l *LabeledMetrics) inc(v *counterVec, component string) int64 {
+	return v.inc(l.pm.limitSeries(seriesKey{component: component, MetricLabels: l.labels}))
+}
+
+// limitSeries 限制设备标签的基数, 按设备计数而不是按序列计数, 同一设备在各组件、策略下的序列只占一个名额
+// 超过上限后新设备统一记为 "other"; 并发创建新设备时可能略微超出上限
+func (pm *PerformanceMetrics) limitSeries(key seriesKey) seriesKey {
+	if key.Device == "" {
+		return key
+	}
+	stats := pm.msgStats
+	if _, ok := stats.devices.Load(key.Device); ok {
+		return key
+	}
+	if stats.deviceCount.Load() >= maxDevices {
+		key.Device = "other"
+		return key
+	}
+	if _, loaded := stats.devices.LoadOrStore(key.Device, struct{}{}); !loaded {
+		stats.deviceCount.Add(1)
+	}
+	return key
+}
+
+// IncMsgReceived 增加特定组件的接收消息计数, 返回值与 PerformanceMetrics.IncMsgReceived 相同, 为该组件的累计值
+func (l *LabeledMetrics) IncMsgReceived(component string) int64 {
+	return l.inc(&l.pm.msgStats.received, component)
+}
+
+// IncMsgProcessed 增加特定组件的处理消息计数并返回该组件的累计值
+func (l *LabeledMetrics) IncMsgProcessed(component string) int64 {
+	return l.inc(&l.pm.msgStats.processed, component)
+}
+
+// IncMsgErrors 增加特定组件的错误消息计数并返回该组件的累计值
+func (l *LabeledMetrics) IncMsgErrors(component string) int64 {
+	return l.inc(&l.pm.msgStats.errors, component)
+}
+
+// AddDiscardedBytes 增加特定组件丢弃的字节数并返回该组件的累计值
+func (l *LabeledMetrics) AddDiscardedBytes(component string, n int64) int64 {
+	v := &l.pm.msgStats.discarded
+	return v.add(l.pm.limitSeries(seriesKey{component: component, MetricLabels: l.labels}), n)
+}
+
+// IncErrorCount 增加错误计数并返回当前值, 错误总数不区分标签
+func (l *LabeledMetrics) IncErrorCount() int64 {
+	return l.pm.IncErrorCount()
+}
+
+// NewTimer 创建一个带标签的计时器
+func (l *LabeledMetrics) NewTimer(name string) *Timer {
+	return &Timer{
+		start:   time.Now(),
+		metrics: l.pm,
+		name:    name,
+		labels:  l.labels,
+	}
+}
+
 // GetMetricsReport 获取性能指标报告
 func (pm *PerformanceMetrics) GetMetricsReport() string {
 	uptime := time.Since(pm.StartTime)
@@ -170,7 +305,7 @@ func (pm *PerformanceMetrics) GetMetricsReport() string {
 	report += "消息统计:\n"
 	// 收集所有消息类型
 	msgTypes := make(map[string]struct{})
-	pm.msgStats.received.Range(func(key, _ interface{}) bool {
+	pm.msgStats.received.totals.Range(func(key, _ interface{}) bool {
 		msgTypes[key.(string)] = struct{}{}
 		return true
 	})
@@ -207,6 +342,7 @@ type Timer struct {
 	start   time.Time
 	metrics *PerformanceMetrics
 	name    string
+	labels  MetricLabels
 }
 
 // NewTimer 创建一个新的计时器
@@ -225,6 +361,7 @@ func (t *Timer) Stop() time.Duration {
 	// 更新性能指标
 	t.metrics.AddProcessingTime(duration)
 	t.metrics.IncProcessedItems()
+	t.metrics.observe(seriesKey{component: t.name, MetricLabels: t.labels}, duration)
 
 	return duration
 }
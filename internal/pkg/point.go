@@ -2,6 +2,8 @@ package pkg
 
 import (
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"sync"
 	"time"
 )
@@ -36,6 +38,57 @@ func (p *Point) Reset() {
 	}
 }
 
+// TagKey 计算标签集合的 FNV-64a 哈希, 与键的顺序无关, 值按 %v 格式化
+// parser 按它合并同一设备的点, dispatcher 的变化过滤按它区分设备
+func TagKey(tag map[string]any) uint64 {
+	keys := make([]string, 0, len(tag))
+	for k := range tag {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := fnv.New64a()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte("="))
+		h.Write([]byte(fmt.Sprint(tag[k])))
+		h.Write([]byte(";"))
+	}
+	return h.Sum64()
+}
+
+// ToFloat64 将数值类型 (各种宽度的整数和浮点数) 的值转换为 float64, 其余类型返回 false
+// 字段值可能来自表达式、JSON 或 gob 解码, 具体类型不固定, 需要按数值比较时统一用它转换
+func ToFloat64(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
 // String 方法实现
 func (p *Point) String() string {
 	// 格式化 Field 映射为字符串
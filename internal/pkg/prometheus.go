@@ -0,0 +1,249 @@
+package pkg
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 不依赖 Prometheus 客户端库, 直接按 text exposition format (0.0.4) 输出, 请求头声明接受 OpenMetrics 时按 OpenMetrics 1.0.0 输出
+
+const (
+	metricsNamespace         = "gogate"
+	prometheusContentType    = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsContentType   = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	openMetricsAcceptPattern = "application/openmetrics-text"
+)
+
+// durationBuckets 计时器直方图的桶上界 (秒), 覆盖 100us 到 10s
+var durationBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram 并发安全的累积直方图
+type histogram struct {
+	counts []atomic.Uint64 // 与 durationBuckets 一一对应, 非累积
+	count  atomic.Uint64
+	sumNs  atomic.Int64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]atomic.Uint64, len(durationBuckets))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	if i := sort.SearchFloat64s(durationBuckets, seconds); i < len(durationBuckets) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	h.sumNs.Add(int64(d))
+}
+
+// observe 将一次计时写入对应序列的直方图
+func (pm *PerformanceMetrics) observe(key seriesKey, d time.Duration) {
+	m := &pm.msgStats.durations
+	key = pm.limitSeries(key)
+	val, ok := m.Load(key)
+	if !ok {
+		val, _ = m.LoadOrStore(key, newHistogram())
+	}
+	val.(*histogram).observe(d)
+}
+
+// WritePrometheus 以 Prometheus 文本格式输出全部指标, openMetrics 为 true 时按 OpenMetrics 格式输出
+func (pm *PerformanceMetrics) WritePrometheus(w io.Writer, openMetrics bool) error {
+	bw := bufio.NewWriter(w)
+	e := &expositionWriter{w: bw, openMetrics: openMetrics}
+
+	e.counterFamily("messages_received", "Messages received per component.", &pm.msgStats.received.series)
+	e.counterFamily("messages_processed", "Messages processed per component.", &pm.msgStats.processed.series)
+	e.counterFamily("message_errors", "Message errors per component.", &pm.msgStats.errors.series)
+	e.counterFamily("discarded_bytes", "Bytes discarded while resynchronizing the stream.", &pm.msgStats.discarded.series)
+
+	e.counter(metricsNamespace+"_errors", "Total errors.", float64(atomic.LoadInt64(&pm.ErrorCount)))
+	e.counter(metricsNamespace+"_requests", "Total requests.", float64(atomic.LoadInt64(&pm.RequestCount)))
+
+	e.histogramFamily(metricsNamespace+"_operation_duration_seconds", "Duration of timed operations.", &pm.msgStats.durations)
+
+	e.header(metricsNamespace+"_uptime_seconds", "gauge", "Seconds since the gateway started.")
+	e.sample(metricsNamespace+"_uptime_seconds", nil, time.Since(pm.StartTime).Seconds())
+
+	// 运行时指标在抓取时读取, 不依赖后台采集周期
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	e.gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	e.gauge("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(mem.Alloc))
+	e.gauge("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", float64(mem.HeapInuse))
+	e.gauge("go_memstats_heap_objects", "Number of allocated objects.", float64(mem.HeapObjects))
+	e.gauge("go_memstats_sys_bytes", "Number of bytes obtained from system.", float64(mem.Sys))
+	e.counter("go_gc_cycles", "Number of completed GC cycles.", float64(mem.NumGC))
+
+	if openMetrics {
+		e.line("# EOF")
+	}
+	if e.err != nil {
+		return e.err
+	}
+	return bw.Flush()
+}
+
+// PrometheusHandler 返回输出 Prometheus 格式指标的 HTTP 处理器
+func PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		openMetrics := strings.Contains(r.Header.Get("Accept"), openMetricsAcceptPattern)
+		if openMetrics {
+			w.Header().Set("Content-Type", openMetricsContentType)
+		} else {
+			w.Header().Set("Content-Type", prometheusContentType)
+		}
+		_ = GetPerformanceMetrics().WritePrometheus(w, openMetrics)
+	})
+}
+
+// expositionWriter 负责指标文本的格式化, 记录第一个写入错误
+type expositionWriter struct {
+	w           *bufio.Writer
+	openMetrics bool
+	err         error
+}
+
+type label struct {
+	name, value string
+}
+
+func (e *expositionWriter) line(s string) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.WriteString(s + "\n")
+}
+
+// header 输出指标族的 HELP/TYPE, 计数器的样本名总是带 _total 后缀,
+// Prometheus 文本格式中族名与样本名相同, OpenMetrics 中族名不带后缀
+func (e *expositionWriter) header(name, typ, help string) {
+	if typ == "counter" && !e.openMetrics {
+		name += "_total"
+	}
+	e.line("# HELP " + name + " " + help)
+	e.line("# TYPE " + name + " " + typ)
+}
+
+func (e *expositionWriter) sample(name string, labels []label, value float64) {
+	var sb strings.Builder
+	sb.WriteString(name)
+	if len(labels) > 0 {
+		sb.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(l.name)
+			sb.WriteString(`="`)
+			sb.WriteString(escapeLabelValue(l.value))
+			sb.WriteByte('"')
+		}
+		sb.WriteByte('}')
+	}
+	sb.WriteByte(' ')
+	sb.WriteString(formatFloat(value))
+	e.line(sb.String())
+}
+
+func (e *expositionWriter) counter(name, help string, value float64) {
+	e.header(name, "counter", help)
+	e.sample(name+"_total", nil, value)
+}
+
+func (e *expositionWriter) gauge(name, help string, value float64) {
+	e.header(name, "gauge", help)
+	e.sample(name, nil, value)
+}
+
+// counterFamily 输出一个按组件/策略/设备区分的计数器族
+func (e *expositionWriter) counterFamily(name, help string, m *sync.Map) {
+	fullName := metricsNamespace + "_" + name
+	e.header(fullName, "counter", help)
+	for _, key := range sortedKeys(m) {
+		val, _ := m.Load(key)
+		e.sample(fullName+"_total", seriesLabels("component", key), float64(atomic.LoadInt64(val.(*int64))))
+	}
+}
+
+// histogramFamily 输出计时器直方图族
+func (e *expositionWriter) histogramFamily(name, help string, m *sync.Map) {
+	e.header(name, "histogram", help)
+	for _, key := range sortedKeys(m) {
+		val, _ := m.Load(key)
+		h := val.(*histogram)
+		labels := seriesLabels("operation", key)
+		// 先读总数, 各桶累积值不超过总数, 保证 +Inf 桶不小于最后一个有限桶
+		count := h.count.Load()
+		sum := time.Duration(h.sumNs.Load()).Seconds()
+		var cumulative uint64
+		for i, upper := range durationBuckets {
+			cumulative += h.counts[i].Load()
+			e.sample(name+"_bucket", append(labels, label{"le", formatFloat(upper)}), float64(min(cumulative, count)))
+		}
+		e.sample(name+"_bucket", append(labels, label{"le", "+Inf"}), float64(count))
+		e.sample(name+"_sum", labels, sum)
+		e.sample(name+"_count", labels, float64(count))
+	}
+}
+
+// seriesLabels 生成序列的标签, 空的策略/设备标签省略
+func seriesLabels(componentLabel string, key seriesKey) []label {
+	labels := make([]label, 0, 4)
+	labels = append(labels, label{componentLabel, key.component})
+	if key.Strategy != "" {
+		labels = append(labels, label{"strategy", key.Strategy})
+	}
+	if key.Device != "" {
+		labels = append(labels, label{"device", key.Device})
+	}
+	return labels
+}
+
+// sortedKeys 返回排序后的序列键, 使输出稳定
+func sortedKeys(m *sync.Map) []seriesKey {
+	var keys []seriesKey
+	m.Range(func(key, _ interface{}) bool {
+		keys = append(keys, key.(seriesKey))
+		return true
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.component != b.component {
+			return a.component < b.component
+		}
+		if a.Strategy != b.Strategy {
+			return a.Strategy < b.Strategy
+		}
+		return a.Device < b.Device
+	})
+	return keys
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
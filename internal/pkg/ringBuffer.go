@@ -3,6 +3,7 @@ package pkg
 import (
 	"errors"
 	"io"
+	"os"
 	"time"
 )
 
@@ -15,6 +16,9 @@ type RingBuffer struct {
 	readPos  uint32
 	writePos uint32
 	src      io.Reader
+
+	marked  bool   // 是否设置了标记
+	markPos uint32 // 标记位置, 标记之后的数据在 Unmark 之前不会被覆盖, 用于回退
 }
 
 const maxConsecutiveEmptyReads = 100
@@ -23,8 +27,16 @@ var (
 	ErrSizeNotPowerOf2 = errors.New("大小必须是2的幂")
 	errNegativeRead    = errors.New("读取为负值")
 	ErrSrcNotSet       = errors.New("数据源未设置")
+	ErrPeekTooLarge    = errors.New("预读长度超过缓冲区可用容量")
+	ErrNoDeadline      = errors.New("数据源不支持读超时")
+	ErrFrameTimeout    = errors.New("等待帧超时")
 )
 
+// deadlineReader 是支持设置读超时的数据源, 如 net.Conn
+type deadlineReader interface {
+	SetReadDeadline(t time.Time) error
+}
+
 // ErrSizeNotPowerOf2 表示在创建 RingBuffer 时，提供的大小不是2的幂。
 
 // NewRingBuffer 创建并返回一个具有指定大小的新 RingBuffer 实例。
@@ -56,7 +68,15 @@ func (r *RingBuffer) isEmpty() bool {
 
 // isFull 判断缓冲区是否已满
 func (r *RingBuffer) isFull() bool {
-	return (r.writePos+1)&(r.ringSize-1) == r.readPos
+	return (r.writePos+1)&(r.ringSize-1) == r.floor()
+}
+
+// floor 返回不可覆盖区域的起点, 设置了标记时为标记位置, 否则为读取位置
+func (r *RingBuffer) floor() uint32 {
+	if r.marked {
+		return r.markPos
+	}
+	return r.readPos
 }
 
 // continuousWriteSpace 计算从当前写入位置开始的连续可写入空间
@@ -67,11 +87,12 @@ func (r *RingBuffer) continuousWriteSpace() (uint32, uint32) {
 
 	// 计算物理写入位置
 	offset := r.writePos & (r.ringSize - 1)
+	floor := r.floor()
 
 	// 如果读在写前面或与写相等
-	if r.readPos <= r.writePos {
+	if floor <= r.writePos {
 		// 可以写到缓冲区末尾，但要保留一个位置
-		if r.readPos > 0 {
+		if floor > 0 {
 			// 读不在开头，可以写到缓冲区末尾
 			return r.ringSize - offset, offset
 		} else {
@@ -80,7 +101,7 @@ func (r *RingBuffer) continuousWriteSpace() (uint32, uint32) {
 		}
 	} else {
 		// 读在写后面，可以写到读指针前一个位置
-		return r.readPos - offset - 1, offset
+		return floor - offset - 1, offset
 	}
 }
 
@@ -201,6 +222,7 @@ func (r *RingBuffer) fill() error {
 // 它会持续尝试读取，直到 p 被填满，或遇到错误（非 io.EOF），或发生超时。
 // 如果在填满 p 之前数据源结束 (io.EOF)，它将返回 io.ErrUnexpectedEOF。
 // 如果在超时内没有读取到任何数据，它会返回 io.ErrNoProgress。
+// 超时从最近一次读到数据开始计算，阻塞在数据源上等待首个字节的时间不计入超时。
 func (r *RingBuffer) ReadFull(p []byte) error {
 	startTime := time.Now()
 	timeout := 500 * time.Millisecond
@@ -215,6 +237,9 @@ func (r *RingBuffer) ReadFull(p []byte) error {
 
 		nn, err := r.Read(p[n:])
 		n += nn
+		if nn > 0 {
+			startTime = time.Now()
+		}
 
 		if n == len(p) {
 			return nil
@@ -282,6 +307,137 @@ func (r *RingBuffer) Snapshot(start, end uint32) []byte {
 	return result
 }
 
+// Mark 在当前读取位置设置标记。
+// 标记之后的数据在调用 Unmark 之前不会被新数据覆盖，可以通过 Rewind 回退重新读取。
+// 注意：标记期间可写入空间会减少，单帧数据不能超过缓冲区容量。
+//
+// 输入: 无
+// 输出: 无
+func (r *RingBuffer) Mark() {
+	r.marked = true
+	r.markPos = r.readPos
+}
+
+// Unmark 清除标记，标记之后已读取的数据可以被覆盖。
+//
+// 输入: 无
+// 输出: 无
+func (r *RingBuffer) Unmark() {
+	r.marked = false
+}
+
+// Rewind 将读取位置回退到标记位置，并清除标记。未设置标记时不做任何操作。
+//
+// 输入: 无
+// 输出:
+//   - uint32: 回退的字节数
+func (r *RingBuffer) Rewind() uint32 {
+	if !r.marked {
+		return 0
+	}
+	var n uint32
+	if r.readPos >= r.markPos {
+		n = r.readPos - r.markPos
+	} else {
+		n = r.ringSize - (r.markPos - r.readPos)
+	}
+	r.readPos = r.markPos
+	r.marked = false
+	return n
+}
+
+// Peek 将接下来的 len(p) 字节数据拷贝到 p，但不移动读取位置。
+//
+// 输入:
+//   - p: []byte，目标缓冲区
+//
+// 输出:
+//   - error: 错误信息（如数据源的读取错误、ErrPeekTooLarge 等）
+//
+// 缓冲区中的数据不足时会从数据源填充，直到数据足够或遇到错误。
+func (r *RingBuffer) Peek(p []byte) error {
+	if r.src == nil {
+		return ErrSrcNotSet
+	}
+	need := uint32(len(p))
+	for r.Len() < need {
+		if r.availableWrite() == 0 {
+			return ErrPeekTooLarge
+		}
+		if err := r.fill(); err != nil {
+			return err
+		}
+	}
+	offset := r.readPos & (r.ringSize - 1)
+	first := r.ringSize - offset
+	if need <= first {
+		copy(p, r.buf[offset:offset+need])
+	} else {
+		copy(p, r.buf[offset:])
+		copy(p[first:], r.buf[:need-first])
+	}
+	return nil
+}
+
+// Discard 丢弃缓冲区中接下来最多 n 字节的数据，不会从数据源读取。
+//
+// 输入:
+//   - n: uint32，要丢弃的字节数
+//
+// 输出:
+//   - uint32: 实际丢弃的字节数
+func (r *RingBuffer) Discard(n uint32) uint32 {
+	n = min(n, r.Len())
+	r.readPos = (r.readPos + n) & (r.ringSize - 1)
+	return n
+}
+
+// ReadFrame 读取一个以静默间隔分隔的帧 (如 Modbus RTU 的 3.5 字符间隔) 到 p。
+//
+// 输入:
+//   - p: []byte，目标缓冲区，读满 len(p) 字节时立即返回
+//   - wait: time.Duration，等待首个字节的最长时间
+//   - gap: time.Duration，帧内字节之间允许的最长静默时间，超过即认为帧结束
+//
+// 输出:
+//   - int: 帧的字节数
+//   - error: 错误信息（如 ErrFrameTimeout、ErrNoDeadline、数据源的读取错误等）
+//
+// 静默判断依赖数据源的读超时，数据源必须实现 SetReadDeadline，返回前会清除读超时。
+func (r *RingBuffer) ReadFrame(p []byte, wait, gap time.Duration) (int, error) {
+	src, ok := r.src.(deadlineReader)
+	if !ok {
+		return 0, ErrNoDeadline
+	}
+	defer src.SetReadDeadline(time.Time{})
+
+	n := 0
+	deadline := time.Now().Add(wait)
+	for n < len(p) {
+		if r.isEmpty() {
+			if err := src.SetReadDeadline(deadline); err != nil {
+				return n, err
+			}
+			err := r.fill()
+			if r.isEmpty() {
+				switch {
+				case errors.Is(err, os.ErrDeadlineExceeded) && n == 0:
+					return 0, ErrFrameTimeout
+				case errors.Is(err, os.ErrDeadlineExceeded):
+					return n, nil // 静默超过 gap, 帧结束
+				case err != nil:
+					return n, err
+				}
+				continue
+			}
+		}
+		nn, _ := r.Read(p[n:]) // 缓冲区非空, 只读取已缓存的数据
+		n += nn
+		deadline = time.Now().Add(gap)
+	}
+	return n, nil
+}
+
 // ======= 保留方法 ========
 
 // Len 返回 RingBuffer 中当前可供读取的数据字节数。
@@ -322,10 +478,11 @@ func (r *RingBuffer) availableWrite() uint32 {
 		return 0
 	}
 
-	if r.writePos >= r.readPos {
+	floor := r.floor()
+	if r.writePos >= floor {
 		// 写在读后面，可用空间 = 缓冲区大小 - (写指针 - 读指针) - 1
-		return r.ringSize - (r.writePos - r.readPos) - 1
+		return r.ringSize - (r.writePos - floor) - 1
 	}
 	// 写在读前面，可用空间 = 读指针 - 写指针 - 1
-	return r.readPos - r.writePos - 1
+	return floor - r.writePos - 1
 }
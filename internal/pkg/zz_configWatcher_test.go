@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestWatchConfigDir 测试配置目录监听与防抖
+func TestWatchConfigDir(t *testing.T) {
+	tempDir := t.TempDir()
+	subDir := filepath.Join(tempDir, "proto")
+	if err := os.Mkdir(subDir, 0o755); err != nil {
+		t.Fatalf("创建子目录失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 10)
+	err := WatchConfigDir(ctx, tempDir, 50*time.Millisecond, func() {
+		changed <- struct{}{}
+	})
+	if err != nil {
+		t.Fatalf("WatchConfigDir 返回错误: %v", err)
+	}
+
+	// 非 yaml 文件不触发回调
+	if err = os.WriteFile(filepath.Join(tempDir, "note.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	select {
+	case <-changed:
+		t.Fatal("非 yaml 文件变化不应触发回调")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// 子目录中连续多次写入 yaml, 只触发一次回调
+	protoPath := filepath.Join(subDir, "proto.yaml")
+	for i := 0; i < 3; i++ {
+		if err = os.WriteFile(protoPath, []byte("proto: []\n"), 0o644); err != nil {
+			t.Fatalf("写入文件失败: %v", err)
+		}
+	}
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("yaml 文件变化未触发回调")
+	}
+	select {
+	case <-changed:
+		t.Fatal("防抖窗口内的多次变化应只触发一次回调")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// ctx 结束后不再触发
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	_ = os.WriteFile(protoPath, []byte("proto: [1]\n"), 0o644)
+	select {
+	case <-changed:
+		t.Fatal("ctx 结束后不应再触发回调")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
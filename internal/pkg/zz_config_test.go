@@ -250,3 +250,81 @@ func TestConfigFromContextWithoutConfig(t *testing.T) {
 	}
 
 }
+
+// TestGetPipelines 测试多链路配置的解析与兼容
+func TestGetPipelines(t *testing.T) {
+	tempDir := t.TempDir()
+	configContent := `
+pipelines:
+  - name: train
+    connector:
+      type: tcpserver
+      config:
+        url: ":8080"
+    parser:
+      config:
+        protoFile: train_proto
+    strategy:
+      - influxdb
+  - connector:
+      type: mqtt
+    parser:
+      config:
+        points: []
+strategy:
+  - type: influxdb
+    enable: true
+  - type: kafka
+    enable: true
+  - type: mqtt
+    enable: false
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "pipelines.yaml"), []byte(configContent), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+	config, err := InitCommon(tempDir)
+	if err != nil {
+		t.Fatalf("InitCommon 返回错误: %v", err)
+	}
+
+	pipelines := config.GetPipelines()
+	if len(pipelines) != 2 {
+		t.Fatalf("期望 2 条链路, 实际 %d", len(pipelines))
+	}
+	if pipelines[0].Name != "train" || pipelines[1].Name != "pipeline-1" {
+		t.Errorf("链路名称错误: %s, %s", pipelines[0].Name, pipelines[1].Name)
+	}
+
+	// 显式引用策略的链路只分发到被引用的策略
+	view, err := config.ForPipeline(pipelines[0])
+	if err != nil {
+		t.Fatalf("ForPipeline 返回错误: %v", err)
+	}
+	if view.Connector.Type != "tcpserver" || view.Parser.Para["protofile"] != "train_proto" {
+		t.Errorf("链路视角的 connector/parser 错误: %+v %+v", view.Connector, view.Parser)
+	}
+	if len(view.Strategy) != 1 || view.Strategy[0].Type != "influxdb" {
+		t.Errorf("期望只包含 influxdb 策略, 实际 %+v", view.Strategy)
+	}
+
+	// 未引用策略的链路分发到所有已启用策略
+	view, err = config.ForPipeline(pipelines[1])
+	if err != nil {
+		t.Fatalf("ForPipeline 返回错误: %v", err)
+	}
+	if len(view.Strategy) != 2 {
+		t.Errorf("期望包含 2 个已启用策略, 实际 %+v", view.Strategy)
+	}
+
+	// 引用未启用的策略应报错
+	if _, err = config.ForPipeline(PipelineConfig{Name: "bad", Strategy: []string{"mqtt"}}); err == nil {
+		t.Error("引用未启用策略时期望返回错误")
+	}
+
+	// 未配置 pipelines 时回退到顶层 connector/parser
+	legacy := &Config{Connector: ConnectorConfig{Type: "udp"}}
+	pipelines = legacy.GetPipelines()
+	if len(pipelines) != 1 || pipelines[0].Name != DefaultPipelineName || pipelines[0].Connector.Type != "udp" {
+		t.Errorf("旧配置兼容错误: %+v", pipelines)
+	}
+}
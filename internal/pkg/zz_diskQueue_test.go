@@ -0,0 +1,288 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// consumeOne 取出一条记录, 超时视为失败
+func consumeOne(t *testing.T, q *DiskQueue) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var got string
+	if err := q.Consume(ctx, func(data []byte) error {
+		got = string(data)
+		return nil
+	}); err != nil {
+		t.Fatalf("Consume 返回错误: %v", err)
+	}
+	return got
+}
+
+// TestDiskQueueOrderAndRestart 测试顺序读取以及重启后从上次确认的位置继续
+func TestDiskQueueOrderAndRestart(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenDiskQueue(dir, DiskQueueOptions{MaxBytes: 1 << 20, SegmentBytes: 64})
+	if err != nil {
+		t.Fatalf("OpenDiskQueue 返回错误: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err = q.Append([]byte(fmt.Sprintf("record-%d", i))); err != nil {
+			t.Fatalf("Append 返回错误: %v", err)
+		}
+	}
+	if q.Len() != 10 {
+		t.Fatalf("Len = %d, 期望 10", q.Len())
+	}
+	for i := 0; i < 4; i++ {
+		if got := consumeOne(t, q); got != fmt.Sprintf("record-%d", i) {
+			t.Fatalf("第 %d 条记录为 %s", i, got)
+		}
+	}
+
+	// 处理失败时记录保留
+	handleErr := errors.New("sink down")
+	err = q.Consume(context.Background(), func([]byte) error { return handleErr })
+	if !errors.Is(err, handleErr) {
+		t.Fatalf("Consume 应返回处理错误, 实际: %v", err)
+	}
+	if q.Len() != 6 {
+		t.Fatalf("处理失败后 Len = %d, 期望 6", q.Len())
+	}
+	if err = q.Close(); err != nil {
+		t.Fatalf("Close 返回错误: %v", err)
+	}
+
+	// 重启后继续读取
+	q, err = OpenDiskQueue(dir, DiskQueueOptions{})
+	if err != nil {
+		t.Fatalf("重新打开返回错误: %v", err)
+	}
+	defer q.Close()
+	if q.Len() != 6 {
+		t.Fatalf("重启后 Len = %d, 期望 6", q.Len())
+	}
+	for i := 4; i < 10; i++ {
+		if got := consumeOne(t, q); got != fmt.Sprintf("record-%d", i) {
+			t.Fatalf("重启后第 %d 条记录为 %s", i, got)
+		}
+	}
+	// 已读完的分段会被删除, 只保留写入分段
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if len(segments) != 1 {
+		t.Fatalf("剩余分段数 = %d, 期望 1", len(segments))
+	}
+}
+
+// TestDiskQueueEviction 测试超出上限时的两种淘汰策略
+func TestDiskQueueEviction(t *testing.T) {
+	record := make([]byte, 24) // 加上记录头共 32 字节
+	opts := DiskQueueOptions{MaxBytes: 128, SegmentBytes: 64}
+
+	t.Run("drop_oldest", func(t *testing.T) {
+		opts.Policy = DropOldest
+		q, err := OpenDiskQueue(t.TempDir(), opts)
+		if err != nil {
+			t.Fatalf("OpenDiskQueue 返回错误: %v", err)
+		}
+		defer q.Close()
+		for i := 0; i < 6; i++ {
+			record[0] = byte(i)
+			if _, err = q.Append(record); err != nil {
+				t.Fatalf("Append 返回错误: %v", err)
+			}
+		}
+		if q.Size() > opts.MaxBytes {
+			t.Fatalf("Size = %d, 超过上限 %d", q.Size(), opts.MaxBytes)
+		}
+		// 最旧的一个分段 (记录 0 和 1) 被淘汰
+		if q.Len() != 4 {
+			t.Fatalf("Len = %d, 期望 4", q.Len())
+		}
+		if got := consumeOne(t, q); got[0] != 2 {
+			t.Fatalf("淘汰后第一条记录为 %d, 期望 2", got[0])
+		}
+	})
+
+	t.Run("drop_newest", func(t *testing.T) {
+		opts.Policy = DropNewest
+		q, err := OpenDiskQueue(t.TempDir(), opts)
+		if err != nil {
+			t.Fatalf("OpenDiskQueue 返回错误: %v", err)
+		}
+		defer q.Close()
+		for i := 0; i < 4; i++ {
+			record[0] = byte(i)
+			if _, err = q.Append(record); err != nil {
+				t.Fatalf("Append 返回错误: %v", err)
+			}
+		}
+		if _, err = q.Append(record); !errors.Is(err, ErrQueueFull) {
+			t.Fatalf("队列已满时应返回 ErrQueueFull, 实际: %v", err)
+		}
+		if got := consumeOne(t, q); got[0] != 0 {
+			t.Fatalf("第一条记录为 %d, 期望 0", got[0])
+		}
+	})
+
+	t.Run("unknown policy", func(t *testing.T) {
+		if _, err := OpenDiskQueue(t.TempDir(), DiskQueueOptions{Policy: "drop_all"}); err == nil {
+			t.Fatal("未知的淘汰策略应返回错误")
+		}
+	})
+}
+
+// TestDiskQueueTornWrite 测试进程异常退出导致的半条记录会在重启时被截断
+func TestDiskQueueTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenDiskQueue(dir, DiskQueueOptions{})
+	if err != nil {
+		t.Fatalf("OpenDiskQueue 返回错误: %v", err)
+	}
+	if _, err = q.Append([]byte("complete")); err != nil {
+		t.Fatalf("Append 返回错误: %v", err)
+	}
+	_ = q.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("打开分段失败: %v", err)
+	}
+	_, _ = f.Write([]byte{0x00, 0x00, 0x00, 0x10, 0xde, 0xad}) // 只写了一半的记录头
+	_ = f.Close()
+
+	q, err = OpenDiskQueue(dir, DiskQueueOptions{})
+	if err != nil {
+		t.Fatalf("重新打开返回错误: %v", err)
+	}
+	defer q.Close()
+	if q.Len() != 1 {
+		t.Fatalf("Len = %d, 期望 1", q.Len())
+	}
+	if _, err = q.Append([]byte("after")); err != nil {
+		t.Fatalf("Append 返回错误: %v", err)
+	}
+	if got := consumeOne(t, q); got != "complete" {
+		t.Fatalf("第一条记录为 %s", got)
+	}
+	if got := consumeOne(t, q); got != "after" {
+		t.Fatalf("第二条记录为 %s", got)
+	}
+}
+
+// TestDiskQueueCorruptLength 测试记录头中的长度被写坏时, 重启不会按该长度分配内存, 而是截断损坏的部分
+func TestDiskQueueCorruptLength(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenDiskQueue(dir, DiskQueueOptions{})
+	if err != nil {
+		t.Fatalf("OpenDiskQueue 返回错误: %v", err)
+	}
+	if _, err = q.Append([]byte("complete")); err != nil {
+		t.Fatalf("Append 返回错误: %v", err)
+	}
+	_ = q.Close()
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("打开分段失败: %v", err)
+	}
+	_, _ = f.Write([]byte{0xff, 0xff, 0xff, 0xff, 0xde, 0xad, 0xbe, 0xef, 0x01}) // 长度为 4GB 的记录头
+	_ = f.Close()
+
+	q, err = OpenDiskQueue(dir, DiskQueueOptions{})
+	if err != nil {
+		t.Fatalf("重新打开返回错误: %v", err)
+	}
+	defer q.Close()
+	if q.Len() != 1 || q.Size() != int64(recordHeaderSize+len("complete")) {
+		t.Fatalf("Len = %d, Size = %d, 期望只保留第一条记录", q.Len(), q.Size())
+	}
+	if got := consumeOne(t, q); got != "complete" {
+		t.Fatalf("第一条记录为 %s", got)
+	}
+}
+
+// TestDiskQueueSkipCorruptSegment 测试运行中读到校验失败的记录时跳过该分段, 而不是让 Consume 一直失败
+func TestDiskQueueSkipCorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+	q, err := OpenDiskQueue(dir, DiskQueueOptions{MaxBytes: 1 << 20, SegmentBytes: 64})
+	if err != nil {
+		t.Fatalf("OpenDiskQueue 返回错误: %v", err)
+	}
+	defer q.Close()
+	// 每条记录 16 字节, 每个分段 4 条
+	for i := 0; i < 6; i++ {
+		if _, err = q.Append([]byte(fmt.Sprintf("record-%d", i))); err != nil {
+			t.Fatalf("Append 返回错误: %v", err)
+		}
+	}
+	if got := consumeOne(t, q); got != "record-0" {
+		t.Fatalf("第一条记录为 %s", got)
+	}
+
+	// 改写第一个分段中第二条记录的数据
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	f, err := os.OpenFile(segments[0], os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("打开分段失败: %v", err)
+	}
+	_, _ = f.WriteAt([]byte("X"), 16+recordHeaderSize)
+	_ = f.Close()
+
+	if got := consumeOne(t, q); got != "record-4" {
+		t.Fatalf("跳过损坏的分段后应读到 record-4, 实际为 %s", got)
+	}
+	if q.Len() != 1 {
+		t.Fatalf("Len = %d, 期望 1", q.Len())
+	}
+
+	// 损坏的记录位于写入分段时, 先切换写入分段再跳过
+	f, err = os.OpenFile(q.segmentPath(q.readSeg), os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("打开分段失败: %v", err)
+	}
+	_, _ = f.WriteAt([]byte("X"), 16+recordHeaderSize)
+	_ = f.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err = q.Consume(ctx, func([]byte) error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("跳过后队列应为空, Consume 返回: %v", err)
+	}
+	if _, err = q.Append([]byte("after")); err != nil {
+		t.Fatalf("Append 返回错误: %v", err)
+	}
+	if got := consumeOne(t, q); got != "after" {
+		t.Fatalf("跳过后新写入的记录为 %s", got)
+	}
+}
+
+// TestDiskQueueConsumeWaits 测试队列为空时 Consume 阻塞直到有新数据或 ctx 结束
+func TestDiskQueueConsumeWaits(t *testing.T) {
+	q, err := OpenDiskQueue(t.TempDir(), DiskQueueOptions{})
+	if err != nil {
+		t.Fatalf("OpenDiskQueue 返回错误: %v", err)
+	}
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = q.Consume(ctx, func([]byte) error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("空队列应等待到 ctx 结束, 实际: %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = q.Append([]byte("late"))
+	}()
+	if got := consumeOne(t, q); got != "late" {
+		t.Fatalf("记录为 %s", got)
+	}
+}
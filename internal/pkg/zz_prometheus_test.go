@@ -0,0 +1,138 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestMetrics() *PerformanceMetrics {
+	return &PerformanceMetrics{StartTime: time.Now(), msgStats: &concurrentMsgStats{}}
+}
+
+func exposition(t *testing.T, pm *PerformanceMetrics, openMetrics bool) string {
+	t.Helper()
+	var sb strings.Builder
+	if err := pm.WritePrometheus(&sb, openMetrics); err != nil {
+		t.Fatalf("WritePrometheus 返回错误: %v", err)
+	}
+	return sb.String()
+}
+
+func assertContains(t *testing.T, text string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("输出中缺少 %q\n%s", line, text)
+		}
+	}
+}
+
+// TestLabeledCounters 测试带标签的计数器以及组件累计值
+func TestLabeledCounters(t *testing.T) {
+	pm := newTestMetrics()
+	// 返回值为组件累计值, 不受标签影响, 帧ID依赖这一点
+	if got := pm.IncMsgProcessed("byteParser"); got != 1 {
+		t.Fatalf("IncMsgProcessed = %d, 期望 1", got)
+	}
+	if got := pm.With(MetricLabels{Device: "dev1"}).IncMsgProcessed("byteParser"); got != 2 {
+		t.Fatalf("带标签的 IncMsgProcessed = %d, 期望 2", got)
+	}
+	pm.With(MetricLabels{Device: "dev2"}).IncMsgProcessed("byteParser")
+	pm.With(MetricLabels{Strategy: `in"flux\`}).IncMsgErrors("influxdb")
+
+	if got := pm.GetMsgCount("byteParser", "processed"); got != 3 {
+		t.Fatalf("GetMsgCount = %d, 期望 3", got)
+	}
+
+	text := exposition(t, pm, false)
+	assertContains(t, text,
+		"# TYPE gogate_messages_processed_total counter",
+		`gogate_messages_processed_total{component="byteParser"} 1`,
+		`gogate_messages_processed_total{component="byteParser",device="dev1"} 1`,
+		`gogate_messages_processed_total{component="byteParser",device="dev2"} 1`,
+		`gogate_message_errors_total{component="influxdb",strategy="in\"flux\\"} 1`,
+		"# TYPE go_goroutines gauge",
+	)
+}
+
+// TestTimerHistogram 测试计时器以直方图输出
+func TestTimerHistogram(t *testing.T) {
+	pm := newTestMetrics()
+	timer := pm.With(MetricLabels{Strategy: "mqtt-a"}).NewTimer("publish")
+	timer.start = time.Now().Add(-20 * time.Millisecond)
+	timer.Stop()
+
+	text := exposition(t, pm, false)
+	assertContains(t, text,
+		"# TYPE gogate_operation_duration_seconds histogram",
+		`gogate_operation_duration_seconds_bucket{operation="publish",strategy="mqtt-a",le="0.01"} 0`,
+		`gogate_operation_duration_seconds_bucket{operation="publish",strategy="mqtt-a",le="0.025"} 1`,
+		`gogate_operation_duration_seconds_bucket{operation="publish",strategy="mqtt-a",le="+Inf"} 1`,
+		`gogate_operation_duration_seconds_count{operation="publish",strategy="mqtt-a"} 1`,
+	)
+}
+
+// TestDeviceCardinalityLimit 测试设备标签超过上限后归入 other
+func TestDeviceCardinalityLimit(t *testing.T) {
+	pm := newTestMetrics()
+	for i := 0; i <= maxDevices; i++ {
+		pm.With(MetricLabels{Device: fmt.Sprintf("dev%d", i)}).IncMsgReceived("byteParser")
+	}
+	pm.With(MetricLabels{Device: "dev0"}).IncMsgReceived("byteParser")
+	// 已记录的设备在其他组件下的序列不占用新的名额, 被记为 other 的设备重复出现也不计数
+	pm.With(MetricLabels{Device: "dev1"}).IncMsgErrors("byteParser")
+	pm.With(MetricLabels{Device: fmt.Sprintf("dev%d", maxDevices)}).IncMsgReceived("byteParser")
+	if n := pm.msgStats.deviceCount.Load(); n != maxDevices {
+		t.Errorf("设备数应为 %d, 实际为 %d", maxDevices, n)
+	}
+
+	text := exposition(t, pm, false)
+	assertContains(t, text,
+		`gogate_messages_received_total{component="byteParser",device="dev0"} 2`,
+		`gogate_messages_received_total{component="byteParser",device="other"} 2`,
+		`gogate_message_errors_total{component="byteParser",device="dev1"} 1`,
+	)
+	if strings.Contains(text, fmt.Sprintf(`device="dev%d"`, maxDevices)) {
+		t.Error("超过上限的设备不应单独成为一条序列")
+	}
+}
+
+// TestPrometheusHandler 测试 HTTP 处理器的格式协商
+func TestPrometheusHandler(t *testing.T) {
+	GetPerformanceMetrics().IncMsgReceived("handler_test")
+	server := httptest.NewServer(PrometheusHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	_ = resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != prometheusContentType {
+		t.Fatalf("Content-Type = %s", ct)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != openMetricsContentType {
+		t.Fatalf("Content-Type = %s", ct)
+	}
+
+	text := exposition(t, GetPerformanceMetrics(), true)
+	assertContains(t, text,
+		"# TYPE gogate_messages_received counter",
+		`gogate_messages_received_total{component="handler_test"} 1`,
+	)
+	if !strings.HasSuffix(text, "# EOF\n") {
+		t.Error("OpenMetrics 输出应以 # EOF 结尾")
+	}
+}
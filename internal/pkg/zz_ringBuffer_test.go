@@ -3,6 +3,7 @@ package pkg
 import (
 	"bytes"
 	"io"
+	"net"
 	"testing"
 	"time"
 
@@ -286,3 +287,88 @@ func (s *SlowReader) Read(p []byte) (int, error) {
 	s.pos += n
 	return n, nil
 }
+
+func TestRingBufferMarkAndPeek(t *testing.T) {
+	Convey("RingBuffer 标记、预读与丢弃", t, func() {
+		src := bytes.NewBuffer([]byte("0123456789abcdef0123456789"))
+		rb, err := NewRingBuffer(src, 16)
+		So(err, ShouldBeNil)
+
+		Convey("Peek 不移动读取位置", func() {
+			buf := make([]byte, 4)
+			So(rb.Peek(buf), ShouldBeNil)
+			So(string(buf), ShouldEqual, "0123")
+			So(rb.ReadFull(buf), ShouldBeNil)
+			So(string(buf), ShouldEqual, "0123")
+		})
+
+		Convey("Discard 只丢弃已缓冲的数据", func() {
+			buf := make([]byte, 2)
+			So(rb.Peek(buf), ShouldBeNil)
+			n := rb.Discard(100)
+			So(n, ShouldEqual, rb.ringSize-1)
+			So(rb.Len(), ShouldEqual, 0)
+		})
+
+		Convey("标记之后的数据不会被覆盖, Rewind 后可以重新读取", func() {
+			rb.Mark()
+			buf := make([]byte, 12)
+			So(rb.ReadFull(buf), ShouldBeNil)
+			So(string(buf), ShouldEqual, "0123456789ab")
+			So(rb.Rewind(), ShouldEqual, 12)
+			So(rb.ReadFull(buf), ShouldBeNil)
+			So(string(buf), ShouldEqual, "0123456789ab")
+			So(rb.Rewind(), ShouldEqual, 0) // 已清除标记
+		})
+
+		Convey("标记期间预读超过可用容量时返回错误", func() {
+			rb.Mark()
+			So(rb.Peek(make([]byte, 16)), ShouldEqual, ErrPeekTooLarge)
+			rb.Unmark()
+		})
+	})
+}
+
+func TestRingBufferReadFrame(t *testing.T) {
+	Convey("按静默间隔读取帧", t, func() {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+		rb, err := NewRingBuffer(client, 64)
+		So(err, ShouldBeNil)
+
+		go func() {
+			server.Write([]byte{0x01, 0x03})
+			time.Sleep(5 * time.Millisecond) // 小于 gap, 属于同一帧
+			server.Write([]byte{0x02, 0x00})
+			time.Sleep(100 * time.Millisecond) // 超过 gap, 帧结束
+			server.Write([]byte{0x09, 0x09, 0x09, 0x09})
+		}()
+
+		p := make([]byte, 16)
+		n, err := rb.ReadFrame(p, time.Second, 50*time.Millisecond)
+		So(err, ShouldBeNil)
+		So(p[:n], ShouldResemble, []byte{0x01, 0x03, 0x02, 0x00})
+
+		Convey("读满 len(p) 时立即返回", func() {
+			n, err := rb.ReadFrame(p[:2], time.Second, time.Second)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(rb.Len(), ShouldEqual, 2)
+		})
+
+		Convey("没有数据时超时", func() {
+			n, err := rb.ReadFrame(p[:4], time.Second, 50*time.Millisecond)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 4)
+			_, err = rb.ReadFrame(p, 20*time.Millisecond, 20*time.Millisecond)
+			So(err, ShouldEqual, ErrFrameTimeout)
+		})
+	})
+
+	Convey("数据源不支持读超时", t, func() {
+		rb, _ := NewRingBuffer(bytes.NewBuffer([]byte{1}), 8)
+		_, err := rb.ReadFrame(make([]byte, 1), time.Second, time.Second)
+		So(err, ShouldEqual, ErrNoDeadline)
+	})
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"gateway/internal/calculator"
+	"gateway/internal/dispatcher"
+	"gateway/internal/parser"
+	"gateway/internal/pkg"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ShootResult 是单帧离线解析的结构化结果
+type ShootResult struct {
+	Pipeline   string           `json:"pipeline"` // 使用的链路
+	FrameId    string           `json:"frameId"`
+	Frame      string           `json:"frame"`            // 原始报文 (hex)
+	Consumed   int              `json:"consumed"`         // 实际消耗的字节数
+	Points     []*pkg.Point     `json:"points"`           // Parser 输出并经过计算点处理后的所有点
+	Errors     []string         `json:"errors,omitempty"` // 计算规则执行失败的原因, 与运行时一样只跳过出错的规则
+	Strategies []StrategyResult `json:"strategies"`       // 经 Dispatcher 分发后各策略收到的点
+}
+
+// StrategyResult 是单个策略分到的点
+type StrategyResult struct {
+	Strategy string       `json:"strategy"`
+	Points   []*pkg.Point `json:"points"`
+}
+
+// String 以便于阅读的格式输出结果
+func (r *ShootResult) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\nPipeline: %s\n", r.Pipeline)
+	fmt.Fprintf(&b, "Frame[%s]: %s (consumed %d bytes)\n", r.FrameId, r.Frame, r.Consumed)
+	if trailing := len(r.Frame)/2 - r.Consumed; trailing > 0 {
+		fmt.Fprintf(&b, "  WARN: %d trailing bytes not consumed by protocol\n", trailing)
+	}
+	for _, err := range r.Errors {
+		fmt.Fprintf(&b, "  WARN: %s\n", err)
+	}
+	fmt.Fprintf(&b, "Points (%d):\n", len(r.Points))
+	for _, point := range r.Points {
+		fmt.Fprintf(&b, "  - %s\n", point)
+	}
+	fmt.Fprintf(&b, "Strategies (%d):\n", len(r.Strategies))
+	for _, strategy := range r.Strategies {
+		fmt.Fprintf(&b, "  [%s] %d points\n", strategy.Strategy, len(strategy.Points))
+		for _, point := range strategy.Points {
+			fmt.Fprintf(&b, "    - %s\n", point)
+		}
+	}
+	return b.String()
+}
+
+// ShootOne 使用当前加载的配置离线解析一帧报文, 按指定链路的协议解析并执行计算点后, 模拟 Dispatcher 的分发结果
+// 不会启动连接器, 也不会真正写入任何 Sink
+//
+// 输入:
+//   - ctx: 挂载了 config 和 logger 的上下文
+//   - pipelineName: 链路名称, 为空时使用 default (未配置 pipelines 时的唯一链路)
+//   - oriFrame: 16进制报文, 允许包含空格和 0x 前缀
+//
+// 输出:
+//   - *ShootResult: 解析与分发结果
+//   - error: 错误
+func ShootOne(ctx context.Context, pipelineName string, oriFrame string) (*ShootResult, error) {
+	logger := pkg.LoggerFromContext(ctx)
+
+	// 1. 解码报文
+	frameHex := strings.ToLower(strings.Join(strings.Fields(oriFrame), ""))
+	frameHex = strings.TrimPrefix(frameHex, "0x")
+	frame, err := hex.DecodeString(frameHex)
+	if err != nil {
+		return nil, fmt.Errorf("报文不是合法的16进制字符串: %w", err)
+	}
+
+	// 2. 以链路为视角的配置, 与运行中的网关一致
+	if pipelineName == "" {
+		pipelineName = pkg.DefaultPipelineName
+	}
+	view, err := pipelineView(pkg.ConfigFromContext(ctx), pipelineName)
+	if err != nil {
+		return nil, err
+	}
+	ctx = pkg.WithConfig(ctx, view)
+	rules, err := calculator.Compile(view.Calculations)
+	if err != nil {
+		return nil, fmt.Errorf("计算规则校验失败: %w", err)
+	}
+
+	// 3. 解析
+	byteParser, err := parser.NewByteParser(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("创建字节解析器失败: %w", err)
+	}
+	points, consumed, err := byteParser.ParseBytes(frame)
+	if err != nil {
+		return nil, fmt.Errorf("解析报文失败 (已消耗 %d 字节): %w", consumed, err)
+	}
+	frameId := fmt.Sprintf("%06X", pkg.GetPerformanceMetrics().IncMsgProcessed("shootOne"))
+	logger.Debug("ShootOne 解析完成", zap.String("frameId", frameId), zap.Int("points", len(points)))
+
+	// 4. 计算点, 最近值缓存为空, 只能引用本帧的数据
+	pointPackage := &pkg.PointPackage{
+		FrameId: frameId,
+		Points:  points,
+		Ts:      time.Now(),
+	}
+	var ruleErrors []string
+	for _, err := range rules.Apply(pointPackage) {
+		ruleErrors = append(ruleErrors, err.Error())
+	}
+
+	// 5. 分发到链路引用的已启用策略
+	handler, err := dispatcher.NewHandler(view.Strategy)
+	if err != nil {
+		return nil, fmt.Errorf("创建分发器失败: %w", err)
+	}
+	dispatched, filterErrors := handler.Dispatch(pointPackage)
+	for _, err := range filterErrors {
+		ruleErrors = append(ruleErrors, err.Error())
+	}
+
+	result := &ShootResult{
+		Pipeline:   pipelineName,
+		FrameId:    frameId,
+		Frame:      frameHex,
+		Consumed:   consumed,
+		Points:     pointPackage.Points,
+		Errors:     ruleErrors,
+		Strategies: make([]StrategyResult, 0, len(dispatched)),
+	}
+	for name, pointPackage := range dispatched {
+		result.Strategies = append(result.Strategies, StrategyResult{
+			Strategy: name,
+			Points:   pointPackage.Points,
+		})
+	}
+	sort.Slice(result.Strategies, func(i, j int) bool {
+		return result.Strategies[i].Strategy < result.Strategies[j].Strategy
+	})
+	return result, nil
+}
+
+// pipelineView 返回指定链路视角的配置, 链路不存在时返回错误并列出可用的链路
+func pipelineView(config *pkg.Config, name string) (*pkg.Config, error) {
+	var names []string
+	for _, pipeline := range config.GetPipelines() {
+		if pipeline.Name == name {
+			return config.ForPipeline(pipeline)
+		}
+		names = append(names, pipeline.Name)
+	}
+	return nil, fmt.Errorf("链路 %s 不存在, 可选: %s", name, strings.Join(names, ", "))
+}
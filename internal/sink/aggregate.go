@@ -0,0 +1,339 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"gateway/internal/pkg"
+	"math"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAggregateMaxSeries = 100000
+	// aggregateFlushTimeout 退出时将未关闭的窗口交给内部策略的最长等待时间
+	aggregateFlushTimeout = 5 * time.Second
+)
+
+// aggregateFunctions 是支持的聚合函数, 输出字段名为 <字段名>_<函数名>
+var aggregateFunctions = []string{"min", "max", "mean", "last", "count"}
+
+// aggregateStats 是一个数值字段在窗口内的统计
+type aggregateStats struct {
+	min, max, sum float64
+	count         int64
+	last          any // 保留原始类型
+}
+
+// aggregateSeries 是窗口内一个标签集合的统计, fields 按首次出现的顺序记录字段名
+type aggregateSeries struct {
+	tag    map[string]any
+	names  []string
+	fields map[string]*aggregateStats
+}
+
+// aggregateWindow 是一个滚动窗口, series 按首次出现的顺序输出
+type aggregateWindow struct {
+	start   time.Time
+	frameId string // 窗口内最后一个点包的帧号
+	index   map[uint64]*aggregateSeries
+	series  []*aggregateSeries
+}
+
+// aggregator 按标签集合在对齐的滚动窗口内聚合数值字段, 非数值字段被忽略。
+// 窗口以点包时间戳划分, 收到的最大时间戳超过窗口结束时间 + delay 后输出;
+// 超过 window + delay 没有收到新数据时输出全部未关闭的窗口。
+// 早于已输出窗口的点包视为迟到数据并丢弃, 以免同一窗口重复输出;
+// 晚于系统时间 + window 的点包 (设备时钟错误) 同样丢弃, 否则水位线会被推到未来, 之后的窗口一创建就被关闭。
+type aggregator struct {
+	window    time.Duration
+	delay     time.Duration
+	functions []string
+	maxSeries int
+
+	windows   map[time.Time]*aggregateWindow
+	watermark time.Time // 已收到的最大点包时间戳
+	closed    time.Time // 已输出窗口的最大结束时间
+	received  time.Time // 最近一次收到数据的系统时间
+}
+
+func newAggregator(config pkg.AggregateConfig) (*aggregator, error) {
+	if config.Window <= 0 {
+		return nil, fmt.Errorf("聚合窗口 window 必须大于 0")
+	}
+	if config.Delay < 0 {
+		return nil, fmt.Errorf("聚合 delay 不能为负数: %v", config.Delay)
+	}
+	functions := config.Functions
+	if len(functions) == 0 {
+		functions = aggregateFunctions
+	}
+	for _, function := range functions {
+		if !slices.Contains(aggregateFunctions, function) {
+			return nil, fmt.Errorf("不支持的聚合函数: %s, 可选 %v", function, aggregateFunctions)
+		}
+	}
+	maxSeries := config.MaxSeries
+	if maxSeries <= 0 {
+		maxSeries = defaultAggregateMaxSeries
+	}
+	return &aggregator{
+		window:    config.Window,
+		delay:     config.Delay,
+		functions: functions,
+		maxSeries: maxSeries,
+		windows:   make(map[time.Time]*aggregateWindow),
+	}, nil
+}
+
+// add 将点包计入所属窗口, now 为系统时间
+// 返回 false 表示点包迟到或时间戳超前被丢弃, dropped 为因超出 maxSeries 被丢弃的点数
+func (a *aggregator) add(pointPackage *pkg.PointPackage, now time.Time) (ok bool, dropped int) {
+	if pointPackage.Ts.Before(a.closed) || a.ahead(pointPackage.Ts, now) {
+		return false, 0
+	}
+	a.received = now
+	if pointPackage.Ts.After(a.watermark) {
+		a.watermark = pointPackage.Ts
+	}
+
+	start := pointPackage.Ts.Truncate(a.window)
+	window, exists := a.windows[start]
+	if !exists {
+		window = &aggregateWindow{start: start, index: make(map[uint64]*aggregateSeries)}
+		a.windows[start] = window
+	}
+	window.frameId = pointPackage.FrameId
+
+	for _, point := range pointPackage.Points {
+		if point == nil {
+			continue
+		}
+		key := pkg.TagKey(point.Tag)
+		series, exists := window.index[key]
+		if !exists {
+			if len(window.series) >= a.maxSeries {
+				dropped++
+				continue
+			}
+			series = &aggregateSeries{tag: make(map[string]any, len(point.Tag)), fields: make(map[string]*aggregateStats)}
+			for k, v := range point.Tag {
+				series.tag[k] = v
+			}
+			window.index[key] = series
+			window.series = append(window.series, series)
+		}
+		series.add(point.Field)
+	}
+	return true, dropped
+}
+
+// ahead 判断时间戳是否超前系统时间一个窗口以上
+func (a *aggregator) ahead(ts, now time.Time) bool {
+	return ts.After(now.Add(a.window))
+}
+
+func (s *aggregateSeries) add(field map[string]any) {
+	for name, v := range field {
+		f, ok := aggregateValue(v)
+		if !ok {
+			continue
+		}
+		stats, exists := s.fields[name]
+		if !exists {
+			stats = &aggregateStats{min: f, max: f}
+			s.fields[name] = stats
+			s.names = append(s.names, name)
+		}
+		stats.min = math.Min(stats.min, f)
+		stats.max = math.Max(stats.max, f)
+		stats.sum += f
+		stats.count++
+		stats.last = v
+	}
+}
+
+// collect 关闭已经结束的窗口, 按窗口起始时间的顺序返回聚合结果, now 为系统时间
+func (a *aggregator) collect(now time.Time) []*pkg.PointPackage {
+	idle := !a.received.IsZero() && now.Sub(a.received) >= a.window+a.delay
+	return a.close(func(start time.Time) bool {
+		return idle || !start.Add(a.window+a.delay).After(a.watermark)
+	})
+}
+
+// flush 关闭全部未关闭的窗口, 用于退出或热加载
+func (a *aggregator) flush() []*pkg.PointPackage {
+	return a.close(func(time.Time) bool { return true })
+}
+
+// close 关闭 done 返回 true 的窗口, 按窗口起始时间的顺序返回聚合结果
+func (a *aggregator) close(done func(start time.Time) bool) []*pkg.PointPackage {
+	var starts []time.Time
+	for start := range a.windows {
+		if done(start) {
+			starts = append(starts, start)
+		}
+	}
+	slices.SortFunc(starts, func(x, y time.Time) int { return x.Compare(y) })
+
+	var result []*pkg.PointPackage
+	for _, start := range starts {
+		window := a.windows[start]
+		delete(a.windows, start)
+		if end := start.Add(a.window); end.After(a.closed) {
+			a.closed = end
+		}
+		if pointPackage := a.emit(window); pointPackage != nil {
+			result = append(result, pointPackage)
+		}
+	}
+	return result
+}
+
+// emit 将窗口转换为点包, 时间戳为窗口起始时间, 没有数值字段的窗口返回 nil
+func (a *aggregator) emit(window *aggregateWindow) *pkg.PointPackage {
+	pointPackage := &pkg.PointPackage{FrameId: window.frameId, Ts: window.start}
+	for _, series := range window.series {
+		if len(series.names) == 0 {
+			continue
+		}
+		point := &pkg.Point{Tag: series.tag, Field: make(map[string]any, len(series.names)*len(a.functions))}
+		for _, name := range series.names {
+			stats := series.fields[name]
+			for _, function := range a.functions {
+				switch function {
+				case "min":
+					point.Field[name+"_min"] = stats.min
+				case "max":
+					point.Field[name+"_max"] = stats.max
+				case "mean":
+					point.Field[name+"_mean"] = stats.sum / float64(stats.count)
+				case "last":
+					point.Field[name+"_last"] = stats.last
+				case "count":
+					point.Field[name+"_count"] = stats.count
+				}
+			}
+		}
+		pointPackage.Points = append(pointPackage.Points, point)
+	}
+	if len(pointPackage.Points) == 0 {
+		return nil
+	}
+	return pointPackage
+}
+
+// aggregateValue 将数值类型的字段值转换为 float64, 布尔、字符串与 NaN 不参与聚合
+func aggregateValue(v any) (float64, bool) {
+	switch v.(type) {
+	case nil, bool, string:
+		return 0, false
+	}
+	f, err := toFloat(v)
+	return f, err == nil && !math.IsNaN(f)
+}
+
+// aggregateTemplate 在 Dispatcher 与策略之间插入时间窗口聚合, 策略只收到聚合后的点包
+// 内部策略使用 innerCtx, 在 ctx 结束 (退出或热加载) 后先收到未关闭窗口的结果, 再结束
+type aggregateTemplate struct {
+	ctx         context.Context
+	name        string
+	inner       Template
+	innerCtx    context.Context
+	cancelInner context.CancelFunc
+	aggregator  *aggregator
+	logger      *zap.Logger
+}
+
+// newAggregateTemplate 校验策略的聚合配置, 被包装的策略由调用方使用 innerCtx 创建后设置到 inner
+func newAggregateTemplate(ctx context.Context, config pkg.StrategyConfig) (*aggregateTemplate, error) {
+	aggregator, err := newAggregator(config.Aggregate)
+	if err != nil {
+		return nil, fmt.Errorf("策略 %s 的聚合配置无效: %w", config.GetName(), err)
+	}
+	logger := pkg.LoggerFromContext(ctx)
+	logger.Info("时间窗口聚合已启用", zap.Duration("window", aggregator.window), zap.Strings("functions", aggregator.functions))
+	innerCtx, cancelInner := context.WithCancel(context.WithoutCancel(ctx))
+	return &aggregateTemplate{
+		ctx:         ctx,
+		name:        config.GetName(),
+		innerCtx:    innerCtx,
+		cancelInner: cancelInner,
+		aggregator:  aggregator,
+		logger:      logger,
+	}, nil
+}
+
+func (a *aggregateTemplate) GetType() string {
+	return a.inner.GetType()
+}
+
+// Start 聚合 Dispatcher 发来的点包, 窗口关闭后将结果交给内部策略
+func (a *aggregateTemplate) Start(source chan *pkg.PointPackage) {
+	metrics := pkg.MetricsFromContext(a.ctx)
+	ch := make(chan *pkg.PointPackage)
+	go a.inner.Start(ch)
+	defer a.cancelInner()
+
+	ticker := time.NewTicker(min(a.aggregator.window, time.Second))
+	defer ticker.Stop()
+	for {
+		var ready []*pkg.PointPackage
+		select {
+		case <-a.ctx.Done():
+			a.flush(ch)
+			return
+		case pointPackage := <-source:
+			if pointPackage == nil {
+				continue
+			}
+			metrics.IncMsgReceived("aggregate_" + a.name)
+			now := time.Now()
+			ok, dropped := a.aggregator.add(pointPackage, now)
+			if !ok {
+				metrics.IncMsgErrors("aggregate_" + a.name)
+				if a.aggregator.ahead(pointPackage.Ts, now) {
+					a.logger.Debug("丢弃时间戳超前的点包", zap.String("frameId", pointPackage.FrameId), zap.Time("ts", pointPackage.Ts))
+				} else {
+					a.logger.Debug("丢弃迟到的点包", zap.String("frameId", pointPackage.FrameId), zap.Time("ts", pointPackage.Ts))
+				}
+				continue
+			}
+			if dropped > 0 {
+				metrics.IncMsgErrors("aggregate_" + a.name)
+				a.logger.Warn("聚合窗口的标签集合数已达上限, 丢弃新的点", zap.Int("dropped", dropped), zap.Int("maxSeries", a.aggregator.maxSeries))
+			}
+			ready = a.aggregator.collect(now)
+		case now := <-ticker.C:
+			ready = a.aggregator.collect(now)
+		}
+		for _, pointPackage := range ready {
+			select {
+			case ch <- pointPackage:
+				metrics.IncMsgProcessed("aggregate_" + a.name)
+			case <-a.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// flush 在 ctx 结束后将未关闭的窗口交给内部策略, 内部策略的 ctx 在返回后才结束
+// 热加载时旧的一代会被取消, 不输出的话每次热加载都会丢失最多 window + delay 的数据
+func (a *aggregateTemplate) flush(ch chan *pkg.PointPackage) {
+	metrics := pkg.MetricsFromContext(a.ctx)
+	ready := a.aggregator.flush()
+	timeout := time.After(aggregateFlushTimeout)
+	for i, pointPackage := range ready {
+		select {
+		case ch <- pointPackage:
+			metrics.IncMsgProcessed("aggregate_" + a.name)
+		case <-timeout:
+			metrics.IncMsgErrors("aggregate_" + a.name)
+			a.logger.Warn("退出时输出聚合窗口超时, 丢弃剩余窗口", zap.Int("windows", len(ready)-i))
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gateway/internal/pkg"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"go.uber.org/zap"
+)
+
+func init() {
+	Register("console", NewConsoleStrategy)
+}
+
+// ConsoleInfo console 策略的专属配置
+type ConsoleInfo struct {
+	Format string `mapstructure:"format"` // text (默认, 便于阅读) | json (每个点一行 JSON)
+	Output string `mapstructure:"output"` // stdout (默认) | stderr
+}
+
+// ConsoleStrategy 将点包打印到控制台, 用于调试
+type ConsoleStrategy struct {
+	info   ConsoleInfo
+	out    io.Writer
+	ctx    context.Context
+	logger *zap.Logger
+}
+
+// NewConsoleStrategy Step.0 构造函数
+func NewConsoleStrategy(ctx context.Context, strategyConfig pkg.StrategyConfig) (Template, error) {
+	var info ConsoleInfo
+	if err := mapstructure.Decode(strategyConfig.Para, &info); err != nil {
+		return nil, fmt.Errorf("解析 console 配置失败: %w", err)
+	}
+	switch info.Format {
+	case "":
+		info.Format = "text"
+	case "text", "json":
+	default:
+		return nil, fmt.Errorf("console 不支持的 format: %s, 可选 text|json", info.Format)
+	}
+	var out io.Writer
+	switch info.Output {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		return nil, fmt.Errorf("console 不支持的 output: %s, 可选 stdout|stderr", info.Output)
+	}
+	return &ConsoleStrategy{
+		info:   info,
+		out:    out,
+		ctx:    ctx,
+		logger: pkg.LoggerFromContext(ctx).With(zap.String("sink_type", "console")),
+	}, nil
+}
+
+// GetType Step.1
+func (c *ConsoleStrategy) GetType() string {
+	return "console"
+}
+
+// Start Step.2
+func (c *ConsoleStrategy) Start(sink chan *pkg.PointPackage) {
+	metrics := pkg.MetricsFromContext(c.ctx)
+	c.logger.Info("===ConsoleStrategy Started===")
+	for {
+		select {
+		case <-c.ctx.Done():
+			c.logger.Info("===ConsoleStrategy Stopping===")
+			return
+		case pointPackage, ok := <-sink:
+			if !ok {
+				return
+			}
+			metrics.IncMsgReceived("console_strategy")
+			if err := c.Write(c.ctx, pointPackage); err != nil {
+				metrics.IncMsgErrors("console_strategy")
+				c.logger.Error("打印点包失败", zap.Error(err))
+				continue
+			}
+			metrics.IncMsgProcessed("console_strategy")
+		}
+	}
+}
+
+// Write 实现 Writer 接口, 打印一个点包
+func (c *ConsoleStrategy) Write(_ context.Context, pointPackage *pkg.PointPackage) error {
+	if pointPackage == nil || len(pointPackage.Points) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if c.info.Format == "json" {
+		if err := encodeJsonLines(&buf, pointPackage); err != nil {
+			return err
+		}
+	} else {
+		formatText(&buf, pointPackage)
+	}
+	_, err := c.out.Write(buf.Bytes())
+	return err
+}
+
+// formatText 以便于阅读的格式输出点包, 标签与字段按名称排序:
+//
+//	[00001A] 2025-01-02T15:04:05.000+08:00 2 points
+//	  id=dev1 line=a | temp=21.5 hum=40
+func formatText(buf *bytes.Buffer, pointPackage *pkg.PointPackage) {
+	fmt.Fprintf(buf, "[%s] %s %d points\n", pointPackage.FrameId, pointPackage.Ts.Format("2006-01-02T15:04:05.000Z07:00"), len(pointPackage.Points))
+	for _, point := range pointPackage.Points {
+		if point == nil {
+			continue
+		}
+		fmt.Fprintf(buf, "  %s | %s\n", formatMap(point.Tag, " "), formatMap(point.Field, " "))
+	}
+}
+
+// formatMap 将 map 格式化为按键排序、以 sep 分隔的 k=v 列表
+func formatMap(m map[string]any, sep string) string {
+	parts := make([]string, 0, len(m))
+	for _, k := range sortedMapKeys(m) {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, m[k]))
+	}
+	return strings.Join(parts, sep)
+}
+
+// sortedMapKeys 返回按名称排序的键
+func sortedMapKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encodeJsonLines 每个点输出一行 JSON, 字段与 kafka/mqtt 策略的消息一致, 另附 frameId
+func encodeJsonLines(w io.Writer, pointPackage *pkg.PointPackage) error {
+	encoder := json.NewEncoder(w)
+	for _, point := range pointPackage.Points {
+		if point == nil {
+			continue
+		}
+		if err := encoder.Encode(map[string]interface{}{
+			"frameId": pointPackage.FrameId,
+			"tags":    point.Tag,
+			"fields":  point.Field,
+			"ts":      pointPackage.Ts.UnixNano(),
+		}); err != nil {
+			return fmt.Errorf("序列化点失败: %w", err)
+		}
+	}
+	return nil
+}
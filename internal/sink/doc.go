@@ -46,5 +46,6 @@ strategy 接口定义了下游数据源的发送策略，包括：
 // 批量处理等策略。主要职责包括：
 //   - 实现与各种外部存储或服务（如 InfluxDB、控制台输出、HTTP API）的集成。
 //   - 根据用户配置的过滤规则筛选数据。
+//   - 按策略配置在发送前进行时间窗口聚合（aggregate）或落盘缓冲（wal）。
 //   - 高效地将数据点写入目标系统。
 package sink
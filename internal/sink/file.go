@@ -0,0 +1,226 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"gateway/internal/pkg"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"go.uber.org/zap"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const defaultFileMaxSize = 100 // MB
+
+// csvHeader 是 CSV 格式的表头, 每个字段一行, 标签按名称排序后以 k=v;k=v 的形式写入一列
+var csvHeader = []string{"ts", "frameId", "tags", "field", "value"}
+
+func init() {
+	Register("file", NewFileStrategy)
+}
+
+// FileInfo file 策略的专属配置, 切割相关的配置与日志文件 (pkg/logger.go) 一致
+type FileInfo struct {
+	Path           string        `mapstructure:"path"`           // 文件路径, 切割后的旧文件在同一目录下
+	Format         string        `mapstructure:"format"`         // jsonl (默认) | csv
+	MaxSize        int           `mapstructure:"maxSize"`        // 单个文件最大体积 (MB), 默认 100
+	MaxBackups     int           `mapstructure:"maxBackups"`     // 保留的旧文件个数, 0 表示全部保留
+	MaxAge         int           `mapstructure:"maxAge"`         // 旧文件保留天数, 0 表示不按时间删除
+	Compress       bool          `mapstructure:"compress"`       // 是否 gzip 压缩旧文件
+	RotateInterval time.Duration `mapstructure:"rotateInterval"` // (可选) 按时间切割的周期, 如 1h / 24h
+}
+
+// FileStrategy 将点包以 JSON Lines 或 CSV 格式写入本地文件, 用于没有数据库的现场归档
+type FileStrategy struct {
+	info   FileInfo
+	ctx    context.Context
+	logger *zap.Logger
+
+	mu     sync.Mutex // Start 与 WAL 重放可能并发写入
+	writer *lumberjack.Logger
+	size   int64 // 当前文件的大小, 用于判断 lumberjack 是否即将切割, 切割后的新文件需要重写 CSV 表头
+	opened bool
+}
+
+// NewFileStrategy Step.0 构造函数
+func NewFileStrategy(ctx context.Context, strategyConfig pkg.StrategyConfig) (Template, error) {
+	var info FileInfo
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           &info,
+		TagName:          "mapstructure",
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建 file 配置解码器失败: %w", err)
+	}
+	if err = decoder.Decode(strategyConfig.Para); err != nil {
+		return nil, fmt.Errorf("解析 file 配置失败: %w", err)
+	}
+	if info.Path == "" {
+		return nil, errors.New("file 策略需要配置 path")
+	}
+	switch info.Format {
+	case "":
+		info.Format = "jsonl"
+	case "jsonl", "csv":
+	default:
+		return nil, fmt.Errorf("file 不支持的 format: %s, 可选 jsonl|csv", info.Format)
+	}
+	if info.MaxSize <= 0 {
+		info.MaxSize = defaultFileMaxSize
+	}
+
+	return &FileStrategy{
+		info: info,
+		ctx:  ctx,
+		writer: &lumberjack.Logger{
+			Filename:   info.Path,
+			MaxSize:    info.MaxSize,
+			MaxBackups: info.MaxBackups,
+			MaxAge:     info.MaxAge,
+			Compress:   info.Compress,
+			LocalTime:  true,
+		},
+		logger: pkg.LoggerFromContext(ctx).With(zap.String("sink_type", "file"), zap.String("path", info.Path)),
+	}, nil
+}
+
+// GetType Step.1
+func (f *FileStrategy) GetType() string {
+	return "file"
+}
+
+// Start Step.2
+func (f *FileStrategy) Start(sink chan *pkg.PointPackage) {
+	metrics := pkg.MetricsFromContext(f.ctx)
+	f.logger.Info("===FileStrategy Started===", zap.String("format", f.info.Format))
+	defer func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if err := f.writer.Close(); err != nil {
+			f.logger.Error("关闭文件失败", zap.Error(err))
+		}
+	}()
+
+	// 未配置按时间切割时 rotate 永远不会触发
+	var rotate <-chan time.Time
+	if f.info.RotateInterval > 0 {
+		ticker := time.NewTicker(f.info.RotateInterval)
+		defer ticker.Stop()
+		rotate = ticker.C
+	}
+
+	for {
+		select {
+		case <-f.ctx.Done():
+			f.logger.Info("===FileStrategy Stopping===")
+			return
+		case <-rotate:
+			if err := f.Rotate(); err != nil {
+				metrics.IncMsgErrors("file_strategy_rotate")
+				f.logger.Error("按时间切割文件失败", zap.Error(err))
+			}
+		case pointPackage, ok := <-sink:
+			if !ok {
+				return
+			}
+			metrics.IncMsgReceived("file_strategy")
+			if err := f.Write(f.ctx, pointPackage); err != nil {
+				metrics.IncErrorCount()
+				metrics.IncMsgErrors("file_strategy")
+				f.logger.Error("写入文件失败", zap.String("frameId", pointPackage.FrameId), zap.Error(err))
+				continue
+			}
+			metrics.IncMsgProcessed("file_strategy")
+		}
+	}
+}
+
+// Rotate 立即切割当前文件, 之后的数据写入新文件
+func (f *FileStrategy) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writer.Rotate(); err != nil {
+		return err
+	}
+	f.size, f.opened = 0, true
+	return nil
+}
+
+// Write 实现 Writer 接口, 一个点包编码后一次写入, 保证同一点包不会被切割到两个文件中
+func (f *FileStrategy) Write(_ context.Context, pointPackage *pkg.PointPackage) error {
+	if pointPackage == nil || len(pointPackage.Points) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if f.info.Format == "csv" {
+		if err := encodeCsv(&buf, pointPackage); err != nil {
+			return err
+		}
+	} else if err := encodeJsonLines(&buf, pointPackage); err != nil {
+		return err
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data := buf.Bytes()
+	if f.info.Format == "csv" && f.newFile(len(data)) {
+		var header bytes.Buffer
+		w := csv.NewWriter(&header)
+		w.Write(csvHeader)
+		w.Flush()
+		data = append(header.Bytes(), data...)
+	}
+	n, err := f.writer.Write(data)
+	f.size += int64(n)
+	return err
+}
+
+// newFile 判断写入 n 字节时 lumberjack 是否会写入一个新文件 (文件不存在、为空或即将按大小切割)
+// 判断条件与 lumberjack.Logger.Write 保持一致
+func (f *FileStrategy) newFile(n int) bool {
+	maxSize := int64(f.info.MaxSize) * 1024 * 1024
+	if !f.opened {
+		f.opened = true
+		f.size = 0
+		if stat, err := os.Stat(f.info.Path); err == nil {
+			f.size = stat.Size()
+			if f.size+int64(n) >= maxSize {
+				f.size = 0
+			}
+		}
+	} else if f.size+int64(n) > maxSize {
+		f.size = 0
+	}
+	return f.size == 0
+}
+
+// encodeCsv 每个字段输出一行: ts(RFC3339Nano), frameId, tags, field, value
+// 字段按名称排序, 不同设备、不同字段的数据可以写入同一个文件
+func encodeCsv(buf *bytes.Buffer, pointPackage *pkg.PointPackage) error {
+	w := csv.NewWriter(buf)
+	ts := pointPackage.Ts.Format(time.RFC3339Nano)
+	for _, point := range pointPackage.Points {
+		if point == nil {
+			continue
+		}
+		tags := formatMap(point.Tag, ";")
+		for _, field := range sortedMapKeys(point.Field) {
+			if err := w.Write([]string{ts, pointPackage.FrameId, tags, field, fmt.Sprint(point.Field[field])}); err != nil {
+				return fmt.Errorf("写入 CSV 失败: %w", err)
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
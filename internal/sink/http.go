@@ -0,0 +1,398 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gateway/internal/pkg"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHttpBatchSize     = 100
+	defaultHttpFlushInterval = time.Second
+	defaultHttpTimeout       = 10 * time.Second
+	defaultHttpMaxRetries    = 3
+	defaultHttpRetryInterval = 500 * time.Millisecond
+	maxHttpRetryInterval     = 30 * time.Second
+)
+
+func init() {
+	Register("http", NewHttpStrategy)
+}
+
+// HttpInfo http 策略的专属配置
+type HttpInfo struct {
+	URL           string            `mapstructure:"url"`
+	Method        string            `mapstructure:"method"`        // 默认 POST
+	Headers       map[string]string `mapstructure:"headers"`       // 附加的请求头, 可覆盖默认的 Content-Type
+	Token         string            `mapstructure:"token"`         // (可选) Bearer Token
+	Username      string            `mapstructure:"username"`      // (可选) Basic 认证
+	Password      string            `mapstructure:"password"`      //
+	Format        string            `mapstructure:"format"`        // json (默认) | line | template
+	Template      string            `mapstructure:"template"`      // format 为 template 时的 Go 模板
+	Measurement   string            `mapstructure:"measurement"`   // format 为 line 时的 measurement, 默认 gateway_points
+	BatchSize     int               `mapstructure:"batchSize"`     // 每批最多的点包数, 默认 100
+	FlushInterval time.Duration     `mapstructure:"flushInterval"` // 未攒满一批时的最长等待时间, 默认 1s
+	Timeout       time.Duration     `mapstructure:"timeout"`       // 单次请求超时, 默认 10s
+	MaxRetries    int               `mapstructure:"maxRetries"`    // 5xx/超时后的最大重试次数, 默认 3, 负数表示不重试
+	RetryInterval time.Duration     `mapstructure:"retryInterval"` // 首次重试间隔, 之后翻倍直至 30s, 默认 500ms
+}
+
+// httpRecord 是请求体中的一个点, json 格式直接序列化, template 格式中通过 .Points 访问
+type httpRecord struct {
+	FrameId string         `json:"frameId"`
+	Tags    map[string]any `json:"tags"`
+	Fields  map[string]any `json:"fields"`
+	Ts      time.Time      `json:"-"`
+	TsNano  int64          `json:"ts"` // 与 kafka/mqtt 策略一致, 为纳秒时间戳
+}
+
+// httpTemplateData 是 template 格式的模板数据
+type httpTemplateData struct {
+	Packages []*pkg.PointPackage
+	Points   []httpRecord
+}
+
+// HttpStrategy 将点包分批推送到 HTTP/Webhook 接口
+type HttpStrategy struct {
+	info     HttpInfo
+	client   *http.Client
+	template *template.Template
+	ctx      context.Context
+	logger   *zap.Logger
+}
+
+// NewHttpStrategy Step.0 构造函数
+func NewHttpStrategy(ctx context.Context, strategyConfig pkg.StrategyConfig) (Template, error) {
+	var info HttpInfo
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           &info,
+		TagName:          "mapstructure",
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建 http 配置解码器失败: %w", err)
+	}
+	if err = decoder.Decode(strategyConfig.Para); err != nil {
+		return nil, fmt.Errorf("解析 http 配置失败: %w", err)
+	}
+	if info.URL == "" {
+		return nil, errors.New("http 策略需要配置 url")
+	}
+	if info.Method == "" {
+		info.Method = http.MethodPost
+	}
+	info.Method = strings.ToUpper(info.Method)
+
+	strategy := &HttpStrategy{ctx: ctx}
+	switch info.Format {
+	case "", "json":
+		info.Format = "json"
+	case "line":
+		if info.Measurement == "" {
+			info.Measurement = "gateway_points"
+		}
+	case "template":
+		if info.Template == "" {
+			return nil, errors.New("http 策略 format 为 template 时需要配置 template")
+		}
+		tmpl, err := template.New("body").Funcs(template.FuncMap{"json": toJson}).Parse(info.Template)
+		if err != nil {
+			return nil, fmt.Errorf("解析 http 模板失败: %w", err)
+		}
+		strategy.template = tmpl
+	default:
+		return nil, fmt.Errorf("http 不支持的 format: %s, 可选 json|line|template", info.Format)
+	}
+
+	if info.BatchSize <= 0 {
+		info.BatchSize = defaultHttpBatchSize
+	}
+	if info.FlushInterval <= 0 {
+		info.FlushInterval = defaultHttpFlushInterval
+	}
+	if info.Timeout <= 0 {
+		info.Timeout = defaultHttpTimeout
+	}
+	if info.MaxRetries == 0 {
+		info.MaxRetries = defaultHttpMaxRetries
+	}
+	if info.RetryInterval <= 0 {
+		info.RetryInterval = defaultHttpRetryInterval
+	}
+
+	strategy.info = info
+	strategy.client = &http.Client{Timeout: info.Timeout}
+	strategy.logger = pkg.LoggerFromContext(ctx).With(zap.String("sink_type", "http"), zap.String("url", info.URL))
+	return strategy, nil
+}
+
+// GetType Step.1
+func (h *HttpStrategy) GetType() string {
+	return "http"
+}
+
+// Start Step.2 按数量或时间攒批, 每批发送一次请求
+func (h *HttpStrategy) Start(sink chan *pkg.PointPackage) {
+	metrics := pkg.MetricsFromContext(h.ctx)
+	h.logger.Info("===HttpStrategy Started===", zap.String("format", h.info.Format), zap.Int("batchSize", h.info.BatchSize))
+
+	ticker := time.NewTicker(h.info.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]*pkg.PointPackage, 0, h.info.BatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := h.send(ctx, batch); err != nil {
+			metrics.IncErrorCount()
+			metrics.IncMsgErrors("http_strategy")
+			h.logger.Error("推送数据失败, 丢弃该批数据", zap.Int("packages", len(batch)), zap.Error(err))
+		} else {
+			metrics.IncMsgProcessed("http_strategy")
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			// 退出前尽力发送最后一批, 不再重试
+			ctx, cancel := context.WithTimeout(context.Background(), h.info.Timeout)
+			if len(batch) > 0 {
+				if err := h.do(ctx, batch); err != nil {
+					h.logger.Warn("退出前推送剩余数据失败", zap.Int("packages", len(batch)), zap.Error(err))
+				}
+			}
+			cancel()
+			h.logger.Info("===HttpStrategy Stopping===")
+			return
+		case <-ticker.C:
+			flush(h.ctx)
+		case pointPackage, ok := <-sink:
+			if !ok {
+				flush(h.ctx)
+				return
+			}
+			if pointPackage == nil || len(pointPackage.Points) == 0 {
+				continue
+			}
+			metrics.IncMsgReceived("http_strategy")
+			batch = append(batch, pointPackage)
+			if len(batch) >= h.info.BatchSize {
+				flush(h.ctx)
+				ticker.Reset(h.info.FlushInterval)
+			}
+		}
+	}
+}
+
+// Write 实现 Writer 接口, 立即推送一个点包
+func (h *HttpStrategy) Write(ctx context.Context, pointPackage *pkg.PointPackage) error {
+	if pointPackage == nil || len(pointPackage.Points) == 0 {
+		return nil
+	}
+	return h.send(ctx, []*pkg.PointPackage{pointPackage})
+}
+
+// send 推送一批点包, 网络错误、超时、429 与 5xx 按指数退避重试, 其他 4xx 直接返回错误
+func (h *HttpStrategy) send(ctx context.Context, batch []*pkg.PointPackage) error {
+	metrics := pkg.MetricsFromContext(h.ctx)
+	backoff := h.info.RetryInterval
+	for attempt := 0; ; attempt++ {
+		err := h.do(ctx, batch)
+		if err == nil || errors.Is(err, ErrPermanent) || attempt >= h.info.MaxRetries {
+			return err
+		}
+		metrics.IncMsgErrors("http_strategy_retry")
+		h.logger.Warn("推送数据失败, 稍后重试", zap.Error(err), zap.Int("attempt", attempt+1), zap.Duration("backoff", backoff))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxHttpRetryInterval)
+	}
+}
+
+// do 编码并发送一次请求
+func (h *HttpStrategy) do(ctx context.Context, batch []*pkg.PointPackage) error {
+	body, contentType, err := h.encode(batch)
+	if err != nil {
+		return fmt.Errorf("%w: 编码请求体失败: %w", ErrPermanent, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, h.info.Method, h.info.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: 创建请求失败: %w", ErrPermanent, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range h.info.Headers {
+		req.Header.Set(k, v)
+	}
+	if h.info.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.info.Token)
+	} else if h.info.Username != "" {
+		req.SetBasicAuth(h.info.Username, h.info.Password)
+	}
+
+	timer := pkg.MetricsFromContext(h.ctx).NewTimer("http_strategy_request")
+	resp, err := h.client.Do(req)
+	timer.StopAndLog(h.logger)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	// 读取少量响应体用于日志, 剩余部分丢弃以便复用连接
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("下游返回 %s: %s", resp.Status, bytes.TrimSpace(msg))
+	default:
+		return fmt.Errorf("%w: 下游返回 %s: %s", ErrPermanent, resp.Status, bytes.TrimSpace(msg))
+	}
+}
+
+// encode 按 format 生成请求体与默认的 Content-Type
+func (h *HttpStrategy) encode(batch []*pkg.PointPackage) ([]byte, string, error) {
+	var buf bytes.Buffer
+	switch h.info.Format {
+	case "line":
+		for _, pointPackage := range batch {
+			for _, point := range pointPackage.Points {
+				if point != nil {
+					writeLineProtocol(&buf, h.info.Measurement, point, pointPackage.Ts)
+				}
+			}
+		}
+		return buf.Bytes(), "text/plain; charset=utf-8", nil
+	case "template":
+		if err := h.template.Execute(&buf, httpTemplateData{Packages: batch, Points: httpRecords(batch)}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "application/json", nil
+	default:
+		if err := json.NewEncoder(&buf).Encode(httpRecords(batch)); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "application/json", nil
+	}
+}
+
+// httpRecords 将一批点包展开为点列表
+func httpRecords(batch []*pkg.PointPackage) []httpRecord {
+	records := make([]httpRecord, 0, len(batch))
+	for _, pointPackage := range batch {
+		for _, point := range pointPackage.Points {
+			if point == nil {
+				continue
+			}
+			records = append(records, httpRecord{
+				FrameId: pointPackage.FrameId,
+				Tags:    point.Tag,
+				Fields:  point.Field,
+				Ts:      pointPackage.Ts,
+				TsNano:  pointPackage.Ts.UnixNano(),
+			})
+		}
+	}
+	return records
+}
+
+// toJson 是模板函数 json, 将任意值序列化为 JSON 字符串
+func toJson(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+var (
+	lineKeyEscaper    = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	lineStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// writeLineProtocol 按 InfluxDB 行协议写入一个点, 标签与字段按名称排序, 时间戳为纳秒
+// 值为 nil 或非有限浮点数的字段被跳过, 没有字段的点不输出
+func writeLineProtocol(buf *bytes.Buffer, measurement string, point *pkg.Point, ts time.Time) {
+	fields := make([]string, 0, len(point.Field))
+	for _, k := range sortedMapKeys(point.Field) {
+		if v, ok := lineFieldValue(point.Field[k]); ok {
+			fields = append(fields, lineKeyEscaper.Replace(k)+"="+v)
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+	buf.WriteString(strings.NewReplacer(",", `\,`, " ", `\ `).Replace(measurement))
+	for _, k := range sortedMapKeys(point.Tag) {
+		value := fmt.Sprint(point.Tag[k])
+		if point.Tag[k] == nil || value == "" {
+			continue
+		}
+		buf.WriteByte(',')
+		buf.WriteString(lineKeyEscaper.Replace(k))
+		buf.WriteByte('=')
+		buf.WriteString(lineKeyEscaper.Replace(value))
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strings.Join(fields, ","))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(ts.UnixNano(), 10))
+	buf.WriteByte('\n')
+}
+
+// lineFieldValue 返回字段值在行协议中的表示: 整数带 i/u 后缀, 字符串加引号
+func lineFieldValue(v any) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.FormatInt(int64(v), 10) + "i", true
+	case int8:
+		return strconv.FormatInt(int64(v), 10) + "i", true
+	case int16:
+		return strconv.FormatInt(int64(v), 10) + "i", true
+	case int32:
+		return strconv.FormatInt(int64(v), 10) + "i", true
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", true
+	case uint:
+		return strconv.FormatUint(uint64(v), 10) + "u", true
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10) + "u", true
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10) + "u", true
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10) + "u", true
+	case uint64:
+		return strconv.FormatUint(v, 10) + "u", true
+	case float32:
+		return lineFieldValue(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case string:
+		return `"` + lineStringEscaper.Replace(v) + `"`, true
+	default:
+		return `"` + lineStringEscaper.Replace(fmt.Sprint(v)) + `"`, true
+	}
+}
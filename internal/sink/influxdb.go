@@ -7,6 +7,7 @@ import (
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"github.com/mitchellh/mapstructure"
 	"go.uber.org/zap"
 )
@@ -30,33 +31,22 @@ type InfluxDbInfo struct {
 
 // InfluxDbStrategy 实现将数据发布到 InfluxDB 的逻辑
 type InfluxDbStrategy struct {
-	client   influxdb2.Client
-	writeAPI api.WriteAPI
-	info     InfluxDbInfo
-	ctx      context.Context
-	logger   *zap.Logger
+	client           influxdb2.Client
+	writeAPI         api.WriteAPI
+	writeAPIBlocking api.WriteAPIBlocking // 同步写入, 供 WAL 重放使用
+	info             InfluxDbInfo
+	ctx              context.Context
+	logger           *zap.Logger
 }
 
 // NewInfluxDbStrategy Step.0 构造函数
-func NewInfluxDbStrategy(ctx context.Context) (Template, error) {
-	config := pkg.ConfigFromContext(ctx)
+func NewInfluxDbStrategy(ctx context.Context, strategyConfig pkg.StrategyConfig) (Template, error) {
 	logger := pkg.LoggerFromContext(ctx)
 
 	var info InfluxDbInfo
-	foundConfig := false
-	for _, strategyConfig := range config.Strategy {
-		if strategyConfig.Enable && strategyConfig.Type == "influxdb" {
-			// 将 map 转换为结构体
-			if err := mapstructure.Decode(strategyConfig.Para, &info); err != nil {
-				return nil, fmt.Errorf("[NewInfluxDbStrategy] Error decoding map to struct: %v", err)
-			}
-			foundConfig = true
-			break // Assuming only one influxdb config section
-		}
-	}
-
-	if !foundConfig {
-		return nil, fmt.Errorf("[NewInfluxDbStrategy] No enabled influxdb strategy configuration found")
+	// 将 map 转换为结构体
+	if err := mapstructure.Decode(strategyConfig.Para, &info); err != nil {
+		return nil, fmt.Errorf("[NewInfluxDbStrategy] Error decoding map to struct: %v", err)
 	}
 
 	// 检查 BatchSize 是否为零或未设置，如果是，使用默认值
@@ -84,11 +74,12 @@ func NewInfluxDbStrategy(ctx context.Context) (Template, error) {
 		}
 	}()
 	return &InfluxDbStrategy{
-		logger:   logger,
-		client:   client,
-		writeAPI: writeAPI,
-		info:     info,
-		ctx:      ctx,
+		logger:           logger,
+		client:           client,
+		writeAPI:         writeAPI,
+		writeAPIBlocking: client.WriteAPIBlocking(info.Org, info.Bucket),
+		info:             info,
+		ctx:              ctx,
 	}, nil
 }
 
@@ -99,7 +90,7 @@ func (b *InfluxDbStrategy) GetType() string {
 
 // Start Step.2
 func (b *InfluxDbStrategy) Start(sink chan *pkg.PointPackage) {
-	metrics := pkg.GetPerformanceMetrics() // 获取性能指标实例
+	metrics := pkg.MetricsFromContext(b.ctx) // 获取带策略标签的性能指标
 
 	defer b.client.Close()
 	b.logger.Info("InfluxDB Strategy started", zap.String("measurement", b.info.Measurement), zap.String("bucket", b.info.Bucket))
@@ -145,7 +136,31 @@ func (b *InfluxDbStrategy) Publish(pointPackage *pkg.PointPackage) error {
 
 	b.logger.Debug("Publishing point package to InfluxDB", zap.String("frameId", pointPackage.FrameId), zap.Int("pointCount", len(pointPackage.Points)))
 
-	pointsWritten := 0
+	for _, p := range b.buildPoints(pointPackage) {
+		// Write point (asynchronously via batching API)
+		b.writeAPI.WritePoint(p)
+	}
+	return nil
+}
+
+// Write 实现 Writer 接口, 同步写入 InfluxDB, 写入失败时返回错误以便 WAL 稍后重放
+func (b *InfluxDbStrategy) Write(ctx context.Context, pointPackage *pkg.PointPackage) error {
+	if pointPackage == nil || len(pointPackage.Points) == 0 {
+		return nil
+	}
+	points := b.buildPoints(pointPackage)
+	if len(points) == 0 {
+		return nil
+	}
+	if err := b.writeAPIBlocking.WritePoint(ctx, points...); err != nil {
+		return fmt.Errorf("写入 InfluxDB 失败: %w", err)
+	}
+	return nil
+}
+
+// buildPoints 将点包转换为 InfluxDB 的点, 跳过没有字段的点
+func (b *InfluxDbStrategy) buildPoints(pointPackage *pkg.PointPackage) []*write.Point {
+	points := make([]*write.Point, 0, len(pointPackage.Points))
 	for _, point := range pointPackage.Points {
 		if point == nil {
 			b.logger.Warn("Skipping nil point within package", zap.String("frameId", pointPackage.FrameId))
@@ -190,9 +205,7 @@ func (b *InfluxDbStrategy) Publish(pointPackage *pkg.PointPackage) error {
 			pointPackage.Ts,    // Timestamp from the package
 		)
 
-		// Write point (asynchronously via batching API)
-		b.writeAPI.WritePoint(p)
-		pointsWritten++
+		points = append(points, p)
 
 		// Reduce log verbosity, maybe log only first point or summary later
 		// b.logger.Info("InfluxDB point prepared",
@@ -202,17 +215,16 @@ func (b *InfluxDbStrategy) Publish(pointPackage *pkg.PointPackage) error {
 		// 	zap.String("frameId", pointPackage.FrameId))
 	}
 
-	if pointsWritten > 0 {
+	if len(points) > 0 {
 		b.logger.Debug("Points prepared for InfluxDB batch write",
-			zap.Int("pointsWritten", pointsWritten),
+			zap.Int("pointsWritten", len(points)),
 			zap.Int("totalInPackage", len(pointPackage.Points)),
 			zap.String("measurement", b.info.Measurement),
 			zap.String("frameId", pointPackage.FrameId))
 	} else {
 		b.logger.Warn("No valid points were written from the package", zap.String("frameId", pointPackage.FrameId))
 	}
-
-	return nil
+	return points
 }
 
 // Stop 停止 InfluxDBStrategy
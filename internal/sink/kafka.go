@@ -39,40 +39,26 @@ type KafkaStrategy struct {
 }
 
 // NewKafkaStrategy 是创建 KafkaStrategy 的工厂函数
-func NewKafkaStrategy(ctx context.Context) (Template, error) {
+func NewKafkaStrategy(ctx context.Context, strategyConfig pkg.StrategyConfig) (Template, error) {
 	log := pkg.LoggerFromContext(ctx)
-	config := pkg.ConfigFromContext(ctx)
 	var cfg KafkaSinkConfig
-	found := false
-
-	// 查找 kafka 策略配置
-	for _, strategyConfig := range config.Strategy {
-		if strategyConfig.Enable && strategyConfig.Type == "kafka" {
-			// 使用 mapstructure 进行稳健的解码
-			decoderConfig := &mapstructure.DecoderConfig{
-				Metadata: nil,
-				Result:   &cfg,
-				TagName:  "mapstructure",
-				// 如果需要为缺失字段设置默认值，添加 ZeroFields = true
-			}
-			decoder, err := mapstructure.NewDecoder(decoderConfig)
-			if err != nil {
-				log.Error("Failed to create mapstructure decoder for Kafka config", zap.Error(err))
-				return nil, fmt.Errorf("failed to create Kafka config decoder: %w", err)
-			}
 
-			if err := decoder.Decode(strategyConfig.Para); err != nil {
-				log.Error("Error decoding Kafka config", zap.Error(err), zap.Any("config", strategyConfig.Para))
-				return nil, fmt.Errorf("error decoding Kafka config: %w", err)
-			}
-			found = true
-			break // 假设只有一个 kafka 配置块
-		}
+	// 使用 mapstructure 进行稳健的解码
+	decoderConfig := &mapstructure.DecoderConfig{
+		Metadata: nil,
+		Result:   &cfg,
+		TagName:  "mapstructure",
+		// 如果需要为缺失字段设置默认值，添加 ZeroFields = true
+	}
+	decoder, err := mapstructure.NewDecoder(decoderConfig)
+	if err != nil {
+		log.Error("Failed to create mapstructure decoder for Kafka config", zap.Error(err))
+		return nil, fmt.Errorf("failed to create Kafka config decoder: %w", err)
 	}
 
-	if !found {
-		log.Warn("No enabled Kafka strategy configuration found")
-		return nil, fmt.Errorf("no enabled Kafka strategy configuration found")
+	if err := decoder.Decode(strategyConfig.Para); err != nil {
+		log.Error("Error decoding Kafka config", zap.Error(err), zap.Any("config", strategyConfig.Para))
+		return nil, fmt.Errorf("error decoding Kafka config: %w", err)
 	}
 
 	// 验证必填字段
@@ -140,7 +126,7 @@ func (ks *KafkaStrategy) GetType() string {
 
 // Start 开始监听通道并将数据发送到 Kafka
 func (ks *KafkaStrategy) Start(pointChan chan *pkg.PointPackage) {
-	metrics := pkg.GetPerformanceMetrics() // 获取性能指标实例
+	metrics := pkg.MetricsFromContext(ks.ctx) // 获取带策略标签的性能指标
 	ks.logger.Info("===KafkaStrategy Started===")
 
 	defer func() {
@@ -175,48 +161,7 @@ OuterLoop:
 			sendTimer := metrics.NewTimer("kafka_strategy_send_batch")
 
 			// 准备 Kafka 批处理的消息
-			messages := make([]kafka.Message, 0, len(pointPackage.Points))
-			var firstPointTags map[string]any // For logging context on error
-
-			for _, point := range pointPackage.Points {
-				if point == nil {
-					ks.logger.Warn("Skipping nil point within package", zap.String("frameId", pointPackage.FrameId))
-					continue
-				}
-				if firstPointTags == nil {
-					firstPointTags = point.Tag // Store tags of the first valid point for logging
-				}
-
-				// New Payload Structure
-				payload := map[string]interface{}{
-					"tags":   point.Tag,                  // Include all tags (map[string]any)
-					"fields": point.Field,                // Include all fields (map[string]interface{})
-					"ts":     pointPackage.Ts.UnixNano(), // Timestamp from package
-				}
-
-				jsonData, err := json.Marshal(payload)
-				if err != nil {
-					metrics.IncErrorCount()
-					metrics.IncMsgErrors("kafka_strategy_json_marshal")
-					// Log with point tags for context if available
-					ks.logger.Error("Failed to marshal point to JSON in batch", zap.Error(err), zap.Any("point_tags", point.Tag), zap.String("frameId", pointPackage.FrameId))
-					continue
-				}
-
-				// Determine Kafka Message Key (e.g., from 'id' tag)
-				var messageKey []byte
-				if idVal, ok := point.Tag["id"]; ok {
-					if idStr, isStr := idVal.(string); isStr {
-						messageKey = []byte(idStr)
-					}
-				}
-
-				messages = append(messages, kafka.Message{
-					Key:   messageKey, // Use tag 'id' as key if available and string
-					Value: jsonData,
-					Time:  pointPackage.Ts,
-				})
-			}
+			messages, firstPointTags := ks.buildMessages(pointPackage)
 
 			if len(messages) == 0 {
 				ks.logger.Warn("No valid messages generated from point package", zap.String("frameId", pointPackage.FrameId), zap.Any("first_point_tags", firstPointTags))
@@ -249,6 +194,69 @@ OuterLoop:
 	ks.logger.Info("===KafkaStrategy Finished===")
 }
 
+// buildMessages 将点包转换为 Kafka 消息, 同时返回第一个有效点的 Tag 用于日志
+func (ks *KafkaStrategy) buildMessages(pointPackage *pkg.PointPackage) ([]kafka.Message, map[string]any) {
+	metrics := pkg.MetricsFromContext(ks.ctx)
+	messages := make([]kafka.Message, 0, len(pointPackage.Points))
+	var firstPointTags map[string]any // For logging context on error
+
+	for _, point := range pointPackage.Points {
+		if point == nil {
+			ks.logger.Warn("Skipping nil point within package", zap.String("frameId", pointPackage.FrameId))
+			continue
+		}
+		if firstPointTags == nil {
+			firstPointTags = point.Tag // Store tags of the first valid point for logging
+		}
+
+		// New Payload Structure
+		payload := map[string]interface{}{
+			"tags":   point.Tag,                  // Include all tags (map[string]any)
+			"fields": point.Field,                // Include all fields (map[string]interface{})
+			"ts":     pointPackage.Ts.UnixNano(), // Timestamp from package
+		}
+
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			metrics.IncErrorCount()
+			metrics.IncMsgErrors("kafka_strategy_json_marshal")
+			// Log with point tags for context if available
+			ks.logger.Error("Failed to marshal point to JSON in batch", zap.Error(err), zap.Any("point_tags", point.Tag), zap.String("frameId", pointPackage.FrameId))
+			continue
+		}
+
+		// Determine Kafka Message Key (e.g., from 'id' tag)
+		var messageKey []byte
+		if idVal, ok := point.Tag["id"]; ok {
+			if idStr, isStr := idVal.(string); isStr {
+				messageKey = []byte(idStr)
+			}
+		}
+
+		messages = append(messages, kafka.Message{
+			Key:   messageKey, // Use tag 'id' as key if available and string
+			Value: jsonData,
+			Time:  pointPackage.Ts,
+		})
+	}
+	return messages, firstPointTags
+}
+
+// Write 实现 Writer 接口, 同步写入 Kafka, 写入失败时返回错误以便 WAL 稍后重放
+func (ks *KafkaStrategy) Write(ctx context.Context, pointPackage *pkg.PointPackage) error {
+	if pointPackage == nil || len(pointPackage.Points) == 0 {
+		return nil
+	}
+	messages, _ := ks.buildMessages(pointPackage)
+	if len(messages) == 0 {
+		return nil
+	}
+	if err := ks.writer.WriteMessages(ctx, messages...); err != nil {
+		return fmt.Errorf("写入 Kafka 失败: %w", err)
+	}
+	return nil
+}
+
 // Stop 优雅地停止 KafkaStrategy（通过上下文取消调用）
 // 实际清理在 Start 中的 defer 函数中完成
 func (ks *KafkaStrategy) Stop() {
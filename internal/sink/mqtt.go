@@ -3,6 +3,7 @@ package sink
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gateway/internal/pkg"
 	"strings"
@@ -52,26 +53,13 @@ type MqttStrategy struct {
 }
 
 // NewMqttStrategy Step.0 Constructor
-func NewMqttStrategy(ctx context.Context) (Template, error) {
+func NewMqttStrategy(ctx context.Context, strategyConfig pkg.StrategyConfig) (Template, error) {
 	log := pkg.LoggerFromContext(ctx)
-	config := pkg.ConfigFromContext(ctx)
 	var info MqttInfo
-	found := false
 
-	for _, strategyConfig := range config.Strategy {
-		if strategyConfig.Enable && strategyConfig.Type == "mqtt" {
-			if err := mapstructure.Decode(strategyConfig.Para, &info); err != nil {
-				log.Error("Failed to decode MQTT config", zap.Error(err), zap.Any("config", strategyConfig.Para))
-				return nil, fmt.Errorf("failed to decode MQTT config: %w", err)
-			}
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		log.Warn("No enabled MQTT strategy configuration found")
-		return nil, fmt.Errorf("no enabled MQTT strategy configuration found")
+	if err := mapstructure.Decode(strategyConfig.Para, &info); err != nil {
+		log.Error("Failed to decode MQTT config", zap.Error(err), zap.Any("config", strategyConfig.Para))
+		return nil, fmt.Errorf("failed to decode MQTT config: %w", err)
 	}
 
 	if info.Broker == "" {
@@ -136,7 +124,7 @@ func (b *MqttStrategy) GetType() string {
 
 // Start Step.2
 func (b *MqttStrategy) Start(sink chan *pkg.PointPackage) {
-	metrics := pkg.GetPerformanceMetrics()
+	metrics := pkg.MetricsFromContext(b.ctx)
 	b.logger.Info("===MQTTStrategy Started===")
 
 OuterLoop:
@@ -165,29 +153,7 @@ OuterLoop:
 					continue
 				}
 
-				// Determine device ID for topic (e.g., from 'id' tag)
-				deviceID := "unknown_device"
-				if idVal, ok := point.Tag["id"]; ok {
-					if idStr, isStr := idVal.(string); isStr && idStr != "" {
-						deviceID = idStr
-					} else {
-						b.logger.Warn("Tag 'id' is not a non-empty string, using default deviceID for topic", zap.Any("tag_id", idVal), zap.String("frameId", pointPackage.FrameId))
-					}
-				} else {
-					b.logger.Warn("Tag 'id' not found, using default deviceID for topic", zap.String("frameId", pointPackage.FrameId))
-				}
-
-				// Construct topic: base_topic/deviceID
-				topic := strings.TrimSuffix(b.info.Topic, "/") + "/" + deviceID
-
-				// Create payload similar to Kafka for consistency
-				payloadMap := map[string]interface{}{
-					"tags":   point.Tag,
-					"fields": point.Field,
-					"ts":     pointPackage.Ts.UnixNano(),
-				}
-
-				jsonData, err := json.Marshal(payloadMap)
+				topic, jsonData, err := b.buildMessage(point, pointPackage)
 				if err != nil {
 					metrics.IncErrorCount()
 					metrics.IncMsgErrors("mqtt_strategy_json_marshal")
@@ -233,6 +199,63 @@ OuterLoop:
 	}
 }
 
+// buildMessage 根据点的 id Tag 生成主题, 并将点序列化为 JSON
+func (b *MqttStrategy) buildMessage(point *pkg.Point, pointPackage *pkg.PointPackage) (string, []byte, error) {
+	// Determine device ID for topic (e.g., from 'id' tag)
+	deviceID := "unknown_device"
+	if idVal, ok := point.Tag["id"]; ok {
+		if idStr, isStr := idVal.(string); isStr && idStr != "" {
+			deviceID = idStr
+		} else {
+			b.logger.Warn("Tag 'id' is not a non-empty string, using default deviceID for topic", zap.Any("tag_id", idVal), zap.String("frameId", pointPackage.FrameId))
+		}
+	} else {
+		b.logger.Warn("Tag 'id' not found, using default deviceID for topic", zap.String("frameId", pointPackage.FrameId))
+	}
+
+	// Construct topic: base_topic/deviceID
+	topic := strings.TrimSuffix(b.info.Topic, "/") + "/" + deviceID
+
+	// Create payload similar to Kafka for consistency
+	payloadMap := map[string]interface{}{
+		"tags":   point.Tag,
+		"fields": point.Field,
+		"ts":     pointPackage.Ts.UnixNano(),
+	}
+	jsonData, err := json.Marshal(payloadMap)
+	return topic, jsonData, err
+}
+
+// Write 实现 Writer 接口, 同步发布并等待 Broker 确认, 连接断开或发布失败时返回错误以便 WAL 稍后重放
+func (b *MqttStrategy) Write(ctx context.Context, pointPackage *pkg.PointPackage) error {
+	if pointPackage == nil || len(pointPackage.Points) == 0 {
+		return nil
+	}
+	if !b.client.IsConnected() {
+		return errors.New("MQTT 未连接")
+	}
+	for _, point := range pointPackage.Points {
+		if point == nil {
+			continue
+		}
+		topic, jsonData, err := b.buildMessage(point, pointPackage)
+		if err != nil {
+			b.logger.Error("Failed to marshal point to JSON for MQTT", zap.Error(err), zap.String("frameId", pointPackage.FrameId))
+			continue
+		}
+		token := b.client.Publish(topic, b.info.QoS, b.info.Retained, jsonData)
+		select {
+		case <-token.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err = token.Error(); err != nil {
+			return fmt.Errorf("发布到 MQTT 失败: %w", err)
+		}
+	}
+	return nil
+}
+
 // Stop 停止 MqttStrategy
 func (b *MqttStrategy) Stop() {
 	b.logger.Info("Requesting stop for MQTTStrategy via context cancel")
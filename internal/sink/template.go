@@ -14,8 +14,8 @@ type Template interface {
 	Start(chan *pkg.PointPackage) // Step:3 强制要求所有策略都有一个启动方法
 }
 
-// FactoryFunc 代表一个发送策略的工厂函数
-type FactoryFunc func(context.Context) (Template, error)
+// FactoryFunc 代表一个发送策略的工厂函数, config 为该策略实例自身的配置
+type FactoryFunc func(ctx context.Context, config pkg.StrategyConfig) (Template, error)
 
 // Factories 全局工厂映射，用于注册不同策略类型的构造函数  这里面可能包含了没有启用的数据源
 var Factories = make(map[string]FactoryFunc)
@@ -25,7 +25,7 @@ func Register(strategyType string, factory FactoryFunc) {
 	Factories[strategyType] = factory
 }
 
-// TemplateCollection 代表发送策略集 这里面是所有已启用的数据源
+// TemplateCollection 代表发送策略集 这里面是所有已启用的数据源, 以策略名称为键
 type TemplateCollection map[string]Template
 
 func (c *TemplateCollection) Start(sinkMap *pkg.Dispatch2SinkChan) {
@@ -47,14 +47,55 @@ var New = func(ctx context.Context) (TemplateCollection, error) {
 	pkg.LoggerFromContext(ctx).Debug("Template Factory:", zap.Strings("Factories", factoryTypes))
 	for _, strategyConfig := range pkg.ConfigFromContext(ctx).Strategy {
 		if strategyConfig.Enable {
-			pkg.LoggerFromContext(ctx).Info(fmt.Sprintf("===正在启动Strategy: %s===", strategyConfig.Type))
-			if factory, exists := Factories[strategyConfig.Type]; exists {
-				strategy, err := factory(ctx)
+			name := strategyConfig.GetName()
+			pkg.LoggerFromContext(ctx).Info(fmt.Sprintf("===正在启动Strategy: %s (%s)===", name, strategyConfig.Type))
+			if _, exists := SendStrategyMap[name]; exists {
+				closeWALs(SendStrategyMap)
+				return nil, fmt.Errorf("策略名称重复: %s, 同类型的多个策略需要配置不同的 name", name)
+			}
+			factory, exists := Factories[strategyConfig.Type]
+			if !exists {
+				closeWALs(SendStrategyMap)
+				return nil, fmt.Errorf("未找到策略类型: %s", strategyConfig.Type)
+			}
+			strategyCtx := pkg.WithLogger(ctx, pkg.LoggerFromContext(ctx).With(zap.String("strategy", name)))
+			strategyCtx = pkg.WithMetricLabels(strategyCtx, pkg.MetricLabels{Strategy: name})
+			// 聚合在 WAL 之前执行, 磁盘上缓存的是聚合后的数据
+			// 开启聚合时, 内部策略与 WAL 使用聚合阶段的 innerCtx, 以便退出时先收到未关闭窗口的结果
+			var aggregate *aggregateTemplate
+			innerCtx := strategyCtx
+			if strategyConfig.Aggregate.Enable {
+				var err error
+				aggregate, err = newAggregateTemplate(strategyCtx, strategyConfig)
+				if err != nil {
+					closeWALs(SendStrategyMap)
+					return nil, err
+				}
+				innerCtx = aggregate.innerCtx
+			}
+			strategy, err := factory(innerCtx, strategyConfig)
+			if err != nil {
+				if aggregate != nil {
+					aggregate.cancelInner()
+				}
+				closeWALs(SendStrategyMap)
+				return nil, fmt.Errorf("初始化策略 %s 失败: %w", name, err)
+			}
+			if strategyConfig.WAL.Enable {
+				strategy, err = newWALTemplate(innerCtx, strategyConfig, strategy)
 				if err != nil {
-					return nil, fmt.Errorf("初始化策略 %s 失败: %w", strategyConfig.Type, err)
+					if aggregate != nil {
+						aggregate.cancelInner()
+					}
+					closeWALs(SendStrategyMap)
+					return nil, err
 				}
-				SendStrategyMap[strategyConfig.Type] = strategy
 			}
+			if aggregate != nil {
+				aggregate.inner = strategy
+				strategy = aggregate
+			}
+			SendStrategyMap[name] = strategy
 		}
 	}
 	return SendStrategyMap, nil
@@ -0,0 +1,220 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"gateway/internal/pkg"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWALDir           = "wal"
+	defaultWALRetryInterval = time.Second
+	maxWALRetryInterval     = 30 * time.Second
+)
+
+func init() {
+	// Field/Tag 中可能出现的非基础类型, gob 编码 interface 前需要注册
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
+	gob.Register(time.Time{})
+}
+
+// Writer 是 Template 的可选接口, 同步发送一个点包, 返回 nil 表示下游已确认接收
+// 开启 WAL 的策略如果实现了 Writer, 发送失败的数据会保留在磁盘上, 待下游恢复后按顺序重放
+// 未实现 Writer 的策略只能保证数据在交给 Start 之前不丢失
+type Writer interface {
+	Write(ctx context.Context, pointPackage *pkg.PointPackage) error
+}
+
+// ErrPermanent 表示数据本身被下游拒绝 (如 HTTP 4xx、数据库类型不匹配), 重试也不会成功
+// Writer 返回包装了 ErrPermanent 的错误时, WAL 丢弃该记录继续重放后面的数据, 而不是一直重试阻塞队列
+var ErrPermanent = errors.New("数据被下游拒绝")
+
+// walTemplate 在 Dispatcher 与策略之间插入一个磁盘队列
+// Dispatcher 写入的数据先落盘, 再由重放协程按顺序交给内部策略
+type walTemplate struct {
+	ctx           context.Context
+	name          string
+	inner         Template
+	queue         *pkg.DiskQueue
+	retryInterval time.Duration
+	logger        *zap.Logger
+}
+
+// newWALTemplate 为策略包装磁盘队列
+func newWALTemplate(ctx context.Context, config pkg.StrategyConfig, inner Template) (*walTemplate, error) {
+	name := config.GetName()
+	dir := config.WAL.Dir
+	if dir == "" {
+		dir = filepath.Join(defaultWALDir, name)
+	}
+	logger := pkg.LoggerFromContext(ctx).With(zap.String("wal", dir))
+	queue, err := pkg.OpenDiskQueue(dir, pkg.DiskQueueOptions{
+		MaxBytes:     config.WAL.MaxBytes,
+		SegmentBytes: config.WAL.SegmentBytes,
+		Policy:       config.WAL.Policy,
+		Logger:       logger,
+		Metrics:      pkg.MetricsFromContext(ctx),
+		Component:    "wal_" + name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("打开策略 %s 的 WAL 失败: %w", name, err)
+	}
+	retryInterval := config.WAL.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = defaultWALRetryInterval
+	}
+	logger.Info("WAL 已启用", zap.Int("pending", queue.Len()), zap.Int64("size", queue.Size()))
+	return &walTemplate{
+		ctx:           ctx,
+		name:          name,
+		inner:         inner,
+		queue:         queue,
+		retryInterval: retryInterval,
+		logger:        logger,
+	}, nil
+}
+
+func (w *walTemplate) GetType() string {
+	return w.inner.GetType()
+}
+
+// Start 将 Dispatcher 发来的数据写入磁盘队列, 并启动重放协程
+func (w *walTemplate) Start(source chan *pkg.PointPackage) {
+	metrics := pkg.MetricsFromContext(w.ctx)
+	replayDone := make(chan struct{})
+	go func() {
+		defer close(replayDone)
+		w.replay()
+	}()
+	defer func() {
+		<-replayDone
+		if err := w.queue.Close(); err != nil {
+			w.logger.Error("关闭 WAL 失败", zap.Error(err))
+		}
+	}()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case pointPackage := <-source:
+			if pointPackage == nil {
+				continue
+			}
+			data, err := encodePointPackage(pointPackage)
+			if err != nil {
+				metrics.IncMsgErrors("wal_" + w.name)
+				w.logger.Error("WAL 编码失败, 丢弃该点包", zap.String("frameId", pointPackage.FrameId), zap.Error(err))
+				continue
+			}
+			dropped, err := w.queue.Append(data)
+			if dropped > 0 {
+				metrics.IncMsgErrors("wal_" + w.name)
+				w.logger.Warn("WAL 已达上限, 淘汰最旧的数据", zap.Int("dropped", dropped))
+			}
+			if err != nil {
+				metrics.IncMsgErrors("wal_" + w.name)
+				w.logger.Warn("WAL 写入失败, 丢弃该点包", zap.String("frameId", pointPackage.FrameId), zap.Error(err))
+				continue
+			}
+			metrics.IncMsgReceived("wal_" + w.name)
+		}
+	}
+}
+
+// replay 按顺序从磁盘队列中取出数据交给内部策略, 发送失败时按指数退避重试同一条数据, 被下游拒绝的数据直接跳过
+func (w *walTemplate) replay() {
+	metrics := pkg.MetricsFromContext(w.ctx)
+	deliver := w.deliverFunc()
+	backoff := w.retryInterval
+	for {
+		err := w.queue.Consume(w.ctx, func(data []byte) error {
+			pointPackage, err := decodePointPackage(data)
+			if err != nil {
+				// 无法解码的数据重试也没有意义, 记录后跳过
+				metrics.IncMsgErrors("wal_" + w.name)
+				w.logger.Error("WAL 解码失败, 跳过该记录", zap.Error(err))
+				return nil
+			}
+			if err = deliver(pointPackage); errors.Is(err, ErrPermanent) {
+				metrics.IncMsgErrors("wal_" + w.name)
+				w.logger.Error("WAL 记录被下游拒绝, 跳过该记录", zap.String("frameId", pointPackage.FrameId), zap.Error(err))
+				return nil
+			}
+			return err
+		})
+		if w.ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			backoff = w.retryInterval
+			metrics.IncMsgProcessed("wal_" + w.name)
+			continue
+		}
+		w.logger.Warn("WAL 重放失败, 稍后重试", zap.Error(err), zap.Duration("backoff", backoff), zap.Int("pending", w.queue.Len()))
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxWALRetryInterval)
+	}
+}
+
+// deliverFunc 返回将一个点包交给内部策略的方法
+// 内部策略的 Start 总会被启动, 以便其在 ctx 结束时释放连接等资源
+func (w *walTemplate) deliverFunc() func(*pkg.PointPackage) error {
+	ch := make(chan *pkg.PointPackage)
+	go w.inner.Start(ch)
+	if writer, ok := w.inner.(Writer); ok {
+		return func(pointPackage *pkg.PointPackage) error {
+			return writer.Write(w.ctx, pointPackage)
+		}
+	}
+	w.logger.Warn("策略未实现同步写入接口, WAL 只能保证数据交给策略之前不丢失", zap.String("type", w.inner.GetType()))
+	return func(pointPackage *pkg.PointPackage) error {
+		select {
+		case ch <- pointPackage:
+			return nil
+		case <-w.ctx.Done():
+			return w.ctx.Err()
+		}
+	}
+}
+
+func encodePointPackage(pointPackage *pkg.PointPackage) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(pointPackage); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodePointPackage(data []byte) (*pkg.PointPackage, error) {
+	var pointPackage pkg.PointPackage
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&pointPackage); err != nil {
+		return nil, err
+	}
+	return &pointPackage, nil
+}
+
+// closeWALs 关闭集合中已打开的 WAL, 用于策略集初始化失败时释放队列
+func closeWALs(c TemplateCollection) {
+	for _, strategy := range c {
+		if a, ok := strategy.(*aggregateTemplate); ok {
+			a.cancelInner()
+			strategy = a.inner
+		}
+		if w, ok := strategy.(*walTemplate); ok {
+			_ = w.queue.Close()
+		}
+	}
+}
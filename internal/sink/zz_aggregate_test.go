@@ -0,0 +1,179 @@
+package sink
+
+import (
+	"context"
+	"gateway/internal/pkg"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+// recordTemplate 记录 Start 收到的点包
+type recordTemplate struct {
+	mu       sync.Mutex
+	received []*pkg.PointPackage
+}
+
+func (r *recordTemplate) GetType() string { return "record" }
+
+func (r *recordTemplate) Start(source chan *pkg.PointPackage) {
+	for pointPackage := range source {
+		r.mu.Lock()
+		r.received = append(r.received, pointPackage)
+		r.mu.Unlock()
+	}
+}
+
+func (r *recordTemplate) packages() []*pkg.PointPackage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*pkg.PointPackage(nil), r.received...)
+}
+
+func TestAggregator(t *testing.T) {
+	base := time.Date(2025, 1, 2, 15, 4, 0, 0, time.UTC)
+	now := time.Now()
+	frame := func(frameId string, offset time.Duration, points ...*pkg.Point) *pkg.PointPackage {
+		return &pkg.PointPackage{FrameId: frameId, Ts: base.Add(offset), Points: points}
+	}
+	point := func(id string, field map[string]any) *pkg.Point {
+		return &pkg.Point{Tag: map[string]any{"id": id}, Field: field}
+	}
+
+	Convey("按标签集合在滚动窗口内输出 min/max/mean/last/count", t, func() {
+		a, err := newAggregator(pkg.AggregateConfig{Window: time.Minute})
+		So(err, ShouldBeNil)
+
+		ok, _ := a.add(frame("1", 0, point("dev1", map[string]any{"temp": 20.0, "state": "run"}), point("dev2", map[string]any{"temp": 1})), now)
+		So(ok, ShouldBeTrue)
+		a.add(frame("2", 20*time.Second, point("dev1", map[string]any{"temp": 24.0, "ok": true}), nil), now)
+		a.add(frame("3", 40*time.Second, point("dev1", map[string]any{"temp": int64(22)})), now)
+		So(a.collect(now), ShouldBeEmpty)
+
+		// 下一个窗口的数据到达后输出上一个窗口
+		a.add(frame("4", 61*time.Second, point("dev1", map[string]any{"temp": 30.0})), now)
+		result := a.collect(now)
+		So(len(result), ShouldEqual, 1)
+		So(result[0].Ts, ShouldEqual, base)
+		So(result[0].FrameId, ShouldEqual, "3")
+		So(len(result[0].Points), ShouldEqual, 2)
+		So(result[0].Points[0].Tag, ShouldResemble, map[string]any{"id": "dev1"})
+		So(result[0].Points[0].Field, ShouldResemble, map[string]any{
+			"temp_min": 20.0, "temp_max": 24.0, "temp_mean": 22.0, "temp_last": int64(22), "temp_count": int64(3),
+		})
+		So(result[0].Points[1].Field["temp_mean"], ShouldEqual, 1.0)
+
+		Convey("早于已输出窗口的数据被丢弃", func() {
+			ok, _ := a.add(frame("5", 59*time.Second, point("dev1", map[string]any{"temp": 1.0})), now)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("长时间没有新数据时输出未关闭的窗口", func() {
+			So(a.collect(now.Add(59*time.Second)), ShouldBeEmpty)
+			result := a.collect(now.Add(time.Minute))
+			So(len(result), ShouldEqual, 1)
+			So(result[0].Ts, ShouldEqual, base.Add(time.Minute))
+		})
+	})
+
+	Convey("delay 推迟窗口关闭, functions 与 maxSeries 生效", t, func() {
+		a, err := newAggregator(pkg.AggregateConfig{Window: time.Minute, Delay: 10 * time.Second, Functions: []string{"max", "count"}, MaxSeries: 1})
+		So(err, ShouldBeNil)
+
+		_, dropped := a.add(frame("1", 0, point("dev1", map[string]any{"v": 1}), point("dev2", map[string]any{"v": 2})), now)
+		So(dropped, ShouldEqual, 1)
+		a.add(frame("2", 65*time.Second, point("dev1", map[string]any{"v": 5})), now)
+		So(a.collect(now), ShouldBeEmpty)
+
+		// 迟到但仍在 delay 内的数据计入原窗口
+		ok, _ := a.add(frame("3", 50*time.Second, point("dev1", map[string]any{"v": 3})), now)
+		So(ok, ShouldBeTrue)
+		a.add(frame("4", 70*time.Second, point("dev1", map[string]any{"v": 5})), now)
+		result := a.collect(now)
+		So(len(result), ShouldEqual, 1)
+		So(result[0].Points[0].Field, ShouldResemble, map[string]any{"v_max": 3.0, "v_count": int64(2)})
+	})
+
+	Convey("时间戳超前系统时间一个窗口以上的点包被丢弃, 不推进水位线", t, func() {
+		a, err := newAggregator(pkg.AggregateConfig{Window: time.Minute})
+		So(err, ShouldBeNil)
+		clock := base.Add(30 * time.Second)
+
+		ok, _ := a.add(frame("1", 0, point("dev1", map[string]any{"v": 1})), clock)
+		So(ok, ShouldBeTrue)
+		ok, _ = a.add(frame("2", time.Hour, point("dev1", map[string]any{"v": 100})), clock)
+		So(ok, ShouldBeFalse)
+		So(a.collect(clock), ShouldBeEmpty)
+
+		// 同一窗口的后续数据仍然计入, 窗口按正常的时间戳关闭
+		ok, _ = a.add(frame("3", 10*time.Second, point("dev1", map[string]any{"v": 3})), clock)
+		So(ok, ShouldBeTrue)
+		a.add(frame("4", 61*time.Second, point("dev1", map[string]any{"v": 4})), clock.Add(31*time.Second))
+		result := a.collect(clock.Add(31 * time.Second))
+		So(len(result), ShouldEqual, 1)
+		So(result[0].Points[0].Field["v_count"], ShouldEqual, int64(2))
+		So(result[0].Points[0].Field["v_max"], ShouldEqual, 3.0)
+	})
+
+	Convey("配置校验", t, func() {
+		_, err := newAggregator(pkg.AggregateConfig{})
+		So(err, ShouldNotBeNil)
+		_, err = newAggregator(pkg.AggregateConfig{Window: time.Minute, Functions: []string{"median"}})
+		So(err, ShouldNotBeNil)
+		_, err = newAggregator(pkg.AggregateConfig{Window: time.Minute, Delay: -time.Second})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestAggregateTemplate(t *testing.T) {
+	ctx := pkg.WithLogger(context.Background(), zap.NewNop())
+
+	Convey("聚合结果交给内部策略, 空闲时输出最后一个窗口", t, func() {
+		strategyCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		aggregate, err := newAggregateTemplate(strategyCtx, pkg.StrategyConfig{Type: "record", Aggregate: pkg.AggregateConfig{Enable: true, Window: 50 * time.Millisecond}})
+		So(err, ShouldBeNil)
+		inner := &recordTemplate{}
+		aggregate.inner = inner
+		So(aggregate.GetType(), ShouldEqual, "record")
+
+		source := make(chan *pkg.PointPackage)
+		go aggregate.Start(source)
+		source <- filePackage("000001")
+		source <- filePackage("000002")
+
+		So(waitFor(func() bool { return len(inner.packages()) == 1 }), ShouldBeTrue)
+		received := inner.packages()[0]
+		So(received.FrameId, ShouldEqual, "000002")
+		So(received.Points[0].Field["temp_count"], ShouldEqual, int64(2))
+		So(received.Points[0].Tag, ShouldResemble, map[string]any{"id": "dev1", "line": "a b"})
+	})
+	Convey("ctx 结束 (退出或热加载) 时输出未关闭的窗口后再结束内部策略", t, func() {
+		strategyCtx, cancel := context.WithCancel(ctx)
+		aggregate, err := newAggregateTemplate(strategyCtx, pkg.StrategyConfig{Type: "record", Aggregate: pkg.AggregateConfig{Enable: true, Window: time.Hour}})
+		So(err, ShouldBeNil)
+		inner := &recordTemplate{}
+		aggregate.inner = inner
+
+		source := make(chan *pkg.PointPackage)
+		stopped := make(chan struct{})
+		go func() {
+			aggregate.Start(source)
+			close(stopped)
+		}()
+		source <- filePackage("000001")
+		time.Sleep(20 * time.Millisecond)
+		So(inner.packages(), ShouldBeEmpty)
+
+		cancel()
+		<-stopped
+		So(waitFor(func() bool { return len(inner.packages()) == 1 }), ShouldBeTrue)
+		received := inner.packages()
+		So(received[0].FrameId, ShouldEqual, "000001")
+		So(received[0].Points[0].Field["temp_count"], ShouldEqual, int64(1))
+		So(aggregate.innerCtx.Err(), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,183 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"gateway/internal/pkg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+func filePackage(frameId string) *pkg.PointPackage {
+	return &pkg.PointPackage{
+		FrameId: frameId,
+		Ts:      time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC),
+		Points: []*pkg.Point{
+			{Tag: map[string]any{"id": "dev1", "line": "a b"}, Field: map[string]any{"temp": 21.5, "hum": 40}},
+			nil,
+		},
+	}
+}
+
+func TestConsoleStrategy(t *testing.T) {
+	ctx := pkg.WithLogger(context.Background(), zap.NewNop())
+
+	Convey("text 格式按名称排序输出标签与字段", t, func() {
+		strategy, err := NewConsoleStrategy(ctx, pkg.StrategyConfig{Type: "console"})
+		So(err, ShouldBeNil)
+		console := strategy.(*ConsoleStrategy)
+		var out bytes.Buffer
+		console.out = &out
+
+		So(console.Write(ctx, filePackage("00001A")), ShouldBeNil)
+		So(out.String(), ShouldEqual, "[00001A] 2025-01-02T15:04:05.000Z 2 points\n  id=dev1 line=a b | hum=40 temp=21.5\n")
+	})
+
+	Convey("json 格式每个点一行", t, func() {
+		strategy, err := NewConsoleStrategy(ctx, pkg.StrategyConfig{Type: "console", Para: map[string]interface{}{"format": "json"}})
+		So(err, ShouldBeNil)
+		console := strategy.(*ConsoleStrategy)
+		var out bytes.Buffer
+		console.out = &out
+
+		So(console.Write(ctx, filePackage("00001A")), ShouldBeNil)
+		var line map[string]any
+		So(json.Unmarshal(out.Bytes(), &line), ShouldBeNil)
+		So(line["frameId"], ShouldEqual, "00001A")
+		So(line["fields"], ShouldResemble, map[string]any{"temp": 21.5, "hum": float64(40)})
+	})
+
+	Convey("不支持的 format/output 报错", t, func() {
+		_, err := NewConsoleStrategy(ctx, pkg.StrategyConfig{Para: map[string]interface{}{"format": "xml"}})
+		So(err, ShouldNotBeNil)
+		_, err = NewConsoleStrategy(ctx, pkg.StrategyConfig{Para: map[string]interface{}{"output": "file"}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestFileStrategy(t *testing.T) {
+	ctx := pkg.WithLogger(context.Background(), zap.NewNop())
+
+	Convey("jsonl 格式每个点一行, 多次写入追加到同一文件", t, func() {
+		path := filepath.Join(t.TempDir(), "points.jsonl")
+		strategy, err := NewFileStrategy(ctx, pkg.StrategyConfig{Type: "file", Para: map[string]interface{}{"path": path}})
+		So(err, ShouldBeNil)
+		file := strategy.(*FileStrategy)
+		defer file.writer.Close()
+
+		So(file.Write(ctx, filePackage("000001")), ShouldBeNil)
+		So(file.Write(ctx, filePackage("000002")), ShouldBeNil)
+
+		data, err := os.ReadFile(path)
+		So(err, ShouldBeNil)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		So(len(lines), ShouldEqual, 2)
+		var line map[string]any
+		So(json.Unmarshal([]byte(lines[1]), &line), ShouldBeNil)
+		So(line["frameId"], ShouldEqual, "000002")
+		So(line["tags"], ShouldResemble, map[string]any{"id": "dev1", "line": "a b"})
+		So(line["ts"], ShouldEqual, float64(filePackage("").Ts.UnixNano()))
+	})
+
+	Convey("csv 格式每个文件只写一次表头, 切割后的新文件重写表头", t, func() {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "points.csv")
+		strategy, err := NewFileStrategy(ctx, pkg.StrategyConfig{Type: "file", Para: map[string]interface{}{
+			"path":   path,
+			"format": "csv",
+		}})
+		So(err, ShouldBeNil)
+		file := strategy.(*FileStrategy)
+		defer file.writer.Close()
+
+		So(file.Write(ctx, filePackage("000001")), ShouldBeNil)
+		So(file.Write(ctx, filePackage("000002")), ShouldBeNil)
+		records, err := readCsv(path)
+		So(err, ShouldBeNil)
+		So(records, ShouldResemble, [][]string{
+			csvHeader,
+			{"2025-01-02T15:04:05Z", "000001", "id=dev1;line=a b", "hum", "40"},
+			{"2025-01-02T15:04:05Z", "000001", "id=dev1;line=a b", "temp", "21.5"},
+			{"2025-01-02T15:04:05Z", "000002", "id=dev1;line=a b", "hum", "40"},
+			{"2025-01-02T15:04:05Z", "000002", "id=dev1;line=a b", "temp", "21.5"},
+		})
+
+		So(file.Rotate(), ShouldBeNil)
+		So(file.Write(ctx, filePackage("000003")), ShouldBeNil)
+		records, err = readCsv(path)
+		So(err, ShouldBeNil)
+		So(len(records), ShouldEqual, 3)
+		So(records[0], ShouldResemble, csvHeader)
+		So(records[1][1], ShouldEqual, "000003")
+
+		matches, _ := filepath.Glob(filepath.Join(dir, "points-*.csv"))
+		So(len(matches), ShouldEqual, 1)
+	})
+
+	Convey("追加到已有的 csv 文件时不重复写表头", t, func() {
+		path := filepath.Join(t.TempDir(), "points.csv")
+		So(os.WriteFile(path, []byte("ts,frameId,tags,field,value\n"), 0644), ShouldBeNil)
+		strategy, err := NewFileStrategy(ctx, pkg.StrategyConfig{Type: "file", Para: map[string]interface{}{"path": path, "format": "csv"}})
+		So(err, ShouldBeNil)
+		file := strategy.(*FileStrategy)
+		defer file.writer.Close()
+
+		So(file.Write(ctx, filePackage("000001")), ShouldBeNil)
+		records, err := readCsv(path)
+		So(err, ShouldBeNil)
+		So(len(records), ShouldEqual, 3)
+	})
+
+	Convey("rotateInterval 按时间切割文件", t, func() {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "points.jsonl")
+		strategyCtx, cancel := context.WithCancel(ctx)
+		strategy, err := NewFileStrategy(strategyCtx, pkg.StrategyConfig{Type: "file", Para: map[string]interface{}{
+			"path":           path,
+			"rotateInterval": "50ms",
+		}})
+		So(err, ShouldBeNil)
+
+		source := make(chan *pkg.PointPackage)
+		stopped := make(chan struct{})
+		go func() {
+			strategy.Start(source)
+			close(stopped)
+		}()
+		source <- filePackage("000001")
+		time.Sleep(120 * time.Millisecond)
+		source <- filePackage("000002")
+		cancel()
+		<-stopped
+
+		matches, _ := filepath.Glob(filepath.Join(dir, "points-*.jsonl"))
+		So(len(matches), ShouldBeGreaterThanOrEqualTo, 1)
+		data, err := os.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldContainSubstring, "000002")
+		So(string(data), ShouldNotContainSubstring, "000001")
+	})
+
+	Convey("缺少 path 或 format 不支持时报错", t, func() {
+		_, err := NewFileStrategy(ctx, pkg.StrategyConfig{Type: "file"})
+		So(err, ShouldNotBeNil)
+		_, err = NewFileStrategy(ctx, pkg.StrategyConfig{Type: "file", Para: map[string]interface{}{"path": "x", "format": "parquet"}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func readCsv(path string) ([][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return csv.NewReader(bytes.NewReader(data)).ReadAll()
+}
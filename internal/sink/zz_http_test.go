@@ -0,0 +1,221 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"gateway/internal/pkg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+// httpRecorder 记录下游收到的请求, status 依次作为每个请求的响应码, 用完后返回 200
+type httpRecorder struct {
+	mu       sync.Mutex
+	bodies   []string
+	headers  []http.Header
+	status   []int
+	requests atomic.Int32
+}
+
+func (r *httpRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.requests.Add(1)
+	r.mu.Lock()
+	status := http.StatusOK
+	if len(r.status) > 0 {
+		status, r.status = r.status[0], r.status[1:]
+	}
+	if status == http.StatusOK {
+		r.bodies = append(r.bodies, string(body))
+		r.headers = append(r.headers, req.Header.Clone())
+	}
+	r.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func (r *httpRecorder) received() ([]string, []http.Header) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.bodies...), append([]http.Header(nil), r.headers...)
+}
+
+func newHttpTestStrategy(ctx context.Context, para map[string]interface{}) *HttpStrategy {
+	strategy, err := NewHttpStrategy(ctx, pkg.StrategyConfig{Type: "http", Para: para})
+	So(err, ShouldBeNil)
+	return strategy.(*HttpStrategy)
+}
+
+func TestHttpStrategy(t *testing.T) {
+	ctx := pkg.WithLogger(context.Background(), zap.NewNop())
+
+	Convey("攒满 batchSize 个点包后发送一次 JSON 数组", t, func() {
+		recorder := &httpRecorder{}
+		server := httptest.NewServer(recorder)
+		defer server.Close()
+
+		strategyCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		strategy := newHttpTestStrategy(strategyCtx, map[string]interface{}{
+			"url":           server.URL,
+			"batchSize":     2,
+			"flushInterval": "1h",
+			"token":         "secret",
+			"headers":       map[string]interface{}{"X-Site": "s1"},
+		})
+		source := make(chan *pkg.PointPackage)
+		go strategy.Start(source)
+		source <- filePackage("000001")
+		source <- filePackage("000002")
+
+		So(waitFor(func() bool { return recorder.requests.Load() == 1 }), ShouldBeTrue)
+		bodies, headers := recorder.received()
+		var records []map[string]any
+		So(json.Unmarshal([]byte(bodies[0]), &records), ShouldBeNil)
+		So(len(records), ShouldEqual, 2)
+		So(records[0]["frameId"], ShouldEqual, "000001")
+		So(records[1]["fields"], ShouldResemble, map[string]any{"temp": 21.5, "hum": float64(40)})
+		So(records[1]["ts"], ShouldEqual, float64(filePackage("").Ts.UnixNano()))
+		So(headers[0].Get("Authorization"), ShouldEqual, "Bearer secret")
+		So(headers[0].Get("X-Site"), ShouldEqual, "s1")
+		So(headers[0].Get("Content-Type"), ShouldEqual, "application/json")
+	})
+
+	Convey("未攒满时按 flushInterval 发送", t, func() {
+		recorder := &httpRecorder{}
+		server := httptest.NewServer(recorder)
+		defer server.Close()
+
+		strategyCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		strategy := newHttpTestStrategy(strategyCtx, map[string]interface{}{
+			"url":           server.URL,
+			"flushInterval": "20ms",
+			"username":      "user",
+			"password":      "pass",
+		})
+		source := make(chan *pkg.PointPackage)
+		go strategy.Start(source)
+		source <- filePackage("000001")
+
+		So(waitFor(func() bool { return recorder.requests.Load() == 1 }), ShouldBeTrue)
+		_, headers := recorder.received()
+		So(headers[0].Get("Authorization"), ShouldEqual, "Basic dXNlcjpwYXNz")
+	})
+
+	Convey("5xx 按退避重试直至成功, 4xx 不重试", t, func() {
+		recorder := &httpRecorder{status: []int{http.StatusBadGateway, http.StatusServiceUnavailable}}
+		server := httptest.NewServer(recorder)
+		defer server.Close()
+
+		strategy := newHttpTestStrategy(ctx, map[string]interface{}{"url": server.URL, "retryInterval": "5ms"})
+		So(strategy.Write(ctx, filePackage("000001")), ShouldBeNil)
+		So(recorder.requests.Load(), ShouldEqual, 3)
+
+		recorder.status = []int{http.StatusBadRequest}
+		err := strategy.Write(ctx, filePackage("000002"))
+		So(err, ShouldWrap, ErrPermanent)
+		So(recorder.requests.Load(), ShouldEqual, 4)
+
+		recorder.status = []int{500, 500, 500, 500, 500}
+		So(strategy.Write(ctx, filePackage("000003")), ShouldNotBeNil)
+		So(recorder.requests.Load(), ShouldEqual, 8) // 首次请求 + 3 次重试
+	})
+
+	Convey("开启 WAL 时被 4xx 拒绝的记录被跳过, 不阻塞后面的数据", t, func() {
+		recorder := &httpRecorder{status: []int{http.StatusBadRequest}}
+		server := httptest.NewServer(recorder)
+		defer server.Close()
+
+		walCtx, cancel := context.WithCancel(ctx)
+		strategy := newHttpTestStrategy(walCtx, map[string]interface{}{"url": server.URL, "retryInterval": "5ms"})
+		config := pkg.StrategyConfig{Name: "http", Type: "http", WAL: pkg.WALConfig{Enable: true, Dir: t.TempDir(), RetryInterval: 10 * time.Millisecond}}
+		wal, err := newWALTemplate(walCtx, config, strategy)
+		So(err, ShouldBeNil)
+		source := make(chan *pkg.PointPackage)
+		stopped := make(chan struct{})
+		go func() {
+			wal.Start(source)
+			close(stopped)
+		}()
+		source <- walPackage("000001")
+		source <- walPackage("000002")
+
+		So(waitFor(func() bool { bodies, _ := recorder.received(); return len(bodies) == 1 }), ShouldBeTrue)
+		bodies, _ := recorder.received()
+		So(bodies[0], ShouldContainSubstring, `"frameId":"000002"`)
+		So(recorder.requests.Load(), ShouldEqual, 2)
+		So(waitFor(func() bool { return wal.queue.Len() == 0 }), ShouldBeTrue)
+		cancel()
+		<-stopped
+	})
+
+	Convey("超时视为可重试的错误", t, func() {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				time.Sleep(100 * time.Millisecond)
+			}
+		}))
+		defer server.Close()
+
+		strategy := newHttpTestStrategy(ctx, map[string]interface{}{"url": server.URL, "timeout": "20ms", "retryInterval": "5ms"})
+		So(strategy.Write(ctx, filePackage("000001")), ShouldBeNil)
+		So(calls.Load(), ShouldEqual, 2)
+	})
+
+	Convey("line 格式输出 InfluxDB 行协议", t, func() {
+		recorder := &httpRecorder{}
+		server := httptest.NewServer(recorder)
+		defer server.Close()
+
+		strategy := newHttpTestStrategy(ctx, map[string]interface{}{"url": server.URL, "format": "line", "measurement": "train"})
+		pointPackage := filePackage("000001")
+		pointPackage.Points = append(pointPackage.Points, &pkg.Point{
+			Tag:   map[string]any{"id": "dev2"},
+			Field: map[string]any{"name": `a "b"`, "ok": true, "count": uint16(3), "nil": nil},
+		}, &pkg.Point{Tag: map[string]any{"id": "dev3"}, Field: map[string]any{"nil": nil}})
+		So(strategy.Write(ctx, pointPackage), ShouldBeNil)
+
+		bodies, headers := recorder.received()
+		So(bodies[0], ShouldEqual, "train,id=dev1,line=a\\ b hum=40i,temp=21.5 1735830245000000000\n"+
+			"train,id=dev2 count=3u,name=\"a \\\"b\\\"\",ok=true 1735830245000000000\n")
+		So(headers[0].Get("Content-Type"), ShouldStartWith, "text/plain")
+	})
+
+	Convey("template 格式使用自定义模板", t, func() {
+		recorder := &httpRecorder{}
+		server := httptest.NewServer(recorder)
+		defer server.Close()
+
+		strategy := newHttpTestStrategy(ctx, map[string]interface{}{
+			"url":      server.URL,
+			"format":   "template",
+			"template": `{"items":[{{range $i, $p := .Points}}{{if $i}},{{end}}{"device":"{{index $p.Tags "id"}}","values":{{json $p.Fields}},"time":"{{$p.Ts.Format "2006-01-02"}}"}{{end}}]}`,
+			"headers":  map[string]interface{}{"Content-Type": "application/vnd.site+json"},
+		})
+		So(strategy.Write(ctx, filePackage("000001")), ShouldBeNil)
+
+		bodies, headers := recorder.received()
+		So(bodies[0], ShouldEqual, `{"items":[{"device":"dev1","values":{"hum":40,"temp":21.5},"time":"2025-01-02"}]}`)
+		So(headers[0].Get("Content-Type"), ShouldEqual, "application/vnd.site+json")
+	})
+
+	Convey("配置校验", t, func() {
+		_, err := NewHttpStrategy(ctx, pkg.StrategyConfig{Type: "http"})
+		So(err, ShouldNotBeNil)
+		_, err = NewHttpStrategy(ctx, pkg.StrategyConfig{Type: "http", Para: map[string]interface{}{"url": "http://x", "format": "xml"}})
+		So(err, ShouldNotBeNil)
+		_, err = NewHttpStrategy(ctx, pkg.StrategyConfig{Type: "http", Para: map[string]interface{}{"url": "http://x", "format": "template"}})
+		So(err, ShouldNotBeNil)
+		_, err = NewHttpStrategy(ctx, pkg.StrategyConfig{Type: "http", Para: map[string]interface{}{"url": "http://x", "format": "template", "template": "{{"}})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,130 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"gateway/internal/pkg"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+// flakyWriter 模拟一个可以掉线的下游, 掉线期间 Write 返回错误
+type flakyWriter struct {
+	down     atomic.Bool
+	mu       sync.Mutex
+	received []string
+}
+
+func (f *flakyWriter) GetType() string              { return "flaky" }
+func (f *flakyWriter) Start(chan *pkg.PointPackage) {}
+func (f *flakyWriter) frames() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.received...)
+}
+func (f *flakyWriter) Write(_ context.Context, pointPackage *pkg.PointPackage) error {
+	if f.down.Load() {
+		return errors.New("sink down")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.received = append(f.received, pointPackage.FrameId)
+	return nil
+}
+
+func walPackage(frameId string) *pkg.PointPackage {
+	return &pkg.PointPackage{
+		FrameId: frameId,
+		Ts:      time.Now(),
+		Points: []*pkg.Point{{
+			Tag:   map[string]any{"id": "dev1"},
+			Field: map[string]any{"v": 1, "ok": true, "name": "x", "missing": nil},
+		}},
+	}
+}
+
+func TestWALTemplate(t *testing.T) {
+	Convey("WAL 在下游掉线期间缓存数据, 恢复后按顺序重放", t, func() {
+		dir := t.TempDir()
+		config := pkg.StrategyConfig{
+			Name: "flaky",
+			Type: "flaky",
+			WAL:  pkg.WALConfig{Enable: true, Dir: dir, RetryInterval: 10 * time.Millisecond},
+		}
+		inner := &flakyWriter{}
+		inner.down.Store(true)
+
+		ctx, cancel := context.WithCancel(pkg.WithLogger(context.Background(), zap.NewNop()))
+		wal, err := newWALTemplate(ctx, config, inner)
+		So(err, ShouldBeNil)
+		So(wal.GetType(), ShouldEqual, "flaky")
+
+		source := make(chan *pkg.PointPackage)
+		stopped := make(chan struct{})
+		go func() {
+			wal.Start(source)
+			close(stopped)
+		}()
+		for _, frameId := range []string{"1", "2", "3"} {
+			source <- walPackage(frameId)
+		}
+		time.Sleep(50 * time.Millisecond)
+		So(inner.frames(), ShouldBeEmpty)
+
+		inner.down.Store(false)
+		So(waitFor(func() bool { return len(inner.frames()) == 3 }), ShouldBeTrue)
+		So(inner.frames(), ShouldResemble, []string{"1", "2", "3"})
+
+		Convey("重启后未确认的数据不会丢失", func() {
+			inner.down.Store(true)
+			source <- walPackage("4")
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+			<-stopped
+
+			restarted := &flakyWriter{}
+			ctx2, cancel2 := context.WithCancel(pkg.WithLogger(context.Background(), zap.NewNop()))
+			defer cancel2()
+			wal2, err := newWALTemplate(ctx2, config, restarted)
+			So(err, ShouldBeNil)
+			So(wal2.queue.Len(), ShouldEqual, 1)
+			go wal2.Start(make(chan *pkg.PointPackage))
+
+			So(waitFor(func() bool { return len(restarted.frames()) == 1 }), ShouldBeTrue)
+			So(restarted.frames(), ShouldResemble, []string{"4"})
+		})
+
+		Reset(func() {
+			cancel()
+			<-stopped
+		})
+	})
+
+	Convey("点包编码后字段类型保持不变", t, func() {
+		data, err := encodePointPackage(walPackage("1"))
+		So(err, ShouldBeNil)
+		decoded, err := decodePointPackage(data)
+		So(err, ShouldBeNil)
+		So(decoded.FrameId, ShouldEqual, "1")
+		So(decoded.Points[0].Field["v"], ShouldEqual, 1)
+		So(decoded.Points[0].Field["ok"], ShouldEqual, true)
+		So(decoded.Points[0].Field["missing"], ShouldBeNil)
+	})
+}
+
+// waitFor 轮询等待条件成立
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
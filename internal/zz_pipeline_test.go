@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"context"
+	"gateway/internal/connector"
+	"gateway/internal/pkg"
+	"gateway/internal/sink"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+// fakeConnector 启动后立即向下游发送一帧, 点的 Tag 中带有其所属链路的名称
+type fakeConnector struct {
+	ctx context.Context
+}
+
+// fakeConnectorSinks 按 source 记录最近启动的 fakeConnector 的下游通道, 便于测试中继续发送数据
+var fakeConnectorSinks sync.Map
+
+func (f *fakeConnector) Start(sink *pkg.Parser2DispatcherChan) error {
+	source := pkg.ConfigFromContext(f.ctx).Connector.Para["source"]
+	*sink <- fakePackage(source)
+	fakeConnectorSinks.Store(source, sink)
+	return nil
+}
+
+func fakePackage(source any) *pkg.PointPackage {
+	return &pkg.PointPackage{
+		FrameId: "000001",
+		Points: []*pkg.Point{{
+			Tag:   map[string]any{"source": source},
+			Field: map[string]any{"v": 1},
+		}},
+		Ts: time.Now(),
+	}
+}
+
+// fakeSink 将收到的数据转发到全局通道中
+type fakeSink struct {
+	ctx context.Context
+}
+
+var fakeSinkReceived = make(chan *pkg.PointPackage, 10)
+
+func (f *fakeSink) GetType() string { return "fake_sink" }
+
+func (f *fakeSink) Start(source chan *pkg.PointPackage) {
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case pointPackage := <-source:
+			fakeSinkReceived <- pointPackage
+		}
+	}
+}
+
+func init() {
+	connector.Register("fake_conn", func(ctx context.Context) (connector.Template, error) {
+		return &fakeConnector{ctx: ctx}, nil
+	})
+	sink.Register("fake_sink", func(ctx context.Context, _ pkg.StrategyConfig) (sink.Template, error) {
+		return &fakeSink{ctx: ctx}, nil
+	})
+}
+
+func TestMultiPipeline(t *testing.T) {
+	Convey("多条链路共享同一个策略", t, func() {
+		config := &pkg.Config{
+			Pipelines: []pkg.PipelineConfig{
+				{Name: "tcp", Connector: pkg.ConnectorConfig{Type: "fake_conn", Para: map[string]interface{}{"source": "tcp"}}},
+				{Name: "udp", Connector: pkg.ConnectorConfig{Type: "fake_conn", Para: map[string]interface{}{"source": "udp"}}, Strategy: []string{"fake_sink"}},
+			},
+			Strategy: []pkg.StrategyConfig{
+				{Type: "fake_sink", Enable: true, Filter: []string{"true"}},
+			},
+		}
+		ctx, cancel := context.WithCancel(pkg.WithLogger(pkg.WithConfig(context.Background(), config), zap.NewNop()))
+		defer cancel()
+
+		pipeline, err := NewPipeline(ctx)
+		So(err, ShouldBeNil)
+		So(len(pipeline.chains), ShouldEqual, 2)
+		So(pipeline.Start(ctx), ShouldBeNil)
+
+		sources := make(map[any]bool)
+		for i := 0; i < 2; i++ {
+			select {
+			case pointPackage := <-fakeSinkReceived:
+				So(len(pointPackage.Points), ShouldEqual, 1)
+				sources[pointPackage.Points[0].Tag["source"]] = true
+			case <-time.After(time.Second):
+				t.Fatal("等待策略接收数据超时")
+			}
+		}
+		So(sources, ShouldResemble, map[any]bool{"tcp": true, "udp": true})
+	})
+
+	Convey("链路名称重复时创建失败", t, func() {
+		config := &pkg.Config{
+			Pipelines: []pkg.PipelineConfig{
+				{Name: "dup", Connector: pkg.ConnectorConfig{Type: "fake_conn"}},
+				{Name: "dup", Connector: pkg.ConnectorConfig{Type: "fake_conn"}},
+			},
+		}
+		_, err := NewPipeline(pkg.WithConfig(context.Background(), config))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "链路名称重复")
+	})
+
+	Convey("链路名称包含 '/' 时创建失败, 否则告警 ID 无法用于确认接口的路径", t, func() {
+		config := &pkg.Config{
+			Pipelines: []pkg.PipelineConfig{
+				{Name: "line/1", Connector: pkg.ConnectorConfig{Type: "fake_conn"}},
+			},
+		}
+		_, err := NewPipeline(pkg.WithLogger(pkg.WithConfig(context.Background(), config), zap.NewNop()))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "line/1")
+	})
+}
+
+func TestPipelineReload(t *testing.T) {
+	Convey("热加载策略", t, func() {
+		newConfig := func(filter string) *pkg.Config {
+			return &pkg.Config{
+				Pipelines: []pkg.PipelineConfig{
+					{Name: "reload", Connector: pkg.ConnectorConfig{Type: "fake_conn", Para: map[string]interface{}{"source": "reload"}}},
+				},
+				Strategy: []pkg.StrategyConfig{
+					{Name: "reload_sink", Type: "fake_sink", Enable: true, Filter: []string{filter}},
+				},
+			}
+		}
+		ctx, cancel := context.WithCancel(pkg.WithLogger(pkg.WithConfig(context.Background(), newConfig("false")), zap.NewNop()))
+		defer cancel()
+
+		pipeline, err := NewPipeline(ctx)
+		So(err, ShouldBeNil)
+		So(pipeline.Start(ctx), ShouldBeNil)
+		value, ok := fakeConnectorSinks.Load("reload")
+		So(ok, ShouldBeTrue)
+		sink := value.(*pkg.Parser2DispatcherChan)
+		expectNothing := func() {
+			select {
+			case <-fakeSinkReceived:
+				t.Fatal("不应收到数据")
+			case <-time.After(200 * time.Millisecond):
+			}
+		}
+		expectNothing()
+
+		Convey("校验失败时保留旧策略", func() {
+			err := pipeline.Reload(newConfig("this is not a valid expression !!!"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "策略校验失败")
+
+			*sink <- fakePackage("reload")
+			expectNothing()
+		})
+
+		Convey("增删链路或修改连接器时拒绝热加载", func() {
+			added := newConfig("true")
+			added.Pipelines = append(added.Pipelines, pkg.PipelineConfig{Name: "extra", Connector: pkg.ConnectorConfig{Type: "fake_conn"}})
+			err := pipeline.Reload(added)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "需要重启")
+			So(err.Error(), ShouldContainSubstring, "extra")
+
+			modified := newConfig("true")
+			modified.Pipelines[0].Connector.Para["source"] = "other"
+			err = pipeline.Reload(modified)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "reload(修改)")
+
+			*sink <- fakePackage("reload")
+			expectNothing()
+		})
+
+		Convey("校验通过后新策略生效, 连接器无需重启", func() {
+			So(pipeline.Reload(newConfig("true")), ShouldBeNil)
+
+			*sink <- fakePackage("reload")
+			select {
+			case pointPackage := <-fakeSinkReceived:
+				So(pointPackage.Points[0].Tag["source"], ShouldEqual, "reload")
+			case <-time.After(time.Second):
+				t.Fatal("等待新策略接收数据超时")
+			}
+		})
+	})
+}
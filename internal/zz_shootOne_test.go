@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"context"
+	"gateway/internal/pkg"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+)
+
+func shootOneContext() context.Context {
+	config := &pkg.Config{
+		Parser: pkg.ParserConfig{Para: map[string]interface{}{"protoFile": "shoot_proto"}},
+		Strategy: []pkg.StrategyConfig{
+			{Type: "all", Enable: true, Filter: []string{"true"}},
+			{Type: "only_a", Enable: true, Filter: []string{"Tag.id == 'a'"}},
+			{Type: "disabled", Enable: false, Filter: []string{"true"}},
+		},
+		Others: map[string]interface{}{
+			"shoot_proto": []interface{}{
+				map[string]interface{}{
+					"desc": "two devices",
+					"size": 2,
+					"points": []interface{}{
+						map[string]interface{}{
+							"tag":   map[string]interface{}{"id": "'a'"},
+							"field": map[string]interface{}{"v": "Bytes[0]"},
+						},
+						map[string]interface{}{
+							"tag":   map[string]interface{}{"id": "'b'"},
+							"field": map[string]interface{}{"v": "Bytes[1]"},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := pkg.WithConfig(context.Background(), config)
+	return pkg.WithLogger(ctx, zap.NewNop())
+}
+
+func TestShootOne(t *testing.T) {
+	Convey("ShootOne 离线解析单帧", t, func() {
+		ctx := shootOneContext()
+
+		Convey("合法报文应返回解析和分发结果", func() {
+			result, err := ShootOne(ctx, "", "0x01 02")
+			So(err, ShouldBeNil)
+			So(result.Frame, ShouldEqual, "0102")
+			So(result.Consumed, ShouldEqual, 2)
+			So(len(result.Points), ShouldEqual, 2)
+
+			So(len(result.Strategies), ShouldEqual, 2)
+			So(result.Strategies[0].Strategy, ShouldEqual, "all")
+			So(len(result.Strategies[0].Points), ShouldEqual, 2)
+			So(result.Strategies[1].Strategy, ShouldEqual, "only_a")
+			So(len(result.Strategies[1].Points), ShouldEqual, 1)
+			So(result.String(), ShouldContainSubstring, "only_a")
+		})
+
+		Convey("计算点应在分发前执行", func() {
+			config := pkg.ConfigFromContext(ctx)
+			config.Calculations = pkg.CalculationsConfig{Rules: []pkg.CalculationRule{
+				{Name: "double", When: "Tag.id == 'a'", Field: map[string]string{"v2": "Field.v * 2"}},
+				{Name: "broken", Field: map[string]string{"bad": "Field.missing > 1"}},
+			}}
+			config.Strategy = append(config.Strategy, pkg.StrategyConfig{Type: "doubled", Enable: true, Filter: []string{"hasField('v2')"}})
+
+			result, err := ShootOne(ctx, "", "0102")
+			So(err, ShouldBeNil)
+			So(result.Pipeline, ShouldEqual, pkg.DefaultPipelineName)
+			So(result.Points[0].Field["v2"], ShouldEqual, 2)
+			So(result.Errors, ShouldNotBeEmpty)
+			So(result.String(), ShouldContainSubstring, "WARN")
+			So(result.Strategies[1].Strategy, ShouldEqual, "doubled")
+			So(len(result.Strategies[1].Points), ShouldEqual, 1)
+		})
+
+		Convey("指定链路时应使用该链路的解析器和策略", func() {
+			config := pkg.ConfigFromContext(ctx)
+			config.Pipelines = []pkg.PipelineConfig{
+				{Name: "line-1", Parser: config.Parser, Strategy: []string{"only_a"}},
+			}
+
+			result, err := ShootOne(ctx, "line-1", "0102")
+			So(err, ShouldBeNil)
+			So(result.Pipeline, ShouldEqual, "line-1")
+			So(len(result.Strategies), ShouldEqual, 1)
+			So(result.Strategies[0].Strategy, ShouldEqual, "only_a")
+
+			_, err = ShootOne(ctx, "", "0102")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "line-1")
+		})
+
+		Convey("非法16进制报文应返回错误", func() {
+			_, err := ShootOne(ctx, "", "zz")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("报文长度不足应返回错误", func() {
+			_, err := ShootOne(ctx, "", "01")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "解析报文失败")
+		})
+	})
+}
@@ -24,7 +24,7 @@ func RegisterMemorySink() {
 }
 
 // NewMemorySink 创建一个新的MemorySink实例
-func NewMemorySink(ctx context.Context) (sink.Template, error) {
+func NewMemorySink(ctx context.Context, _ pkg.StrategyConfig) (sink.Template, error) {
 	logger := pkg.LoggerFromContext(ctx)
 	childCtx, cancel := context.WithCancel(ctx)
 